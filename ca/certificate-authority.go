@@ -7,25 +7,30 @@ package ca
 
 import (
 	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"strings"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/lint"
 	blog "github.com/letsencrypt/boulder/log"
 
 	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/crypto/pkcs11key"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/helpers"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer/local"
 )
 
 // This map is used to detect algorithms in crypto/x509 that
@@ -44,22 +49,52 @@ var badSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
 	x509.ECDSAWithSHA1:             true,
 }
 
+// serialLength is the length of the serial numbers we generate: a one byte
+// prefix followed by random bytes. At 16 bytes this matches the 32 hex
+// character serial strings produced by core.SerialToString.
+const serialLength = 16
+
+var keyTypes = map[string]x509.PublicKeyAlgorithm{
+	"RSA":   x509.RSA,
+	"ECDSA": x509.ECDSA,
+}
+
+// certProfile holds the issuance parameters of a named certificate profile.
+type certProfile struct {
+	cfsslProfile    string
+	validityPeriod  time.Duration
+	mustStaple      bool
+	allowMustStaple bool
+	allowedKeyTypes map[x509.PublicKeyAlgorithm]bool
+	lintConfig      lint.Config
+}
+
 // CertificateAuthorityImpl represents a CA that signs certificates, CRLs, and
 // OCSP responses.
 type CertificateAuthorityImpl struct {
 	profile        string
-	Signer         signer.Signer
+	profiles       map[string]*certProfile
+	Issuer         *Issuer
 	OCSPSigner     ocsp.Signer
 	SA             core.StorageAuthority
 	PA             core.PolicyAuthority
-	DB             core.CertificateAuthorityDatabase
 	Clk            clock.Clock // TODO(jmhodges): should be private, like log
 	log            *blog.AuditLogger
-	Prefix         int // Prepended to the serial number
+	Prefix         int // Prepended to the random part of the serial number
 	ValidityPeriod time.Duration
 	NotAfter       time.Time
 	MaxNames       int
 	MaxKeySize     int
+	KeyBlocklist   *core.KeyBlocklist
+	// lintIssuer signs a throwaway copy of each certificate with a key that
+	// is not trusted by anyone, so that it can be checked against the lint
+	// registry before the real certificate is signed. If nil, no pre-issuance
+	// linting is done.
+	lintIssuer *Issuer
+	LintConfig lint.Config
+	// AllowMustStapleRequests permits CSRs to request the TLS Feature
+	// extension when issuing under the default profile.
+	AllowMustStapleRequests bool
 }
 
 // NewCertificateAuthorityImpl creates a CA that talks to a remote CFSSL
@@ -68,7 +103,7 @@ type CertificateAuthorityImpl struct {
 // using CFSSL's authenticated signature scheme.  A CA created in this way
 // issues for a single profile on the remote signer, which is indicated
 // by name in this constructor.
-func NewCertificateAuthorityImpl(cadb core.CertificateAuthorityDatabase, config cmd.CAConfig, clk clock.Clock, issuerCert string) (*CertificateAuthorityImpl, error) {
+func NewCertificateAuthorityImpl(config cmd.CAConfig, clk clock.Clock, issuerCert string) (*CertificateAuthorityImpl, error) {
 	var ca *CertificateAuthorityImpl
 	var err error
 	logger := blog.GetAuditLogger()
@@ -101,7 +136,12 @@ func NewCertificateAuthorityImpl(cadb core.CertificateAuthorityDatabase, config
 		return nil, err
 	}
 
-	signer, err := local.NewSigner(priv, issuer, x509.SHA256WithRSA, cfsslConfigObj.Signing)
+	certIssuer, err := NewIssuer(priv, issuer, x509.SHA256WithRSA, cfsslConfigObj.Signing)
+	if err != nil {
+		return nil, err
+	}
+
+	lintIssuer, err := newLintIssuer(issuer, cfsslConfigObj.Signing)
 	if err != nil {
 		return nil, err
 	}
@@ -122,10 +162,10 @@ func NewCertificateAuthorityImpl(cadb core.CertificateAuthorityDatabase, config
 	}
 
 	ca = &CertificateAuthorityImpl{
-		Signer:     signer,
+		Issuer:     certIssuer,
+		lintIssuer: lintIssuer,
 		OCSPSigner: ocspSigner,
 		profile:    config.Profile,
-		DB:         cadb,
 		Prefix:     config.SerialPrefix,
 		Clk:        clk,
 		log:        logger,
@@ -142,9 +182,120 @@ func NewCertificateAuthorityImpl(cadb core.CertificateAuthorityDatabase, config
 
 	ca.MaxNames = config.MaxNames
 
+	ca.LintConfig = lint.Config{
+		MaxValidity: ca.ValidityPeriod,
+		PolicyOIDs:  profilePolicyOIDs(cfsslConfigObj.Signing, config.Profile),
+	}
+
+	ca.profiles, err = loadCertProfiles(config.Profiles, cfsslConfigObj.Signing)
+	if err != nil {
+		return nil, err
+	}
+
+	ca.AllowMustStapleRequests = config.AllowMustStapleRequests
+
 	return ca, nil
 }
 
+// loadCertProfiles builds the named certificate profiles from their
+// configuration and the CFSSL signing profiles they refer to.
+func loadCertProfiles(configs map[string]cmd.CertProfileConfig, policy *cfsslConfig.Signing) (map[string]*certProfile, error) {
+	profiles := make(map[string]*certProfile)
+	for name, pc := range configs {
+		if name == "" {
+			return nil, errors.New("Certificate profiles must have a name.")
+		}
+		var cfsslProfile *cfsslConfig.SigningProfile
+		if policy != nil {
+			cfsslProfile = policy.Profiles[pc.CFSSLProfile]
+		}
+		if cfsslProfile == nil {
+			return nil, fmt.Errorf("Certificate profile %s uses unknown CFSSL profile %q.", name, pc.CFSSLProfile)
+		}
+
+		profile := &certProfile{
+			cfsslProfile:    pc.CFSSLProfile,
+			validityPeriod:  cfsslProfile.Expiry,
+			mustStaple:      pc.MustStaple,
+			allowMustStaple: pc.AllowMustStapleRequests,
+			lintConfig: lint.Config{
+				MaxValidity: cfsslProfile.Expiry,
+				PolicyOIDs:  profilePolicyOIDs(policy, pc.CFSSLProfile),
+			},
+		}
+		if len(pc.AllowedKeyTypes) > 0 {
+			profile.allowedKeyTypes = make(map[x509.PublicKeyAlgorithm]bool)
+			for _, keyType := range pc.AllowedKeyTypes {
+				alg, ok := keyTypes[keyType]
+				if !ok {
+					return nil, fmt.Errorf("Certificate profile %s allows unknown key type %q.", name, keyType)
+				}
+				profile.allowedKeyTypes[alg] = true
+			}
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// certProfile returns the certificate profile with the given name. The empty
+// name refers to the default profile.
+func (ca *CertificateAuthorityImpl) certProfile(name string) (*certProfile, error) {
+	if name == "" {
+		return &certProfile{
+			cfsslProfile:    ca.profile,
+			validityPeriod:  ca.ValidityPeriod,
+			allowMustStaple: ca.AllowMustStapleRequests,
+			lintConfig:      ca.LintConfig,
+		}, nil
+	}
+	profile, ok := ca.profiles[name]
+	if !ok {
+		return nil, core.MalformedRequestError(fmt.Sprintf("Unknown certificate profile %q", name))
+	}
+	return profile, nil
+}
+
+// newLintIssuer creates an issuer with the same subject and signing policy as
+// the issuer, but with a freshly generated key that is never used for
+// anything except signing certificates to be linted.
+func newLintIssuer(issuer *x509.Certificate, policy *cfsslConfig.Signing) (*Issuer, error) {
+	lintKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	template := *issuer
+	template.PublicKey = &lintKey.PublicKey
+	lintIssuerDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &lintKey.PublicKey, lintKey)
+	if err != nil {
+		return nil, err
+	}
+	lintIssuer, err := x509.ParseCertificate(lintIssuerDER)
+	if err != nil {
+		return nil, err
+	}
+	return NewIssuer(lintKey, lintIssuer, x509.SHA256WithRSA, policy)
+}
+
+// profilePolicyOIDs returns the certificate policies asserted by the named
+// signing profile, or by the default profile if there is no such profile.
+func profilePolicyOIDs(policy *cfsslConfig.Signing, name string) (oids []asn1.ObjectIdentifier) {
+	if policy == nil {
+		return
+	}
+	profile := policy.Profiles[name]
+	if profile == nil {
+		profile = policy.Default
+	}
+	if profile == nil {
+		return
+	}
+	for _, p := range profile.Policies {
+		oids = append(oids, asn1.ObjectIdentifier(p.ID))
+	}
+	return
+}
+
 func loadKey(keyConfig cmd.KeyConfig) (priv crypto.Signer, err error) {
 	if keyConfig.File != "" {
 		var keyBytes []byte
@@ -198,7 +349,7 @@ func (ca *CertificateAuthorityImpl) GenerateOCSP(xferObj core.OCSPSigningRequest
 
 // RevokeCertificate revokes the trust of the Cert referred to by the provided Serial.
 func (ca *CertificateAuthorityImpl) RevokeCertificate(serial string, reasonCode core.RevocationCode) (err error) {
-	coreCert, err := ca.SA.GetCertificate(serial)
+	coreCert, err := core.ReadYourWrites(ca.SA).GetCertificate(serial)
 	if err != nil {
 		// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
 		ca.log.AuditErr(err)
@@ -227,11 +378,61 @@ func (ca *CertificateAuthorityImpl) RevokeCertificate(serial string, reasonCode
 	return err
 }
 
+// newSerial returns a serial number made up of the CA's prefix followed by
+// random bytes from the CSPRNG. Serials are not checked for uniqueness here;
+// the SA refuses to store a second certificate with the same serial.
+func (ca *CertificateAuthorityImpl) newSerial() (*big.Int, error) {
+	serialBytes := make([]byte, serialLength)
+	serialBytes[0] = byte(ca.Prefix)
+	if _, err := rand.Read(serialBytes[1:]); err != nil {
+		return nil, fmt.Errorf("Failed to generate serial: %s", err)
+	}
+	return new(big.Int).SetBytes(serialBytes), nil
+}
+
+// lintCertificate signs the request with the lint issuer and checks the
+// resulting certificate against the lint registry, returning an error if any
+// Error level lint fails. Warnings are logged.
+func (ca *CertificateAuthorityImpl) lintCertificate(req issuanceRequest, config lint.Config) error {
+	if ca.lintIssuer == nil {
+		return nil
+	}
+	lintDER, err := ca.lintIssuer.sign(req)
+	if err != nil {
+		return err
+	}
+	lintCert, err := x509.ParseCertificate(lintDER)
+	if err != nil {
+		return err
+	}
+
+	findings := lint.DefaultRegistry.Run(lintCert, config)
+	for _, f := range findings {
+		if f.Level != lint.Error {
+			ca.log.Warning(fmt.Sprintf("Pre-issuance lint warning: %s", f))
+		}
+	}
+	if errs := lint.Errors(findings); len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, f := range errs {
+			messages[i] = f.String()
+		}
+		return core.CertificateIssuanceError(fmt.Sprintf("Certificate failed pre-issuance lint: %s", strings.Join(messages, "; ")))
+	}
+	return nil
+}
+
 // IssueCertificate attempts to convert a CSR into a signed Certificate, while
-// enforcing all policies.
-func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest, regID int64, earliestExpiry time.Time) (core.Certificate, error) {
+// enforcing all policies. The certificate is issued under the named profile,
+// or the default profile if profileName is empty.
+func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest, regID int64, earliestExpiry time.Time, profileName string) (core.Certificate, error) {
 	emptyCert := core.Certificate{}
-	var err error
+	profile, err := ca.certProfile(profileName)
+	if err != nil {
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(err)
+		return emptyCert, err
+	}
 	key, ok := csr.PublicKey.(crypto.PublicKey)
 	if !ok {
 		err = fmt.Errorf("Invalid public key in CSR.")
@@ -245,6 +446,30 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		ca.log.AuditErr(err)
 		return emptyCert, err
 	}
+	if err = core.CheckKeyBlocked(key, ca.KeyBlocklist, ca.SA); err != nil {
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(err)
+		return emptyCert, err
+	}
+	if profile.allowedKeyTypes != nil && !profile.allowedKeyTypes[csr.PublicKeyAlgorithm] {
+		err = core.MalformedRequestError(fmt.Sprintf("Key type not allowed for certificate profile %s", profileName))
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(err)
+		return emptyCert, err
+	}
+	mustStaple, err := core.HasMustStaple(csr.Extensions)
+	if err != nil {
+		err = core.MalformedRequestError(fmt.Sprintf("Invalid TLS Feature extension in CSR: %s", err))
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(err)
+		return emptyCert, err
+	}
+	if mustStaple && !profile.allowMustStaple && !profile.mustStaple {
+		err = core.MalformedRequestError("Certificate profile does not permit requesting Must-Staple")
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(err)
+		return emptyCert, err
+	}
 	if badSignatureAlgorithms[csr.SignatureAlgorithm] {
 		err = fmt.Errorf("Invalid signature algorithm in CSR")
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
@@ -252,50 +477,41 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		return emptyCert, err
 	}
 
-	// Pull hostnames from CSR
+	// Pull hostnames and IP addresses from CSR
 	// Authorization is checked by the RA
 	commonName := ""
-	hostNames := make([]string, len(csr.DNSNames))
-	copy(hostNames, csr.DNSNames)
 	if len(csr.Subject.CommonName) > 0 {
 		commonName = csr.Subject.CommonName
-		hostNames = append(hostNames, csr.Subject.CommonName)
-	} else if len(hostNames) > 0 {
-		commonName = hostNames[0]
+	} else if len(csr.DNSNames) > 0 {
+		commonName = csr.DNSNames[0]
+	} else if len(csr.IPAddresses) > 0 {
+		commonName = csr.IPAddresses[0].String()
 	} else {
-		err = fmt.Errorf("Cannot issue a certificate without a hostname.")
+		err = fmt.Errorf("Cannot issue a certificate without a hostname or IP address.")
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 		ca.log.AuditErr(err)
 		return emptyCert, err
 	}
 
 	// Collapse any duplicate names.  Note that this operation may re-order the names
-	hostNames = core.UniqueNames(hostNames)
-	if ca.MaxNames > 0 && len(hostNames) > ca.MaxNames {
-		err = fmt.Errorf("Certificate request has %d > %d names", len(hostNames), ca.MaxNames)
+	hostNames, ipAddresses := core.SubjectNames(commonName, csr.DNSNames, csr.IPAddresses)
+	if numNames := len(hostNames) + len(ipAddresses); ca.MaxNames > 0 && numNames > ca.MaxNames {
+		err = fmt.Errorf("Certificate request has %d > %d names", numNames, ca.MaxNames)
 		ca.log.WarningErr(err)
 		return emptyCert, err
 	}
 
-	// Verify that names are allowed by policy
-	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: commonName}
-	if err = ca.PA.WillingToIssue(identifier); err != nil {
-		err = fmt.Errorf("Policy forbids issuing for name %s", commonName)
-		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ca.log.AuditErr(err)
-		return emptyCert, err
-	}
-	for _, name := range hostNames {
-		identifier = core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
-		if err = ca.PA.WillingToIssue(identifier); err != nil {
-			err = fmt.Errorf("Policy forbids issuing for name %s", name)
+	// Verify that names are allowed by policy. The CommonName is one of them.
+	for _, identifier := range core.NameIdentifiers(hostNames, ipAddresses) {
+		if err = ca.PA.WillingToIssue(identifier, regID); err != nil {
+			err = fmt.Errorf("Policy forbids issuing for name %s", identifier.Value)
 			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 			ca.log.AuditErr(err)
 			return emptyCert, err
 		}
 	}
 
-	notAfter := ca.Clk.Now().Add(ca.ValidityPeriod)
+	notAfter := ca.Clk.Now().Add(profile.validityPeriod)
 
 	if ca.NotAfter.Before(notAfter) {
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
@@ -311,66 +527,41 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		ca.log.Notice(message)
 	}
 
-	// Convert the CSR to PEM
-	csrPEM := string(pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE REQUEST",
-		Bytes: csr.Raw,
-	}))
-
-	// Get the next serial number
-	tx, err := ca.DB.Begin()
+	serial, err := ca.newSerial()
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 		ca.log.AuditErr(err)
 		return emptyCert, err
 	}
+	serialHex := core.SerialToString(serial)
 
-	serialDec, err := ca.DB.IncrementAndGetSerial(tx)
-	if err != nil {
-		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("Serial increment failed, rolling back: err=[%v]", err))
-		tx.Rollback()
-		return emptyCert, err
-	}
-	serialHex := fmt.Sprintf("%02X%014X", ca.Prefix, serialDec)
-
-	// Send the cert off for signing
-	req := signer.SignRequest{
-		Request: csrPEM,
-		Profile: ca.profile,
-		Hosts:   hostNames,
-		Subject: &signer.Subject{
-			CN: commonName,
-		},
-		SerialSeq: serialHex,
+	req := issuanceRequest{
+		csr:         &csr,
+		profile:     profile.cfsslProfile,
+		commonName:  commonName,
+		dnsNames:    hostNames,
+		ipAddresses: ipAddresses,
+		serial:      serial,
 	}
-
-	certPEM, err := ca.Signer.Sign(req)
-	if err != nil {
-		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("Signer failed, rolling back: serial=[%s] err=[%v]", serialHex, err))
-		tx.Rollback()
-		return emptyCert, err
+	if profile.mustStaple || mustStaple {
+		req.extensions = []pkix.Extension{
+			pkix.Extension{Id: core.OIDTLSFeature, Value: core.MustStapleExtensionValue},
+		}
 	}
 
-	if len(certPEM) == 0 {
-		err = fmt.Errorf("No certificate returned by server")
-		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("PEM empty from Signer, rolling back: serial=[%s] err=[%v]", serialHex, err))
-		tx.Rollback()
+	if err = ca.lintCertificate(req, profile.lintConfig); err != nil {
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.Audit(fmt.Sprintf("Pre-issuance lint failed: serial=[%s] err=[%v]", serialHex, err))
 		return emptyCert, err
 	}
 
-	block, _ := pem.Decode(certPEM)
-	if block == nil || block.Type != "CERTIFICATE" {
-		err = fmt.Errorf("Invalid certificate value returned")
-
+	certDER, err := ca.Issuer.sign(req)
+	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("PEM decode error, aborting and rolling back issuance: pem=[%s] err=[%v]", certPEM, err))
-		tx.Rollback()
+		ca.log.Audit(fmt.Sprintf("Signer failed: serial=[%s] err=[%v]", serialHex, err))
 		return emptyCert, err
 	}
-	certDER := block.Bytes
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
 
 	cert := core.Certificate{
 		DER: certDER,
@@ -379,8 +570,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	// This is one last check for uncaught errors
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("Uncaught error, aborting and rolling back issuance: pem=[%s] err=[%v]", certPEM, err))
-		tx.Rollback()
+		ca.log.Audit(fmt.Sprintf("Uncaught error, aborting issuance: pem=[%s] err=[%v]", certPEM, err))
 		return emptyCert, err
 	}
 
@@ -389,13 +579,6 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 		ca.log.Audit(fmt.Sprintf("Failed RPC to store at SA, orphaning certificate: pem=[%s] err=[%v]", certPEM, err))
-		tx.Rollback()
-		return emptyCert, err
-	}
-
-	if err = tx.Commit(); err != nil {
-		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("Failed to commit, orphaning certificate: pem=[%s] err=[%v]", certPEM, err))
 		return emptyCert, err
 	}
 
@@ -409,8 +592,6 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		return cert, nil
 	}
 
-	serial := core.SerialToString(certObj.SerialNumber)
-
 	signRequest := ocsp.SignRequest{
 		Certificate: certObj,
 		Status:      string(core.OCSPStatusGood),
@@ -422,7 +603,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		return cert, nil
 	}
 
-	err = ca.SA.UpdateOCSP(serial, ocspResponse)
+	err = ca.SA.UpdateOCSP(core.SerialToString(certObj.SerialNumber), ocspResponse)
 	if err != nil {
 		ca.log.Warning(fmt.Sprintf("Post-Issuance OCSP failed storing: %s", err))
 		return cert, nil
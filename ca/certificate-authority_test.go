@@ -7,7 +7,10 @@ package ca
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"fmt"
 	"io/ioutil"
@@ -95,7 +98,6 @@ const caCertFile = "../test/test-ca.pem"
 
 const (
 	paDBConnStr = "mysql+tcp://boulder@localhost:3306/boulder_policy_test"
-	caDBConnStr = "mysql+tcp://boulder@localhost:3306/boulder_ca_test"
 	saDBConnStr = "mysql+tcp://boulder@localhost:3306/boulder_sa_test"
 )
 
@@ -108,7 +110,6 @@ func mustRead(path string) []byte {
 }
 
 type testCtx struct {
-	caDB     core.CertificateAuthorityDatabase
 	sa       core.StorageAuthority
 	caConfig cmd.CAConfig
 	reg      core.Registration
@@ -130,7 +131,6 @@ func setup(t *testing.T) *testCtx {
 		t.Fatalf("Failed to create SA: %s", err)
 	}
 	saDBCleanUp := test.ResetTestDatabase(t, dbMap.Db)
-	cadb, caDBCleanUp := caDBImpl(t)
 
 	paDbMap, err := sa.NewDbMap(paDBConnStr)
 	test.AssertNotError(t, err, "Could not construct dbMap")
@@ -140,7 +140,6 @@ func setup(t *testing.T) *testCtx {
 
 	cleanUp := func() {
 		saDBCleanUp()
-		caDBCleanUp()
 		paDBCleanUp()
 	}
 
@@ -192,7 +191,7 @@ func setup(t *testing.T) *testCtx {
 			},
 		},
 	}
-	return &testCtx{cadb, ssa, caConfig, reg, pa, fc, cleanUp}
+	return &testCtx{ssa, caConfig, reg, pa, fc, cleanUp}
 }
 
 func TestFailNoSerial(t *testing.T) {
@@ -200,14 +199,14 @@ func TestFailNoSerial(t *testing.T) {
 	defer ctx.cleanUp()
 
 	ctx.caConfig.SerialPrefix = 0
-	_, err := NewCertificateAuthorityImpl(ctx.caDB, ctx.caConfig, ctx.fc, caCertFile)
+	_, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
 	test.AssertError(t, err, "CA should have failed with no SerialPrefix")
 }
 
 func TestRevoke(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
-	ca, err := NewCertificateAuthorityImpl(ctx.caDB, ctx.caConfig, ctx.fc, caCertFile)
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
 	test.AssertNotError(t, err, "Failed to create CA")
 
 	ca.PA = ctx.pa
@@ -215,7 +214,7 @@ func TestRevoke(t *testing.T) {
 	ca.MaxKeySize = 4096
 
 	csr, _ := x509.ParseCertificateRequest(CNandSANCSR)
-	certObj, err := ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture)
+	certObj, err := ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
 	test.AssertNotError(t, err, "Failed to sign certificate")
 
 	cert, err := x509.ParseCertificate(certObj.DER)
@@ -249,7 +248,7 @@ func TestRevoke(t *testing.T) {
 func TestIssueCertificate(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
-	ca, err := NewCertificateAuthorityImpl(ctx.caDB, ctx.caConfig, ctx.fc, caCertFile)
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
 	test.AssertNotError(t, err, "Failed to create CA")
 	ca.PA = ctx.pa
 	ca.SA = ctx.sa
@@ -269,7 +268,7 @@ func TestIssueCertificate(t *testing.T) {
 		csr, _ := x509.ParseCertificateRequest(csrDER)
 
 		// Sign CSR
-		issuedCert, err := ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture)
+		issuedCert, err := ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
 		test.AssertNotError(t, err, "Failed to sign certificate")
 		if err != nil {
 			continue
@@ -314,6 +313,11 @@ func TestIssueCertificate(t *testing.T) {
 		test.AssertNotError(t, err,
 			fmt.Sprintf("Certificate %s not found in database", serialString))
 		test.Assert(t, bytes.Equal(issuedCert.DER, storedCert.DER), "Retrieved cert not equal to issued cert.")
+		test.AssertEquals(t, serialString[:2], "11")
+		storedCert, err = ctx.sa.GetCertificateByShortSerial(serialString[:16])
+		test.AssertNotError(t, err,
+			fmt.Sprintf("Certificate %s not found by short serial", serialString))
+		test.Assert(t, bytes.Equal(issuedCert.DER, storedCert.DER), "Retrieved cert not equal to issued cert.")
 
 		certStatus, err := ctx.sa.GetCertificateStatus(serialString)
 		test.AssertNotError(t, err,
@@ -323,10 +327,24 @@ func TestIssueCertificate(t *testing.T) {
 	}
 }
 
+func TestNewSerial(t *testing.T) {
+	ca := CertificateAuthorityImpl{Prefix: 17}
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		serial, err := ca.newSerial()
+		test.AssertNotError(t, err, "Failed to generate serial")
+		serialString := core.SerialToString(serial)
+		test.AssertEquals(t, len(serialString), 32)
+		test.AssertEquals(t, serialString[:2], "11")
+		test.Assert(t, !seen[serialString], "Generated a duplicate serial")
+		seen[serialString] = true
+	}
+}
+
 func TestRejectNoName(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
-	ca, err := NewCertificateAuthorityImpl(ctx.caDB, ctx.caConfig, ctx.fc, caCertFile)
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
 	test.AssertNotError(t, err, "Failed to create CA")
 	ca.PA = ctx.pa
 	ca.SA = ctx.sa
@@ -334,7 +352,7 @@ func TestRejectNoName(t *testing.T) {
 
 	// Test that the CA rejects CSRs with no names
 	csr, _ := x509.ParseCertificateRequest(NoNameCSR)
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture)
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
 	if err == nil {
 		t.Errorf("CA improperly agreed to create a certificate with no name")
 	}
@@ -343,21 +361,21 @@ func TestRejectNoName(t *testing.T) {
 func TestRejectTooManyNames(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
-	ca, err := NewCertificateAuthorityImpl(ctx.caDB, ctx.caConfig, ctx.fc, caCertFile)
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
 	test.AssertNotError(t, err, "Failed to create CA")
 	ca.PA = ctx.pa
 	ca.SA = ctx.sa
 
 	// Test that the CA rejects a CSR with too many names
 	csr, _ := x509.ParseCertificateRequest(TooManyNameCSR)
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture)
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
 	test.Assert(t, err != nil, "Issued certificate with too many names")
 }
 
 func TestDeduplication(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
-	ca, err := NewCertificateAuthorityImpl(ctx.caDB, ctx.caConfig, ctx.fc, caCertFile)
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
 	test.AssertNotError(t, err, "Failed to create CA")
 	ca.PA = ctx.pa
 	ca.SA = ctx.sa
@@ -365,7 +383,7 @@ func TestDeduplication(t *testing.T) {
 
 	// Test that the CA collapses duplicate names
 	csr, _ := x509.ParseCertificateRequest(DupeNameCSR)
-	cert, err := ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture)
+	cert, err := ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
 	test.AssertNotError(t, err, "Failed to gracefully handle a CSR with duplicate names")
 	if err != nil {
 		return
@@ -387,7 +405,7 @@ func TestDeduplication(t *testing.T) {
 func TestRejectValidityTooLong(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
-	ca, err := NewCertificateAuthorityImpl(ctx.caDB, ctx.caConfig, ctx.fc, caCertFile)
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
 	test.AssertNotError(t, err, "Failed to create CA")
 	ca.PA = ctx.pa
 	ca.SA = ctx.sa
@@ -395,40 +413,174 @@ func TestRejectValidityTooLong(t *testing.T) {
 
 	// Test that the CA rejects CSRs that would expire after the intermediate cert
 	csr, _ := x509.ParseCertificateRequest(NoCNCSR)
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarPast)
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarPast, "")
 	test.Assert(t, err == nil, "Can issue a certificate that expires after the underlying authorization.")
 
 	// Test that the CA rejects CSRs that would expire after the intermediate cert
 	csr, _ = x509.ParseCertificateRequest(NoCNCSR)
 	ca.NotAfter = ctx.fc.Now()
-	_, err = ca.IssueCertificate(*csr, 1, FarFuture)
+	_, err = ca.IssueCertificate(*csr, 1, FarFuture, "")
 	test.AssertEquals(t, err.Error(), "Cannot issue a certificate that expires after the intermediate certificate.")
 }
 
 func TestShortKey(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
-	ca, err := NewCertificateAuthorityImpl(ctx.caDB, ctx.caConfig, ctx.fc, caCertFile)
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
 	ca.PA = ctx.pa
 	ca.SA = ctx.sa
 	ca.MaxKeySize = 4096
 
 	// Test that the CA rejects CSRs that would expire after the intermediate cert
 	csr, _ := x509.ParseCertificateRequest(ShortKeyCSR)
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture)
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
 	test.Assert(t, err != nil, "Issued a certificate with too short a key.")
 }
 
 func TestRejectBadAlgorithm(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
-	ca, err := NewCertificateAuthorityImpl(ctx.caDB, ctx.caConfig, ctx.fc, caCertFile)
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
 	ca.PA = ctx.pa
 	ca.SA = ctx.sa
 	ca.MaxKeySize = 4096
 
 	// Test that the CA rejects CSRs that would expire after the intermediate cert
 	csr, _ := x509.ParseCertificateRequest(BadAlgorithmCSR)
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture)
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
 	test.Assert(t, err != nil, "Issued a certificate based on a CSR with a weak algorithm.")
 }
+
+func TestRejectLintFailure(t *testing.T) {
+	ctx := setup(t)
+	defer ctx.cleanUp()
+	// A profile that allows the certificate to sign other certificates fails
+	// the basic_constraints lint.
+	ctx.caConfig.CFSSL.Signing.Profiles[profileName].CA = true
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.PA = ctx.pa
+	ca.SA = ctx.sa
+	ca.MaxKeySize = 4096
+
+	csr, _ := x509.ParseCertificateRequest(CNandSANCSR)
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
+	test.AssertError(t, err, "Issued a certificate that failed pre-issuance lint")
+	_, ok := err.(core.CertificateIssuanceError)
+	test.Assert(t, ok, "Lint failure should be a CertificateIssuanceError")
+}
+
+func TestLoadCertProfiles(t *testing.T) {
+	policy := &cfsslConfig.Signing{
+		Profiles: map[string]*cfsslConfig.SigningProfile{
+			"short": &cfsslConfig.SigningProfile{Expiry: time.Hour},
+		},
+	}
+
+	_, err := loadCertProfiles(map[string]cmd.CertProfileConfig{
+		"short-lived": cmd.CertProfileConfig{CFSSLProfile: "missing"},
+	}, policy)
+	test.AssertError(t, err, "Loaded a profile with an unknown CFSSL profile")
+
+	_, err = loadCertProfiles(map[string]cmd.CertProfileConfig{
+		"short-lived": cmd.CertProfileConfig{CFSSLProfile: "short", AllowedKeyTypes: []string{"DSA"}},
+	}, policy)
+	test.AssertError(t, err, "Loaded a profile with an unknown key type")
+
+	profiles, err := loadCertProfiles(map[string]cmd.CertProfileConfig{
+		"short-lived": cmd.CertProfileConfig{CFSSLProfile: "short", MustStaple: true, AllowedKeyTypes: []string{"RSA"}},
+	}, policy)
+	test.AssertNotError(t, err, "Failed to load profiles")
+	profile := profiles["short-lived"]
+	test.AssertEquals(t, profile.validityPeriod, time.Hour)
+	test.Assert(t, profile.mustStaple, "Profile should be Must-Staple")
+	test.Assert(t, profile.allowedKeyTypes[x509.RSA], "Profile should allow RSA keys")
+	test.Assert(t, !profile.allowedKeyTypes[x509.ECDSA], "Profile shouldn't allow ECDSA keys")
+}
+
+func TestIssueCertificateWithProfile(t *testing.T) {
+	ctx := setup(t)
+	defer ctx.cleanUp()
+	shortProfile := *ctx.caConfig.CFSSL.Signing.Profiles[profileName]
+	shortProfile.ExpiryString = "24h"
+	ctx.caConfig.CFSSL.Signing.Profiles["short"] = &shortProfile
+	ctx.caConfig.Profiles = map[string]cmd.CertProfileConfig{
+		"short-lived": cmd.CertProfileConfig{CFSSLProfile: "short", MustStaple: true},
+		"ecdsa-only":  cmd.CertProfileConfig{CFSSLProfile: profileName, AllowedKeyTypes: []string{"ECDSA"}},
+	}
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.PA = ctx.pa
+	ca.SA = ctx.sa
+	ca.MaxKeySize = 4096
+
+	csr, _ := x509.ParseCertificateRequest(CNandSANCSR)
+	issued, err := ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "short-lived")
+	test.AssertNotError(t, err, "Failed to issue certificate with profile")
+	cert, err := x509.ParseCertificate(issued.DER)
+	test.AssertNotError(t, err, "Certificate failed to parse")
+	test.AssertEquals(t, cert.NotAfter.Sub(cert.NotBefore), 24*time.Hour)
+	mustStaple := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(core.OIDTLSFeature) {
+			mustStaple = bytes.Equal(ext.Value, core.MustStapleExtensionValue)
+		}
+	}
+	test.Assert(t, mustStaple, "Certificate doesn't have the Must-Staple extension")
+
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "ecdsa-only")
+	test.AssertError(t, err, "Issued an RSA certificate under an ECDSA-only profile")
+
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "unknown")
+	test.AssertError(t, err, "Issued a certificate under an unknown profile")
+}
+
+func makeMustStapleCSR(t *testing.T) *x509.CertificateRequest {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Error generating key")
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "not-example.com"},
+		DNSNames:        []string{"not-example.com", "www.not-example.com"},
+		ExtraExtensions: []pkix.Extension{{Id: core.OIDTLSFeature, Value: core.MustStapleExtensionValue}},
+	}, key)
+	test.AssertNotError(t, err, "Error creating CSR")
+	csr, err := x509.ParseCertificateRequest(der)
+	test.AssertNotError(t, err, "Error parsing CSR")
+	return csr
+}
+
+func TestMustStapleRequest(t *testing.T) {
+	ctx := setup(t)
+	defer ctx.cleanUp()
+	csr := makeMustStapleCSR(t)
+
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.PA = ctx.pa
+	ca.SA = ctx.sa
+	ca.MaxKeySize = 4096
+
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
+	test.AssertError(t, err, "Issued a Must-Staple certificate without AllowMustStapleRequests")
+	_, ok := err.(core.MalformedRequestError)
+	test.Assert(t, ok, "Disallowed Must-Staple request should be a MalformedRequestError")
+
+	ctx.caConfig.AllowMustStapleRequests = true
+	ca, err = NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, caCertFile)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.PA = ctx.pa
+	ca.SA = ctx.sa
+	ca.MaxKeySize = 4096
+
+	issued, err := ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
+	test.AssertNotError(t, err, "Failed to issue a Must-Staple certificate")
+	cert, err := x509.ParseCertificate(issued.DER)
+	test.AssertNotError(t, err, "Certificate failed to parse")
+	mustStaple, err := core.HasMustStaple(cert.Extensions)
+	test.AssertNotError(t, err, "Certificate has an invalid TLS Feature extension")
+	test.Assert(t, mustStaple, "Certificate doesn't have the Must-Staple extension")
+
+	csr.Extensions = []pkix.Extension{{Id: core.OIDTLSFeature, Value: []byte{0x30, 0x03, 0x02, 0x01, 0x11}}}
+	_, err = ca.IssueCertificate(*csr, ctx.reg.ID, FarFuture, "")
+	test.AssertError(t, err, "Issued a certificate with an unsupported TLS Feature")
+}
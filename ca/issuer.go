@@ -0,0 +1,145 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+
+	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer/local"
+)
+
+// Issuer signs end-entity certificates under CFSSL signing profiles. It
+// builds the certificate template the way CFSSL's local signer does, but
+// lets Boulder choose the serial number and add extensions such as the TLS
+// Feature, which the local signer can't do.
+type Issuer struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	sigAlgo x509.SignatureAlgorithm
+	policy  *cfsslConfig.Signing
+}
+
+// issuanceRequest describes a certificate for an issuer to sign.
+type issuanceRequest struct {
+	csr *x509.CertificateRequest
+	// profile names the CFSSL signing profile, or is empty for the default
+	profile     string
+	commonName  string
+	dnsNames    []string
+	ipAddresses []net.IP
+	serial      *big.Int
+	// extensions are added to the certificate as they are. Checking that
+	// they're permitted is up to the caller.
+	extensions []pkix.Extension
+}
+
+// NewIssuer creates an Issuer that signs with key under the given CFSSL
+// signing policy, or CFSSL's default policy if it's nil.
+func NewIssuer(key crypto.Signer, cert *x509.Certificate, sigAlgo x509.SignatureAlgorithm, policy *cfsslConfig.Signing) (*Issuer, error) {
+	if policy == nil {
+		policy = &cfsslConfig.Signing{
+			Profiles: map[string]*cfsslConfig.SigningProfile{},
+			Default:  cfsslConfig.DefaultConfig(),
+		}
+	}
+	if !policy.Valid() {
+		return nil, errors.New("Invalid CFSSL signing policy")
+	}
+	return &Issuer{cert: cert, key: key, sigAlgo: sigAlgo, policy: policy}, nil
+}
+
+// signingProfile returns the named CFSSL signing profile, or the default
+// profile if there is no such profile.
+func (i *Issuer) signingProfile(name string) (*cfsslConfig.SigningProfile, error) {
+	var profile *cfsslConfig.SigningProfile
+	if name != "" {
+		profile = i.policy.Profiles[name]
+	}
+	if profile == nil {
+		profile = i.policy.Default
+	}
+	if profile == nil {
+		return nil, fmt.Errorf("No CFSSL signing profile %q", name)
+	}
+	return profile, nil
+}
+
+// template builds the certificate for req, copying only the fields of the
+// CSR that the profile's CSR whitelist permits.
+func (i *Issuer) template(req issuanceRequest, profile *cfsslConfig.SigningProfile) (*x509.Certificate, error) {
+	csr := req.csr
+	err := signer.CheckSignature(csr, csr.SignatureAlgorithm, csr.RawTBSCertificateRequest, csr.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSR signature: %s", err)
+	}
+
+	template := &x509.Certificate{}
+	if whitelist := profile.CSRWhitelist; whitelist == nil {
+		template.Subject = csr.Subject
+		template.PublicKeyAlgorithm = csr.PublicKeyAlgorithm
+		template.PublicKey = csr.PublicKey
+		template.SignatureAlgorithm = i.sigAlgo
+	} else {
+		if whitelist.Subject {
+			template.Subject = csr.Subject
+		}
+		if whitelist.PublicKeyAlgorithm {
+			template.PublicKeyAlgorithm = csr.PublicKeyAlgorithm
+		}
+		if whitelist.PublicKey {
+			template.PublicKey = csr.PublicKey
+		}
+		if whitelist.SignatureAlgorithm {
+			template.SignatureAlgorithm = i.sigAlgo
+		}
+	}
+	template.Subject = local.PopulateSubjectFromCSR(&signer.Subject{CN: req.commonName}, template.Subject)
+	template.DNSNames = req.dnsNames
+	template.IPAddresses = req.ipAddresses
+
+	if profile.NameWhitelist != nil {
+		names := append([]string{template.Subject.CommonName}, template.DNSNames...)
+		for _, name := range names {
+			if name != "" && profile.NameWhitelist.Find([]byte(name)) == nil {
+				return nil, fmt.Errorf("Name %s isn't permitted by the CFSSL signing profile", name)
+			}
+		}
+	}
+
+	// FillTemplate sets the validity period, key usages, issuer, OCSP and CRL
+	// URLs and policies, along with a random serial that's replaced below.
+	if err = signer.FillTemplate(template, i.policy.Default, profile, ""); err != nil {
+		return nil, err
+	}
+	template.SerialNumber = req.serial
+	template.ExtraExtensions = append(template.ExtraExtensions, req.extensions...)
+	return template, nil
+}
+
+// sign issues the certificate described by req and returns its DER.
+func (i *Issuer) sign(req issuanceRequest) ([]byte, error) {
+	if req.serial == nil {
+		return nil, errors.New("Certificate has no serial number")
+	}
+	profile, err := i.signingProfile(req.profile)
+	if err != nil {
+		return nil, err
+	}
+	template, err := i.template(req, profile)
+	if err != nil {
+		return nil, err
+	}
+	return x509.CreateCertificate(rand.Reader, template, i.cert, template.PublicKey, i.key)
+}
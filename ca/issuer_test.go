@@ -0,0 +1,81 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/helpers"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestIssuerSign(t *testing.T) {
+	keyPEM, err := ioutil.ReadFile(caKeyFile)
+	test.AssertNotError(t, err, "Couldn't read CA key")
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	test.AssertNotError(t, err, "Couldn't parse CA key")
+	caCert, err := loadIssuer(caCertFile)
+	test.AssertNotError(t, err, "Couldn't load CA certificate")
+
+	policy := &cfsslConfig.Signing{
+		Profiles: map[string]*cfsslConfig.SigningProfile{
+			"ee": &cfsslConfig.SigningProfile{
+				Usage:        []string{"digital signature", "server auth"},
+				Expiry:       time.Hour,
+				ExpiryString: "1h",
+				CSRWhitelist: &cfsslConfig.CSRWhitelist{PublicKey: true, PublicKeyAlgorithm: true, SignatureAlgorithm: true},
+			},
+		},
+		Default: cfsslConfig.DefaultConfig(),
+	}
+	i, err := NewIssuer(key, caCert, x509.SHA256WithRSA, policy)
+	test.AssertNotError(t, err, "Couldn't create issuer")
+
+	csr, err := x509.ParseCertificateRequest(CNandSANCSR)
+	test.AssertNotError(t, err, "Couldn't parse CSR")
+	req := issuanceRequest{
+		csr:         csr,
+		profile:     "ee",
+		commonName:  "example.com",
+		dnsNames:    []string{"example.com", "www.example.com"},
+		ipAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+		serial:      big.NewInt(0x2a1234),
+		extensions:  []pkix.Extension{pkix.Extension{Id: core.OIDTLSFeature, Value: core.MustStapleExtensionValue}},
+	}
+	der, err := i.sign(req)
+	test.AssertNotError(t, err, "Couldn't sign certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Couldn't parse certificate")
+	test.AssertNotError(t, cert.CheckSignatureFrom(caCert), "Certificate isn't signed by the CA")
+
+	test.AssertEquals(t, cert.SerialNumber.Cmp(req.serial), 0)
+	test.AssertEquals(t, cert.Subject.CommonName, "example.com")
+	// The CSR whitelist doesn't include the subject, so only the CN is set
+	test.AssertEquals(t, len(cert.Subject.Organization), 0)
+	test.AssertDeepEquals(t, cert.DNSNames, req.dnsNames)
+	test.AssertEquals(t, len(cert.IPAddresses), 1)
+	test.AssertEquals(t, cert.NotAfter.Sub(cert.NotBefore), time.Hour)
+	hasMustStaple, err := core.HasMustStaple(cert.Extensions)
+	test.AssertNotError(t, err, "Couldn't read TLS Feature extension")
+	test.Assert(t, hasMustStaple, "Certificate isn't Must-Staple")
+
+	req.serial = nil
+	_, err = i.sign(req)
+	test.AssertError(t, err, "Signed a certificate without a serial")
+
+	req.serial = big.NewInt(1)
+	csr.Signature[0] ^= 0xff
+	_, err = i.sign(req)
+	test.AssertError(t, err, "Signed a CSR with a bad signature")
+}
@@ -59,6 +59,7 @@ func setupContext(context *cli.Context) (rpc.RegistrationAuthorityClient, *blog.
 
 	dbMap, err := sa.NewDbMap(c.Revoker.DBConnect)
 	cmd.FailOnError(err, "Couldn't setup database connection")
+	cmd.CheckSchemaVersion(dbMap, "sa")
 
 	saRPC, err := rpc.NewAmqpRPCClient("AdminRevoker->SA", c.AMQP.SA.Server, ch)
 	cmd.FailOnError(err, "Unable to create RPC client")
@@ -0,0 +1,154 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/policy"
+	"github.com/letsencrypt/boulder/rpc"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+// heldAuthz is the part of a pending authorization listed for reviewers
+type heldAuthz struct {
+	ID             string `db:"id"`
+	Identifier     string `db:"identifier"`
+	RegistrationID int64  `db:"registrationID"`
+}
+
+func loadConfig(c *cli.Context) cmd.Config {
+	configFileName := c.GlobalString("config")
+	configJSON, err := ioutil.ReadFile(configFileName)
+	cmd.FailOnError(err, "Couldn't read configuration file")
+	var config cmd.Config
+	err = json.Unmarshal(configJSON, &config)
+	cmd.FailOnError(err, "Couldn't unmarshal configuration object")
+	return config
+}
+
+func setupRA(c cmd.Config) rpc.RegistrationAuthorityClient {
+	stats, err := statsd.NewClient(c.Statsd.Server, c.Statsd.Prefix)
+	cmd.FailOnError(err, "Couldn't connect to statsd")
+
+	auditlogger, err := blog.Dial(c.Syslog.Network, c.Syslog.Server, c.Syslog.Tag, stats)
+	cmd.FailOnError(err, "Could not connect to Syslog")
+	blog.SetAuditLogger(auditlogger)
+
+	ch, err := rpc.AmqpChannel(c)
+	cmd.FailOnError(err, "Could not connect to AMQP")
+
+	raRPC, err := rpc.NewAmqpRPCClient("reviewer->RA", c.AMQP.RA.Server, ch)
+	cmd.FailOnError(err, "Unable to create RPC client")
+
+	rac, err := rpc.NewRegistrationAuthorityClient(raRPC)
+	cmd.FailOnError(err, "Unable to create RA client")
+	return rac
+}
+
+func listHeld(c cmd.Config) {
+	dbMap, err := sa.NewDbMap(c.AuthzReviewer.DBConnect)
+	cmd.FailOnError(err, "Couldn't setup database connection")
+	cmd.CheckSchemaVersion(dbMap, "sa")
+	var held []heldAuthz
+	_, err = dbMap.Select(
+		&held,
+		"SELECT id, identifier, registrationID FROM pendingAuthorizations WHERE status = :status",
+		map[string]interface{}{"status": string(core.StatusNeedsReview)},
+	)
+	cmd.FailOnError(err, "Couldn't list held authorizations")
+
+	paDbMap, err := sa.NewDbMap(c.PA.DBConnect)
+	cmd.FailOnError(err, "Couldn't connect to policy database")
+	cmd.CheckSchemaVersion(paDbMap, "policy")
+	pa, err := policy.NewPolicyAuthorityImpl(paDbMap, c.PA.EnforcePolicyWhitelist)
+	cmd.FailOnError(err, "Couldn't create PA")
+
+	fmt.Printf("# %d authorizations held for review\n", len(held))
+	for _, authz := range held {
+		var identifier core.AcmeIdentifier
+		err = json.Unmarshal([]byte(authz.Identifier), &identifier)
+		cmd.FailOnError(err, "Couldn't unmarshal identifier")
+		rule, err := pa.ReviewRuleFor(identifier)
+		cmd.FailOnError(err, "Couldn't check review rules")
+		if rule == "" {
+			rule = "no longer matches a rule"
+		}
+		fmt.Printf("%s\t%s\tregistration %d\t%s\n", authz.ID, identifier.Value, authz.RegistrationID, rule)
+	}
+}
+
+func review(c *cli.Context, approve bool) {
+	authzID := c.Args().First()
+	if authzID == "" {
+		fmt.Println("authorization ID argument is required")
+		os.Exit(1)
+	}
+	rac := setupRA(loadConfig(c))
+
+	u, err := user.Current()
+	cmd.FailOnError(err, "Couldn't determine the current user")
+	err = rac.ReviewAuthorization(authzID, approve, u.Username)
+	cmd.FailOnError(err, "Couldn't review authorization")
+	if approve {
+		fmt.Printf("# Approved authorization %s\n", authzID)
+	} else {
+		fmt.Printf("# Denied authorization %s\n", authzID)
+	}
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "authz-reviewer"
+	app.Usage = "Approves or denies authorizations held for manual review"
+	app.Version = cmd.Version()
+	app.Author = "Boulder contributors"
+	app.Email = "ca-dev@letsencrypt.org"
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Value:  "config.json",
+			EnvVar: "BOULDER_CONFIG",
+			Usage:  "Path to Boulder JSON configuration file",
+		},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "list",
+			Usage: "List authorizations held for review and the rules they match",
+			Action: func(c *cli.Context) {
+				listHeld(loadConfig(c))
+			},
+		},
+		{
+			Name:  "approve",
+			Usage: "Approve a held authorization by ID so the client can complete its challenges",
+			Action: func(c *cli.Context) {
+				review(c, true)
+			},
+		},
+		{
+			Name:  "deny",
+			Usage: "Deny a held authorization by ID, making it invalid",
+			Action: func(c *cli.Context) {
+				review(c, false)
+			},
+		},
+	}
+
+	err := app.Run(os.Args)
+	cmd.FailOnError(err, "Failed to run application")
+}
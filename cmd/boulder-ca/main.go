@@ -6,10 +6,13 @@
 package main
 
 import (
+	"time"
+
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/ca"
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/policy"
 	"github.com/letsencrypt/boulder/rpc"
@@ -33,20 +36,30 @@ func main() {
 
 		go cmd.DebugServer(c.CA.DebugAddr)
 
-		dbMap, err := sa.NewDbMap(c.CA.DBConnect)
-		cmd.FailOnError(err, "Couldn't connect to CA database")
-
-		cadb, err := ca.NewCertificateAuthorityDatabaseImpl(dbMap)
-		cmd.FailOnError(err, "Failed to create CA database")
-
 		paDbMap, err := sa.NewDbMap(c.PA.DBConnect)
 		cmd.FailOnError(err, "Couldn't connect to policy database")
+		cmd.CheckSchemaVersion(paDbMap, "policy")
 		pa, err := policy.NewPolicyAuthorityImpl(paDbMap, c.PA.EnforcePolicyWhitelist)
 		cmd.FailOnError(err, "Couldn't create PA")
+		pa.IPBlocklist, err = policy.ParseIPBlocklist(c.PA.IPBlocklist)
+		cmd.FailOnError(err, "Couldn't parse IP blocklist")
+		pa.IDN.Scripts, err = policy.ParseIDNScripts(c.PA.IDN.Scripts)
+		cmd.FailOnError(err, "Couldn't parse IDN scripts")
+		pa.IDN.AllowMixedScripts = c.PA.IDN.AllowMixedScripts
+		pa.IDN.AllowConfusables = c.PA.IDN.AllowConfusables
+		pa.Suffixes = cmd.LoadPublicSuffixList(c.PA)
+		if c.PA.RuleRefreshInterval != "" {
+			ruleRefresh, err := time.ParseDuration(c.PA.RuleRefreshInterval)
+			cmd.FailOnError(err, "Couldn't parse rule refresh interval")
+			err = pa.DB.CacheRules(ruleRefresh)
+			cmd.FailOnError(err, "Couldn't load policy rules")
+		}
 
-		cai, err := ca.NewCertificateAuthorityImpl(cadb, c.CA, clock.Default(), c.Common.IssuerCert)
+		cai, err := ca.NewCertificateAuthorityImpl(c.CA, clock.Default(), c.Common.IssuerCert)
 		cmd.FailOnError(err, "Failed to create CA impl")
 		cai.MaxKeySize = c.Common.MaxKeySize
+		cai.KeyBlocklist, err = core.LoadKeyBlocklist(c.Common.BlockedKeyFiles)
+		cmd.FailOnError(err, "Couldn't load key blocklist")
 		cai.PA = pa
 
 		go cmd.ProfileCmd("CA", stats)
@@ -0,0 +1,155 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	_ "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/go-sql-driver/mysql"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/migrate"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "boulder-migrate"
+	app.Usage = "Applies, rolls back and reports the status of database schema migrations"
+	app.Version = cmd.Version()
+	app.Author = "Boulder contributors"
+	app.Email = "ca-dev@letsencrypt.org"
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Value:  "config.json",
+			EnvVar: "BOULDER_CONFIG",
+			Usage:  "Path to Boulder JSON configuration file",
+		},
+		cli.StringFlag{
+			Name:  "schema",
+			Usage: "Schema to migrate: sa or policy",
+		},
+		cli.StringFlag{
+			Name:  "db-connect",
+			Usage: "Database to migrate, instead of the one the configuration file gives for the schema",
+		},
+		cli.StringFlag{
+			Name:  "migrations",
+			Usage: "Directory holding the schema's migrations, by default <schema>/_db/migrations, or <schema>/_db/sqlite-migrations for SQLite",
+		},
+	}
+
+	app.Commands = []cli.Command{
+		cli.Command{
+			Name:  "up",
+			Usage: "Apply every migration newer than the database's current version",
+			Action: func(c *cli.Context) {
+				db, migrations := setupFromContext(c)
+				applied, err := migrate.Up(db, migrations)
+				for _, migration := range applied {
+					fmt.Printf("# Applied %s\n", migration.Name)
+				}
+				cmd.FailOnError(err, "Couldn't apply migrations")
+				if len(applied) == 0 {
+					fmt.Println("# Already up to date")
+				}
+			},
+		},
+		cli.Command{
+			Name:  "down",
+			Usage: "Roll back the newest migration applied to the database",
+			Action: func(c *cli.Context) {
+				db, migrations := setupFromContext(c)
+				migration, err := migrate.Down(db, migrations)
+				cmd.FailOnError(err, "Couldn't roll back migration")
+				fmt.Printf("# Rolled back %s\n", migration.Name)
+			},
+		},
+		cli.Command{
+			Name:  "status",
+			Usage: "List the migrations and when each was applied",
+			Action: func(c *cli.Context) {
+				db, migrations := setupFromContext(c)
+				statuses, err := migrate.Status(db, migrations)
+				cmd.FailOnError(err, "Couldn't read migration status")
+				known := false
+				current, err := migrate.CurrentVersion(db)
+				cmd.FailOnError(err, "Couldn't read schema version")
+				for _, status := range statuses {
+					if status.Version == current {
+						known = true
+					}
+					if status.Applied {
+						fmt.Printf("%-30s %s\n", status.AppliedAt.Format(time.RFC3339), status.Name)
+					} else if status.OutOfOrder {
+						fmt.Printf("%-30s %s\n", "Skipped (out of order)", status.Name)
+					} else {
+						fmt.Printf("%-30s %s\n", "Pending", status.Name)
+					}
+				}
+				schema := c.GlobalString("schema")
+				fmt.Printf("# Database is at version %d; this build expects %d\n", current, migrate.SchemaVersions[schema])
+				if current != 0 && !known {
+					fmt.Printf("# WARNING: version %d doesn't match any migration in this build\n", current)
+				}
+			},
+		},
+	}
+
+	app.Run(os.Args)
+}
+
+func setupFromContext(context *cli.Context) (*sql.DB, []migrate.Migration) {
+	schema := context.GlobalString("schema")
+	if _, ok := migrate.SchemaVersions[schema]; !ok {
+		fmt.Println("schema argument must be sa or policy")
+		os.Exit(1)
+	}
+
+	dbConnect := context.GlobalString("db-connect")
+	if dbConnect == "" {
+		c := loadConfig(context)
+		switch schema {
+		case "sa":
+			dbConnect = c.SA.DBConnect
+		case "policy":
+			dbConnect = c.PA.DBConnect
+		}
+	}
+	if dbConnect == "" {
+		fmt.Printf("db-connect argument is required for the %s schema\n", schema)
+		os.Exit(1)
+	}
+
+	dbMap, err := sa.NewDbMap(dbConnect)
+	cmd.FailOnError(err, "Couldn't connect to database")
+
+	dir := context.GlobalString("migrations")
+	if dir == "" {
+		dir = migrate.Dir(schema, sa.IsSQLite(dbMap))
+	}
+	migrations, err := migrate.Load(dir)
+	cmd.FailOnError(err, "Couldn't load migrations")
+	return dbMap.Db, migrations
+}
+
+func loadConfig(context *cli.Context) cmd.Config {
+	configFileName := context.GlobalString("config")
+	configJSON, err := ioutil.ReadFile(configFileName)
+	cmd.FailOnError(err, "Couldn't read configuration file")
+	var c cmd.Config
+	err = json.Unmarshal(configJSON, &c)
+	cmd.FailOnError(err, "Couldn't unmarshal configuration object")
+	return c
+}
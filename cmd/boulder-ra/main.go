@@ -40,12 +40,41 @@ func main() {
 
 		paDbMap, err := sa.NewDbMap(c.PA.DBConnect)
 		cmd.FailOnError(err, "Couldn't connect to policy database")
+		cmd.CheckSchemaVersion(paDbMap, "policy")
 		pa, err := policy.NewPolicyAuthorityImpl(paDbMap, c.PA.EnforcePolicyWhitelist)
 		cmd.FailOnError(err, "Couldn't create PA")
+		pa.IPBlocklist, err = policy.ParseIPBlocklist(c.PA.IPBlocklist)
+		cmd.FailOnError(err, "Couldn't parse IP blocklist")
+		pa.IDN.Scripts, err = policy.ParseIDNScripts(c.PA.IDN.Scripts)
+		cmd.FailOnError(err, "Couldn't parse IDN scripts")
+		pa.IDN.AllowMixedScripts = c.PA.IDN.AllowMixedScripts
+		pa.IDN.AllowConfusables = c.PA.IDN.AllowConfusables
+		pa.Suffixes = cmd.LoadPublicSuffixList(c.PA)
+		if c.PA.RuleRefreshInterval != "" {
+			ruleRefresh, err := time.ParseDuration(c.PA.RuleRefreshInterval)
+			cmd.FailOnError(err, "Couldn't parse rule refresh interval")
+			err = pa.DB.CacheRules(ruleRefresh)
+			cmd.FailOnError(err, "Couldn't load policy rules")
+		}
 
 		rai := ra.NewRegistrationAuthorityImpl(clock.Default(), auditlogger)
 		rai.AuthzBase = c.Common.BaseURL + wfe.AuthzPath
+		rai.RegBase = c.Common.BaseURL + wfe.RegPath
+		if c.RA.CAARecheckWindow != "" {
+			rai.CAARecheckWindow, err = time.ParseDuration(c.RA.CAARecheckWindow)
+			cmd.FailOnError(err, "Couldn't parse CAA recheck window")
+		}
 		rai.MaxKeySize = c.Common.MaxKeySize
+		rai.Profiles = make(map[string]ra.ProfileAccess, len(c.RA.Profiles))
+		for name, pc := range c.RA.Profiles {
+			rai.Profiles[name] = ra.ProfileAccess{
+				AllowAll:      pc.AllowAll,
+				Registrations: pc.Registrations,
+				DefaultFor:    pc.DefaultFor,
+			}
+		}
+		rai.KeyBlocklist, err = core.LoadKeyBlocklist(c.Common.BlockedKeyFiles)
+		cmd.FailOnError(err, "Couldn't load key blocklist")
 		rai.PA = pa
 		raDNSTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
 		cmd.FailOnError(err, "Couldn't parse RA DNS timeout")
@@ -54,6 +83,11 @@ func main() {
 		} else {
 			rai.DNSResolver = core.NewTestDNSResolverImpl(raDNSTimeout, []string{c.Common.DNSResolver})
 		}
+		if c.Common.DNSCacheMaxTTL != "" {
+			maxTTL, err := time.ParseDuration(c.Common.DNSCacheMaxTTL)
+			cmd.FailOnError(err, "Couldn't parse DNS cache max TTL")
+			rai.DNSResolver = core.NewCachingDNSResolver(clock.Default(), rai.DNSResolver, maxTTL, stats)
+		}
 
 		go cmd.ProfileCmd("RA", stats)
 
@@ -6,6 +6,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/cmd"
@@ -33,9 +35,24 @@ func main() {
 
 		dbMap, err := sa.NewDbMap(c.SA.DBConnect)
 		cmd.FailOnError(err, "Couldn't connect to SA database")
+		cmd.CheckSchemaVersion(dbMap, "sa")
 
 		sai, err := sa.NewSQLStorageAuthority(dbMap, clock.Default())
 		cmd.FailOnError(err, "Failed to create SA impl")
+
+		if c.SA.ReplicaDBConnect != "" {
+			replicaMap, err := sa.NewDbMap(c.SA.ReplicaDBConnect)
+			cmd.FailOnError(err, "Couldn't connect to SA replica database")
+			cmd.CheckSchemaVersion(replicaMap, "sa")
+			sai.SetReplica(replicaMap)
+
+			lagInterval := 10 * time.Second
+			if c.SA.ReplicaLagInterval != "" {
+				lagInterval, err = time.ParseDuration(c.SA.ReplicaLagInterval)
+				cmd.FailOnError(err, "Couldn't parse replica lag interval")
+			}
+			go sa.MonitorReplicaLag(replicaMap.Db, stats, lagInterval)
+		}
 		sai.SetSQLDebug(c.SQL.SQLDebug)
 
 		go cmd.ProfileCmd("SA", stats)
@@ -6,13 +6,17 @@
 package main
 
 import (
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mail"
 	"github.com/letsencrypt/boulder/rpc"
 	"github.com/letsencrypt/boulder/va"
 )
@@ -40,6 +44,7 @@ func main() {
 			SimpleHTTPPort:  80,
 			SimpleHTTPSPort: 443,
 			DVSNIPort:       443,
+			TLSSNIPort:      443,
 		}
 		if c.VA.PortConfig.SimpleHTTPPort != 0 {
 			pc.SimpleHTTPPort = c.VA.PortConfig.SimpleHTTPPort
@@ -50,15 +55,68 @@ func main() {
 		if c.VA.PortConfig.DVSNIPort != 0 {
 			pc.DVSNIPort = c.VA.PortConfig.DVSNIPort
 		}
+		if c.VA.PortConfig.TLSSNIPort != 0 {
+			pc.TLSSNIPort = c.VA.PortConfig.TLSSNIPort
+		}
 		vai := va.NewValidationAuthorityImpl(pc)
 		dnsTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
 		cmd.FailOnError(err, "Couldn't parse DNS timeout")
+		var resolver *core.DNSResolverImpl
 		if !c.Common.DNSAllowLoopbackAddresses {
-			vai.DNSResolver = core.NewDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver})
+			resolver = core.NewDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver})
 		} else {
-			vai.DNSResolver = core.NewTestDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver})
+			resolver = core.NewTestDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver})
+		}
+		if c.VA.DNSSEC.TrustAnchorFile != "" {
+			anchors, err := core.LoadTrustAnchors(c.VA.DNSSEC.TrustAnchorFile)
+			cmd.FailOnError(err, "Couldn't load DNSSEC trust anchors")
+			resolver.DNSSEC = &core.DNSSECConfig{
+				TrustAnchors:       anchors,
+				AllowIndeterminate: c.VA.DNSSEC.AllowIndeterminate,
+			}
+		}
+		vai.DNSResolver = resolver
+		vai.AllowLoopbackAddresses = c.Common.DNSAllowLoopbackAddresses
+		if c.Common.DNSCacheMaxTTL != "" {
+			maxTTL, err := time.ParseDuration(c.Common.DNSCacheMaxTTL)
+			cmd.FailOnError(err, "Couldn't parse DNS cache max TTL")
+			cache := core.NewCachingDNSResolver(clock.Default(), resolver, maxTTL, stats)
+			cache.BypassCAA = c.Common.DNSCacheBypassCAA
+			// Validations must see the records as they are now, not as
+			// they were when an earlier validation looked them up
+			cache.BypassValidation = true
+			vai.DNSResolver = cache
 		}
 		vai.UserAgent = c.VA.UserAgent
+		vai.IssuerDomain = c.VA.IssuerDomain
+		if c.VA.SendIodefReports {
+			mailer := mail.New(c.Mailer.Server, c.Mailer.Port, c.Mailer.Username, c.Mailer.Password)
+			vai.Mailer = &mailer
+		}
+		// Each perspective, counting this VA, can only be counted once, so a
+		// larger quorum could never be reached and every validation would fail.
+		if c.VA.Quorum < 0 || c.VA.Quorum > len(c.VA.RemoteVAs)+1 {
+			cmd.FailOnError(
+				fmt.Errorf("quorum is %d but there are only %d perspectives", c.VA.Quorum, len(c.VA.RemoteVAs)+1),
+				"Invalid VA quorum")
+		}
+		vai.Quorum = c.VA.Quorum
+
+		queueConfig := va.QueueConfig{
+			Workers:     c.VA.ValidationQueue.Workers,
+			Size:        c.VA.ValidationQueue.QueueSize,
+			MaxAttempts: c.VA.ValidationQueue.MaxAttempts,
+			JournalDir:  c.VA.ValidationQueue.JournalDir,
+		}
+		if c.VA.ValidationQueue.RetryBackoff != "" {
+			queueConfig.Backoff, err = time.ParseDuration(c.VA.ValidationQueue.RetryBackoff)
+			cmd.FailOnError(err, "Couldn't parse validation retry backoff")
+		}
+		if c.VA.ValidationQueue.JobTimeout != "" {
+			queueConfig.JobTimeout, err = time.ParseDuration(c.VA.ValidationQueue.JobTimeout)
+			cmd.FailOnError(err, "Couldn't parse validation job timeout")
+		}
+		var startWorkers sync.Once
 
 		connectionHandler := func(srv *rpc.AmqpRPCServer) {
 			raRPC, err := rpc.NewAmqpRPCClient("VA->RA", c.AMQP.RA.Server, srv.Channel)
@@ -67,7 +125,25 @@ func main() {
 			rac, err := rpc.NewRegistrationAuthorityClient(raRPC)
 			cmd.FailOnError(err, "Unable to create RA client")
 
-			vai.RA = &rac
+			var remotes []va.RemoteVA
+			for _, server := range c.VA.RemoteVAs {
+				remoteRPC, err := rpc.NewAmqpRPCClient("VA->RemoteVA", server, srv.Channel)
+				cmd.FailOnError(err, "Unable to create RPC client")
+
+				rvac, err := rpc.NewValidationAuthorityClient(remoteRPC)
+				cmd.FailOnError(err, "Unable to create remote VA client")
+
+				remotes = append(remotes, va.RemoteVA{ValidationAuthority: rvac, Name: server})
+			}
+			// Workers may be using the old clients, so they're swapped under
+			// the VA's lock
+			vai.SetClients(&rac, remotes)
+
+			// Workers report to the RA, so they can only start once it's set
+			startWorkers.Do(func() {
+				err := vai.StartWorkers(queueConfig, stats)
+				cmd.FailOnError(err, "Unable to start validation workers")
+			})
 		}
 
 		vas, err := rpc.NewAmqpRPCServer(c.AMQP.VA.Server, connectionHandler)
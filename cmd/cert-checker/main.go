@@ -24,6 +24,7 @@ import (
 
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/lint"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/policy"
 	"github.com/letsencrypt/boulder/sa"
@@ -73,17 +74,26 @@ type certChecker struct {
 	clock        clock.Clock
 	rMu          *sync.Mutex
 	issuedReport report
+	lints        *lint.Registry
+	lintConfig   lint.Config
 }
 
-func newChecker(saDbMap *gorp.DbMap, paDbMap *gorp.DbMap, clk clock.Clock, enforceWhitelist bool) certChecker {
+func newChecker(saDbMap *gorp.DbMap, paDbMap *gorp.DbMap, clk clock.Clock, enforceWhitelist bool, suffixes *policy.SuffixList) certChecker {
 	pa, err := policy.NewPolicyAuthorityImpl(paDbMap, enforceWhitelist)
 	cmd.FailOnError(err, "Failed to create PA")
+	if suffixes != nil {
+		pa.Suffixes = suffixes
+	}
 	c := certChecker{
 		pa:    pa,
 		dbMap: saDbMap,
 		certs: make(chan core.Certificate, batchSize),
 		rMu:   new(sync.Mutex),
 		clock: clk,
+		lints: lint.DefaultRegistry,
+		lintConfig: lint.Config{
+			MaxValidity: checkPeriod,
+		},
 	}
 	c.issuedReport.Entries = make(map[string]reportEntry)
 
@@ -167,19 +177,15 @@ func (c *certChecker) checkCert(cert core.Certificate) (problems []string) {
 		if !parsedCert.NotAfter.Equal(cert.Expires) {
 			problems = append(problems, "Stored expiration doesn't match certificate NotAfter")
 		}
-		// Check basic constraints are set
-		if !parsedCert.BasicConstraintsValid {
-			problems = append(problems, "Certificate doesn't have basic constraints set")
-		}
-		// Check the cert isn't able to sign other certificates
-		if parsedCert.IsCA {
-			problems = append(problems, "Certificate can sign other certificates")
+		// Check the cert passes the same lints the CA runs before issuance,
+		// which cover basic constraints, key usage and a validity period no
+		// longer than checkPeriod
+		for _, f := range lint.Errors(c.lints.Run(parsedCert, c.lintConfig)) {
+			problems = append(problems, fmt.Sprintf("Certificate failed lint %s", f))
 		}
 		// Check the cert has the correct validity period
 		validityPeriod := parsedCert.NotAfter.Sub(parsedCert.NotBefore)
-		if validityPeriod > checkPeriod {
-			problems = append(problems, fmt.Sprintf("Certificate has a validity period longer than %s", checkPeriod))
-		} else if validityPeriod < checkPeriod {
+		if validityPeriod < checkPeriod {
 			problems = append(problems, fmt.Sprintf("Certificate has a validity period shorter than %s", checkPeriod))
 		}
 
@@ -187,16 +193,14 @@ func (c *certChecker) checkCert(cert core.Certificate) (problems []string) {
 			problems = append(problems, "Stored issuance date is outside of 6 hour window of certificate NotBefore")
 		}
 
-		// Check that the PA is still willing to issue for each name in DNSNames + CommonName
-		for _, name := range append(parsedCert.DNSNames, parsedCert.Subject.CommonName) {
-			if err = c.pa.WillingToIssue(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}); err != nil {
-				problems = append(problems, fmt.Sprintf("Policy Authority isn't willing to issue for %s: %s", name, err))
+		// Check that the PA is still willing to issue for each name in DNSNames,
+		// IPAddresses and CommonName
+		names, ips := core.SubjectNames(parsedCert.Subject.CommonName, parsedCert.DNSNames, parsedCert.IPAddresses)
+		for _, identifier := range core.NameIdentifiers(names, ips) {
+			if err = c.pa.WillingToIssue(identifier, cert.RegistrationID); err != nil {
+				problems = append(problems, fmt.Sprintf("Policy Authority isn't willing to issue for %s: %s", identifier.Value, err))
 			}
 		}
-		// Check the cert has the correct key usage extensions
-		if !core.CmpExtKeyUsageSlice(parsedCert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}) {
-			problems = append(problems, "Certificate has incorrect key usage extensions")
-		}
 	}
 	return problems
 }
@@ -241,11 +245,13 @@ func main() {
 
 		saDbMap, err := sa.NewDbMap(c.CertChecker.DBConnect)
 		cmd.FailOnError(err, "Could not connect to database")
+		cmd.CheckSchemaVersion(saDbMap, "sa")
 
 		paDbMap, err := sa.NewDbMap(c.PA.DBConnect)
 		cmd.FailOnError(err, "Could not connect to policy database")
+		cmd.CheckSchemaVersion(paDbMap, "policy")
 
-		checker := newChecker(saDbMap, paDbMap, clock.Default(), c.PA.EnforcePolicyWhitelist)
+		checker := newChecker(saDbMap, paDbMap, clock.Default(), c.PA.EnforcePolicyWhitelist, cmd.LoadPublicSuffixList(c.PA))
 		auditlogger.Info("# Getting certificates issued in the last 90 days")
 
 		// Since we grab certificates in batches we don't want this to block, when it
@@ -52,7 +52,7 @@ func BenchmarkCheckCert(b *testing.B) {
 		fmt.Printf("Failed to truncate tables: %s\n", err)
 	}()
 
-	checker := newChecker(saDbMap, paDbMap, clock.Default(), false)
+	checker := newChecker(saDbMap, paDbMap, clock.Default(), false, nil)
 	testKey, _ := rsa.GenerateKey(rand.Reader, 1024)
 	expiry := time.Now().AddDate(0, 0, 1)
 	serial := big.NewInt(1337)
@@ -94,7 +94,7 @@ func TestCheckCert(t *testing.T) {
 	fc := clock.NewFake()
 	fc.Add(time.Hour * 24 * 90)
 
-	checker := newChecker(saDbMap, paDbMap, fc, false)
+	checker := newChecker(saDbMap, paDbMap, fc, false, nil)
 
 	issued := checker.clock.Now().Add(-time.Hour * 24 * 45)
 	goodExpiry := issued.Add(checkPeriod)
@@ -103,6 +103,7 @@ func TestCheckCert(t *testing.T) {
 	//   Expiry period is too long
 	//   Basic Constraints aren't set
 	//   Wrong key usage (none)
+	//   CommonName isn't one of the SANs
 	rawCert := x509.Certificate{
 		Subject: pkix.Name{
 			CommonName: "example.com",
@@ -128,7 +129,7 @@ func TestCheckCert(t *testing.T) {
 
 	problems := checker.checkCert(cert)
 	fmt.Println(strings.Join(problems, "\n"))
-	test.AssertEquals(t, len(problems), 7)
+	test.AssertEquals(t, len(problems), 8)
 
 	// Fix the problems
 	rawCert.Subject.CommonName = "example-a.com"
@@ -155,7 +156,7 @@ func TestGetAndProcessCerts(t *testing.T) {
 	test.AssertNotError(t, err, "Couldn't connect to policy database")
 	fc := clock.NewFake()
 
-	checker := newChecker(saDbMap, paDbMap, fc, false)
+	checker := newChecker(saDbMap, paDbMap, fc, false, nil)
 	sa, err := sa.NewSQLStorageAuthority(saDbMap, fc)
 	test.AssertNotError(t, err, "Couldn't create SA to insert certificates")
 	saCleanUp := test.ResetTestDatabase(t, saDbMap.Db)
@@ -0,0 +1,413 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+const defaultBatchSize = 1000
+
+// pruneJob describes a kind of row that is deleted once it's older than the
+// retention period.
+type pruneJob struct {
+	// name identifies the job in logs and stats
+	name string
+	// table and key are the table rows are deleted from, and its key column
+	table string
+	key   string
+	// The keys of rows to delete are selected with
+	// "SELECT <keyExpr> FROM <from>", where from has a single placeholder
+	// for the cut-off time.
+	keyExpr string
+	from    string
+	// children are rows in other tables that refer to a deleted row's key,
+	// and are deleted along with it.
+	children  []childRows
+	retention time.Duration
+}
+
+// childRows are the rows of table whose column holds a key of another table.
+type childRows struct {
+	table  string
+	column string
+}
+
+// pruneJobs lists the jobs with a retention period set in config.
+func pruneJobs(config cmd.Config) ([]pruneJob, error) {
+	c := config.DBPruner
+	challenges := []childRows{{table: "challenges", column: "authorizationID"}}
+	jobs := []struct {
+		retention string
+		job       pruneJob
+	}{
+		{c.PendingAuthzRetention, pruneJob{
+			name:     "PendingAuthz",
+			table:    "pendingAuthorizations",
+			key:      "id",
+			keyExpr:  "id",
+			from:     "pendingAuthorizations WHERE expires < ?",
+			children: challenges,
+		}},
+		{c.AuthzRetention, pruneJob{
+			name:     "Authz",
+			table:    "authz",
+			key:      "id",
+			keyExpr:  "id",
+			from:     "authz WHERE expires < ?",
+			children: challenges,
+		}},
+		// The OCSP responder serves the newest response for each
+		// certificate, so the ones before it are no longer used.
+		{c.OCSPRetention, pruneJob{
+			name:    "SupersededOCSP",
+			table:   "ocspResponses",
+			key:     "id",
+			keyExpr: "o.id",
+			from: `ocspResponses AS o WHERE EXISTS (
+				SELECT 1 FROM ocspResponses AS n WHERE n.serial = o.serial AND n.id > o.id AND n.createdAt < ?)`,
+		}},
+		{c.ExpiredCertRetention, pruneJob{
+			name:     "ExpiredCertStatus",
+			table:    "certificateStatus",
+			key:      "serial",
+			keyExpr:  "cs.serial",
+			from:     "certificateStatus AS cs JOIN certificates AS c ON cs.serial = c.serial WHERE c.expires < ?",
+			children: []childRows{{table: "ocspResponses", column: "serial"}},
+		}},
+	}
+
+	var enabled []pruneJob
+	for _, j := range jobs {
+		if j.retention == "" {
+			continue
+		}
+		retention, err := time.ParseDuration(j.retention)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid retention for %s: %s", j.job.name, err)
+		}
+		j.job.retention = retention
+		enabled = append(enabled, j.job)
+	}
+	return enabled, nil
+}
+
+// archiver saves rows before they are deleted.
+type archiver interface {
+	archive(table string, rows []map[string]interface{}) error
+}
+
+// fileArchiver appends rows as lines of JSON to a file for each table and
+// day in dir.
+type fileArchiver struct {
+	dir string
+	clk clock.Clock
+}
+
+func (a fileArchiver) archive(table string, rows []map[string]interface{}) error {
+	name := filepath.Join(a.dir, fmt.Sprintf("%s-%s.json", table, a.clk.Now().UTC().Format("2006-01-02")))
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, row := range rows {
+		if err = encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	// The rows are about to be deleted, so make sure they're on disk
+	return file.Sync()
+}
+
+type pruner struct {
+	stats         statsd.Statter
+	log           *blog.AuditLogger
+	db            *sql.DB
+	clk           clock.Clock
+	sleep         func(time.Duration)
+	batchSize     int
+	batchInterval time.Duration
+	// archive is nil if rows aren't archived
+	archive archiver
+	dryRun  bool
+}
+
+// run deletes the rows each job selects, or in a dry run, counts them.
+func (p *pruner) run(jobs []pruneJob) error {
+	for _, job := range jobs {
+		cutoff := p.clk.Now().Add(-job.retention)
+		if p.dryRun {
+			count, err := p.count(job, cutoff)
+			if err != nil {
+				p.stats.Inc(fmt.Sprintf("DBPruner.%s.Errors", job.name), 1, 1.0)
+				return err
+			}
+			p.stats.Gauge(fmt.Sprintf("DBPruner.%s.Eligible", job.name), count, 1.0)
+			p.log.Info(fmt.Sprintf("db-pruner: %s: would delete %d rows from %s%s",
+				job.name, count, job.table, childDescription(job)))
+			continue
+		}
+
+		deleted, err := p.prune(job, cutoff)
+		p.log.Notice(fmt.Sprintf("db-pruner: %s: deleted %d rows from %s%s",
+			job.name, deleted, job.table, childDescription(job)))
+		if err != nil {
+			p.stats.Inc(fmt.Sprintf("DBPruner.%s.Errors", job.name), 1, 1.0)
+			return err
+		}
+	}
+	return nil
+}
+
+func childDescription(job pruneJob) string {
+	if len(job.children) == 0 {
+		return ""
+	}
+	tables := make([]string, len(job.children))
+	for i, child := range job.children {
+		tables[i] = child.table
+	}
+	return fmt.Sprintf(" with their %s", strings.Join(tables, ", "))
+}
+
+func (p *pruner) count(job pruneJob, cutoff time.Time) (int64, error) {
+	var count int64
+	err := p.db.QueryRow("SELECT COUNT(*) FROM "+job.from, cutoff).Scan(&count)
+	return count, err
+}
+
+// prune deletes the rows job selects in batches, pausing between them, and
+// returns the number of rows deleted from job.table.
+func (p *pruner) prune(job pruneJob, cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		start := p.clk.Now()
+		deleted, err := p.pruneBatch(job, cutoff)
+		total += int64(deleted)
+		if err != nil {
+			return total, err
+		}
+		p.stats.TimingDuration(fmt.Sprintf("DBPruner.%s.BatchTime", job.name), p.clk.Now().Sub(start), 1.0)
+		p.stats.Inc(fmt.Sprintf("DBPruner.%s.Deleted", job.name), int64(deleted), 1.0)
+		if deleted < p.batchSize {
+			return total, nil
+		}
+		p.sleep(p.batchInterval)
+	}
+}
+
+// pruneBatch deletes up to p.batchSize of the rows job selects, and their
+// children, in a transaction, archiving them first if p.archive is set.
+func (p *pruner) pruneBatch(job pruneJob, cutoff time.Time) (int, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	keys, err := selectKeys(tx, job, cutoff, p.batchSize)
+	if err != nil || len(keys) == 0 {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, child := range job.children {
+		if err = p.deleteRows(tx, child.table, child.column, keys); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if err = p.deleteRows(tx, job.table, job.key, keys); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+func selectKeys(tx *sql.Tx, job pruneJob, cutoff time.Time, limit int) ([]interface{}, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT %s FROM %s LIMIT ?", job.keyExpr, job.from), cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []interface{}
+	for rows.Next() {
+		var key interface{}
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// deleteRows deletes the rows of table whose column is one of keys.
+func (p *pruner) deleteRows(tx *sql.Tx, table, column string, keys []interface{}) error {
+	where := fmt.Sprintf("%s WHERE %s IN (%s)", table, column, placeholders(len(keys)))
+	if p.archive != nil {
+		rows, err := selectRows(tx, "SELECT * FROM "+where, keys)
+		if err != nil {
+			return err
+		}
+		if err = p.archive.archive(table, rows); err != nil {
+			return err
+		}
+		p.stats.Inc(fmt.Sprintf("DBPruner.Archived.%s", table), int64(len(rows)), 1.0)
+	}
+
+	result, err := tx.Exec("DELETE FROM "+where, keys...)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	p.stats.Inc(fmt.Sprintf("DBPruner.Deleted.%s", table), deleted, 1.0)
+	return nil
+}
+
+// selectRows returns each row query selects as a map from column name to
+// value. Text is returned as strings rather than bytes so that it's
+// readable once encoded as JSON.
+func selectRows(tx *sql.Tx, query string, args []interface{}) ([]map[string]interface{}, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var results []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok && utf8.Valid(b) {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		results = append(results, row)
+	}
+	return results, rows.Err()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func main() {
+	app := cmd.NewAppShell("db-pruner", "Deletes expired and superseded rows from the SA database")
+
+	app.App.Flags = append(app.App.Flags,
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Count the rows that would be deleted without deleting them",
+		},
+		cli.IntFlag{
+			Name:  "batch-size",
+			Usage: "Count of rows to delete per transaction, overriding the config",
+		})
+
+	var dryRun bool
+	app.Config = func(c *cli.Context, config cmd.Config) cmd.Config {
+		dryRun = c.GlobalBool("dry-run")
+		if c.GlobalInt("batch-size") > 0 {
+			config.DBPruner.BatchSize = c.GlobalInt("batch-size")
+		}
+		return config
+	}
+
+	app.Action = func(c cmd.Config) {
+		// Set up logging
+		stats, err := statsd.NewClient(c.Statsd.Server, c.Statsd.Prefix)
+		cmd.FailOnError(err, "Couldn't connect to statsd")
+
+		auditlogger, err := blog.Dial(c.Syslog.Network, c.Syslog.Server, c.Syslog.Tag, stats)
+		cmd.FailOnError(err, "Could not connect to Syslog")
+
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		defer auditlogger.AuditPanic()
+
+		blog.SetAuditLogger(auditlogger)
+
+		auditlogger.Info(app.VersionString())
+
+		go cmd.DebugServer(c.DBPruner.DebugAddr)
+
+		jobs, err := pruneJobs(c)
+		cmd.FailOnError(err, "Couldn't parse retention periods")
+
+		batchSize := c.DBPruner.BatchSize
+		if batchSize <= 0 {
+			batchSize = defaultBatchSize
+		}
+		var batchInterval time.Duration
+		if c.DBPruner.BatchInterval != "" {
+			batchInterval, err = time.ParseDuration(c.DBPruner.BatchInterval)
+			cmd.FailOnError(err, "Couldn't parse batch interval")
+		}
+
+		// Configure DB
+		dbMap, err := sa.NewDbMap(c.DBPruner.DBConnect)
+		cmd.FailOnError(err, "Could not connect to database")
+		cmd.CheckSchemaVersion(dbMap, "sa")
+
+		p := pruner{
+			stats:         stats,
+			log:           auditlogger,
+			db:            dbMap.Db,
+			clk:           clock.Default(),
+			sleep:         time.Sleep,
+			batchSize:     batchSize,
+			batchInterval: batchInterval,
+			dryRun:        dryRun,
+		}
+		if c.DBPruner.ArchiveDir != "" {
+			p.archive = fileArchiver{dir: c.DBPruner.ArchiveDir, clk: p.clk}
+		}
+
+		auditlogger.Info("db-pruner: Starting")
+		err = p.run(jobs)
+		cmd.FailOnError(err, "Couldn't prune database")
+	}
+
+	app.Run()
+}
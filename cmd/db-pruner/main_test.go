@@ -0,0 +1,183 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/sa/satest"
+	"github.com/letsencrypt/boulder/test"
+)
+
+const dbConnStr = "mysql+tcp://boulder@localhost:3306/boulder_sa_test"
+
+func TestPruneJobs(t *testing.T) {
+	var config cmd.Config
+	config.DBPruner.AuthzRetention = "720h"
+	config.DBPruner.OCSPRetention = "48h"
+	jobs, err := pruneJobs(config)
+	test.AssertNotError(t, err, "Couldn't parse retention periods")
+	test.AssertEquals(t, len(jobs), 2)
+	test.AssertEquals(t, jobs[0].name, "Authz")
+	test.AssertEquals(t, jobs[0].retention, 720*time.Hour)
+	test.AssertEquals(t, jobs[1].name, "SupersededOCSP")
+
+	config.DBPruner.ExpiredCertRetention = "90 days"
+	_, err = pruneJobs(config)
+	test.AssertError(t, err, "Parsed an invalid retention period")
+}
+
+func TestFileArchiver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-pruner")
+	test.AssertNotError(t, err, "Couldn't create archive directory")
+	defer os.RemoveAll(dir)
+
+	fc := clock.NewFake()
+	fc.Add(time.Date(2015, 10, 14, 12, 0, 0, 0, time.UTC).Sub(fc.Now()))
+	a := fileArchiver{dir: dir, clk: fc}
+	err = a.archive("authz", []map[string]interface{}{{"id": "a"}})
+	test.AssertNotError(t, err, "Couldn't archive rows")
+	err = a.archive("authz", []map[string]interface{}{{"id": "b"}})
+	test.AssertNotError(t, err, "Couldn't archive rows")
+
+	file, err := os.Open(filepath.Join(dir, "authz-2015-10-14.json"))
+	test.AssertNotError(t, err, "Archive file wasn't created")
+	defer file.Close()
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var row map[string]string
+		test.AssertNotError(t, json.Unmarshal(scanner.Bytes(), &row), "Archived row isn't JSON")
+		ids = append(ids, row["id"])
+	}
+	test.AssertDeepEquals(t, ids, []string{"a", "b"})
+}
+
+type recordingArchiver map[string]int
+
+func (a recordingArchiver) archive(table string, rows []map[string]interface{}) error {
+	a[table] += len(rows)
+	return nil
+}
+
+func TestPrune(t *testing.T) {
+	dbMap, err := sa.NewDbMap(dbConnStr)
+	if err != nil {
+		t.Fatalf("Couldn't connect the database: %s", err)
+	}
+	fc := clock.NewFake()
+	fc.Add(time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC).Sub(fc.Now()))
+	ssa, err := sa.NewSQLStorageAuthority(dbMap, fc)
+	if err != nil {
+		t.Fatalf("unable to create SQLStorageAuthority: %s", err)
+	}
+	cleanUp := test.ResetTestDatabase(t, dbMap.Db)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, ssa)
+	newAuthz := func(expires time.Time, final bool) string {
+		authz, err := ssa.NewPendingAuthorization(core.Authorization{
+			RegistrationID: reg.ID,
+			Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"},
+			Status:         core.StatusPending,
+			Expires:        &expires,
+			Challenges:     []core.Challenge{core.Challenge{Type: core.ChallengeTypeHTTP01, Status: core.StatusPending, Token: core.NewToken()}},
+		})
+		test.AssertNotError(t, err, "Couldn't create pending authorization")
+		if final {
+			authz.Status = core.StatusValid
+			test.AssertNotError(t, ssa.FinalizeAuthorization(authz), "Couldn't finalize authorization")
+		}
+		return authz.ID
+	}
+	now := fc.Now()
+	expiredPending := newAuthz(now.Add(-time.Hour), false)
+	newAuthz(now.Add(time.Hour), false)
+	oldAuthz := newAuthz(now.Add(-48*time.Hour), true)
+	newAuthz(now.Add(-time.Hour), true)
+
+	// test-cert.der expired in April 2016
+	certDER, err := ioutil.ReadFile("../../sa/test-cert.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = ssa.AddCertificate(certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.der")
+	expiredSerial := "ff00000000000002238054509817da5a"
+
+	addOCSP := func(serial string, age time.Duration) {
+		err := dbMap.Insert(&core.OCSPResponse{Serial: serial, CreatedAt: now.Add(-age), Response: []byte{1}})
+		test.AssertNotError(t, err, "Couldn't add OCSP response")
+	}
+	addOCSP(expiredSerial, 1000*time.Hour)
+	// The first response was superseded long enough ago to be pruned, the
+	// second only recently, and the third is current.
+	addOCSP("00aa", 240*time.Hour)
+	addOCSP("00aa", 216*time.Hour)
+	addOCSP("00aa", time.Hour)
+
+	var config cmd.Config
+	config.DBPruner.PendingAuthzRetention = "0s"
+	config.DBPruner.AuthzRetention = "24h"
+	config.DBPruner.OCSPRetention = "48h"
+	config.DBPruner.ExpiredCertRetention = "24h"
+	jobs, err := pruneJobs(config)
+	test.AssertNotError(t, err, "Couldn't parse retention periods")
+
+	stats, _ := statsd.NewNoopClient(nil)
+	sleeps := 0
+	archived := recordingArchiver{}
+	p := &pruner{
+		stats:     stats,
+		log:       blog.GetAuditLogger(),
+		db:        dbMap.Db,
+		clk:       fc,
+		sleep:     func(time.Duration) { sleeps++ },
+		batchSize: 1,
+		archive:   archived,
+		dryRun:    true,
+	}
+
+	countRows := func(query string, args ...interface{}) int64 {
+		count, err := dbMap.SelectInt(query, args...)
+		test.AssertNotError(t, err, "Couldn't count rows")
+		return count
+	}
+	test.AssertNotError(t, p.run(jobs), "Dry run failed")
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM pendingAuthorizations"), int64(2))
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM authz"), int64(2))
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM ocspResponses"), int64(4))
+	test.AssertEquals(t, len(archived), 0)
+
+	p.dryRun = false
+	test.AssertNotError(t, p.run(jobs), "Pruning failed")
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM pendingAuthorizations WHERE id = ?", expiredPending), int64(0))
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM pendingAuthorizations"), int64(1))
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM authz WHERE id = ?", oldAuthz), int64(0))
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM authz"), int64(1))
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM challenges"), int64(2))
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM ocspResponses WHERE serial = '00aa'"), int64(2))
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM certificateStatus"), int64(0))
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM ocspResponses WHERE serial = ?", expiredSerial), int64(0))
+	// Certificates themselves are kept
+	test.AssertEquals(t, countRows("SELECT COUNT(*) FROM certificates"), int64(1))
+
+	test.AssertEquals(t, archived["challenges"], 2)
+	test.AssertEquals(t, archived["ocspResponses"], 2)
+	test.AssertEquals(t, archived["certificateStatus"], 1)
+	// Each job with a full batch of 1 row pauses before looking for more
+	test.AssertEquals(t, sleeps, 4)
+}
@@ -244,6 +244,7 @@ func main() {
 		// Configure DB
 		dbMap, err := sa.NewDbMap(c.Mailer.DBConnect)
 		cmd.FailOnError(err, "Could not connect to database")
+		cmd.CheckSchemaVersion(dbMap, "sa")
 
 		ch, err := rpc.AmqpChannel(c)
 		cmd.FailOnError(err, "Could not connect to AMQP")
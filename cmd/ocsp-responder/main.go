@@ -139,6 +139,7 @@ func main() {
 		// Configure DB
 		dbMap, err := sa.NewDbMap(c.OCSPResponder.DBConnect)
 		cmd.FailOnError(err, "Could not connect to database")
+		cmd.CheckSchemaVersion(dbMap, "sa")
 		sa.SetSQLDebug(dbMap, c.SQL.SQLDebug)
 
 		// Load the CA's key so we can store its AuthorityKeyId in the DB
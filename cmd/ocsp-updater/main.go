@@ -154,9 +154,9 @@ func (updater *OCSPUpdater) findStaleResponses(oldestLastUpdatedTime time.Time,
 	var certificateStatus []core.CertificateStatus
 	_, err := updater.dbMap.Select(&certificateStatus,
 		`SELECT cs.* FROM certificateStatus AS cs JOIN certificates AS cert ON cs.serial = cert.serial
-		 WHERE cs.ocspLastUpdated < ? AND cert.expires > now()
+		 WHERE cs.ocspLastUpdated < ? AND cert.expires > ?
 		 ORDER BY cs.ocspLastUpdated ASC
-		 LIMIT ?`, oldestLastUpdatedTime, responseLimit)
+		 LIMIT ?`, oldestLastUpdatedTime, time.Now(), responseLimit)
 
 	if err == sql.ErrNoRows {
 		updater.log.Info("All up to date. No OCSP responses needed.")
@@ -216,6 +216,7 @@ func main() {
 		// Configure DB
 		dbMap, err := sa.NewDbMap(c.OCSPUpdater.DBConnect)
 		cmd.FailOnError(err, "Could not connect to database")
+		cmd.CheckSchemaVersion(dbMap, "sa")
 
 		cac, closeChan := setupClients(c)
 
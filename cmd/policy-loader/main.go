@@ -9,13 +9,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
 	_ "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/go-sql-driver/mysql"
 	"github.com/letsencrypt/boulder/sa"
 
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/policy"
 )
 
@@ -50,17 +55,7 @@ func main() {
 				padb, ruleFile := setupFromContext(c)
 				ruleSet, err := padb.DumpRules()
 				cmd.FailOnError(err, "Couldn't retrieve whitelist rules")
-				var rules struct {
-					Blacklist []string
-					Whitelist []string
-				}
-				for _, r := range ruleSet.Blacklist {
-					rules.Blacklist = append(rules.Blacklist, r.Host)
-				}
-				for _, r := range ruleSet.Whitelist {
-					rules.Whitelist = append(rules.Whitelist, r.Host)
-				}
-				rulesJSON, err := json.Marshal(rules)
+				rulesJSON, err := json.MarshalIndent(ruleSet, "", "  ")
 				cmd.FailOnError(err, "Couldn't marshal rule list")
 				err = ioutil.WriteFile(ruleFile, rulesJSON, os.ModePerm)
 				cmd.FailOnError(err, "Failed to write the rule file")
@@ -80,10 +75,12 @@ func main() {
 				cmd.FailOnError(err, "Couldn't unmarshal rules list")
 				rs := policy.RuleSet{}
 				for _, r := range rules.Blacklist {
-					rs.Blacklist = append(rs.Blacklist, policy.BlacklistRule{Host: r})
+					blRule, err := r.BlacklistRule()
+					cmd.FailOnError(err, "Invalid blacklist rule")
+					rs.Blacklist = append(rs.Blacklist, blRule)
 				}
 				for _, r := range rules.Whitelist {
-					rs.Whitelist = append(rs.Whitelist, policy.WhitelistRule{Host: r})
+					rs.Whitelist = append(rs.Whitelist, policy.WhitelistRule(r))
 				}
 
 				err = padb.LoadRules(rs)
@@ -92,24 +89,452 @@ func main() {
 				fmt.Println("# Loaded whitelist and blacklist into database")
 			},
 		},
+		cli.Command{
+			Name:  "add-rule",
+			Usage: "Add a rule to the whitelist or blacklist, replacing any rule for the same host",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "list",
+					Value: "blacklist",
+					Usage: "List to add the rule to, blacklist or whitelist",
+				},
+				cli.StringFlag{
+					Name:  "host",
+					Usage: "Host the rule applies to",
+				},
+				cli.StringFlag{
+					Name:  "reason",
+					Usage: "Why the rule is being added",
+				},
+				cli.StringFlag{
+					Name:   "added-by",
+					EnvVar: "USER",
+					Usage:  "Who is adding the rule",
+				},
+				cli.StringFlag{
+					Name:  "expires",
+					Usage: "RFC 3339 time after which the rule no longer applies",
+				},
+				cli.IntFlag{
+					Name:  "registration-id",
+					Usage: "Only whitelist the host for this registration",
+				},
+				cli.StringFlag{
+					Name:  "group",
+					Usage: "Only whitelist the host for registrations in this group",
+				},
+			},
+			Action: func(c *cli.Context) {
+				padb := setupDBFromContext(c)
+				host := c.String("host")
+				if host == "" {
+					fmt.Println("host argument is required")
+					os.Exit(1)
+				}
+				rule := policy.RawRule{
+					Host:    host,
+					AddedBy: c.String("added-by"),
+					Reason:  c.String("reason"),
+
+					RegistrationID: int64(c.Int("registration-id")),
+					Group:          c.String("group"),
+				}
+				if c.String("expires") != "" {
+					expires, err := time.Parse(time.RFC3339, c.String("expires"))
+					cmd.FailOnError(err, "Couldn't parse expiry time")
+					rule.Expires = &expires
+				}
+
+				var err error
+				switch c.String("list") {
+				case "blacklist":
+					var blRule policy.BlacklistRule
+					blRule, err = rule.BlacklistRule()
+					cmd.FailOnError(err, "Invalid blacklist rule")
+					err = padb.AddBlacklistRule(blRule)
+				case "whitelist":
+					err = padb.AddWhitelistRule(policy.WhitelistRule(rule))
+				default:
+					fmt.Println("list argument must be blacklist or whitelist")
+					os.Exit(1)
+				}
+				cmd.FailOnError(err, "Couldn't add rule")
+				fmt.Printf("# Added %s to the %s\n", host, c.String("list"))
+			},
+		},
+		cli.Command{
+			Name:  "remove-rule",
+			Usage: "Remove the rule for a host from the whitelist or blacklist",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "list",
+					Value: "blacklist",
+					Usage: "List to remove the rule from, blacklist or whitelist",
+				},
+				cli.StringFlag{
+					Name:  "host",
+					Usage: "Host the rule applies to",
+				},
+				cli.IntFlag{
+					Name:  "registration-id",
+					Usage: "Registration the whitelist rule is limited to, if any",
+				},
+				cli.StringFlag{
+					Name:  "group",
+					Usage: "Group the whitelist rule is limited to, if any",
+				},
+				cli.StringFlag{
+					Name:   "removed-by",
+					EnvVar: "USER",
+					Usage:  "Who is removing the rule",
+				},
+			},
+			Action: func(c *cli.Context) {
+				padb := setupDBFromContext(c)
+				host := c.String("host")
+				if host == "" {
+					fmt.Println("host argument is required")
+					os.Exit(1)
+				}
+
+				var err error
+				switch c.String("list") {
+				case "blacklist":
+					err = padb.RemoveBlacklistRule(host, c.String("removed-by"))
+				case "whitelist":
+					err = padb.RemoveWhitelistRule(host, int64(c.Int("registration-id")), c.String("group"), c.String("removed-by"))
+				default:
+					fmt.Println("list argument must be blacklist or whitelist")
+					os.Exit(1)
+				}
+				cmd.FailOnError(err, "Couldn't remove rule")
+				fmt.Printf("# Removed %s from the %s\n", host, c.String("list"))
+			},
+		},
+		cli.Command{
+			Name:  "add-group-member",
+			Usage: "Add a registration to a group, so whitelist rules for the group apply to it",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "group",
+					Usage: "Name of the group",
+				},
+				cli.IntFlag{
+					Name:  "registration-id",
+					Usage: "Registration to add",
+				},
+				cli.StringFlag{
+					Name:   "added-by",
+					EnvVar: "USER",
+					Usage:  "Who is adding the registration",
+				},
+			},
+			Action: func(c *cli.Context) {
+				padb := setupDBFromContext(c)
+				group, regID := groupMemberFromContext(c)
+				err := padb.AddGroupMember(group, regID, c.String("added-by"))
+				cmd.FailOnError(err, "Couldn't add registration to group")
+				fmt.Printf("# Added registration ID %d to group %s\n", regID, group)
+			},
+		},
+		cli.Command{
+			Name:  "remove-group-member",
+			Usage: "Remove a registration from a group",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "group",
+					Usage: "Name of the group",
+				},
+				cli.IntFlag{
+					Name:  "registration-id",
+					Usage: "Registration to remove",
+				},
+				cli.StringFlag{
+					Name:   "removed-by",
+					EnvVar: "USER",
+					Usage:  "Who is removing the registration",
+				},
+			},
+			Action: func(c *cli.Context) {
+				padb := setupDBFromContext(c)
+				group, regID := groupMemberFromContext(c)
+				err := padb.RemoveGroupMember(group, regID, c.String("removed-by"))
+				cmd.FailOnError(err, "Couldn't remove registration from group")
+				fmt.Printf("# Removed registration ID %d from group %s\n", regID, group)
+			},
+		},
+		cli.Command{
+			Name:  "list-groups",
+			Usage: "List the registrations in each group",
+			Action: func(c *cli.Context) {
+				padb := setupDBFromContext(c)
+				groups, err := padb.GroupMembers()
+				cmd.FailOnError(err, "Couldn't retrieve groups")
+				var names []string
+				for group := range groups {
+					names = append(names, group)
+				}
+				sort.Strings(names)
+				for _, group := range names {
+					fmt.Printf("%s: %v\n", group, groups[group])
+				}
+			},
+		},
+		cli.Command{
+			Name:  "add-review-rule",
+			Usage: "Hold names matching a regular expression for manual review, replacing any rule with the same pattern",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pattern",
+					Usage: "Regular expression matched anywhere in a name",
+				},
+				cli.StringFlag{
+					Name:  "reason",
+					Usage: "Why the rule is being added",
+				},
+				cli.StringFlag{
+					Name:   "added-by",
+					EnvVar: "USER",
+					Usage:  "Who is adding the rule",
+				},
+				cli.StringFlag{
+					Name:  "expires",
+					Usage: "RFC 3339 time after which the rule no longer applies",
+				},
+			},
+			Action: func(c *cli.Context) {
+				padb := setupDBFromContext(c)
+				pattern := c.String("pattern")
+				if pattern == "" {
+					fmt.Println("pattern argument is required")
+					os.Exit(1)
+				}
+				rule := policy.ReviewRule{
+					Pattern: pattern,
+					AddedBy: c.String("added-by"),
+					Reason:  c.String("reason"),
+				}
+				if c.String("expires") != "" {
+					expires, err := time.Parse(time.RFC3339, c.String("expires"))
+					cmd.FailOnError(err, "Couldn't parse expiry time")
+					rule.Expires = &expires
+				}
+
+				err := padb.AddReviewRule(rule)
+				cmd.FailOnError(err, "Couldn't add review rule")
+				fmt.Printf("# Added review rule %q\n", pattern)
+			},
+		},
+		cli.Command{
+			Name:  "remove-review-rule",
+			Usage: "Remove the review rule with a pattern",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pattern",
+					Usage: "Pattern of the rule to remove",
+				},
+				cli.StringFlag{
+					Name:   "removed-by",
+					EnvVar: "USER",
+					Usage:  "Who is removing the rule",
+				},
+			},
+			Action: func(c *cli.Context) {
+				padb := setupDBFromContext(c)
+				pattern := c.String("pattern")
+				if pattern == "" {
+					fmt.Println("pattern argument is required")
+					os.Exit(1)
+				}
+
+				err := padb.RemoveReviewRule(pattern, c.String("removed-by"))
+				cmd.FailOnError(err, "Couldn't remove review rule")
+				fmt.Printf("# Removed review rule %q\n", pattern)
+			},
+		},
+		cli.Command{
+			Name:  "list-review-rules",
+			Usage: "List the rules holding names for manual review",
+			Action: func(c *cli.Context) {
+				padb := setupDBFromContext(c)
+				rules, err := padb.ReviewRules()
+				cmd.FailOnError(err, "Couldn't retrieve review rules")
+				for _, rule := range rules {
+					fmt.Println(rule)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "explain",
+			Usage: "Show how the policy applies to a name or IP address without issuing anything",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "registration-id",
+					Usage: "Registration requesting the name, for scoped whitelist rules",
+				},
+			},
+			Action: func(c *cli.Context) {
+				name := c.Args().First()
+				if name == "" {
+					fmt.Println("a name to explain is required")
+					os.Exit(1)
+				}
+				id := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
+				if net.ParseIP(name) != nil {
+					id.Type = core.IdentifierIP
+				}
+
+				pa := setupPAFromContext(c)
+				e, err := pa.Explain(id, int64(c.Int("registration-id")))
+				cmd.FailOnError(err, "Couldn't look up policy rules")
+				printExplanation(e)
+			},
+		},
+		cli.Command{
+			Name:  "check-psl",
+			Usage: "Validate a public_suffix_list.dat file and show how it differs from the Public Suffix List in use",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "psl-file",
+					Usage: "Path to the new public_suffix_list.dat file",
+				},
+			},
+			Action: func(c *cli.Context) {
+				config := loadConfig(c)
+				pslFile := c.String("psl-file")
+				if pslFile == "" {
+					fmt.Println("psl-file argument is required")
+					os.Exit(1)
+				}
+				includePrivate := !config.PA.ExcludePrivateSuffixes
+
+				newRules, err := policy.LoadSuffixListFile(pslFile, includePrivate)
+				cmd.FailOnError(err, "New public suffix list is invalid")
+				currentRules := policy.EmbeddedSuffixRules()
+				current := "the compiled-in list"
+				if config.PA.PublicSuffixListFile != "" {
+					currentRules, err = policy.LoadSuffixListFile(config.PA.PublicSuffixListFile, includePrivate)
+					cmd.FailOnError(err, "Couldn't load the current public suffix list")
+					current = config.PA.PublicSuffixListFile
+				}
+
+				added, removed := policy.DiffSuffixRules(currentRules, newRules)
+				fmt.Printf("# %s is valid with %d rules; compared to %s, %d added and %d removed\n",
+					pslFile, len(newRules.Rules()), current, len(added), len(removed))
+				for _, rule := range added {
+					printSuffixRule("+", rule, newRules)
+				}
+				for _, rule := range removed {
+					printSuffixRule("-", rule, currentRules)
+				}
+			},
+		},
 	}...)
 
 	app.Run(os.Args)
 }
 
-func setupFromContext(context *cli.Context) (*policy.PolicyAuthorityDatabaseImpl, string) {
+func printSuffixRule(change, rule string, rules *policy.SuffixRules) {
+	if rules.IsPrivate(rule) {
+		fmt.Printf("%s %s (private)\n", change, rule)
+	} else {
+		fmt.Printf("%s %s\n", change, rule)
+	}
+}
+
+func printExplanation(e policy.Explanation) {
+	if e.Err != nil {
+		fmt.Printf("%s %s: refused: %s\n", e.Identifier.Type, e.Identifier.Value, e.Err)
+	} else {
+		fmt.Printf("%s %s: allowed\n", e.Identifier.Type, e.Identifier.Value)
+	}
+	if e.Identifier.Type == core.IdentifierDNS {
+		if e.PublicSuffix != "" {
+			fmt.Printf("public suffix: %s\n", e.PublicSuffix)
+		} else {
+			fmt.Println("public suffix: none")
+		}
+		if e.BlacklistRule != nil {
+			fmt.Printf("blacklist rule: %s\n", e.BlacklistRule)
+		} else {
+			fmt.Println("blacklist rule: none")
+		}
+	}
+	switch {
+	case e.WhitelistRule == nil:
+		fmt.Println("whitelist rule: none")
+	case e.WhitelistApplies:
+		fmt.Printf("whitelist rule: %s\n", e.WhitelistRule)
+	default:
+		fmt.Printf("whitelist rule: %s (doesn't apply to registration ID %d)\n", e.WhitelistRule, e.RegistrationID)
+	}
+	fmt.Printf("whitelist enforced: %t\n", e.WhitelistEnforced)
+	if e.ReviewRule != "" {
+		fmt.Printf("review rule: %q\n", e.ReviewRule)
+	}
+	for i, combination := range e.Combinations {
+		types := make([]string, len(combination))
+		for j, index := range combination {
+			types[j] = e.Challenges[index]
+		}
+		fmt.Printf("challenge combination %d: %s\n", i, strings.Join(types, " + "))
+	}
+}
+
+func groupMemberFromContext(c *cli.Context) (string, int64) {
+	group := c.String("group")
+	regID := int64(c.Int("registration-id"))
+	if group == "" || regID == 0 {
+		fmt.Println("group and registration-id arguments are required")
+		os.Exit(1)
+	}
+	return group, regID
+}
+
+func loadConfig(context *cli.Context) cmd.Config {
 	configFileName := context.GlobalString("config")
 	configJSON, err := ioutil.ReadFile(configFileName)
 	cmd.FailOnError(err, "Couldn't read configuration file")
 	var c cmd.Config
 	err = json.Unmarshal(configJSON, &c)
 	cmd.FailOnError(err, "Couldn't unmarshal configuration object")
+	return c
+}
+
+func setupDBFromContext(context *cli.Context) *policy.PolicyAuthorityDatabaseImpl {
+	c := loadConfig(context)
 
 	dbMap, err := sa.NewDbMap(c.PA.DBConnect)
 	cmd.FailOnError(err, "Failed to create DB map")
+	cmd.CheckSchemaVersion(dbMap, "policy")
 
 	padb, err := policy.NewPolicyAuthorityDatabaseImpl(dbMap)
 	cmd.FailOnError(err, "Could not connect to PADB")
+	return padb
+}
+
+// setupPAFromContext builds a PA with the policy settings the RA uses.
+func setupPAFromContext(context *cli.Context) *policy.PolicyAuthorityImpl {
+	c := loadConfig(context)
+
+	dbMap, err := sa.NewDbMap(c.PA.DBConnect)
+	cmd.FailOnError(err, "Failed to create DB map")
+	cmd.CheckSchemaVersion(dbMap, "policy")
+
+	pa, err := policy.NewPolicyAuthorityImpl(dbMap, c.PA.EnforcePolicyWhitelist)
+	cmd.FailOnError(err, "Couldn't create PA")
+	pa.IPBlocklist, err = policy.ParseIPBlocklist(c.PA.IPBlocklist)
+	cmd.FailOnError(err, "Couldn't parse IP blocklist")
+	pa.IDN.Scripts, err = policy.ParseIDNScripts(c.PA.IDN.Scripts)
+	cmd.FailOnError(err, "Couldn't parse IDN scripts")
+	pa.IDN.AllowMixedScripts = c.PA.IDN.AllowMixedScripts
+	pa.IDN.AllowConfusables = c.PA.IDN.AllowConfusables
+	pa.Suffixes = cmd.LoadPublicSuffixList(c.PA)
+	return pa
+}
+
+func setupFromContext(context *cli.Context) (*policy.PolicyAuthorityDatabaseImpl, string) {
+	padb := setupDBFromContext(context)
 
 	ruleFile := context.GlobalString("rule-file")
 	if ruleFile == "" {
@@ -33,14 +33,18 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"runtime"
+	"syscall"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
 
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/migrate"
+	"github.com/letsencrypt/boulder/policy"
 )
 
 // Config stores configuration parameters that applications
@@ -87,6 +91,16 @@ type Config struct {
 	}
 
 	RA struct {
+		// Profiles controls which registrations may request each certificate
+		// profile, keyed by profile name. Profiles not listed here can't be
+		// requested, and the CA's default profile is used instead.
+		Profiles map[string]ProfileAccessConfig
+
+		// CAARecheckWindow is how long after validation an authorization can
+		// be used for issuance before CAA is checked again, as a duration
+		// string. Empty disables the re-check.
+		CAARecheckWindow string
+
 		// DebugAddr is the address to run the /debug handlers on.
 		DebugAddr string
 	}
@@ -94,6 +108,14 @@ type Config struct {
 	SA struct {
 		DBConnect string
 
+		// ReplicaDBConnect, if set, names a read replica of the SA database.
+		// The SA's getters read from it, except when callers ask to read
+		// their own writes. How far it lags behind the primary is reported
+		// every ReplicaLagInterval (default "10s"), which needs the
+		// REPLICATION CLIENT privilege on the replica.
+		ReplicaDBConnect   string
+		ReplicaLagInterval string
+
 		// DebugAddr is the address to run the /debug handlers on.
 		DebugAddr string
 	}
@@ -101,11 +123,53 @@ type Config struct {
 	VA struct {
 		UserAgent string
 
+		// IssuerDomain is the domain CAA issue and issuewild records must
+		// name to authorize issuance.
+		IssuerDomain string
+		// SendIodefReports enables mailing CAA iodef incident reports, using
+		// the Mailer server settings. Only the VA the RA talks to sends them,
+		// at most once a day for each refused name.
+		SendIodefReports bool
+
 		PortConfig struct {
 			SimpleHTTPPort  int
 			SimpleHTTPSPort int
 			DVSNIPort       int
+			TLSSNIPort      int
 		}
+
+		// DNSSEC enables validating DNS answers against TrustAnchorFile, a
+		// zone file of DS or DNSKEY records. Answers from zones proven to be
+		// unsigned are accepted. AllowIndeterminate also lets through answers
+		// that can't be proven secure, insecure or bogus.
+		DNSSEC struct {
+			TrustAnchorFile    string
+			AllowIndeterminate bool
+		}
+
+		// RemoteVAs lists the AMQP server names of remote VAs that validations
+		// and CAA checks are repeated from. Remote VAs should not list any
+		// remote VAs themselves.
+		RemoteVAs []string
+		// Quorum is the number of perspectives, counting this VA, that must
+		// agree. Zero means a majority. It can't be more than the number of
+		// remote VAs plus one.
+		Quorum int
+
+		// ValidationQueue bounds the number of validations run at once and
+		// waiting to run. Validations failing with connection problems are
+		// retried up to MaxAttempts times, and any taking longer than
+		// JobTimeout are marked invalid. If JournalDir is set, queued
+		// validations survive a restart.
+		ValidationQueue struct {
+			Workers      int
+			QueueSize    int
+			MaxAttempts  int
+			RetryBackoff string
+			JobTimeout   string
+			JournalDir   string
+		}
+
 		// DebugAddr is the address to run the /debug handlers on.
 		DebugAddr string
 	}
@@ -129,6 +193,10 @@ type Config struct {
 		DBConnect string
 	}
 
+	AuthzReviewer struct {
+		DBConnect string
+	}
+
 	Mailer struct {
 		Server   string
 		Port     string
@@ -147,6 +215,8 @@ type Config struct {
 	}
 
 	OCSPResponder struct {
+		// DBConnect may name a read replica of the SA database, since the
+		// responder never writes to it.
 		DBConnect     string
 		Path          string
 		ListenAddress string
@@ -164,6 +234,36 @@ type Config struct {
 		DebugAddr string
 	}
 
+	DBPruner struct {
+		DBConnect string
+
+		// How long to keep rows after they stop being useful, as durations
+		// like "720h". Each kind of row with no retention set isn't pruned.
+		//
+		// PendingAuthzRetention and AuthzRetention count from when the
+		// authorization expires, OCSPRetention from when a newer OCSP
+		// response for the same certificate was signed, and
+		// ExpiredCertRetention from when the certificate expires. Pruning
+		// an expired certificate deletes its status and OCSP responses but
+		// keeps the certificate itself.
+		PendingAuthzRetention string
+		AuthzRetention        string
+		OCSPRetention         string
+		ExpiredCertRetention  string
+
+		// BatchSize rows are deleted per transaction, with a pause of
+		// BatchInterval between transactions to limit load on the database.
+		BatchSize     int
+		BatchInterval string
+
+		// ArchiveDir, if set, is a directory to which rows are appended as
+		// JSON before they are deleted.
+		ArchiveDir string
+
+		// DebugAddr is the address to run the /debug handlers on.
+		DebugAddr string
+	}
+
 	ExternalCertImporter struct {
 		CertsToImportCSVFilename   string
 		DomainsToImportCSVFilename string
@@ -178,10 +278,18 @@ type Config struct {
 		// Path to a PEM-encoded copy of the issuer certificate.
 		IssuerCert string
 		MaxKeySize int
+		// Paths to files of hashes of public keys that must be refused, such
+		// as the Debian openssl-blacklist files. See core.KeyBlocklist.
+		BlockedKeyFiles []string
 
 		DNSResolver               string
 		DNSTimeout                string
 		DNSAllowLoopbackAddresses bool
+		// DNSCacheMaxTTL, if set, caches DNS answers for up to this long.
+		// DNSCacheBypassCAA keeps CAA lookups out of the cache. The VA never
+		// caches challenge TXT records or the addresses it validates against.
+		DNSCacheMaxTTL    string
+		DNSCacheBypassCAA bool
 	}
 
 	CertChecker struct {
@@ -196,7 +304,6 @@ type Config struct {
 type CAConfig struct {
 	Profile      string
 	TestMode     bool
-	DBConnect    string
 	SerialPrefix int
 	Key          KeyConfig
 	// LifespanOCSP is how long OCSP responses are valid for; It should be longer
@@ -209,13 +316,73 @@ type CAConfig struct {
 	MaxNames int
 	CFSSL    cfsslConfig.Config
 
+	// Profiles are the named certificate profiles which may be requested
+	// instead of the default CFSSL Profile, keyed by name.
+	Profiles map[string]CertProfileConfig
+	// AllowMustStapleRequests permits CSRs to request the TLS Feature
+	// (OCSP Must-Staple) extension when issuing under the default Profile.
+	AllowMustStapleRequests bool
+
 	// DebugAddr is the address to run the /debug handlers on.
 	DebugAddr string
 }
 
+// CertProfileConfig describes a named certificate profile. The lifetime, key
+// usages and policies of certificates issued under a profile are those of its
+// CFSSL signing profile.
+type CertProfileConfig struct {
+	// CFSSLProfile is the name of the CFSSL signing profile used to sign
+	// certificates issued under this profile.
+	CFSSLProfile string
+	// MustStaple adds the TLS Feature extension requiring OCSP stapling to
+	// certificates issued under this profile.
+	MustStaple bool
+	// AllowMustStapleRequests permits CSRs to request the TLS Feature
+	// extension for certificates issued under this profile.
+	AllowMustStapleRequests bool
+	// AllowedKeyTypes lists the public key algorithms, "RSA" or "ECDSA",
+	// accepted for this profile. If empty, any key type is allowed.
+	AllowedKeyTypes []string
+}
+
+// ProfileAccessConfig controls which registrations may request a certificate
+// profile.
+type ProfileAccessConfig struct {
+	// AllowAll makes the profile available to every registration.
+	AllowAll bool
+	// Registrations lists the IDs of the registrations that may request the
+	// profile when AllowAll is false.
+	Registrations []int64
+	// DefaultFor lists the IDs of registrations that are issued certificates
+	// under this profile when a request doesn't name one.
+	DefaultFor []int64
+}
+
 type PAConfig struct {
 	DBConnect              string
 	EnforcePolicyWhitelist bool
+	// IPBlocklist lists CIDR ranges of IP addresses never to issue for, on
+	// top of the reserved ranges the PA always refuses.
+	IPBlocklist []string
+
+	// PublicSuffixListFile, if set, is a public_suffix_list.dat file to use
+	// in place of the copy compiled into Boulder. It is read again on SIGUSR1.
+	PublicSuffixListFile string
+	// ExcludePrivateSuffixes ignores the private domains section of the
+	// Public Suffix List.
+	ExcludePrivateSuffixes bool
+
+	// RuleRefreshInterval, if set, keeps the blacklist and whitelist in
+	// memory, loading them from the database again this often.
+	RuleRefreshInterval string
+
+	// IDN sets the script and confusable rules for internationalized names.
+	IDN struct {
+		// Scripts, if set, lists the only Unicode scripts names may use.
+		Scripts           []string
+		AllowMixedScripts bool
+		AllowConfusables  bool
+	}
 }
 
 // KeyConfig should contain either a File path to a PEM-format private key,
@@ -317,6 +484,38 @@ func FailOnError(err error, msg string) {
 	}
 }
 
+// CheckSchemaVersion exits unless dbMap has the version of schema ("sa" or
+// "policy") that this build expects applied, so that commands don't run
+// against a database that's missing tables or columns they use. A database
+// with newer migrations applied is logged as a warning.
+func CheckSchemaVersion(dbMap *gorp.DbMap, schema string) {
+	err := migrate.CheckVersion(dbMap.Db, schema)
+	if newer, ok := err.(migrate.NewerSchemaError); ok {
+		blog.GetAuditLogger().Warning(fmt.Sprintf("%s. Continuing, since migrations only add to the schema, but this build should be replaced", newer))
+		return
+	}
+	FailOnError(err, "Database schema doesn't match this build of Boulder")
+}
+
+// LoadPublicSuffixList sets up the Public Suffix List named in the PA config,
+// reloading it whenever the process receives SIGUSR1. If no file is named,
+// or it can't be loaded at startup, the copy compiled into Boulder is used.
+func LoadPublicSuffixList(config PAConfig) *policy.SuffixList {
+	suffixes := policy.NewSuffixList(policy.EmbeddedSuffixRules())
+	if config.PublicSuffixListFile == "" {
+		return suffixes
+	}
+	includePrivate := !config.ExcludePrivateSuffixes
+	rules, err := policy.LoadSuffixListFile(config.PublicSuffixListFile, includePrivate)
+	if err != nil {
+		blog.GetAuditLogger().Err(fmt.Sprintf("Couldn't load public suffix list, using the compiled-in copy: %s", err))
+	} else {
+		suffixes.Replace(rules)
+	}
+	suffixes.ReloadOnSignal(syscall.SIGUSR1, config.PublicSuffixListFile, includePrivate)
+	return suffixes
+}
+
 // ProfileCmd runs forever, sending Go statistics to StatsD.
 func ProfileCmd(profileName string, stats statsd.Statter) {
 	for {
@@ -16,6 +16,24 @@ func SimpleHTTPChallenge() Challenge {
 	}
 }
 
+// HTTPChallenge01 constructs a random http-01 challenge
+func HTTPChallenge01() Challenge {
+	return Challenge{
+		Type:   ChallengeTypeHTTP01,
+		Status: StatusPending,
+		Token:  NewToken(),
+	}
+}
+
+// TLSSNIChallenge01 constructs a random tls-sni-01 challenge
+func TLSSNIChallenge01() Challenge {
+	return Challenge{
+		Type:   ChallengeTypeTLSSNI01,
+		Status: StatusPending,
+		Token:  NewToken(),
+	}
+}
+
 // DvsniChallenge constructs a random DVSNI challenge
 func DvsniChallenge() Challenge {
 	return Challenge{
@@ -67,6 +67,21 @@ func TestCertificateRequest(t *testing.T) {
 	if err != nil {
 		t.Errorf("Marshalled certificate request failed to unmarshal: %v", err)
 	}
+
+	// Profile
+	goodCR.Profile = "short-lived"
+	jsonCR, err = json.Marshal(goodCR)
+	if err != nil {
+		t.Errorf("Failed to marshal certificate request with profile: %v", err)
+	}
+	var profileCR CertificateRequest
+	err = json.Unmarshal(jsonCR, &profileCR)
+	if err != nil {
+		t.Errorf("Marshalled certificate request with profile failed to unmarshal: %v", err)
+	}
+	if profileCR.Profile != "short-lived" {
+		t.Errorf("Profile was not preserved, got %q", profileCR.Profile)
+	}
 }
 
 func TestMergeChallenge(t *testing.T) {
@@ -48,6 +48,9 @@ type DNSResolverImpl struct {
 	DNSClient              *dns.Client
 	Servers                []string
 	allowLoopbackAddresses bool
+	// DNSSEC, if set, makes the resolver validate answers itself instead of
+	// trusting the configured servers.
+	DNSSEC *DNSSECConfig
 }
 
 // NewDNSResolverImpl constructs a new DNS resolver object that utilizes the
@@ -78,12 +81,29 @@ func NewTestDNSResolverImpl(dialTimeout time.Duration, servers []string) *DNSRes
 // out of the server list, returning the response, time, and error (if any).
 // This method sets the DNSSEC OK bit on the message to true before sending
 // it to the resolver in case validation isn't the resolvers default behaviour.
+// In validating mode the answer is checked against the trust anchors, and a
+// DNSSECError is returned if it is bogus or not allowed to be indeterminate.
 func (dnsResolver *DNSResolverImpl) ExchangeOne(hostname string, qtype uint16) (rsp *dns.Msg, rtt time.Duration, err error) {
+	rsp, rtt, err = dnsResolver.exchange(hostname, qtype)
+	if err != nil || dnsResolver.DNSSEC == nil {
+		return
+	}
+	if err = dnsResolver.validateResponse(rsp); err != nil {
+		rsp = nil
+	}
+	return
+}
+
+// exchange sends a query to a random server without validating the answer.
+func (dnsResolver *DNSResolverImpl) exchange(hostname string, qtype uint16) (rsp *dns.Msg, rtt time.Duration, err error) {
 	m := new(dns.Msg)
 	// Set question type
 	m.SetQuestion(dns.Fqdn(hostname), qtype)
 	// Set DNSSEC OK bit for resolver
 	m.SetEdns0(4096, true)
+	// When validating ourselves, ask for bogus data too so it can be
+	// reported as such rather than as a server failure
+	m.CheckingDisabled = dnsResolver.DNSSEC != nil
 
 	if len(dnsResolver.Servers) < 1 {
 		err = fmt.Errorf("Not configured with at least one DNS Server")
@@ -99,16 +119,23 @@ func (dnsResolver *DNSResolverImpl) ExchangeOne(hostname string, qtype uint16) (
 // LookupTXT sends a DNS query to find all TXT records associated with
 // the provided hostname.
 func (dnsResolver *DNSResolverImpl) LookupTXT(hostname string) ([]string, time.Duration, error) {
-	var txt []string
 	r, rtt, err := dnsResolver.ExchangeOne(hostname, dns.TypeTXT)
 	if err != nil {
 		return nil, 0, err
 	}
-	if r.Rcode != dns.RcodeSuccess {
-		err = fmt.Errorf("DNS failure: %d-%s for TXT query", r.Rcode, dns.RcodeToString[r.Rcode])
+	txt, err := txtFromMsg(r)
+	if err != nil {
 		return nil, 0, err
 	}
+	return txt, rtt, nil
+}
+
+func txtFromMsg(r *dns.Msg) ([]string, error) {
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("DNS failure: %d-%s for TXT query", r.Rcode, dns.RcodeToString[r.Rcode])
+	}
 
+	var txt []string
 	for _, answer := range r.Answer {
 		if answer.Header().Rrtype == dns.TypeTXT {
 			if txtRec, ok := answer.(*dns.TXT); ok {
@@ -116,38 +143,73 @@ func (dnsResolver *DNSResolverImpl) LookupTXT(hostname string) ([]string, time.D
 			}
 		}
 	}
-
-	return txt, rtt, err
+	return txt, nil
 }
 
 func isPrivateV4(ip net.IP, allowLoopback bool) bool {
 	return rfc1918_10.Contains(ip) || rfc1918_172_16.Contains(ip) || rfc1918_192_168.Contains(ip) || (!allowLoopback && rfc5735_127.Contains(ip))
 }
 
-// LookupHost sends a DNS query to find all A records associated with the provided
-// hostname. This method assumes that the external resolver will chase CNAME/DNAME
-// aliases and return relevant A records.
+// LookupHost sends DNS queries to find all A and AAAA records associated with
+// the provided hostname, skipping private IPv4 addresses. Other reserved
+// ranges, for both families, are left to callers such as the VA to drop. It
+// only fails if both queries do, or if either fails DNSSEC validation. This method
+// assumes that the external resolver will chase CNAME/DNAME aliases and
+// return relevant records.
 func (dnsResolver *DNSResolverImpl) LookupHost(hostname string) ([]net.IP, time.Duration, error) {
-	var addrs []net.IP
+	return lookupHost(dnsResolver.ExchangeOne, hostname, dnsResolver.allowLoopbackAddresses)
+}
 
-	r, rtt, err := dnsResolver.ExchangeOne(hostname, dns.TypeA)
-	if err != nil {
-		return addrs, rtt, err
+func lookupHost(exchange func(string, uint16) (*dns.Msg, time.Duration, error), hostname string, allowLoopback bool) ([]net.IP, time.Duration, error) {
+	var addrs []net.IP
+	var totalRTT time.Duration
+	var firstErr error
+	failures := 0
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		r, rtt, err := exchange(hostname, qtype)
+		totalRTT += rtt
+		if err == nil {
+			var found []net.IP
+			found, err = hostsFromMsg(r, qtype, allowLoopback)
+			addrs = append(addrs, found...)
+		}
+		if err != nil {
+			// A DNSSEC failure for either family could be hiding the real
+			// addresses, so it fails the whole lookup
+			if _, ok := err.(DNSSECError); ok {
+				return nil, totalRTT, err
+			}
+			failures++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if failures == 2 {
+		return nil, totalRTT, firstErr
 	}
+	return addrs, totalRTT, nil
+}
+
+func hostsFromMsg(r *dns.Msg, qtype uint16, allowLoopback bool) ([]net.IP, error) {
 	if r.Rcode != dns.RcodeSuccess {
-		err = fmt.Errorf("DNS failure: %d-%s for A query", r.Rcode, dns.RcodeToString[r.Rcode])
-		return nil, rtt, err
+		return nil, fmt.Errorf("DNS failure: %d-%s for %s query", r.Rcode, dns.RcodeToString[r.Rcode], dns.TypeToString[qtype])
 	}
 
+	var addrs []net.IP
 	for _, answer := range r.Answer {
-		if answer.Header().Rrtype == dns.TypeA {
-			if a, ok := answer.(*dns.A); ok && a.A.To4() != nil && !isPrivateV4(a.A, dnsResolver.allowLoopbackAddresses) {
-				addrs = append(addrs, a.A)
+		switch rr := answer.(type) {
+		case *dns.A:
+			if qtype == dns.TypeA && rr.A.To4() != nil && !isPrivateV4(rr.A, allowLoopback) {
+				addrs = append(addrs, rr.A)
+			}
+		case *dns.AAAA:
+			if qtype == dns.TypeAAAA && rr.AAAA.To4() == nil {
+				addrs = append(addrs, rr.AAAA)
 			}
 		}
 	}
-
-	return addrs, rtt, nil
+	return addrs, nil
 }
 
 // LookupCNAME returns the target name if a CNAME record exists for
@@ -159,21 +221,8 @@ func (dnsResolver *DNSResolverImpl) LookupCNAME(hostname string) (string, time.D
 	if err != nil {
 		return "", 0, err
 	}
-	if r.Rcode == dns.RcodeNXRrset || r.Rcode == dns.RcodeNameError {
-		return "", rtt, nil
-	}
-	if r.Rcode != dns.RcodeSuccess {
-		err = fmt.Errorf("DNS failure: %d-%s for CNAME query", r.Rcode, dns.RcodeToString[r.Rcode])
-		return "", rtt, err
-	}
-
-	for _, answer := range r.Answer {
-		if cname, ok := answer.(*dns.CNAME); ok {
-			return cname.Target, rtt, nil
-		}
-	}
-
-	return "", rtt, nil
+	target, err := aliasFromMsg(r, dns.TypeCNAME)
+	return target, rtt, err
 }
 
 // LookupDNAME is LookupCNAME, but for DNAME.
@@ -182,21 +231,31 @@ func (dnsResolver *DNSResolverImpl) LookupDNAME(hostname string) (string, time.D
 	if err != nil {
 		return "", 0, err
 	}
+	target, err := aliasFromMsg(r, dns.TypeDNAME)
+	return target, rtt, err
+}
+
+func aliasFromMsg(r *dns.Msg, qtype uint16) (string, error) {
 	if r.Rcode == dns.RcodeNXRrset || r.Rcode == dns.RcodeNameError {
-		return "", rtt, nil
+		return "", nil
 	}
 	if r.Rcode != dns.RcodeSuccess {
-		err = fmt.Errorf("DNS failure: %d-%s for DNAME query", r.Rcode, dns.RcodeToString[r.Rcode])
-		return "", rtt, err
+		return "", fmt.Errorf("DNS failure: %d-%s for %s query", r.Rcode, dns.RcodeToString[r.Rcode], dns.TypeToString[qtype])
 	}
 
 	for _, answer := range r.Answer {
-		if cname, ok := answer.(*dns.DNAME); ok {
-			return cname.Target, rtt, nil
+		switch alias := answer.(type) {
+		case *dns.CNAME:
+			if qtype == dns.TypeCNAME {
+				return alias.Target, nil
+			}
+		case *dns.DNAME:
+			if qtype == dns.TypeDNAME {
+				return alias.Target, nil
+			}
 		}
 	}
-
-	return "", rtt, nil
+	return "", nil
 }
 
 // LookupCAA sends a DNS query to find all CAA records associated with
@@ -207,12 +266,15 @@ func (dnsResolver *DNSResolverImpl) LookupCAA(hostname string) ([]*dns.CAA, time
 	if err != nil {
 		return nil, 0, err
 	}
+	return caaFromMsg(r), rtt, nil
+}
 
+func caaFromMsg(r *dns.Msg) []*dns.CAA {
 	// On resolver validation failure, or other server failures, return empty an
 	// set and no error.
 	var CAAs []*dns.CAA
 	if r.Rcode == dns.RcodeServerFailure {
-		return CAAs, rtt, nil
+		return CAAs
 	}
 
 	for _, answer := range r.Answer {
@@ -222,7 +284,7 @@ func (dnsResolver *DNSResolverImpl) LookupCAA(hostname string) ([]*dns.CAA, time
 			}
 		}
 	}
-	return CAAs, rtt, nil
+	return CAAs
 }
 
 // LookupMX sends a DNS query to find a MX record associated hostname and returns the
@@ -232,9 +294,13 @@ func (dnsResolver *DNSResolverImpl) LookupMX(hostname string) ([]string, time.Du
 	if err != nil {
 		return nil, 0, err
 	}
+	results, err := mxFromMsg(r)
+	return results, rtt, err
+}
+
+func mxFromMsg(r *dns.Msg) ([]string, error) {
 	if r.Rcode != dns.RcodeSuccess {
-		err = fmt.Errorf("DNS failure: %d-%s for MX query", r.Rcode, dns.RcodeToString[r.Rcode])
-		return nil, rtt, err
+		return nil, fmt.Errorf("DNS failure: %d-%s for MX query", r.Rcode, dns.RcodeToString[r.Rcode])
 	}
 
 	var results []string
@@ -243,6 +309,5 @@ func (dnsResolver *DNSResolverImpl) LookupMX(hostname string) ([]string, time.Du
 			results = append(results, mx.Mx)
 		}
 	}
-
-	return results, rtt, nil
+	return results, nil
 }
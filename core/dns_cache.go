@@ -0,0 +1,274 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+// servFailTTL is how long a SERVFAIL is remembered, unless MaxTTL is lower.
+const servFailTTL = 30 * time.Second
+
+// purgeInterval is the number of cache insertions between sweeps for
+// expired entries.
+const purgeInterval = 1000
+
+// DNSCacheStats counts how queries to a CachingDNSResolver were answered.
+type DNSCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Collapsed int64
+}
+
+type dnsCacheKey struct {
+	name  string
+	qtype uint16
+}
+
+type dnsCacheEntry struct {
+	msg     *dns.Msg
+	expires time.Time
+}
+
+// dnsCall is a query in flight that identical queries wait on rather than
+// sending their own.
+type dnsCall struct {
+	done chan struct{}
+	msg  *dns.Msg
+	rtt  time.Duration
+	err  error
+}
+
+// CachingDNSResolver is a DNSResolver that answers repeated queries from
+// memory. Responses from the wrapped resolver's ExchangeOne are kept for the
+// lowest TTL in the answer, capped at MaxTTL. NXDOMAIN and empty answers are
+// kept for their SOA negative TTL and SERVFAIL for servFailTTL. Errors are
+// never cached.
+type CachingDNSResolver struct {
+	Resolver DNSResolver
+	MaxTTL   time.Duration
+	// BypassCAA sends every CAA query to the wrapped resolver, for when
+	// issuance decisions need the freshest records.
+	BypassCAA bool
+	// BypassValidation sends every TXT, A and AAAA query made by LookupTXT
+	// and LookupHost to the wrapped resolver, so challenge records and the
+	// addresses validations connect to are never stale.
+	BypassValidation bool
+
+	allowLoopbackAddresses bool
+	stats                  statsd.Statter
+	clk                    clock.Clock
+
+	mu       sync.Mutex
+	entries  map[dnsCacheKey]dnsCacheEntry
+	inflight map[dnsCacheKey]*dnsCall
+	inserts  int
+	counts   DNSCacheStats
+}
+
+// NewCachingDNSResolver wraps resolver in a cache that keeps answers for at
+// most maxTTL. If resolver is a DNSResolverImpl, its loopback address policy
+// is kept.
+func NewCachingDNSResolver(clk clock.Clock, resolver DNSResolver, maxTTL time.Duration, stats statsd.Statter) *CachingDNSResolver {
+	cache := &CachingDNSResolver{
+		Resolver: resolver,
+		MaxTTL:   maxTTL,
+		stats:    stats,
+		clk:      clk,
+		entries:  make(map[dnsCacheKey]dnsCacheEntry),
+		inflight: make(map[dnsCacheKey]*dnsCall),
+	}
+	if impl, ok := resolver.(*DNSResolverImpl); ok {
+		cache.allowLoopbackAddresses = impl.allowLoopbackAddresses
+	}
+	return cache
+}
+
+// Stats returns the number of cache hits, misses, and queries that were
+// answered by waiting on an identical query already in flight.
+func (cache *CachingDNSResolver) Stats() DNSCacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.counts
+}
+
+func (cache *CachingDNSResolver) count(counter *int64, stat string) {
+	*counter++
+	if cache.stats != nil {
+		cache.stats.Inc("DNS.Cache."+stat, 1, 1.0)
+	}
+}
+
+// ExchangeOne returns a copy of the cached response for hostname and qtype,
+// querying the wrapped resolver if there is none.
+func (cache *CachingDNSResolver) ExchangeOne(hostname string, qtype uint16) (*dns.Msg, time.Duration, error) {
+	r, rtt, err := cache.exchange(hostname, qtype)
+	if err != nil {
+		return nil, rtt, err
+	}
+	return r.Copy(), rtt, nil
+}
+
+// exchange returns the shared cached response, which must not be modified.
+func (cache *CachingDNSResolver) exchange(hostname string, qtype uint16) (*dns.Msg, time.Duration, error) {
+	key := dnsCacheKey{strings.ToLower(dns.Fqdn(hostname)), qtype}
+
+	cache.mu.Lock()
+	if entry, ok := cache.entries[key]; ok {
+		if cache.clk.Now().Before(entry.expires) {
+			cache.count(&cache.counts.Hits, "Hits")
+			cache.mu.Unlock()
+			return entry.msg, 0, nil
+		}
+		delete(cache.entries, key)
+	}
+	if call, ok := cache.inflight[key]; ok {
+		cache.count(&cache.counts.Collapsed, "Collapsed")
+		cache.mu.Unlock()
+		<-call.done
+		return call.msg, call.rtt, call.err
+	}
+	cache.count(&cache.counts.Misses, "Misses")
+	call := &dnsCall{done: make(chan struct{})}
+	cache.inflight[key] = call
+	cache.mu.Unlock()
+
+	call.msg, call.rtt, call.err = cache.Resolver.ExchangeOne(hostname, qtype)
+
+	cache.mu.Lock()
+	delete(cache.inflight, key)
+	if call.err == nil && call.msg != nil {
+		if ttl := cache.ttl(call.msg); ttl > 0 {
+			cache.insert(key, dnsCacheEntry{msg: call.msg, expires: cache.clk.Now().Add(ttl)})
+		}
+	}
+	cache.mu.Unlock()
+	close(call.done)
+
+	return call.msg, call.rtt, call.err
+}
+
+func (cache *CachingDNSResolver) insert(key dnsCacheKey, entry dnsCacheEntry) {
+	cache.entries[key] = entry
+	cache.inserts++
+	if cache.inserts%purgeInterval != 0 {
+		return
+	}
+	now := cache.clk.Now()
+	for k, e := range cache.entries {
+		if !now.Before(e.expires) {
+			delete(cache.entries, k)
+		}
+	}
+}
+
+// ttl works out how long r may be cached for, following RFC 2308 for
+// negative answers.
+func (cache *CachingDNSResolver) ttl(r *dns.Msg) time.Duration {
+	var ttl time.Duration
+	switch {
+	case r.Rcode == dns.RcodeServerFailure:
+		ttl = servFailTTL
+	case r.Rcode == dns.RcodeSuccess && len(r.Answer) > 0:
+		ttl = time.Duration(r.Answer[0].Header().Ttl) * time.Second
+		for _, rr := range r.Answer[1:] {
+			if rrTTL := time.Duration(rr.Header().Ttl) * time.Second; rrTTL < ttl {
+				ttl = rrTTL
+			}
+		}
+	case r.Rcode == dns.RcodeSuccess || r.Rcode == dns.RcodeNameError:
+		// Without an SOA there is no negative TTL and the answer isn't cached
+		for _, rr := range r.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl = time.Duration(soa.Hdr.Ttl) * time.Second
+				if minTTL := time.Duration(soa.Minttl) * time.Second; minTTL < ttl {
+					ttl = minTTL
+				}
+				break
+			}
+		}
+	}
+	if ttl > cache.MaxTTL {
+		ttl = cache.MaxTTL
+	}
+	return ttl
+}
+
+// LookupTXT is DNSResolverImpl.LookupTXT, answered from the cache unless
+// BypassValidation is set.
+func (cache *CachingDNSResolver) LookupTXT(hostname string) ([]string, time.Duration, error) {
+	if cache.BypassValidation {
+		return cache.Resolver.LookupTXT(hostname)
+	}
+	r, rtt, err := cache.exchange(hostname, dns.TypeTXT)
+	if err != nil {
+		return nil, 0, err
+	}
+	txt, err := txtFromMsg(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return txt, rtt, nil
+}
+
+// LookupHost is DNSResolverImpl.LookupHost, answered from the cache unless
+// BypassValidation is set.
+func (cache *CachingDNSResolver) LookupHost(hostname string) ([]net.IP, time.Duration, error) {
+	if cache.BypassValidation {
+		return cache.Resolver.LookupHost(hostname)
+	}
+	return lookupHost(cache.exchange, hostname, cache.allowLoopbackAddresses)
+}
+
+// LookupCNAME is DNSResolverImpl.LookupCNAME, answered from the cache.
+func (cache *CachingDNSResolver) LookupCNAME(hostname string) (string, time.Duration, error) {
+	r, rtt, err := cache.exchange(hostname, dns.TypeCNAME)
+	if err != nil {
+		return "", 0, err
+	}
+	target, err := aliasFromMsg(r, dns.TypeCNAME)
+	return target, rtt, err
+}
+
+// LookupDNAME is DNSResolverImpl.LookupDNAME, answered from the cache.
+func (cache *CachingDNSResolver) LookupDNAME(hostname string) (string, time.Duration, error) {
+	r, rtt, err := cache.exchange(hostname, dns.TypeDNAME)
+	if err != nil {
+		return "", 0, err
+	}
+	target, err := aliasFromMsg(r, dns.TypeDNAME)
+	return target, rtt, err
+}
+
+// LookupCAA is DNSResolverImpl.LookupCAA, answered from the cache unless
+// BypassCAA is set.
+func (cache *CachingDNSResolver) LookupCAA(hostname string) ([]*dns.CAA, time.Duration, error) {
+	if cache.BypassCAA {
+		return cache.Resolver.LookupCAA(hostname)
+	}
+	r, rtt, err := cache.exchange(hostname, dns.TypeCAA)
+	if err != nil {
+		return nil, 0, err
+	}
+	return caaFromMsg(r), rtt, nil
+}
+
+// LookupMX is DNSResolverImpl.LookupMX, answered from the cache.
+func (cache *CachingDNSResolver) LookupMX(hostname string) ([]string, time.Duration, error) {
+	r, rtt, err := cache.exchange(hostname, dns.TypeMX)
+	if err != nil {
+		return nil, 0, err
+	}
+	results, err := mxFromMsg(r)
+	return results, rtt, err
+}
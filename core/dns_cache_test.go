@@ -0,0 +1,230 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// countingResolver answers from fixed responses and counts the queries that
+// reach it. If release is set, queries block until it is closed.
+type countingResolver struct {
+	DNSResolverImpl
+	mu      sync.Mutex
+	queries map[string]int
+	release chan struct{}
+}
+
+func (r *countingResolver) ExchangeOne(hostname string, qtype uint16) (*dns.Msg, time.Duration, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(hostname), qtype)
+	switch hostname {
+	case "nx.example.com", "nx-nosoa.example.com", "servfail.example.com":
+	default:
+		if qtype == dns.TypeAAAA {
+			// No AAAA records, and no SOA so the answer isn't cached
+			return m, time.Millisecond, nil
+		}
+	}
+
+	if qtype != dns.TypeAAAA {
+		r.mu.Lock()
+		r.queries[hostname]++
+		r.mu.Unlock()
+		if r.release != nil {
+			<-r.release
+		}
+	}
+
+	soa := &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 600},
+		Minttl: 60,
+	}
+	switch hostname {
+	case "short.example.com":
+		m.Answer = append(m.Answer,
+			&dns.A{Hdr: dns.RR_Header{Name: "short.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.ParseIP("1.2.3.4")},
+			&dns.A{Hdr: dns.RR_Header{Name: "short.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 10}, A: net.ParseIP("1.2.3.5")})
+	case "long.example.com":
+		m.Answer = append(m.Answer,
+			&dns.A{Hdr: dns.RR_Header{Name: "long.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 86400}, A: net.ParseIP("1.2.3.4")})
+	case "zero.example.com":
+		m.Answer = append(m.Answer,
+			&dns.A{Hdr: dns.RR_Header{Name: "zero.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 0}, A: net.ParseIP("1.2.3.4")})
+	case "nx.example.com":
+		m.Rcode = dns.RcodeNameError
+		m.Ns = append(m.Ns, soa)
+	case "nx-nosoa.example.com":
+		m.Rcode = dns.RcodeNameError
+	case "servfail.example.com":
+		m.Rcode = dns.RcodeServerFailure
+	case "caa.example.com":
+		m.Answer = append(m.Answer,
+			&dns.CAA{Hdr: dns.RR_Header{Name: "caa.example.com.", Rrtype: dns.TypeCAA, Class: dns.ClassINET, Ttl: 300}, Tag: "issue", Value: "letsencrypt.org"})
+	case "txt.example.com":
+		m.Answer = append(m.Answer,
+			&dns.TXT{Hdr: dns.RR_Header{Name: "txt.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{"token"}})
+	}
+	return m, time.Millisecond, nil
+}
+
+func (r *countingResolver) LookupCAA(hostname string) ([]*dns.CAA, time.Duration, error) {
+	m, rtt, _ := r.ExchangeOne(hostname, dns.TypeCAA)
+	return caaFromMsg(m), rtt, nil
+}
+
+func (r *countingResolver) LookupTXT(hostname string) ([]string, time.Duration, error) {
+	m, rtt, _ := r.ExchangeOne(hostname, dns.TypeTXT)
+	txt, err := txtFromMsg(m)
+	return txt, rtt, err
+}
+
+func (r *countingResolver) LookupHost(hostname string) ([]net.IP, time.Duration, error) {
+	return lookupHost(r.ExchangeOne, hostname, false)
+}
+
+func newCountingCache(maxTTL time.Duration) (*CachingDNSResolver, *countingResolver, clock.FakeClock) {
+	inner := &countingResolver{queries: make(map[string]int)}
+	fc := clock.NewFake()
+	return NewCachingDNSResolver(fc, inner, maxTTL, nil), inner, fc
+}
+
+func TestDNSCacheTTL(t *testing.T) {
+	cache, inner, fc := newCountingCache(time.Hour)
+
+	addrs, _, err := cache.LookupHost("short.example.com")
+	test.AssertNotError(t, err, "Lookup failed")
+	test.AssertEquals(t, len(addrs), 2)
+	cache.LookupHost("SHORT.example.com.")
+	test.AssertEquals(t, inner.queries["short.example.com"], 1)
+
+	// The lowest TTL in the answer wins
+	fc.Add(11 * time.Second)
+	cache.LookupHost("short.example.com")
+	test.AssertEquals(t, inner.queries["short.example.com"], 2)
+
+	// Long TTLs are capped by MaxTTL
+	cache.LookupHost("long.example.com")
+	fc.Add(time.Hour + time.Second)
+	cache.LookupHost("long.example.com")
+	test.AssertEquals(t, inner.queries["long.example.com"], 2)
+
+	// Zero TTLs are never cached
+	cache.LookupHost("zero.example.com")
+	cache.LookupHost("zero.example.com")
+	test.AssertEquals(t, inner.queries["zero.example.com"], 2)
+
+	// Each LookupHost also sends an AAAA query, which is never cached here
+	stats := cache.Stats()
+	test.AssertEquals(t, stats.Hits, int64(1))
+	test.AssertEquals(t, stats.Misses, int64(6+7))
+}
+
+func TestDNSCacheNegative(t *testing.T) {
+	cache, inner, fc := newCountingCache(time.Hour)
+
+	// NXDOMAIN is kept for the SOA minimum
+	cache.LookupHost("nx.example.com")
+	_, _, err := cache.LookupHost("nx.example.com")
+	test.AssertError(t, err, "Cached NXDOMAIN didn't fail")
+	test.AssertEquals(t, inner.queries["nx.example.com"], 1)
+	fc.Add(61 * time.Second)
+	cache.LookupHost("nx.example.com")
+	test.AssertEquals(t, inner.queries["nx.example.com"], 2)
+
+	// ...and not at all without an SOA
+	cache.LookupHost("nx-nosoa.example.com")
+	cache.LookupHost("nx-nosoa.example.com")
+	test.AssertEquals(t, inner.queries["nx-nosoa.example.com"], 2)
+
+	cache.LookupHost("servfail.example.com")
+	_, _, err = cache.LookupHost("servfail.example.com")
+	test.AssertError(t, err, "Cached SERVFAIL didn't fail")
+	test.AssertEquals(t, inner.queries["servfail.example.com"], 1)
+	fc.Add(servFailTTL)
+	cache.LookupHost("servfail.example.com")
+	test.AssertEquals(t, inner.queries["servfail.example.com"], 2)
+}
+
+func TestDNSCacheCAABypass(t *testing.T) {
+	cache, inner, _ := newCountingCache(time.Hour)
+
+	caas, _, err := cache.LookupCAA("caa.example.com")
+	test.AssertNotError(t, err, "Lookup failed")
+	test.AssertEquals(t, len(caas), 1)
+	cache.LookupCAA("caa.example.com")
+	test.AssertEquals(t, inner.queries["caa.example.com"], 1)
+
+	cache.BypassCAA = true
+	cache.LookupCAA("caa.example.com")
+	cache.LookupCAA("caa.example.com")
+	test.AssertEquals(t, inner.queries["caa.example.com"], 3)
+}
+
+func TestDNSCacheValidationBypass(t *testing.T) {
+	cache, inner, _ := newCountingCache(time.Hour)
+	cache.BypassValidation = true
+
+	for i := 0; i < 2; i++ {
+		txts, _, err := cache.LookupTXT("txt.example.com")
+		test.AssertNotError(t, err, "Lookup failed")
+		test.AssertEquals(t, len(txts), 1)
+		addrs, _, err := cache.LookupHost("long.example.com")
+		test.AssertNotError(t, err, "Lookup failed")
+		test.AssertEquals(t, len(addrs), 1)
+	}
+	test.AssertEquals(t, inner.queries["txt.example.com"], 2)
+	test.AssertEquals(t, inner.queries["long.example.com"], 2)
+
+	// Other lookups are still cached
+	cache.LookupCAA("caa.example.com")
+	cache.LookupCAA("caa.example.com")
+	test.AssertEquals(t, inner.queries["caa.example.com"], 1)
+}
+
+func TestDNSCacheCollapse(t *testing.T) {
+	cache, inner, _ := newCountingCache(time.Hour)
+	inner.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs, _, err := cache.LookupHost("zero.example.com")
+			test.AssertNotError(t, err, "Lookup failed")
+			test.AssertEquals(t, len(addrs), 1)
+		}()
+	}
+	// Wait until every lookup is either in flight or waiting on one
+	for {
+		stats := cache.Stats()
+		if stats.Misses+stats.Collapsed == 5 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(inner.release)
+	wg.Wait()
+
+	test.AssertEquals(t, inner.queries["zero.example.com"], 1)
+	test.AssertEquals(t, cache.Stats().Collapsed, int64(4))
+
+	// Copies are handed out so callers can't corrupt the cache
+	r, _, err := cache.ExchangeOne("long.example.com", dns.TypeA)
+	test.AssertNotError(t, err, "Exchange failed")
+	r.Answer = nil
+	addrs, _, err := cache.LookupHost("long.example.com")
+	test.AssertNotError(t, err, "Lookup failed")
+	test.AssertEquals(t, len(addrs), 1)
+}
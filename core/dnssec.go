@@ -0,0 +1,724 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+// maxDNSSECDepth bounds the number of zone cuts followed while building a
+// chain of trust, so a misbehaving resolver can't keep us looping.
+const maxDNSSECDepth = 16
+
+// DNSSECConfig switches a DNSResolverImpl into validating mode.
+type DNSSECConfig struct {
+	// TrustAnchors are the DS or DNSKEY records that chains of trust must
+	// end at, usually the root zone KSK.
+	TrustAnchors []dns.RR
+	// AllowIndeterminate lets answers through that can't be proven secure,
+	// insecure or bogus, such as when there is no trust anchor for the root
+	// zone or the resolver can't be reached for the records needed to decide.
+	// Insecure answers, from zones whose parent proves they are unsigned, are
+	// always accepted, and bogus answers are always rejected.
+	AllowIndeterminate bool
+}
+
+// LoadTrustAnchors reads DS and DNSKEY records in zone file format from
+// filename, for use as DNSSECConfig.TrustAnchors.
+func LoadTrustAnchors(filename string) ([]dns.RR, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var anchors []dns.RR
+	for token := range dns.ParseZone(f, ".", filename) {
+		if token.Error != nil {
+			return nil, token.Error
+		}
+		switch token.RR.(type) {
+		case *dns.DS, *dns.DNSKEY:
+			anchors = append(anchors, token.RR)
+		default:
+			return nil, fmt.Errorf("Trust anchor %s is not a DS or DNSKEY record", token.RR.Header().Name)
+		}
+	}
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("No trust anchors found in %s", filename)
+	}
+	return anchors, nil
+}
+
+type dnssecResult int
+
+// Results are ordered from best to worst, so that a response is as good as
+// the worst of its parts.
+const (
+	dnssecSecure dnssecResult = iota
+	// dnssecInsecure answers come from a zone that is provably unsigned,
+	// because a signed parent proves it has no DS records.
+	dnssecInsecure
+	dnssecIndeterminate
+	dnssecBogus
+)
+
+// maxCNAMEs bounds the CNAME chain followed within a single response.
+const maxCNAMEs = 8
+
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+// groupRRsets splits a section of a response into RRsets and the signatures
+// covering them, keeping the RRsets in the order they first appear.
+func groupRRsets(section []dns.RR) ([]rrsetKey, map[rrsetKey][]dns.RR, map[rrsetKey][]*dns.RRSIG) {
+	var order []rrsetKey
+	rrsets := make(map[rrsetKey][]dns.RR)
+	sigs := make(map[rrsetKey][]*dns.RRSIG)
+	for _, rr := range section {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key := rrsetKey{canonicalName(sig.Hdr.Name), sig.TypeCovered}
+			sigs[key] = append(sigs[key], sig)
+			continue
+		}
+		key := rrsetKey{canonicalName(rr.Header().Name), rr.Header().Rrtype}
+		if _, ok := rrsets[key]; !ok {
+			order = append(order, key)
+		}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+	return order, rrsets, sigs
+}
+
+// validateResponse checks every RRset in the answer section of rsp against
+// the configured trust anchors, along with the proof of non-existence if
+// there is no answer for the name and type asked about. It returns a
+// DNSSECError if any part is bogus, or if any is indeterminate and the
+// configuration doesn't allow that. Insecure answers are accepted.
+func (dnsResolver *DNSResolverImpl) validateResponse(rsp *dns.Msg) error {
+	if len(rsp.Question) == 0 {
+		return dnsResolver.dnssecVerdict("", dnssecIndeterminate, fmt.Errorf("response has no question"))
+	}
+	if rsp.Rcode != dns.RcodeSuccess && rsp.Rcode != dns.RcodeNameError {
+		// Other failures don't carry any data that could be forged
+		return nil
+	}
+	q := rsp.Question[0]
+
+	worst, worstErr, name := dnssecSecure, error(nil), q.Name
+	note := func(owner string, result dnssecResult, err error) {
+		if result > worst {
+			worst, worstErr, name = result, err, owner
+		}
+	}
+
+	order, rrsets, sigs := groupRRsets(rsp.Answer)
+	for _, key := range order {
+		result, err := dnsResolver.validateAnswer(rsp, rrsets[key], sigs[key])
+		note(key.name, result, err)
+	}
+
+	// Follow CNAMEs to the name the answer is finally about. If it has no
+	// records of the type asked for, their absence has to be proven too.
+	target := canonicalName(q.Name)
+	for i := 0; i < maxCNAMEs && q.Qtype != dns.TypeCNAME; i++ {
+		cname, ok := rrsets[rrsetKey{target, dns.TypeCNAME}]
+		if !ok {
+			break
+		}
+		target = canonicalName(cname[0].(*dns.CNAME).Target)
+	}
+	if _, ok := rrsets[rrsetKey{target, q.Qtype}]; !ok {
+		result, err := dnsResolver.validateDenial(rsp, target, q.Qtype)
+		note(target, result, err)
+	}
+	return dnsResolver.dnssecVerdict(name, worst, worstErr)
+}
+
+// dnssecVerdict applies the indeterminate policy to a validation result.
+func (dnsResolver *DNSResolverImpl) dnssecVerdict(name string, result dnssecResult, err error) error {
+	switch result {
+	case dnssecBogus:
+		return DNSSECError(fmt.Sprintf("DNSSEC validation failed for %s: %s", name, err))
+	case dnssecIndeterminate:
+		if !dnsResolver.DNSSEC.AllowIndeterminate {
+			return DNSSECError(fmt.Sprintf("No DNSSEC chain of trust for %s: %s", name, err))
+		}
+	}
+	return nil
+}
+
+// validateAnswer validates one RRset from the answer section of rsp. Unsigned
+// records are only acceptable from a zone that is provably insecure, and
+// records synthesized from a wildcard need proof that there is no closer
+// match.
+func (dnsResolver *DNSResolverImpl) validateAnswer(rsp *dns.Msg, rrset []dns.RR, sigs []*dns.RRSIG) (dnssecResult, error) {
+	name := canonicalName(rrset[0].Header().Name)
+	if len(sigs) == 0 {
+		return dnsResolver.validateUnsigned(name, rrset[0].Header().Rrtype, 1)
+	}
+
+	result, sig, err := dnsResolver.validateRRset(rrset, sigs, 0)
+	if result != dnssecSecure || int(sig.Labels) == dns.CountLabel(name) || strings.HasPrefix(name, "*.") {
+		return result, err
+	}
+
+	// The answer was expanded from a wildcard, so the signing zone has to
+	// prove that the name asked about doesn't exist.
+	zone := canonicalName(sig.SignerName)
+	keys, result, err := dnsResolver.zoneKeys(zone, 1)
+	if result != dnssecSecure {
+		return result, err
+	}
+	nsecs, nsec3s := verifiedDenials(rsp, zone, keys)
+	nextCloser := lastLabels(name, int(sig.Labels)+1)
+	for _, nsec := range nsecs {
+		if nsecCovers(nsec, name) {
+			return dnssecSecure, nil
+		}
+	}
+	for _, nsec3 := range nsec3s {
+		if nsec3Covers(nsec3, nextCloser) {
+			return dnssecSecure, nil
+		}
+	}
+	return dnssecBogus, fmt.Errorf("no proof that %s doesn't exist for a wildcard answer", name)
+}
+
+// validateUnsigned decides whether unsigned records of type rtype at name are
+// acceptable, which they are only if the zone they're in is insecure.
+func (dnsResolver *DNSResolverImpl) validateUnsigned(name string, rtype uint16, depth int) (dnssecResult, error) {
+	zone, err := dnsResolver.findZone(name)
+	if err != nil {
+		return dnssecIndeterminate, err
+	}
+	_, result, err := dnsResolver.zoneKeys(zone, depth)
+	if result == dnssecSecure {
+		return dnssecBogus, fmt.Errorf("%s records are unsigned in signed zone %s", dns.TypeToString[rtype], zone)
+	}
+	return result, err
+}
+
+// validateRRset looks for a signature over rrset made by a key that chains
+// up to a trust anchor, and returns the signature that verified.
+func (dnsResolver *DNSResolverImpl) validateRRset(rrset []dns.RR, sigs []*dns.RRSIG, depth int) (dnssecResult, *dns.RRSIG, error) {
+	if len(sigs) == 0 {
+		return dnssecBogus, nil, fmt.Errorf("%s records are unsigned", dns.TypeToString[rrset[0].Header().Rrtype])
+	}
+
+	name := rrset[0].Header().Name
+	now := time.Now()
+	err := fmt.Errorf("no valid signature")
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(now) {
+			err = fmt.Errorf("signature by %s is outside its validity period", sig.SignerName)
+			continue
+		}
+		if !dns.IsSubDomain(canonicalName(sig.SignerName), canonicalName(name)) || int(sig.Labels) > dns.CountLabel(name) {
+			err = fmt.Errorf("signer %s is not an ancestor", sig.SignerName)
+			continue
+		}
+		keys, result, keyErr := dnsResolver.zoneKeys(sig.SignerName, depth+1)
+		if result != dnssecSecure {
+			return result, nil, keyErr
+		}
+		if verifyRRset(rrset, []*dns.RRSIG{sig}, keys, now) {
+			return dnssecSecure, sig, nil
+		}
+		err = fmt.Errorf("signature by %s does not verify", sig.SignerName)
+	}
+	return dnssecBogus, nil, err
+}
+
+// verifyRRset reports whether one of sigs is a currently valid signature over
+// rrset by one of keys.
+func verifyRRset(rrset []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY, now time.Time) bool {
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(now) {
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() == sig.KeyTag && key.Algorithm == sig.Algorithm && sig.Verify(key, rrset) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// zoneKeys returns the DNSKEY set of zone once it has been authenticated,
+// either against a configured trust anchor or against a secure DS set in the
+// parent zone. If the parent proves that zone has no DS records, the zone is
+// insecure and no keys are returned.
+func (dnsResolver *DNSResolverImpl) zoneKeys(zone string, depth int) ([]*dns.DNSKEY, dnssecResult, error) {
+	if depth > maxDNSSECDepth {
+		return nil, dnssecBogus, fmt.Errorf("chain of trust is too long")
+	}
+	zone = canonicalName(zone)
+
+	var anchors []dns.RR
+	for _, anchor := range dnsResolver.DNSSEC.TrustAnchors {
+		if canonicalName(anchor.Header().Name) == zone {
+			anchors = append(anchors, anchor)
+		}
+	}
+	if len(anchors) == 0 {
+		if zone == "." {
+			return nil, dnssecIndeterminate, fmt.Errorf("no trust anchor for the root zone")
+		}
+		rsp, err := dnsResolver.query(zone, dns.TypeDS)
+		if err != nil {
+			return nil, dnssecIndeterminate, err
+		}
+		_, rrsets, sigs := groupRRsets(rsp.Answer)
+		key := rrsetKey{zone, dns.TypeDS}
+		dsSet := rrsets[key]
+		if len(dsSet) == 0 {
+			result, err := dnsResolver.validateNoDS(rsp, zone, depth)
+			return nil, result, err
+		}
+		if len(sigs[key]) == 0 {
+			// DS records live in the parent zone, which may be insecure
+			result, err := dnsResolver.validateUnsigned(parentName(zone), dns.TypeDS, depth+1)
+			return nil, result, err
+		}
+		if result, _, err := dnsResolver.validateRRset(dsSet, sigs[key], depth); result != dnssecSecure {
+			return nil, result, err
+		}
+		anchors = dsSet
+	}
+
+	rsp, err := dnsResolver.query(zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, dnssecIndeterminate, err
+	}
+	_, rrsets, sigs := groupRRsets(rsp.Answer)
+	key := rrsetKey{zone, dns.TypeDNSKEY}
+	keySet := rrsets[key]
+	var keys, trusted []*dns.DNSKEY
+	for _, rr := range keySet {
+		key := rr.(*dns.DNSKEY)
+		keys = append(keys, key)
+		if matchesAnchor(key, anchors) {
+			trusted = append(trusted, key)
+		}
+	}
+	if len(trusted) == 0 {
+		return nil, dnssecBogus, fmt.Errorf("no DNSKEY for %s matches its DS or trust anchor", zone)
+	}
+	if !verifyRRset(keySet, sigs[key], trusted, time.Now()) {
+		return nil, dnssecBogus, fmt.Errorf("DNSKEY set for %s is not signed by a trusted key", zone)
+	}
+	return keys, dnssecSecure, nil
+}
+
+// validateNoDS checks the parent zone's proof that zone, which has no DS
+// records, is an unsigned delegation. If the parent is signed but can't prove
+// it, the DS records may have been stripped, so the zone is bogus.
+func (dnsResolver *DNSResolverImpl) validateNoDS(rsp *dns.Msg, zone string, depth int) (dnssecResult, error) {
+	parent, err := dnsResolver.authorityZone(rsp, parentName(zone))
+	if err != nil {
+		return dnssecIndeterminate, err
+	}
+	keys, result, err := dnsResolver.zoneKeys(parent, depth+1)
+	if result != dnssecSecure {
+		// Everything below an insecure zone is insecure too
+		return result, err
+	}
+
+	nsecs, nsec3s := verifiedDenials(rsp, parent, keys)
+	for _, nsec := range nsecs {
+		if canonicalName(nsec.Hdr.Name) == zone {
+			if isUnsignedDelegation(nsec.TypeBitMap) {
+				return dnssecInsecure, nil
+			}
+			return dnssecBogus, fmt.Errorf("%s is not an unsigned delegation", zone)
+		}
+	}
+	for _, nsec3 := range nsec3s {
+		if nsec3Matches(nsec3, zone) {
+			if isUnsignedDelegation(nsec3.TypeBitMap) {
+				return dnssecInsecure, nil
+			}
+			return dnssecBogus, fmt.Errorf("%s is not an unsigned delegation", zone)
+		}
+	}
+	// With NSEC3 opt-out, unsigned delegations can be left out of the chain
+	if _, nextCloser, ok := closestEncloser(nsec3s, zone, parent); ok {
+		for _, nsec3 := range nsec3s {
+			if nsec3.Flags&nsec3OptOut != 0 && nsec3Covers(nsec3, nextCloser) {
+				return dnssecInsecure, nil
+			}
+		}
+	}
+	return dnssecBogus, fmt.Errorf("no proof that %s is an unsigned delegation", zone)
+}
+
+// validateDenial checks the proof in the authority section of rsp that name
+// doesn't exist, for an NXDOMAIN answer, or otherwise that it has no records
+// of type qtype.
+func (dnsResolver *DNSResolverImpl) validateDenial(rsp *dns.Msg, name string, qtype uint16) (dnssecResult, error) {
+	zone, err := dnsResolver.authorityZone(rsp, name)
+	if err != nil {
+		return dnssecIndeterminate, err
+	}
+	keys, result, err := dnsResolver.zoneKeys(zone, 1)
+	if result != dnssecSecure {
+		return result, err
+	}
+
+	nsecs, nsec3s := verifiedDenials(rsp, zone, keys)
+	if rsp.Rcode == dns.RcodeNameError {
+		if nsecProvesNXDomain(nsecs, name, zone) || nsec3ProvesNXDomain(nsec3s, name, zone) {
+			return dnssecSecure, nil
+		}
+		return dnssecBogus, fmt.Errorf("no proof that %s doesn't exist", name)
+	}
+	if nsecProvesNoData(nsecs, name, qtype, zone) || nsec3ProvesNoData(nsec3s, name, qtype, zone) {
+		return dnssecSecure, nil
+	}
+	return dnssecBogus, fmt.Errorf("no proof that %s has no %s records", name, dns.TypeToString[qtype])
+}
+
+// authorityZone returns the zone that a negative answer about name came
+// from, which is named by the signatures or SOA record in the authority
+// section. If there are none, the zone is looked up instead. Either way it
+// must be name or one of its ancestors; a false claim fails validation later,
+// since the zone's keys or its parent's proofs won't match.
+func (dnsResolver *DNSResolverImpl) authorityZone(rsp *dns.Msg, name string) (string, error) {
+	for _, rr := range rsp.Ns {
+		owner := ""
+		switch rr := rr.(type) {
+		case *dns.RRSIG:
+			owner = canonicalName(rr.SignerName)
+		case *dns.SOA:
+			owner = canonicalName(rr.Hdr.Name)
+		}
+		if owner != "" && dns.IsSubDomain(owner, name) {
+			return owner, nil
+		}
+	}
+	return dnsResolver.findZone(name)
+}
+
+// findZone returns the apex of the zone that name is in, by asking for the
+// SOA record of name and then of each of its ancestors until the answer
+// names a zone.
+func (dnsResolver *DNSResolverImpl) findZone(name string) (string, error) {
+	for name = canonicalName(name); name != "."; name = parentName(name) {
+		rsp, err := dnsResolver.query(name, dns.TypeSOA)
+		if err != nil {
+			return "", err
+		}
+		for _, rr := range append(rsp.Answer, rsp.Ns...) {
+			if soa, ok := rr.(*dns.SOA); ok && dns.IsSubDomain(canonicalName(soa.Hdr.Name), name) {
+				return canonicalName(soa.Hdr.Name), nil
+			}
+		}
+	}
+	return ".", nil
+}
+
+// verifiedDenials returns the NSEC and NSEC3 records in the authority section
+// of rsp that belong to zone and are signed by one of its keys.
+func verifiedDenials(rsp *dns.Msg, zone string, keys []*dns.DNSKEY) (nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) {
+	now := time.Now()
+	order, rrsets, sigs := groupRRsets(rsp.Ns)
+	for _, key := range order {
+		if key.rtype != dns.TypeNSEC && key.rtype != dns.TypeNSEC3 {
+			continue
+		}
+		if !dns.IsSubDomain(zone, key.name) || !verifyRRset(rrsets[key], sigs[key], keys, now) {
+			continue
+		}
+		for _, rr := range rrsets[key] {
+			switch rr := rr.(type) {
+			case *dns.NSEC:
+				nsecs = append(nsecs, rr)
+			case *dns.NSEC3:
+				// NSEC3 owners are a hash label directly under the apex
+				if parentName(key.name) == zone {
+					nsec3s = append(nsec3s, rr)
+				}
+			}
+		}
+	}
+	return
+}
+
+// matchesAnchor reports whether key is one of the DNSKEY anchors or hashes
+// to one of the DS anchors.
+func matchesAnchor(key *dns.DNSKEY, anchors []dns.RR) bool {
+	for _, anchor := range anchors {
+		switch a := anchor.(type) {
+		case *dns.DNSKEY:
+			if a.Algorithm == key.Algorithm && a.Flags == key.Flags && a.PublicKey == key.PublicKey {
+				return true
+			}
+		case *dns.DS:
+			ds := key.ToDS(a.DigestType)
+			if ds != nil && ds.KeyTag == a.KeyTag && strings.EqualFold(ds.Digest, a.Digest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// query fetches the records of type qtype at name without validating the
+// response.
+func (dnsResolver *DNSResolverImpl) query(name string, qtype uint16) (*dns.Msg, error) {
+	r, _, err := dnsResolver.exchange(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("DNS failure: %d-%s for %s query", r.Rcode, dns.RcodeToString[r.Rcode], dns.TypeToString[qtype])
+	}
+	return r, nil
+}
+
+// nsec3OptOut is the NSEC3 flag saying that unsigned delegations may be left
+// out of the hash chain.
+const nsec3OptOut = 1
+
+// canonicalName returns name fully qualified and in lower case, as DNSSEC
+// compares names.
+func canonicalName(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
+
+// parentName returns the name one label above name, or the root for the root.
+func parentName(name string) string {
+	if i := strings.Index(name, "."); i >= 0 && i < len(name)-1 {
+		return name[i+1:]
+	}
+	return "."
+}
+
+// lastLabels returns the ancestor of name made of its last n labels.
+func lastLabels(name string, n int) string {
+	labels := dns.SplitDomainName(name)
+	if n <= 0 {
+		return "."
+	}
+	if n > len(labels) {
+		n = len(labels)
+	}
+	return dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+}
+
+// wildcardOf returns the wildcard name directly below name.
+func wildcardOf(name string) string {
+	if name == "." {
+		return "*."
+	}
+	return "*." + name
+}
+
+// canonicalLess reports whether a sorts before b in the canonical DNS name
+// order of RFC 4034 section 6.1, which compares labels from the right.
+func canonicalLess(a, b string) bool {
+	la, lb := dns.SplitDomainName(canonicalName(a)), dns.SplitDomainName(canonicalName(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if la[i] != lb[j] {
+			return la[i] < lb[j]
+		}
+	}
+	return len(la) < len(lb)
+}
+
+func hasType(bitmap []uint16, rtype uint16) bool {
+	for _, t := range bitmap {
+		if t == rtype {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnsignedDelegation reports whether an NSEC or NSEC3 type bitmap in the
+// parent zone shows a delegation without DS records.
+func isUnsignedDelegation(bitmap []uint16) bool {
+	return hasType(bitmap, dns.TypeNS) && !hasType(bitmap, dns.TypeDS) && !hasType(bitmap, dns.TypeSOA)
+}
+
+// nsecCovers reports whether name falls strictly between the owner of nsec
+// and the next name, wrapping around at the end of the zone.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner, next := nsec.Hdr.Name, nsec.NextDomain
+	if !canonicalLess(owner, name) {
+		return false
+	}
+	return canonicalLess(name, next) || !canonicalLess(owner, next)
+}
+
+// nsecEncloser returns the closest encloser of name shown by an NSEC record
+// that covers it, which is the longest ancestor it shares with either end
+// of the gap.
+func nsecEncloser(nsec *dns.NSEC, name string) string {
+	n := dns.CompareDomainName(name, nsec.Hdr.Name)
+	if m := dns.CompareDomainName(name, nsec.NextDomain); m > n {
+		n = m
+	}
+	return lastLabels(name, n)
+}
+
+// nsecProvesNXDomain reports whether nsecs prove that name, in zone, doesn't
+// exist: one must cover name and another the wildcard that could have
+// matched instead.
+func nsecProvesNXDomain(nsecs []*dns.NSEC, name, zone string) bool {
+	for _, nsec := range nsecs {
+		// A next name below name makes it an empty non-terminal, which exists
+		if !nsecCovers(nsec, name) || dns.IsSubDomain(name, canonicalName(nsec.NextDomain)) {
+			continue
+		}
+		encloser := nsecEncloser(nsec, name)
+		if !dns.IsSubDomain(zone, encloser) {
+			continue
+		}
+		for _, wildcard := range nsecs {
+			if nsecCovers(wildcard, wildcardOf(encloser)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nsecProvesNoData reports whether nsecs prove that name, in zone, has no
+// records of type qtype: either name's own NSEC record leaves the type out,
+// name is an empty non-terminal, or name doesn't exist and the wildcard that
+// matches it leaves the type out.
+func nsecProvesNoData(nsecs []*dns.NSEC, name string, qtype uint16, zone string) bool {
+	for _, nsec := range nsecs {
+		if canonicalName(nsec.Hdr.Name) == name {
+			return !hasType(nsec.TypeBitMap, qtype) && !hasType(nsec.TypeBitMap, dns.TypeCNAME)
+		}
+	}
+	for _, nsec := range nsecs {
+		if !nsecCovers(nsec, name) {
+			continue
+		}
+		next := canonicalName(nsec.NextDomain)
+		if next != name && dns.IsSubDomain(name, next) {
+			return true
+		}
+		encloser := nsecEncloser(nsec, name)
+		if !dns.IsSubDomain(zone, encloser) {
+			continue
+		}
+		for _, wildcard := range nsecs {
+			if canonicalName(wildcard.Hdr.Name) == wildcardOf(encloser) {
+				return !hasType(wildcard.TypeBitMap, qtype) && !hasType(wildcard.TypeBitMap, dns.TypeCNAME)
+			}
+		}
+	}
+	return false
+}
+
+// nsec3Hashes returns the hash in the owner name of nsec3 and the hash of
+// name with the same parameters. The hash of name is empty if the hash
+// algorithm isn't supported.
+func nsec3Hashes(nsec3 *dns.NSEC3, name string) (owner, hashed string) {
+	owner = strings.ToUpper(dns.SplitDomainName(nsec3.Hdr.Name)[0])
+	hashed = dns.HashName(name, nsec3.Hash, nsec3.Iterations, nsec3.Salt)
+	return
+}
+
+// nsec3Matches reports whether nsec3 is the record for name.
+func nsec3Matches(nsec3 *dns.NSEC3, name string) bool {
+	owner, hashed := nsec3Hashes(nsec3, name)
+	return hashed != "" && hashed == owner
+}
+
+// nsec3Covers reports whether the hash of name falls strictly between the
+// hash of the owner of nsec3 and the next hash, wrapping around at the end
+// of the chain.
+func nsec3Covers(nsec3 *dns.NSEC3, name string) bool {
+	owner, hashed := nsec3Hashes(nsec3, name)
+	next := strings.ToUpper(nsec3.NextDomain)
+	if hashed == "" || hashed == owner {
+		return false
+	}
+	if owner < next {
+		return owner < hashed && hashed < next
+	}
+	return hashed > owner || hashed < next
+}
+
+// closestEncloser finds the closest encloser proof of RFC 5155 section 7.2.1
+// for name, which doesn't have an NSEC3 record of its own: the longest
+// ancestor of name in zone that does, and the next closer name below it,
+// whose hash must be covered.
+func closestEncloser(nsec3s []*dns.NSEC3, name, zone string) (encloser, nextCloser string, ok bool) {
+	nextCloser = name
+	for candidate := name; dns.IsSubDomain(zone, candidate); candidate = parentName(candidate) {
+		for _, nsec3 := range nsec3s {
+			if !nsec3Matches(nsec3, candidate) {
+				continue
+			}
+			if candidate == name {
+				return "", "", false
+			}
+			for _, cover := range nsec3s {
+				if nsec3Covers(cover, nextCloser) {
+					return candidate, nextCloser, true
+				}
+			}
+			return "", "", false
+		}
+		nextCloser = candidate
+		if candidate == "." {
+			break
+		}
+	}
+	return "", "", false
+}
+
+// nsec3ProvesNXDomain reports whether nsec3s prove that name, in zone,
+// doesn't exist: there must be a closest encloser proof, and the wildcard
+// below the closest encloser must be covered.
+func nsec3ProvesNXDomain(nsec3s []*dns.NSEC3, name, zone string) bool {
+	encloser, _, ok := closestEncloser(nsec3s, name, zone)
+	if !ok {
+		return false
+	}
+	for _, nsec3 := range nsec3s {
+		if nsec3Covers(nsec3, wildcardOf(encloser)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nsec3ProvesNoData reports whether nsec3s prove that name, in zone, has no
+// records of type qtype: either name's own NSEC3 record leaves the type out,
+// or name doesn't exist and the wildcard that matches it leaves the type out.
+func nsec3ProvesNoData(nsec3s []*dns.NSEC3, name string, qtype uint16, zone string) bool {
+	for _, nsec3 := range nsec3s {
+		if nsec3Matches(nsec3, name) {
+			return !hasType(nsec3.TypeBitMap, qtype) && !hasType(nsec3.TypeBitMap, dns.TypeCNAME)
+		}
+	}
+	encloser, _, ok := closestEncloser(nsec3s, name, zone)
+	if !ok {
+		return false
+	}
+	for _, nsec3 := range nsec3s {
+		if nsec3Matches(nsec3, wildcardOf(encloser)) {
+			return !hasType(nsec3.TypeBitMap, qtype) && !hasType(nsec3.TypeBitMap, dns.TypeCNAME)
+		}
+	}
+	return false
+}
@@ -0,0 +1,346 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/test"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+const dnssecLoopbackAddr = "127.0.0.1:4054"
+
+type signedZone struct {
+	key     *dns.DNSKEY
+	private dns.PrivateKey
+}
+
+func newSignedZone(t *testing.T, name string) *signedZone {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	private, err := key.Generate(256)
+	test.AssertNotError(t, err, "Couldn't generate zone key")
+	return &signedZone{key: key, private: private}
+}
+
+func (z *signedZone) sign(t *testing.T, expiration time.Time, rrset ...dns.RR) *dns.RRSIG {
+	sig := &dns.RRSIG{
+		Algorithm:  z.key.Algorithm,
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.key.Hdr.Name,
+		Inception:  uint32(expiration.Add(-2 * time.Hour).Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	test.AssertNotError(t, sig.Sign(z.private, rrset), "Couldn't sign RRset")
+	return sig
+}
+
+func aRecord(name, ip string) *dns.A {
+	return &dns.A{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP(ip),
+	}
+}
+
+func soaRecord(zone string) *dns.SOA {
+	apex := strings.TrimPrefix(zone, ".")
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60},
+		Ns:      "ns." + apex,
+		Mbox:    "hostmaster." + apex,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  60,
+	}
+}
+
+func nsecRecord(owner, next string, types ...uint16) *dns.NSEC {
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 60},
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+}
+
+// nsec3Chain returns the NSEC3 records for the names of zone, which map to
+// the types present at each name.
+func nsec3Chain(zone string, names map[string][]uint16) map[string]*dns.NSEC3 {
+	hashes := make(map[string]string)
+	var sorted []string
+	for name := range names {
+		h := dns.HashName(name, dns.SHA1, 0, "")
+		hashes[h] = name
+		sorted = append(sorted, h)
+	}
+	sort.Strings(sorted)
+	chain := make(map[string]*dns.NSEC3)
+	for i, h := range sorted {
+		chain[hashes[h]] = &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: h + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 60},
+			Hash:       dns.SHA1,
+			HashLength: 20,
+			NextDomain: sorted[(i+1)%len(sorted)],
+			TypeBitMap: names[hashes[h]],
+		}
+	}
+	return chain
+}
+
+type dnssecResponse struct {
+	rcode  int
+	answer []dns.RR
+	ns     []dns.RR
+}
+
+// serveSignedZones starts a server answering from a root zone that delegates
+// securely to signed.test. and nsec3.test., insecurely to unsigned.test., and
+// to stripped.test., a signed zone whose DS records and the proof of their
+// absence are missing. It returns the root key to use as a trust anchor.
+func serveSignedZones(t *testing.T) (*dns.DNSKEY, func()) {
+	root := newSignedZone(t, ".")
+	signed := newSignedZone(t, "signed.test.")
+	unsigned := newSignedZone(t, "unsigned.test.")
+	nsec3 := newSignedZone(t, "nsec3.test.")
+	stripped := newSignedZone(t, "stripped.test.")
+	valid := time.Now().Add(time.Hour)
+	expired := time.Now().Add(-time.Hour)
+
+	responses := make(map[string]*dnssecResponse)
+	respond := func(name string, qtype uint16) *dnssecResponse {
+		key := strings.ToLower(name) + dns.TypeToString[qtype]
+		if responses[key] == nil {
+			responses[key] = &dnssecResponse{rcode: dns.RcodeSuccess}
+		}
+		return responses[key]
+	}
+	// signedBy returns rrs followed by z's signature over them
+	signedBy := func(z *signedZone, rrs ...dns.RR) []dns.RR {
+		return append(rrs, z.sign(t, valid, rrs...))
+	}
+
+	for _, z := range []*signedZone{root, signed, unsigned, nsec3, stripped} {
+		respond(z.key.Hdr.Name, dns.TypeDNSKEY).answer = signedBy(z, z.key)
+	}
+	for _, z := range []*signedZone{signed, unsigned, nsec3} {
+		respond(z.key.Hdr.Name, dns.TypeSOA).answer = signedBy(z, soaRecord(z.key.Hdr.Name))
+	}
+	for _, z := range []*signedZone{signed, nsec3} {
+		ds := z.key.ToDS(dns.SHA256)
+		ds.Hdr.Ttl = 3600
+		respond(z.key.Hdr.Name, dns.TypeDS).answer = signedBy(root, ds)
+	}
+	r := respond("unsigned.test.", dns.TypeDS)
+	r.ns = append(signedBy(root, soaRecord(".")),
+		signedBy(root, nsecRecord("unsigned.test.", ".", dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC))...)
+
+	// signed.test. uses NSEC, with the chain
+	// signed.test. bogus. expired. plain. secure. *.wild.
+	signedSOA := signedBy(signed, soaRecord("signed.test."))
+	apexNSEC := signedBy(signed, nsecRecord("signed.test.", "bogus.signed.test.",
+		dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY))
+	expiredNSEC := signedBy(signed, nsecRecord("expired.signed.test.", "plain.signed.test.",
+		dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC))
+	secureNSEC := signedBy(signed, nsecRecord("secure.signed.test.", "*.wild.signed.test.",
+		dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC))
+	wildNSEC := signedBy(signed, nsecRecord("*.wild.signed.test.", "signed.test.",
+		dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC))
+
+	secure := aRecord("secure.signed.test.", "1.2.3.4")
+	respond("secure.signed.test.", dns.TypeA).answer = signedBy(signed, secure)
+	r = respond("secure.signed.test.", dns.TypeAAAA)
+	r.ns = append(append([]dns.RR{}, signedSOA...), secureNSEC...)
+
+	// Signed as 1.2.3.4 but served as 5.6.7.8
+	tampered := aRecord("bogus.signed.test.", "1.2.3.4")
+	sig := signed.sign(t, valid, tampered)
+	respond("bogus.signed.test.", dns.TypeA).answer = []dns.RR{aRecord("bogus.signed.test.", "5.6.7.8"), sig}
+
+	stale := aRecord("expired.signed.test.", "1.2.3.4")
+	respond("expired.signed.test.", dns.TypeA).answer = []dns.RR{stale, signed.sign(t, expired, stale)}
+
+	respond("plain.signed.test.", dns.TypeA).answer = []dns.RR{aRecord("plain.signed.test.", "1.2.3.4")}
+
+	r = respond("nonexistent.signed.test.", dns.TypeA)
+	r.rcode = dns.RcodeNameError
+	r.ns = append(append(append([]dns.RR{}, signedSOA...), expiredNSEC...), apexNSEC...)
+
+	r = respond("unproven.signed.test.", dns.TypeA)
+	r.rcode = dns.RcodeNameError
+	r.ns = signedSOA
+
+	// Answers expanded from *.wild.signed.test., with and without proof that
+	// the name asked about doesn't exist
+	wildSig := signed.sign(t, valid, aRecord("*.wild.signed.test.", "1.2.3.4"))
+	expand := func(name string) []dns.RR {
+		sig := *wildSig
+		sig.Hdr.Name = name
+		return []dns.RR{aRecord(name, "1.2.3.4"), &sig}
+	}
+	r = respond("foo.wild.signed.test.", dns.TypeA)
+	r.answer = expand("foo.wild.signed.test.")
+	r.ns = wildNSEC
+	respond("bare.wild.signed.test.", dns.TypeA).answer = expand("bare.wild.signed.test.")
+
+	// unsigned.test. is provably insecure, so its records are accepted
+	// whether they're signed or not
+	insecure := aRecord("www.unsigned.test.", "1.2.3.4")
+	respond("www.unsigned.test.", dns.TypeA).answer = signedBy(unsigned, insecure)
+	respond("plain.unsigned.test.", dns.TypeA).answer = []dns.RR{aRecord("plain.unsigned.test.", "1.2.3.4")}
+
+	strippedA := aRecord("www.stripped.test.", "1.2.3.4")
+	respond("www.stripped.test.", dns.TypeA).answer = signedBy(stripped, strippedA)
+
+	// nsec3.test. uses NSEC3
+	chain := nsec3Chain("nsec3.test.", map[string][]uint16{
+		"nsec3.test.":      {dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM},
+		"host.nsec3.test.": {dns.TypeA, dns.TypeRRSIG},
+	})
+	nsec3SOA := signedBy(nsec3, soaRecord("nsec3.test."))
+	host := aRecord("host.nsec3.test.", "1.2.3.4")
+	respond("host.nsec3.test.", dns.TypeA).answer = signedBy(nsec3, host)
+	r = respond("host.nsec3.test.", dns.TypeAAAA)
+	r.ns = append(append([]dns.RR{}, nsec3SOA...), signedBy(nsec3, chain["host.nsec3.test."])...)
+	r = respond("missing.nsec3.test.", dns.TypeA)
+	r.rcode = dns.RcodeNameError
+	r.ns = append(append(append([]dns.RR{}, nsec3SOA...),
+		signedBy(nsec3, chain["nsec3.test."])...), signedBy(nsec3, chain["host.nsec3.test."])...)
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, r *dns.Msg) {
+		defer w.Close()
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for _, q := range r.Question {
+			if resp, ok := responses[strings.ToLower(q.Name)+dns.TypeToString[q.Qtype]]; ok {
+				m.Rcode = resp.rcode
+				m.Answer = append(m.Answer, resp.answer...)
+				m.Ns = append(m.Ns, resp.ns...)
+			}
+		}
+		w.WriteMsg(m)
+	})
+	started := make(chan bool, 1)
+	server := &dns.Server{
+		Addr:              dnssecLoopbackAddr,
+		Net:               "udp",
+		Handler:           mux,
+		ReadTimeout:       time.Millisecond,
+		WriteTimeout:      time.Millisecond,
+		NotifyStartedFunc: func() { started <- true },
+	}
+	go server.ListenAndServe()
+	<-started
+	return root.key, func() { go server.Shutdown() }
+}
+
+func TestDNSSECValidation(t *testing.T) {
+	rootKey, stop := serveSignedZones(t)
+	defer stop()
+
+	testCases := []struct {
+		name     string
+		qtype    uint16
+		accepted bool
+	}{
+		{"secure.signed.test", dns.TypeA, true},
+		{"secure.signed.test", dns.TypeAAAA, true},
+		{"nonexistent.signed.test", dns.TypeA, true},
+		{"foo.wild.signed.test", dns.TypeA, true},
+		{"www.unsigned.test", dns.TypeA, true},
+		{"plain.unsigned.test", dns.TypeA, true},
+		{"host.nsec3.test", dns.TypeA, true},
+		{"host.nsec3.test", dns.TypeAAAA, true},
+		{"missing.nsec3.test", dns.TypeA, true},
+		{"bogus.signed.test", dns.TypeA, false},
+		{"expired.signed.test", dns.TypeA, false},
+		{"plain.signed.test", dns.TypeA, false},
+		{"unproven.signed.test", dns.TypeA, false},
+		{"bare.wild.signed.test", dns.TypeA, false},
+		{"www.stripped.test", dns.TypeA, false},
+	}
+
+	// Secure and insecure answers are accepted and bogus ones rejected
+	// whether or not indeterminate answers are allowed
+	for _, allowIndeterminate := range []bool{false, true} {
+		resolver := NewTestDNSResolverImpl(time.Second*10, []string{dnssecLoopbackAddr})
+		resolver.DNSSEC = &DNSSECConfig{
+			TrustAnchors:       []dns.RR{rootKey},
+			AllowIndeterminate: allowIndeterminate,
+		}
+		for _, tc := range testCases {
+			_, _, err := resolver.ExchangeOne(tc.name, tc.qtype)
+			if tc.accepted {
+				test.AssertNotError(t, err, "Lookup of "+tc.name+" was rejected")
+				continue
+			}
+			_, ok := err.(DNSSECError)
+			test.Assert(t, ok, "Lookup of "+tc.name+" didn't fail with a DNSSECError")
+		}
+	}
+
+	// Without a trust anchor for the root, unsigned.test. can't be shown to
+	// be insecure, so its answers are indeterminate
+	for _, allowIndeterminate := range []bool{false, true} {
+		resolver := NewTestDNSResolverImpl(time.Second*10, []string{dnssecLoopbackAddr})
+		resolver.DNSSEC = &DNSSECConfig{
+			TrustAnchors:       []dns.RR{newSignedZone(t, "other.test.").key},
+			AllowIndeterminate: allowIndeterminate,
+		}
+		_, _, err := resolver.ExchangeOne("www.unsigned.test", dns.TypeA)
+		if allowIndeterminate {
+			test.AssertNotError(t, err, "Indeterminate lookup was rejected")
+		} else {
+			_, ok := err.(DNSSECError)
+			test.Assert(t, ok, "Indeterminate lookup didn't fail with a DNSSECError")
+		}
+	}
+
+	// A trust anchor that doesn't match the root key makes everything bogus
+	otherRoot := newSignedZone(t, ".")
+	resolver := NewTestDNSResolverImpl(time.Second*10, []string{dnssecLoopbackAddr})
+	resolver.DNSSEC = &DNSSECConfig{TrustAnchors: []dns.RR{otherRoot.key.ToDS(dns.SHA256)}, AllowIndeterminate: true}
+	_, _, err := resolver.LookupHost("secure.signed.test")
+	_, ok := err.(DNSSECError)
+	test.Assert(t, ok, "Lookup with the wrong trust anchor succeeded")
+
+	// Without DNSSEC configured answers are taken as they come
+	resolver = NewTestDNSResolverImpl(time.Second*10, []string{dnssecLoopbackAddr})
+	addrs, _, err := resolver.LookupHost("bogus.signed.test")
+	test.AssertNotError(t, err, "Non-validating lookup failed")
+	test.AssertEquals(t, len(addrs), 1)
+}
+
+func TestLoadTrustAnchors(t *testing.T) {
+	anchors, err := LoadTrustAnchors("../test/dnssec/root.key")
+	test.AssertNotError(t, err, "Couldn't load test trust anchor")
+	test.AssertEquals(t, len(anchors), 1)
+	test.AssertEquals(t, anchors[0].Header().Name, ".")
+
+	_, err = LoadTrustAnchors("../test/dnssec/nonexistent.key")
+	test.AssertError(t, err, "Loaded a missing file")
+
+	f, err := ioutil.TempFile("", "anchors")
+	test.AssertNotError(t, err, "Couldn't create temp file")
+	defer os.Remove(f.Name())
+	f.WriteString(". 3600 IN A 1.2.3.4\n")
+	f.Close()
+	_, err = LoadTrustAnchors(f.Name())
+	test.AssertError(t, err, "Loaded an A record as a trust anchor")
+}
@@ -13,7 +13,6 @@ import (
 
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
-	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
 )
 
 // A WebFrontEnd object supplies methods that can be hooked into
@@ -76,6 +75,9 @@ type RegistrationAuthority interface {
 	// [AdminRevoker]
 	AdministrativelyRevokeCertificate(x509.Certificate, RevocationCode, string) error
 
+	// [AuthzReviewer]
+	ReviewAuthorization(string, bool, string) error
+
 	// [ValidationAuthority]
 	OnValidationUpdate(Authorization) error
 }
@@ -84,20 +86,25 @@ type RegistrationAuthority interface {
 type ValidationAuthority interface {
 	// [RegistrationAuthority]
 	UpdateValidations(Authorization, int) error
-	CheckCAARecords(AcmeIdentifier) (bool, bool, error)
+	CheckCAARecords(AcmeIdentifier, string, string) (bool, bool, error)
+
+	// [ValidationAuthority]
+	PerformValidation(AcmeIdentifier, Challenge) (Challenge, error)
+	PerformCAACheck(AcmeIdentifier, string, string) (bool, bool, error)
 }
 
 // CertificateAuthority defines the public interface for the Boulder CA
 type CertificateAuthority interface {
 	// [RegistrationAuthority]
-	IssueCertificate(x509.CertificateRequest, int64, time.Time) (Certificate, error)
+	IssueCertificate(x509.CertificateRequest, int64, time.Time, string) (Certificate, error)
 	RevokeCertificate(string, RevocationCode) error
 	GenerateOCSP(OCSPSigningRequest) ([]byte, error)
 }
 
 // PolicyAuthority defines the public interface for the Boulder PA
 type PolicyAuthority interface {
-	WillingToIssue(AcmeIdentifier) error
+	WillingToIssue(AcmeIdentifier, int64) error
+	ReviewRuleFor(AcmeIdentifier) (string, error)
 	ChallengesFor(AcmeIdentifier) ([]Challenge, [][]int)
 }
 
@@ -111,6 +118,7 @@ type StorageGetter interface {
 	GetCertificateByShortSerial(string) (Certificate, error)
 	GetCertificateStatus(string) (CertificateStatus, error)
 	AlreadyDeniedCSR([]string) (bool, error)
+	KeyBlocked(string) (bool, error)
 }
 
 // StorageAdder are the Boulder SA's write/update methods
@@ -135,10 +143,21 @@ type StorageAuthority interface {
 	StorageAdder
 }
 
-// CertificateAuthorityDatabase represents an atomic sequence source
-type CertificateAuthorityDatabase interface {
-	IncrementAndGetSerial(*gorp.Transaction) (int64, error)
-	Begin() (*gorp.Transaction, error)
+// PrimaryReader is implemented by StorageGetters that may serve reads from a
+// replica that lags behind the primary database. Primary returns a
+// StorageGetter that reads from the primary instead.
+type PrimaryReader interface {
+	Primary() StorageGetter
+}
+
+// ReadYourWrites returns a StorageGetter that sees every write already made
+// to sa, for flows that read back something they, or the client, have just
+// written: from the primary if sa implements PrimaryReader, or sa itself.
+func ReadYourWrites(sa StorageGetter) StorageGetter {
+	if pr, ok := sa.(PrimaryReader); ok {
+		return pr.Primary()
+	}
+	return sa
 }
 
 // DNSResolver defines methods used for DNS resolution
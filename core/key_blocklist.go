@@ -0,0 +1,175 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// debianHashLength is the length of the truncated hex SHA-1 digests used by
+// the Debian openssl-blacklist package (the last 80 bits of the digest).
+const debianHashLength = 20
+
+// KeyBlocklist is a set of public keys which must never be accepted, either
+// for an account or in a certificate request, regardless of whether they are
+// otherwise acceptable to GoodKey. The list is loaded from hash files and is
+// supplemented at request time by the blockedKeys table in the SA.
+//
+// Each non-empty line of a hash file that does not start with '#' is either:
+//   - a 20 character hex string, in the format of the Debian openssl-blacklist
+//     package: the last 80 bits of SHA-1("Modulus=<upper case hex modulus>\n"),
+//     which only applies to RSA keys; or
+//   - a base64 SHA-256 digest of the DER encoded SubjectPublicKeyInfo, as
+//     computed by KeyDigest.
+type KeyBlocklist struct {
+	debianHashes map[string]bool
+	spkiDigests  map[string]bool
+}
+
+// NewKeyBlocklist returns an empty KeyBlocklist.
+func NewKeyBlocklist() *KeyBlocklist {
+	return &KeyBlocklist{
+		debianHashes: make(map[string]bool),
+		spkiDigests:  make(map[string]bool),
+	}
+}
+
+// LoadKeyBlocklist constructs a KeyBlocklist from the hash files at the given
+// paths.
+func LoadKeyBlocklist(paths []string) (*KeyBlocklist, error) {
+	kb := NewKeyBlocklist()
+	for _, path := range paths {
+		if err := kb.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return kb, nil
+}
+
+func (kb *KeyBlocklist) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err = kb.Add(line); err != nil {
+			return fmt.Errorf("%s:%d: %s", path, lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Add adds a single hash, in either of the formats accepted in hash files, to
+// the blocklist.
+func (kb *KeyBlocklist) Add(hash string) error {
+	if len(hash) == debianHashLength {
+		if _, err := hex.DecodeString(hash); err != nil {
+			return fmt.Errorf("Invalid key hash %q: %s", hash, err)
+		}
+		kb.debianHashes[strings.ToLower(hash)] = true
+		return nil
+	}
+	digest, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil || len(digest) != 32 {
+		return fmt.Errorf("Invalid key hash %q", hash)
+	}
+	kb.spkiDigests[hash] = true
+	return nil
+}
+
+// Size returns the number of hashes in the blocklist.
+func (kb *KeyBlocklist) Size() int {
+	return len(kb.debianHashes) + len(kb.spkiDigests)
+}
+
+// Blocked returns true if the key matches any hash in the blocklist.
+func (kb *KeyBlocklist) Blocked(key crypto.PublicKey) (bool, error) {
+	rsaKey := rsaPublicKey(key)
+	if rsaKey != nil {
+		// KeyDigest only handles pointers to RSA keys
+		key = rsaKey
+	}
+	digest, err := KeyDigest(key)
+	if err != nil {
+		return false, err
+	}
+	if kb.spkiDigests[digest] {
+		return true, nil
+	}
+	if rsaKey != nil {
+		return kb.debianHashes[debianHash(rsaKey)], nil
+	}
+	return false, nil
+}
+
+func rsaPublicKey(key crypto.PublicKey) *rsa.PublicKey {
+	switch t := key.(type) {
+	case *rsa.PublicKey:
+		return t
+	case rsa.PublicKey:
+		return &t
+	}
+	return nil
+}
+
+func debianHash(key *rsa.PublicKey) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("Modulus=%X\n", key.N)))
+	digest := hex.EncodeToString(sum[:])
+	return digest[len(digest)-debianHashLength:]
+}
+
+// CheckKeyBlocked returns a BlockedKeyError if the key is present in the
+// provided blocklist or in the blockedKeys table of the SA. Either of the
+// blocklist or the SA may be nil, in which case that source is skipped.
+func CheckKeyBlocked(key crypto.PublicKey, kb *KeyBlocklist, sa StorageGetter) error {
+	if kb != nil {
+		blocked, err := kb.Blocked(key)
+		if err != nil {
+			return MalformedRequestError(fmt.Sprintf("Unable to compute key digest: %s", err))
+		}
+		if blocked {
+			return BlockedKeyError("Key is on the blocklist of weak or compromised keys")
+		}
+	}
+	if sa != nil {
+		if rsaKey := rsaPublicKey(key); rsaKey != nil {
+			key = rsaKey
+		}
+		digest, err := KeyDigest(key)
+		if err != nil {
+			return MalformedRequestError(fmt.Sprintf("Unable to compute key digest: %s", err))
+		}
+		blocked, err := sa.KeyBlocked(digest)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			blog.GetAuditLogger().AuditErr(fmt.Errorf("Unable to check key blocklist: %s", err))
+			return InternalServerError("Unable to check key blocklist")
+		}
+		if blocked {
+			return BlockedKeyError("Key belongs to a certificate revoked for key compromise")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+type mockBlockedKeyGetter struct {
+	StorageGetter
+	blocked map[string]bool
+	err     error
+}
+
+func (m mockBlockedKeyGetter) KeyBlocked(digest string) (bool, error) {
+	return m.blocked[digest], m.err
+}
+
+func writeBlocklistFile(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "key-blocklist")
+	test.AssertNotError(t, err, "Failed to create temp file")
+	defer f.Close()
+	_, err = f.WriteString(contents)
+	test.AssertNotError(t, err, "Failed to write temp file")
+	return f.Name()
+}
+
+func TestKeyBlocklistFiles(t *testing.T) {
+	debianKey, err := rsa.GenerateKey(rand.Reader, 512)
+	test.AssertNotError(t, err, "Error generating key")
+	digestKey, err := rsa.GenerateKey(rand.Reader, 512)
+	test.AssertNotError(t, err, "Error generating key")
+	goodKey, err := rsa.GenerateKey(rand.Reader, 512)
+	test.AssertNotError(t, err, "Error generating key")
+
+	digest, err := KeyDigest(&digestKey.PublicKey)
+	test.AssertNotError(t, err, "Error computing digest")
+
+	debianFile := writeBlocklistFile(t, fmt.Sprintf("# comment\n\n%s\n", debianHash(&debianKey.PublicKey)))
+	defer os.Remove(debianFile)
+	digestFile := writeBlocklistFile(t, digest+"\n")
+	defer os.Remove(digestFile)
+
+	kb, err := LoadKeyBlocklist([]string{debianFile, digestFile})
+	test.AssertNotError(t, err, "Failed to load blocklist")
+	test.AssertEquals(t, kb.Size(), 2)
+
+	blocked, err := kb.Blocked(&debianKey.PublicKey)
+	test.AssertNotError(t, err, "Blocked failed")
+	test.Assert(t, blocked, "Debian hash was not blocked")
+
+	blocked, err = kb.Blocked(digestKey.PublicKey)
+	test.AssertNotError(t, err, "Blocked failed")
+	test.Assert(t, blocked, "SPKI digest was not blocked")
+
+	blocked, err = kb.Blocked(&goodKey.PublicKey)
+	test.AssertNotError(t, err, "Blocked failed")
+	test.Assert(t, !blocked, "Unlisted key was blocked")
+}
+
+func TestKeyBlocklistBadFile(t *testing.T) {
+	_, err := LoadKeyBlocklist([]string{"/does/not/exist"})
+	test.AssertError(t, err, "Loaded a missing file")
+
+	badFile := writeBlocklistFile(t, "not a hash\n")
+	defer os.Remove(badFile)
+	_, err = LoadKeyBlocklist([]string{badFile})
+	test.AssertError(t, err, "Loaded a file with an invalid hash")
+}
+
+func TestCheckKeyBlocked(t *testing.T) {
+	listedKey, err := rsa.GenerateKey(rand.Reader, 512)
+	test.AssertNotError(t, err, "Error generating key")
+	revokedKey, err := rsa.GenerateKey(rand.Reader, 512)
+	test.AssertNotError(t, err, "Error generating key")
+	goodKey, err := rsa.GenerateKey(rand.Reader, 512)
+	test.AssertNotError(t, err, "Error generating key")
+
+	kb := NewKeyBlocklist()
+	listedDigest, _ := KeyDigest(&listedKey.PublicKey)
+	test.AssertNotError(t, kb.Add(listedDigest), "Failed to add digest")
+	revokedDigest, _ := KeyDigest(&revokedKey.PublicKey)
+	sa := mockBlockedKeyGetter{blocked: map[string]bool{revokedDigest: true}}
+
+	err = CheckKeyBlocked(&listedKey.PublicKey, kb, sa)
+	_, ok := err.(BlockedKeyError)
+	test.Assert(t, ok, "Key on the blocklist was not rejected with BlockedKeyError")
+
+	err = CheckKeyBlocked(&revokedKey.PublicKey, kb, sa)
+	_, ok = err.(BlockedKeyError)
+	test.Assert(t, ok, "Key in the SA was not rejected with BlockedKeyError")
+
+	test.AssertNotError(t, CheckKeyBlocked(&goodKey.PublicKey, kb, sa), "Good key was rejected")
+	test.AssertNotError(t, CheckKeyBlocked(&revokedKey.PublicKey, nil, nil), "Key was rejected with no sources")
+
+	sa.err = errors.New("db down")
+	err = CheckKeyBlocked(&goodKey.PublicKey, kb, sa)
+	_, ok = err.(InternalServerError)
+	test.Assert(t, ok, "SA failure should be an InternalServerError")
+}
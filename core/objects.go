@@ -6,8 +6,10 @@
 package core
 
 import (
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -45,17 +47,19 @@ type ProblemDetails struct {
 
 // These statuses are the states of authorizations
 const (
-	StatusUnknown    = AcmeStatus("unknown")    // Unknown status; the default
-	StatusPending    = AcmeStatus("pending")    // In process; client has next action
-	StatusProcessing = AcmeStatus("processing") // In process; server has next action
-	StatusValid      = AcmeStatus("valid")      // Validation succeeded
-	StatusInvalid    = AcmeStatus("invalid")    // Validation failed
-	StatusRevoked    = AcmeStatus("revoked")    // Object no longer valid
+	StatusUnknown     = AcmeStatus("unknown")     // Unknown status; the default
+	StatusPending     = AcmeStatus("pending")     // In process; client has next action
+	StatusProcessing  = AcmeStatus("processing")  // In process; server has next action
+	StatusValid       = AcmeStatus("valid")       // Validation succeeded
+	StatusInvalid     = AcmeStatus("invalid")     // Validation failed
+	StatusRevoked     = AcmeStatus("revoked")     // Object no longer valid
+	StatusNeedsReview = AcmeStatus("needsReview") // Held; an administrator has next action
 )
 
 // These types are the available identification mechanisms
 const (
 	IdentifierDNS = IdentifierType("dns")
+	IdentifierIP  = IdentifierType("ip")
 )
 
 // The types of ACME resources
@@ -77,6 +81,7 @@ const (
 // Error types that can be used in ACME payloads
 const (
 	ConnectionProblem     = ProblemType("urn:acme:error:connection")
+	DNSSECProblem         = ProblemType("urn:acme:error:dnssec")
 	MalformedProblem      = ProblemType("urn:acme:error:malformed")
 	ServerInternalProblem = ProblemType("urn:acme:error:serverInternal")
 	TLSProblem            = ProblemType("urn:acme:error:tls")
@@ -89,11 +94,19 @@ const (
 	ChallengeTypeSimpleHTTP = "simpleHttp"
 	ChallengeTypeDVSNI      = "dvsni"
 	ChallengeTypeDNS        = "dns"
+	ChallengeTypeHTTP01     = "http-01"
+	ChallengeTypeTLSSNI01   = "tls-sni-01"
 )
 
+// The path at which HTTP challenge responses are provisioned
+const HTTPChallengePath = ".well-known/acme-challenge"
+
 // The suffix appended to pseudo-domain names in DVSNI challenges
 const DVSNISuffix = "acme.invalid"
 
+// The suffix appended to pseudo-domain names in tls-sni-01 challenges
+const TLSSNISuffix = "acme.invalid"
+
 // The label attached to DNS names in DNS challenges
 const DNSPrefix = "_acme-challenge"
 
@@ -149,9 +162,9 @@ func cmpIPSlice(a, b []net.IP) bool {
 
 // An AcmeIdentifier encodes an identifier that can
 // be validated by ACME.  The protocol allows for different
-// types of identifier to be supported (DNS names, IP
-// addresses, etc.), but currently we only support
-// domain names.
+// types of identifier to be supported; we support domain
+// names and IP addresses. IP addresses are given in the
+// form net.IP.String() produces.
 type AcmeIdentifier struct {
 	Type  IdentifierType `json:"type"`  // The type of identifier being encoded
 	Value string         `json:"value"` // The identifier itself
@@ -162,12 +175,14 @@ type AcmeIdentifier struct {
 // This data is unmarshalled from JSON by way of rawCertificateRequest, which
 // represents the actual structure received from the client.
 type CertificateRequest struct {
-	CSR   *x509.CertificateRequest // The CSR
-	Bytes []byte                   // The original bytes of the CSR, for logging.
+	CSR     *x509.CertificateRequest // The CSR
+	Bytes   []byte                   // The original bytes of the CSR, for logging.
+	Profile string                   // The requested certificate profile, if any
 }
 
 type rawCertificateRequest struct {
-	CSR JSONBuffer `json:"csr"` // The encoded CSR
+	CSR     JSONBuffer `json:"csr"`               // The encoded CSR
+	Profile string     `json:"profile,omitempty"` // The requested certificate profile
 }
 
 // UnmarshalJSON provides an implementation for decoding CertificateRequest objects.
@@ -184,13 +199,15 @@ func (cr *CertificateRequest) UnmarshalJSON(data []byte) error {
 
 	cr.CSR = csr
 	cr.Bytes = raw.CSR
+	cr.Profile = raw.Profile
 	return nil
 }
 
 // MarshalJSON provides an implementation for encoding CertificateRequest objects.
 func (cr CertificateRequest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(rawCertificateRequest{
-		CSR: cr.CSR.Raw,
+		CSR:     cr.CSR.Raw,
+		Profile: cr.Profile,
 	})
 }
 
@@ -222,10 +239,85 @@ func (r *Registration) MergeUpdate(input Registration) {
 	}
 }
 
+// KeyAuthorization is the response to http-01 challenges: the challenge token
+// and the thumbprint of the account key, joined by a "." when serialized. It
+// proves that whoever provisioned the response holds the account key, without
+// requiring a signature.
+type KeyAuthorization struct {
+	Token      string
+	Thumbprint string
+}
+
+// NewKeyAuthorization computes the key authorization for a token and account
+// key.
+func NewKeyAuthorization(token string, key *jose.JsonWebKey) (KeyAuthorization, error) {
+	thumbprint, err := Thumbprint(key)
+	if err != nil {
+		return KeyAuthorization{}, err
+	}
+	return KeyAuthorization{Token: token, Thumbprint: thumbprint}, nil
+}
+
+// NewKeyAuthorizationFromString parses a serialized key authorization.
+func NewKeyAuthorizationFromString(input string) (KeyAuthorization, error) {
+	parts := strings.Split(input, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return KeyAuthorization{}, fmt.Errorf("Invalid key authorization: %q", input)
+	}
+	return KeyAuthorization{Token: parts[0], Thumbprint: parts[1]}, nil
+}
+
+// String produces the serialized form of the key authorization.
+func (ka KeyAuthorization) String() string {
+	return ka.Token + "." + ka.Thumbprint
+}
+
+// Match returns true if the key authorization is for the given token and
+// account key.
+func (ka KeyAuthorization) Match(token string, key *jose.JsonWebKey) bool {
+	if key == nil {
+		return false
+	}
+	thumbprint, err := Thumbprint(key)
+	if err != nil {
+		return false
+	}
+	return ka.Token == token && ka.Thumbprint == thumbprint
+}
+
+// TLSSNIName computes the pseudo-domain name which tls-sni-01 challenges are
+// validated against: the hex SHA256 digest of the key authorization, split
+// into two labels, with TLSSNISuffix appended. The same name is used both for
+// SNI and as the expected dNSName SAN.
+func (ka KeyAuthorization) TLSSNIName() string {
+	h := sha256.Sum256([]byte(ka.String()))
+	z := hex.EncodeToString(h[:])
+	return fmt.Sprintf("%s.%s.%s", z[:32], z[32:], TLSSNISuffix)
+}
+
+// MarshalJSON packs a key authorization into its string form.
+func (ka KeyAuthorization) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ka.String())
+}
+
+// UnmarshalJSON unpacks a key authorization from its string form.
+func (ka *KeyAuthorization) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	parsed, err := NewKeyAuthorizationFromString(str)
+	if err != nil {
+		return err
+	}
+	*ka = parsed
+	return nil
+}
+
 // ValidationRecord represents a validation attempt against a specific URL/hostname
 // and the IP addresses that were resolved and used
 type ValidationRecord struct {
-	// SimpleHTTP only
+	// SimpleHTTP and http-01 only
 	URL string `json:"url,omitempty"`
 
 	// Shared
@@ -233,6 +325,14 @@ type ValidationRecord struct {
 	Port              string   `json:"port"`
 	AddressesResolved []net.IP `json:"addressesResolved"`
 	AddressUsed       net.IP   `json:"addressUsed"`
+	// Every address a connection was attempted to, in order. The VA prefers
+	// IPv6 and falls back to IPv4.
+	AddressesTried []net.IP `json:"addressesTried,omitempty"`
+
+	// Names of the network perspectives from which the validation succeeded.
+	// Only set on the last record of a challenge validated from more than
+	// one perspective.
+	Perspectives []string `json:"perspectives,omitempty"`
 }
 
 // Challenge is an aggregate of all data needed for any challenges.
@@ -257,12 +357,15 @@ type Challenge struct {
 	// A URI to which a response can be POSTed
 	URI *AcmeURL `json:"uri"`
 
-	// Used by simpleHttp, dvsni, and dns challenges
+	// Used by simpleHttp, http-01, dvsni, and dns challenges
 	Token string `json:"token,omitempty"`
 
 	// Used by simpleHTTP challenges
 	TLS *bool `json:"tls,omitempty"`
 
+	// Used by http-01 and tls-sni-01 challenges
+	KeyAuthorization *KeyAuthorization `json:"keyAuthorization,omitempty"`
+
 	// Used by dns and dvsni challenges
 	Validation *jose.JsonWebSignature `json:"validation,omitempty"`
 
@@ -289,14 +392,14 @@ func (ch Challenge) RecordsSane() bool {
 	}
 
 	switch ch.Type {
-	case ChallengeTypeSimpleHTTP:
+	case ChallengeTypeSimpleHTTP, ChallengeTypeHTTP01:
 		for _, rec := range ch.ValidationRecord {
 			if rec.URL == "" || rec.Hostname == "" || rec.Port == "" || rec.AddressUsed == nil ||
 				len(rec.AddressesResolved) == 0 {
 				return false
 			}
 		}
-	case ChallengeTypeDVSNI:
+	case ChallengeTypeDVSNI, ChallengeTypeTLSSNI01:
 		if len(ch.ValidationRecord) > 1 {
 			return false
 		}
@@ -308,7 +411,10 @@ func (ch Challenge) RecordsSane() bool {
 			return false
 		}
 	case ChallengeTypeDNS:
-		// Nothing for now
+		// Only the name whose TXT records were checked is recorded
+		if len(ch.ValidationRecord) > 1 || ch.ValidationRecord[0].Hostname == "" {
+			return false
+		}
 	}
 
 	return true
@@ -328,7 +434,7 @@ func (ch Challenge) IsSane(completed bool) bool {
 	switch ch.Type {
 	case ChallengeTypeSimpleHTTP:
 		// check extra fields aren't used
-		if ch.Validation != nil {
+		if ch.Validation != nil || ch.KeyAuthorization != nil {
 			return false
 		}
 
@@ -343,12 +449,31 @@ func (ch Challenge) IsSane(completed bool) bool {
 		if _, err := B64dec(ch.Token); err != nil {
 			return false
 		}
+	case ChallengeTypeHTTP01, ChallengeTypeTLSSNI01:
+		// check extra fields aren't used
+		if ch.Validation != nil || ch.TLS != nil {
+			return false
+		}
+
+		// check token is present, corrent length, and contains b64 encoded string
+		if ch.Token == "" || len(ch.Token) != 43 {
+			return false
+		}
+		if _, err := B64dec(ch.Token); err != nil {
+			return false
+		}
+
+		// If completed, check that the key authorization is for this
+		// challenge and account key
+		if completed && (ch.KeyAuthorization == nil || !ch.KeyAuthorization.Match(ch.Token, ch.AccountKey)) {
+			return false
+		}
 	case ChallengeTypeDVSNI:
 		// Same as DNS
 		fallthrough
 	case ChallengeTypeDNS:
 		// check extra fields aren't used
-		if ch.TLS != nil {
+		if ch.TLS != nil || ch.KeyAuthorization != nil {
 			return false
 		}
 
@@ -385,6 +510,12 @@ func (ch Challenge) MergeResponse(resp Challenge) Challenge {
 			*ch.TLS = true
 		}
 
+	case ChallengeTypeHTTP01, ChallengeTypeTLSSNI01:
+		// For http-01 and tls-sni-01, only "keyAuthorization" is client-provided
+		if resp.KeyAuthorization != nil {
+			ch.KeyAuthorization = resp.KeyAuthorization
+		}
+
 	case ChallengeTypeDVSNI:
 		fallthrough
 	case ChallengeTypeDNS:
@@ -429,6 +560,10 @@ type Authorization struct {
 	// The server may suggest combinations of challenges if it
 	// requires more than one challenge to be completed.
 	Combinations [][]int `json:"combinations,omitempty" db:"combinations"`
+
+	// The administrator who approved this authorization, if its identifier
+	// matched a review rule
+	ReviewedBy string `json:"reviewedBy,omitempty" db:"reviewedBy"`
 }
 
 // JSONBuffer fields get encoded and decoded JOSE-style, in base64url encoding
@@ -505,7 +640,7 @@ type ExternalCert struct {
 }
 
 // MatchesCSR tests the contents of a generated certificate to make sure
-// that the PublicKey, CommonName, and DNSNames match those provided in
+// that the PublicKey, CommonName, DNSNames and IPAddresses match those provided in
 // the CSR that was used to generate the certificate. It also checks the
 // following fields for:
 //		* notAfter is after earliestExpiry
@@ -521,12 +656,7 @@ func (cert Certificate) MatchesCSR(csr *x509.CertificateRequest, earliestExpiry
 	}
 
 	// Check issued certificate matches what was expected from the CSR
-	hostNames := make([]string, len(csr.DNSNames))
-	copy(hostNames, csr.DNSNames)
-	if len(csr.Subject.CommonName) > 0 {
-		hostNames = append(hostNames, csr.Subject.CommonName)
-	}
-	hostNames = UniqueNames(hostNames)
+	hostNames, ipAddresses := SubjectNames(csr.Subject.CommonName, csr.DNSNames, csr.IPAddresses)
 
 	if !KeyDigestEquals(parsedCertificate.PublicKey, csr.PublicKey) {
 		err = InternalServerError("Generated certificate public key doesn't match CSR public key")
@@ -540,7 +670,13 @@ func (cert Certificate) MatchesCSR(csr *x509.CertificateRequest, earliestExpiry
 		err = InternalServerError("Generated certificate DNSNames don't match CSR DNSNames")
 		return
 	}
-	if !cmpIPSlice(parsedCertificate.IPAddresses, csr.IPAddresses) {
+	for _, name := range parsedCertificate.DNSNames {
+		if base, _ := WildcardBase(name); strings.Contains(base, "*") {
+			err = InternalServerError(fmt.Sprintf("Generated certificate has a malformed wildcard name %s", name))
+			return
+		}
+	}
+	if !cmpIPSlice(parsedCertificate.IPAddresses, ipAddresses) {
 		err = InternalServerError("Generated certificate IPAddresses don't match CSR IPAddresses")
 		return
 	}
@@ -576,6 +712,22 @@ func (cert Certificate) MatchesCSR(csr *x509.CertificateRequest, earliestExpiry
 		err = InternalServerError("Generated certificate doesn't have correct key usage extensions")
 		return
 	}
+	// A certificate may be Must-Staple because of its profile even if the CSR
+	// didn't ask for it, but not the other way around
+	csrMustStaple, err := HasMustStaple(csr.Extensions)
+	if err != nil {
+		err = InternalServerError(fmt.Sprintf("CSR has an invalid TLS Feature extension: %s", err))
+		return
+	}
+	certMustStaple, err := HasMustStaple(parsedCertificate.Extensions)
+	if err != nil {
+		err = InternalServerError(fmt.Sprintf("Generated certificate has an invalid TLS Feature extension: %s", err))
+		return
+	}
+	if csrMustStaple && !certMustStaple {
+		err = InternalServerError("Generated certificate doesn't have the Must-Staple extension requested in the CSR")
+		return
+	}
 
 	return
 }
@@ -616,7 +768,8 @@ type CertificateStatus struct {
 // OCSPResponse is a (large) table of OCSP responses. This contains all
 // historical OCSP responses we've signed, is append-only, and is likely to get
 // quite large.
-// It must be administratively truncated outside of Boulder.
+// Superseded responses, and responses for expired certificates, are deleted
+// by db-pruner.
 type OCSPResponse struct {
 	ID int `db:"id"`
 
@@ -651,6 +804,19 @@ type DeniedCSR struct {
 	Names string `db:"names"`
 }
 
+// BlockedKey is a public key which must never be accepted, recorded by the
+// digest computed by KeyDigest.
+type BlockedKey struct {
+	// The base64 SHA-256 digest of the key's SubjectPublicKeyInfo
+	KeyDigest string `db:"keyDigest"`
+
+	// The serial of the certificate whose revocation caused the key to be
+	// blocked
+	CertSerial string `db:"certSerial"`
+
+	Added time.Time `db:"added"`
+}
+
 // OCSPSigningRequest is a transfer object representing an OCSP Signing Request
 type OCSPSigningRequest struct {
 	CertDER   []byte
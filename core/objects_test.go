@@ -8,6 +8,7 @@ package core
 import (
 	"encoding/json"
 	"net"
+	"strings"
 	"testing"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
@@ -64,6 +65,13 @@ func TestRecordSanityCheck(t *testing.T) {
 
 	chall.ValidationRecord = append(chall.ValidationRecord, rec...)
 	test.Assert(t, !chall.RecordsSane(), "Record should not be sane")
+
+	chall = Challenge{Type: ChallengeTypeDNS, ValidationRecord: []ValidationRecord{
+		ValidationRecord{Hostname: "_acme-challenge.localhost"},
+	}}
+	test.Assert(t, chall.RecordsSane(), "Record should be sane")
+	chall.ValidationRecord[0].Hostname = ""
+	test.Assert(t, !chall.RecordsSane(), "Record should not be sane")
 }
 
 func TestChallengeSanityCheck(t *testing.T) {
@@ -76,7 +84,7 @@ func TestChallengeSanityCheck(t *testing.T) {
   }`), &accountKey)
 	test.AssertNotError(t, err, "Error unmarshaling JWK")
 
-	types := []string{ChallengeTypeSimpleHTTP, ChallengeTypeDVSNI, ChallengeTypeDNS}
+	types := []string{ChallengeTypeSimpleHTTP, ChallengeTypeDVSNI, ChallengeTypeDNS, ChallengeTypeHTTP01, ChallengeTypeTLSSNI01}
 	for _, challengeType := range types {
 		chall := Challenge{
 			Type:       challengeType,
@@ -107,6 +115,18 @@ func TestChallengeSanityCheck(t *testing.T) {
 				AddressUsed:       net.IP{127, 0, 0, 1},
 			}}
 			test.Assert(t, chall.IsSane(true), "IsSane should be true")
+		} else if challengeType == ChallengeTypeHTTP01 || challengeType == ChallengeTypeTLSSNI01 {
+			test.Assert(t, !chall.IsSane(true), "IsSane should be false without a key authorization")
+			ka, err := NewKeyAuthorization("wrongtoken", accountKey)
+			test.AssertNotError(t, err, "Error computing key authorization")
+			chall.KeyAuthorization = &ka
+			test.Assert(t, !chall.IsSane(true), "IsSane should be false with a mismatched key authorization")
+			ka, err = NewKeyAuthorization(chall.Token, accountKey)
+			test.AssertNotError(t, err, "Error computing key authorization")
+			chall.KeyAuthorization = &ka
+			test.Assert(t, chall.IsSane(true), "IsSane should be true")
+			chall.TLS = new(bool)
+			test.Assert(t, !chall.IsSane(true), "IsSane should be false with TLS set")
 		} else if challengeType == ChallengeTypeDVSNI || challengeType == ChallengeTypeDNS {
 			chall.Validation = new(jose.JsonWebSignature)
 			if challengeType == ChallengeTypeDVSNI {
@@ -128,6 +148,40 @@ func TestChallengeSanityCheck(t *testing.T) {
 	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
 }
 
+func TestKeyAuthorization(t *testing.T) {
+	var accountKey *jose.JsonWebKey
+	err := json.Unmarshal([]byte(`{
+    "kty":"RSA",
+    "n":"yNWVhtYEKJR21y9xsHV-PD_bYwbXSeNuFal46xYxVfRL5mqha7vttvjB_vc7Xg2RvgCxHPCqoxgMPTzHrZT75LjCwIW2K_klBYN8oYvTwwmeSkAz6ut7ZxPv-nZaT5TJhGk0NT2kh_zSpdriEJ_3vW-mqxYbbBmpvHqsa1_zx9fSuHYctAZJWzxzUZXykbWMWQZpEiE0J4ajj51fInEzVn7VxV-mzfMyboQjujPh7aNJxAWSq4oQEJJDgWwSh9leyoJoPpONHxh5nEE5AjE01FkGICSxjpZsF-w8hOTI3XXohUdu29Se26k2B0PolDSuj0GIQU6-W9TdLXSjBb2SpQ",
+    "e":"AQAB"
+  }`), &accountKey)
+	test.AssertNotError(t, err, "Error unmarshaling JWK")
+	token := "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4"
+
+	ka, err := NewKeyAuthorization(token, accountKey)
+	test.AssertNotError(t, err, "Error computing key authorization")
+	test.Assert(t, ka.Match(token, accountKey), "Key authorization should match")
+	test.Assert(t, !ka.Match("other", accountKey), "Key authorization shouldn't match a different token")
+	test.Assert(t, !ka.Match(token, nil), "Key authorization shouldn't match a nil key")
+
+	kaJSON, err := json.Marshal(ka)
+	test.AssertNotError(t, err, "Error marshaling key authorization")
+	test.AssertEquals(t, string(kaJSON), `"`+token+"."+ka.Thumbprint+`"`)
+	var parsed KeyAuthorization
+	test.AssertNotError(t, json.Unmarshal(kaJSON, &parsed), "Error unmarshaling key authorization")
+	test.AssertEquals(t, parsed, ka)
+
+	sniName := ka.TLSSNIName()
+	test.Assert(t, strings.HasSuffix(sniName, "."+TLSSNISuffix), "tls-sni-01 name should end in "+TLSSNISuffix)
+	test.AssertEquals(t, len(strings.Split(sniName, ".")[0]), 32)
+	test.AssertEquals(t, len(strings.Split(sniName, ".")[1]), 32)
+
+	for _, bad := range []string{"", "notoken", "a.b.c", ".thumbprint", "token."} {
+		_, err = NewKeyAuthorizationFromString(bad)
+		test.AssertError(t, err, "Parsed an invalid key authorization "+bad)
+	}
+}
+
 func TestJSONBufferUnmarshal(t *testing.T) {
 	testStruct := struct {
 		Buffer JSONBuffer
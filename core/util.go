@@ -14,6 +14,7 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
@@ -22,6 +23,7 @@ import (
 	"hash"
 	"io"
 	"math/big"
+	"net"
 	"net/url"
 	"strings"
 
@@ -78,6 +80,13 @@ type SignatureValidationError string
 // for some reason.
 type CertificateIssuanceError string
 
+// BlockedKeyError indicates the public key is known to be weak or compromised
+// and must not be used.
+type BlockedKeyError string
+
+// DNSSECError indicates a DNS answer failed DNSSEC validation.
+type DNSSECError string
+
 func (e InternalServerError) Error() string      { return string(e) }
 func (e NotSupportedError) Error() string        { return string(e) }
 func (e MalformedRequestError) Error() string    { return string(e) }
@@ -87,6 +96,8 @@ func (e LengthRequiredError) Error() string      { return string(e) }
 func (e SyntaxError) Error() string              { return string(e) }
 func (e SignatureValidationError) Error() string { return string(e) }
 func (e CertificateIssuanceError) Error() string { return string(e) }
+func (e BlockedKeyError) Error() string          { return string(e) }
+func (e DNSSECError) Error() string              { return string(e) }
 
 // Base64 functions
 
@@ -178,6 +189,38 @@ func KeyDigestEquals(j, k crypto.PublicKey) bool {
 	return digestJ == digestK
 }
 
+// Thumbprint produces the RFC 7638 JWK thumbprint of a key: the unpadded,
+// URL-safe Base64-encoded SHA256 digest of the key's required JWK members,
+// serialized in lexical order with no whitespace.
+func Thumbprint(key *jose.JsonWebKey) (string, error) {
+	if key == nil {
+		return "", fmt.Errorf("Cannot compute thumbprint of nil key")
+	}
+	var input string
+	switch t := key.Key.(type) {
+	case *rsa.PublicKey:
+		input = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+			B64enc(big.NewInt(int64(t.E)).Bytes()), B64enc(t.N.Bytes()))
+	case *ecdsa.PublicKey:
+		size := (t.Params().BitSize + 7) / 8
+		input = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			t.Params().Name, B64enc(padBytes(t.X.Bytes(), size)), B64enc(padBytes(t.Y.Bytes(), size)))
+	default:
+		return "", fmt.Errorf("Cannot compute thumbprint of key type %T", key.Key)
+	}
+	return Fingerprint256([]byte(input)), nil
+}
+
+// padBytes left-pads b with zeros to the given length.
+func padBytes(b []byte, length int) []byte {
+	if len(b) >= length {
+		return b
+	}
+	padded := make([]byte, length)
+	copy(padded[length-len(b):], b)
+	return padded
+}
+
 // AcmeURL is a URL that automatically marshal/unmarshal to JSON strings
 type AcmeURL url.URL
 
@@ -347,3 +390,89 @@ func UniqueNames(names []string) (unique []string) {
 	}
 	return
 }
+
+// WildcardBase returns the name a wildcard DNS name such as "*.example.com"
+// stands in for, and whether name is a wildcard at all. Only a whole leftmost
+// "*" label makes a wildcard; any other "*" is left for the caller to reject.
+func WildcardBase(name string) (base string, wildcard bool) {
+	if strings.HasPrefix(name, "*.") {
+		return name[2:], true
+	}
+	return name, false
+}
+
+// SubjectNames sorts the CommonName and subject alternative names of a
+// certificate or CSR into unique DNS names and IP addresses. A CommonName
+// that parses as an IP address is counted as one.
+func SubjectNames(commonName string, dnsNames []string, ipAddresses []net.IP) (names []string, ips []net.IP) {
+	names = make([]string, len(dnsNames))
+	copy(names, dnsNames)
+	ips = make([]net.IP, len(ipAddresses))
+	copy(ips, ipAddresses)
+	if commonName != "" {
+		if ip := net.ParseIP(commonName); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			names = append(names, commonName)
+		}
+	}
+
+	seen := make(map[string]bool, len(ips))
+	var uniqueIPs []net.IP
+	for _, ip := range ips {
+		if !seen[ip.String()] {
+			seen[ip.String()] = true
+			uniqueIPs = append(uniqueIPs, ip)
+		}
+	}
+	return UniqueNames(names), uniqueIPs
+}
+
+// NameIdentifiers returns the ACME identifiers that must be authorized to
+// issue for names and ips.
+func NameIdentifiers(names []string, ips []net.IP) []AcmeIdentifier {
+	identifiers := make([]AcmeIdentifier, 0, len(names)+len(ips))
+	for _, name := range names {
+		identifiers = append(identifiers, AcmeIdentifier{Type: IdentifierDNS, Value: name})
+	}
+	for _, ip := range ips {
+		identifiers = append(identifiers, AcmeIdentifier{Type: IdentifierIP, Value: ip.String()})
+	}
+	return identifiers
+}
+
+// OIDTLSFeature is the id-pe-tlsfeature extension defined in RFC 7633.
+var OIDTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// TLSFeatureStatusRequest is the TLS extension number of status_request.
+// Certificates with a TLS Feature extension listing it are "Must-Staple".
+const TLSFeatureStatusRequest = 5
+
+// MustStapleExtensionValue is the DER encoded value of a TLS Feature extension
+// listing only status_request.
+var MustStapleExtensionValue = []byte{0x30, 0x03, 0x02, 0x01, 0x05}
+
+// HasMustStaple returns true if the extensions, from either a certificate or a
+// CSR, include a TLS Feature extension listing status_request. An error is
+// returned if the TLS Feature extension is malformed or lists any other
+// feature, since we don't support those.
+func HasMustStaple(extensions []pkix.Extension) (bool, error) {
+	for _, ext := range extensions {
+		if !ext.Id.Equal(OIDTLSFeature) {
+			continue
+		}
+		var features []int
+		rest, err := asn1.Unmarshal(ext.Value, &features)
+		if err != nil {
+			return false, fmt.Errorf("Malformed TLS Feature extension: %s", err)
+		}
+		if len(rest) > 0 {
+			return false, errors.New("Malformed TLS Feature extension: trailing data")
+		}
+		if len(features) != 1 || features[0] != TLSFeatureStatusRequest {
+			return false, fmt.Errorf("Unsupported TLS Features %v", features)
+		}
+		return true, nil
+	}
+	return false, nil
+}
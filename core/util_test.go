@@ -6,11 +6,15 @@
 package core
 
 import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
 	"fmt"
 	"math"
 	"math/big"
+	"net"
 	"net/url"
+	"sort"
 	"testing"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
@@ -97,3 +101,81 @@ func TestAcmeURL(t *testing.T) {
 	a := (*AcmeURL)(u)
 	test.AssertEquals(t, s, a.String())
 }
+
+func TestHasMustStaple(t *testing.T) {
+	other := pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3}, Value: []byte{5, 0}}
+
+	mustStaple, err := HasMustStaple([]pkix.Extension{other})
+	test.AssertNotError(t, err, "Failed without a TLS Feature extension")
+	test.Assert(t, !mustStaple, "Found Must-Staple without a TLS Feature extension")
+
+	mustStaple, err = HasMustStaple([]pkix.Extension{other, {Id: OIDTLSFeature, Value: MustStapleExtensionValue}})
+	test.AssertNotError(t, err, "Failed with a valid TLS Feature extension")
+	test.Assert(t, mustStaple, "Didn't find Must-Staple")
+
+	for _, value := range [][]byte{
+		{0x05, 0x00},
+		{0x30, 0x03, 0x02, 0x01, 0x11},
+		{0x30, 0x06, 0x02, 0x01, 0x05, 0x02, 0x01, 0x11},
+		append(MustStapleExtensionValue, 0x00),
+	} {
+		_, err = HasMustStaple([]pkix.Extension{{Id: OIDTLSFeature, Value: value}})
+		test.AssertError(t, err, fmt.Sprintf("Accepted TLS Feature value %x", value))
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// Example from RFC 7638 section 3.1
+	var jwk jose.JsonWebKey
+	err := json.Unmarshal([]byte(`{
+  "kty": "RSA",
+  "n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+  "e": "AQAB"
+}`), &jwk)
+	test.AssertNotError(t, err, "Error unmarshaling JWK")
+	thumbprint, err := Thumbprint(&jwk)
+	test.AssertNotError(t, err, "Error computing thumbprint")
+	test.AssertEquals(t, thumbprint, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs")
+
+	_, err = Thumbprint(nil)
+	test.AssertError(t, err, "Computed thumbprint of nil key")
+	_, err = Thumbprint(&jose.JsonWebKey{Key: struct{}{}})
+	test.AssertError(t, err, "Computed thumbprint of unknown key type")
+}
+
+func TestSubjectNames(t *testing.T) {
+	names, ips := SubjectNames("1.2.3.4",
+		[]string{"example.com", "www.example.com", "example.com"},
+		[]net.IP{net.ParseIP("2606:4700::6810:85e5"), net.ParseIP("1.2.3.4")})
+	sort.Strings(names)
+	test.AssertEquals(t, fmt.Sprintf("%s", names), "[example.com www.example.com]")
+	test.AssertEquals(t, fmt.Sprintf("%s", ips), "[2606:4700::6810:85e5 1.2.3.4]")
+
+	names, ips = SubjectNames("example.com", nil, nil)
+	test.AssertEquals(t, fmt.Sprintf("%s", names), "[example.com]")
+	test.AssertEquals(t, len(ips), 0)
+
+	identifiers := NameIdentifiers([]string{"example.com"}, []net.IP{net.ParseIP("::ffff:1.2.3.4")})
+	test.AssertEquals(t, len(identifiers), 2)
+	test.AssertEquals(t, identifiers[0], AcmeIdentifier{Type: IdentifierDNS, Value: "example.com"})
+	test.AssertEquals(t, identifiers[1], AcmeIdentifier{Type: IdentifierIP, Value: "1.2.3.4"})
+}
+
+func TestWildcardBase(t *testing.T) {
+	testCases := []struct {
+		name     string
+		base     string
+		wildcard bool
+	}{
+		{"*.example.com", "example.com", true},
+		{"*.*.example.com", "*.example.com", true},
+		{"example.com", "example.com", false},
+		{"www*.example.com", "www*.example.com", false},
+		{"*", "*", false},
+	}
+	for _, tc := range testCases {
+		base, wildcard := WildcardBase(tc.name)
+		test.AssertEquals(t, base, tc.base)
+		test.AssertEquals(t, wildcard, tc.wildcard)
+	}
+}
@@ -19,6 +19,8 @@ GRANT SELECT,INSERT ON deniedCSRs TO 'sa'@'%';
 GRANT INSERT ON ocspResponses TO 'sa'@'%';
 GRANT SELECT,INSERT,UPDATE ON registrations TO 'sa'@'%';
 GRANT SELECT,INSERT,UPDATE ON challenges TO 'sa'@'%';
+-- Only needed on read replicas, to report how far they lag behind
+GRANT REPLICATION CLIENT ON *.* TO 'sa'@'%';
 
 -- OCSP Responder
 CREATE USER `ocsp_resp`@`%` IDENTIFIED BY 'password';
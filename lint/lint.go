@@ -0,0 +1,133 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package lint provides a registry of checks that are run against
+// certificates, both by the CA before issuance (against a certificate signed
+// by a throwaway key) and by cert-checker against certificates that have
+// already been issued.
+package lint
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a lint finding.
+type Level int
+
+const (
+	// Warn findings are logged but do not prevent issuance.
+	Warn Level = iota
+	// Error findings prevent issuance.
+	Error
+)
+
+func (l Level) String() string {
+	switch l {
+	case Warn:
+		return "warn"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// Config holds the issuance parameters that some lints check against.
+type Config struct {
+	// MaxValidity is the longest permitted period between NotBefore and
+	// NotAfter. Zero disables the check.
+	MaxValidity time.Duration
+	// PolicyOIDs are the certificate policies every certificate must assert.
+	PolicyOIDs []asn1.ObjectIdentifier
+}
+
+// Lint is a single named check. Check returns a non-nil error describing the
+// problem if the certificate fails the check.
+type Lint struct {
+	Name        string
+	Description string
+	Level       Level
+	Check       func(cert *x509.Certificate, config Config) error
+}
+
+// Finding is the result of a failed Lint.
+type Finding struct {
+	Lint    string
+	Level   Level
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("[%s] %s: %s", f.Level, f.Lint, f.Message)
+}
+
+// Registry is a set of lints which are run together.
+type Registry struct {
+	mu    sync.RWMutex
+	lints []Lint
+	names map[string]bool
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// DefaultRegistry contains all of the built-in lints, and is shared by the CA
+// and cert-checker.
+var DefaultRegistry = NewRegistry()
+
+// Register adds a lint to the registry. Lint names must be unique.
+func (r *Registry) Register(l Lint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l.Name == "" || l.Check == nil {
+		return fmt.Errorf("Lint must have a name and a check")
+	}
+	if r.names[l.Name] {
+		return fmt.Errorf("Lint %s is already registered", l.Name)
+	}
+	r.names[l.Name] = true
+	r.lints = append(r.lints, l)
+	return nil
+}
+
+// Lints returns the lints in the registry, in registration order.
+func (r *Registry) Lints() []Lint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	lints := make([]Lint, len(r.lints))
+	copy(lints, r.lints)
+	return lints
+}
+
+// Run checks the certificate against every lint in the registry and returns
+// a Finding for each one that fails.
+func (r *Registry) Run(cert *x509.Certificate, config Config) (findings []Finding) {
+	for _, l := range r.Lints() {
+		if err := l.Check(cert, config); err != nil {
+			findings = append(findings, Finding{
+				Lint:    l.Name,
+				Level:   l.Level,
+				Message: err.Error(),
+			})
+		}
+	}
+	return
+}
+
+// Errors returns only the Error level findings.
+func Errors(findings []Finding) (errors []Finding) {
+	for _, f := range findings {
+		if f.Level == Error {
+			errors = append(errors, f)
+		}
+	}
+	return
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lint
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+var testKey, _ = rsa.GenerateKey(rand.Reader, 1024)
+
+var dvPolicy = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}
+
+var testConfig = Config{
+	MaxValidity: 90 * 24 * time.Hour,
+	PolicyOIDs:  []asn1.ObjectIdentifier{dvPolicy},
+}
+
+func goodTemplate() *x509.Certificate {
+	notBefore := time.Now()
+	serial, _ := new(big.Int).SetString("0123456789abcdef0123456789abcdef", 16)
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "example.com"},
+		DNSNames:              []string{"example.com", "www.example.com"},
+		SerialNumber:          serial,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(90 * 24 * time.Hour),
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		PolicyIdentifiers:     []asn1.ObjectIdentifier{dvPolicy},
+	}
+}
+
+func makeCert(t *testing.T, template *x509.Certificate) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Couldn't parse certificate")
+	return cert
+}
+
+func findingNames(findings []Finding) map[string]bool {
+	names := make(map[string]bool)
+	for _, f := range findings {
+		names[f.Lint] = true
+	}
+	return names
+}
+
+func TestGoodCertificate(t *testing.T) {
+	findings := DefaultRegistry.Run(makeCert(t, goodTemplate()), testConfig)
+	test.AssertEquals(t, len(findings), 0)
+}
+
+func TestBadCertificates(t *testing.T) {
+	testCases := []struct {
+		lint   string
+		mutate func(*x509.Certificate)
+	}{
+		{"validity_period", func(c *x509.Certificate) { c.NotAfter = c.NotAfter.Add(time.Hour) }},
+		{"validity_period", func(c *x509.Certificate) { c.NotAfter = c.NotBefore.Add(-time.Hour) }},
+		{"cn_in_san", func(c *x509.Certificate) { c.Subject.CommonName = "other.com" }},
+		{"cn_in_san", func(c *x509.Certificate) { c.DNSNames = nil }},
+		{"basic_constraints", func(c *x509.Certificate) { c.BasicConstraintsValid = false }},
+		{"basic_constraints", func(c *x509.Certificate) { c.IsCA = true }},
+		{"key_usage_signing", func(c *x509.Certificate) { c.KeyUsage |= x509.KeyUsageCertSign }},
+		{"key_usage_digital_signature", func(c *x509.Certificate) { c.KeyUsage = x509.KeyUsageKeyEncipherment }},
+		{"ext_key_usage", func(c *x509.Certificate) { c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth} }},
+		{"ext_key_usage", func(c *x509.Certificate) {
+			c.ExtKeyUsage = append(c.ExtKeyUsage, x509.ExtKeyUsageCodeSigning)
+		}},
+		{"extension_criticality", func(c *x509.Certificate) {
+			c.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Critical: true, Value: []byte{5, 0}}}
+		}},
+		{"serial_number_valid", func(c *x509.Certificate) {
+			c.SerialNumber = new(big.Int).Lsh(big.NewInt(1), 160)
+		}},
+		{"serial_number_length", func(c *x509.Certificate) { c.SerialNumber = big.NewInt(1337) }},
+		{"tls_feature", func(c *x509.Certificate) {
+			c.ExtraExtensions = []pkix.Extension{{Id: core.OIDTLSFeature, Critical: true, Value: core.MustStapleExtensionValue}}
+		}},
+		{"tls_feature", func(c *x509.Certificate) {
+			// status_request_v2 isn't supported
+			c.ExtraExtensions = []pkix.Extension{{Id: core.OIDTLSFeature, Value: []byte{0x30, 0x03, 0x02, 0x01, 0x11}}}
+		}},
+		{"certificate_policies", func(c *x509.Certificate) { c.PolicyIdentifiers = nil }},
+	}
+
+	for _, tc := range testCases {
+		template := goodTemplate()
+		tc.mutate(template)
+		names := findingNames(DefaultRegistry.Run(makeCert(t, template), testConfig))
+		if !names[tc.lint] {
+			t.Errorf("Expected lint %s to fail, got %v", tc.lint, names)
+		}
+	}
+}
+
+func TestIPAddressCertificate(t *testing.T) {
+	template := goodTemplate()
+	template.Subject.CommonName = "1.2.3.4"
+	template.DNSNames = nil
+	template.IPAddresses = []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("2606:4700::6810:85e5")}
+	findings := DefaultRegistry.Run(makeCert(t, template), testConfig)
+	test.AssertEquals(t, len(findings), 0)
+
+	template.Subject.CommonName = "5.6.7.8"
+	names := findingNames(DefaultRegistry.Run(makeCert(t, template), testConfig))
+	test.Assert(t, names["cn_in_san"], "CommonName outside the IP address SANs passed")
+}
+
+func TestMustStapleCertificate(t *testing.T) {
+	template := goodTemplate()
+	template.ExtraExtensions = []pkix.Extension{{Id: core.OIDTLSFeature, Value: core.MustStapleExtensionValue}}
+	findings := DefaultRegistry.Run(makeCert(t, template), testConfig)
+	test.AssertEquals(t, len(findings), 0)
+}
+
+func TestErrors(t *testing.T) {
+	template := goodTemplate()
+	template.SerialNumber = big.NewInt(1337)
+	template.IsCA = true
+	findings := DefaultRegistry.Run(makeCert(t, template), testConfig)
+	test.AssertEquals(t, len(findings), 2)
+	errs := Errors(findings)
+	test.AssertEquals(t, len(errs), 1)
+	test.AssertEquals(t, errs[0].Lint, "basic_constraints")
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry()
+	l := Lint{
+		Name:  "always_fails",
+		Level: Error,
+		Check: func(*x509.Certificate, Config) error { return errors.New("failed") },
+	}
+	test.AssertNotError(t, r.Register(l), "Failed to register lint")
+	test.AssertError(t, r.Register(l), "Registered the same lint twice")
+	test.AssertError(t, r.Register(Lint{Name: "no_check"}), "Registered a lint without a check")
+
+	findings := r.Run(makeCert(t, goodTemplate()), Config{})
+	test.AssertEquals(t, len(findings), 1)
+	test.AssertEquals(t, findings[0].String(), "[error] always_fails: failed")
+}
@@ -0,0 +1,257 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lint
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+	// Extensions which clients are expected to understand, and so may be
+	// marked critical
+	criticalAllowed = []asn1.ObjectIdentifier{
+		oidExtensionKeyUsage,
+		oidExtensionSubjectAltName,
+		oidExtensionBasicConstraints,
+		oidExtensionExtendedKeyUsage,
+	}
+)
+
+// The maximum length of a serial number according to RFC 5280 section 4.1.2.2
+const maxSerialOctets = 20
+
+// The minimum serial number entropy required by the Baseline Requirements
+const minSerialBits = 64
+
+func init() {
+	for _, l := range []Lint{
+		{
+			Name:        "validity_period",
+			Description: "NotAfter must follow NotBefore by no more than the configured validity period",
+			Level:       Error,
+			Check:       checkValidityPeriod,
+		},
+		{
+			Name:        "cn_in_san",
+			Description: "Certificate must have a SAN and the CommonName must be one of the SANs",
+			Level:       Error,
+			Check:       checkCommonNameInSAN,
+		},
+		{
+			Name:        "basic_constraints",
+			Description: "Basic constraints must be present and must not allow signing",
+			Level:       Error,
+			Check:       checkBasicConstraints,
+		},
+		{
+			Name:        "key_usage_signing",
+			Description: "Key usage must not include certificate or CRL signing",
+			Level:       Error,
+			Check:       checkKeyUsageSigning,
+		},
+		{
+			Name:        "key_usage_digital_signature",
+			Description: "Key usage should include digital signature",
+			Level:       Warn,
+			Check:       checkKeyUsageDigitalSignature,
+		},
+		{
+			Name:        "ext_key_usage",
+			Description: "Extended key usage must include server auth and only server or client auth",
+			Level:       Error,
+			Check:       checkExtKeyUsage,
+		},
+		{
+			Name:        "extension_criticality",
+			Description: "Only well known extensions may be critical, and SAN must be critical when the subject is empty",
+			Level:       Error,
+			Check:       checkExtensionCriticality,
+		},
+		{
+			Name:        "serial_number_valid",
+			Description: "Serial number must be positive and at most 20 octets",
+			Level:       Error,
+			Check:       checkSerialNumberValid,
+		},
+		{
+			Name:        "serial_number_length",
+			Description: "Serial number should be at least 64 bits",
+			Level:       Warn,
+			Check:       checkSerialNumberLength,
+		},
+		{
+			Name:        "tls_feature",
+			Description: "The TLS Feature extension, if present, must be non-critical and list only status_request",
+			Level:       Error,
+			Check:       checkTLSFeature,
+		},
+		{
+			Name:        "certificate_policies",
+			Description: "Certificate must assert all of the configured policy OIDs",
+			Level:       Error,
+			Check:       checkCertificatePolicies,
+		},
+	} {
+		if err := DefaultRegistry.Register(l); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func checkValidityPeriod(cert *x509.Certificate, config Config) error {
+	if !cert.NotAfter.After(cert.NotBefore) {
+		return fmt.Errorf("NotAfter %s is not after NotBefore %s", cert.NotAfter, cert.NotBefore)
+	}
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	if config.MaxValidity > 0 && validity > config.MaxValidity {
+		return fmt.Errorf("Validity period %s is longer than %s", validity, config.MaxValidity)
+	}
+	return nil
+}
+
+func checkCommonNameInSAN(cert *x509.Certificate, config Config) error {
+	if len(cert.DNSNames) == 0 && len(cert.IPAddresses) == 0 {
+		return fmt.Errorf("Certificate has no subject alternative names")
+	}
+	cn := cert.Subject.CommonName
+	if cn == "" {
+		return nil
+	}
+	for _, name := range cert.DNSNames {
+		if strings.EqualFold(name, cn) {
+			return nil
+		}
+	}
+	if ip := net.ParseIP(cn); ip != nil {
+		for _, san := range cert.IPAddresses {
+			if san.Equal(ip) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("CommonName %s is not one of the subject alternative names", cn)
+}
+
+func checkBasicConstraints(cert *x509.Certificate, config Config) error {
+	if !cert.BasicConstraintsValid {
+		return fmt.Errorf("Basic constraints are not set")
+	}
+	if cert.IsCA {
+		return fmt.Errorf("Certificate can sign other certificates")
+	}
+	return nil
+}
+
+func checkKeyUsageSigning(cert *x509.Certificate, config Config) error {
+	if cert.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		return fmt.Errorf("Key usage allows certificate or CRL signing")
+	}
+	return nil
+}
+
+func checkKeyUsageDigitalSignature(cert *x509.Certificate, config Config) error {
+	if cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return fmt.Errorf("Key usage does not include digital signature")
+	}
+	return nil
+}
+
+func checkExtKeyUsage(cert *x509.Certificate, config Config) error {
+	serverAuth := false
+	for _, eku := range cert.ExtKeyUsage {
+		switch eku {
+		case x509.ExtKeyUsageServerAuth:
+			serverAuth = true
+		case x509.ExtKeyUsageClientAuth:
+		default:
+			return fmt.Errorf("Unexpected extended key usage %d", eku)
+		}
+	}
+	if len(cert.UnknownExtKeyUsage) > 0 {
+		return fmt.Errorf("Unexpected extended key usage %v", cert.UnknownExtKeyUsage[0])
+	}
+	if !serverAuth {
+		return fmt.Errorf("Extended key usage does not include server auth")
+	}
+	return nil
+}
+
+func checkExtensionCriticality(cert *x509.Certificate, config Config) error {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) && len(cert.Subject.Names) == 0 && !ext.Critical {
+			return fmt.Errorf("Subject is empty but the SAN extension is not critical")
+		}
+		if !ext.Critical {
+			continue
+		}
+		allowed := false
+		for _, oid := range criticalAllowed {
+			if ext.Id.Equal(oid) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("Extension %v must not be critical", ext.Id)
+		}
+	}
+	return nil
+}
+
+func checkSerialNumberValid(cert *x509.Certificate, config Config) error {
+	if cert.SerialNumber == nil || cert.SerialNumber.Sign() <= 0 {
+		return fmt.Errorf("Serial number is not positive")
+	}
+	// DER integers are signed, so a set high bit needs an extra leading octet
+	if octets := cert.SerialNumber.BitLen()/8 + 1; octets > maxSerialOctets {
+		return fmt.Errorf("Serial number is %d octets, longer than %d", octets, maxSerialOctets)
+	}
+	return nil
+}
+
+func checkSerialNumberLength(cert *x509.Certificate, config Config) error {
+	if cert.SerialNumber == nil || cert.SerialNumber.BitLen() < minSerialBits {
+		return fmt.Errorf("Serial number is shorter than %d bits", minSerialBits)
+	}
+	return nil
+}
+
+func checkTLSFeature(cert *x509.Certificate, config Config) error {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(core.OIDTLSFeature) && ext.Critical {
+			return fmt.Errorf("TLS Feature extension is critical")
+		}
+	}
+	_, err := core.HasMustStaple(cert.Extensions)
+	return err
+}
+
+func checkCertificatePolicies(cert *x509.Certificate, config Config) error {
+	for _, required := range config.PolicyOIDs {
+		found := false
+		for _, oid := range cert.PolicyIdentifiers {
+			if oid.Equal(required) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Certificate does not assert policy %v", required)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package migrate applies and rolls back the goose migrations in each
+// schema's _db/migrations directory, or _db/sqlite-migrations for SQLite
+// databases, and checks that a database has the schema this build of
+// Boulder expects.
+//
+// Applied versions are recorded in the goose_db_version table the same way
+// goose records them, so databases can be migrated with either tool.
+package migrate
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaVersions holds the version of the newest migration for each schema,
+// which is the version this build of Boulder needs the database to have.
+// It must be updated whenever a migration is added, and each migration
+// needs a SQLite counterpart with the same version.
+//
+// Databases with newer migrations applied are accepted, with a warning, so
+// that migrations can be applied before the code that needs them is
+// deployed. A migration must therefore only add to the schema: older builds
+// have to keep working against it until they're replaced. Migrations that
+// drop or rename anything need a release that stops using it first.
+var SchemaVersions = map[string]int64{
+	"sa":     20151012151904,
+	"policy": 20151009143027,
+}
+
+// Migration is one of a schema's migration files.
+type Migration struct {
+	Version int64
+	Name    string
+	// Up and Down are the statements that apply and roll back the migration
+	Up   []string
+	Down []string
+}
+
+// MigrationStatus says whether a migration has been applied to a database,
+// and if so, when. OutOfOrder is set for a migration that hasn't been
+// applied but is older than the database's current version, which Up
+// refuses to skip past.
+type MigrationStatus struct {
+	Migration
+	Applied    bool
+	AppliedAt  time.Time
+	OutOfOrder bool
+}
+
+// Dir returns the directory, relative to the top of the Boulder tree, that
+// holds schema's migrations for MySQL, or for SQLite if sqlite is true.
+func Dir(schema string, sqlite bool) string {
+	if sqlite {
+		return filepath.Join(schema, "_db", "sqlite-migrations")
+	}
+	return filepath.Join(schema, "_db", "migrations")
+}
+
+// Load reads the migrations in dir, sorted by version.
+func Load(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".sql" {
+			continue
+		}
+		version, err := strconv.ParseInt(strings.SplitN(file.Name(), "_", 2)[0], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("Migration %s doesn't start with a version number", file.Name())
+		}
+
+		f, err := os.Open(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		up, down, err := parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Migration %s: %s", file.Name(), err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: file.Name(), Up: up, Down: down})
+	}
+
+	sort.Sort(byVersion(migrations))
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("Migrations %s and %s have the same version", migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+type byVersion []Migration
+
+func (m byVersion) Len() int           { return len(m) }
+func (m byVersion) Less(i, j int) bool { return m[i].Version < m[j].Version }
+func (m byVersion) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+// parse splits a goose SQL migration into the statements of its Up and Down
+// sections. Statements end with a semicolon at the end of a line, or at the
+// end of the section, unless they're between "-- +goose StatementBegin" and
+// "-- +goose StatementEnd".
+func parse(r io.Reader) (up, down []string, err error) {
+	var section *[]string
+	var statement []string
+	inBlock := false
+	endStatement := func() {
+		if section != nil && len(statement) > 0 {
+			*section = append(*section, strings.Join(statement, "\n"))
+		}
+		statement = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			switch annotation := strings.TrimSpace(strings.TrimPrefix(trimmed, "--")); annotation {
+			case "+goose Up", "+goose Down":
+				if inBlock {
+					return nil, nil, fmt.Errorf("%s inside a statement block", annotation)
+				}
+				endStatement()
+				if annotation == "+goose Up" {
+					section = &up
+				} else {
+					section = &down
+				}
+			case "+goose StatementBegin":
+				inBlock = true
+			case "+goose StatementEnd":
+				inBlock = false
+				endStatement()
+			}
+			continue
+		}
+		if section == nil {
+			if trimmed != "" {
+				return nil, nil, fmt.Errorf("statement before the +goose Up annotation")
+			}
+			continue
+		}
+		if trimmed == "" && len(statement) == 0 {
+			continue
+		}
+
+		statement = append(statement, line)
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			endStatement()
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if inBlock {
+		return nil, nil, fmt.Errorf("no +goose StatementEnd annotation")
+	}
+	endStatement()
+	if section == nil {
+		return nil, nil, fmt.Errorf("no +goose Up annotation")
+	}
+	return up, down, nil
+}
+
+// appliedVersions returns when each migration still applied to db was
+// applied. As goose does, it goes by the latest row for each version.
+func appliedVersions(db *sql.DB) (map[int64]time.Time, error) {
+	rows, err := db.Query("SELECT version_id, is_applied, tstamp FROM goose_db_version ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[int64]bool{}
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var tstamp *time.Time
+		if err = rows.Scan(&version, &isApplied, &tstamp); err != nil {
+			return nil, err
+		}
+		if seen[version] {
+			continue
+		}
+		seen[version] = true
+		if isApplied && version > 0 {
+			applied[version] = time.Time{}
+			if tstamp != nil {
+				applied[version] = *tstamp
+			}
+		}
+	}
+	return applied, rows.Err()
+}
+
+// CurrentVersion returns the version of the newest migration applied to db,
+// or 0 if none have been.
+func CurrentVersion(db *sql.DB) (int64, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return 0, err
+	}
+	return newest(applied), nil
+}
+
+func newest(applied map[int64]time.Time) int64 {
+	var current int64
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current
+}
+
+// NewerSchemaError is returned by CheckVersion when the database has
+// migrations applied that are newer than any this build knows about.
+type NewerSchemaError struct {
+	Schema  string
+	Version int64
+	Want    int64
+}
+
+func (e NewerSchemaError) Error() string {
+	return fmt.Sprintf("The %s schema is at version %d, newer than the version %d this build knows about", e.Schema, e.Version, e.Want)
+}
+
+// CheckVersion returns an error unless the migration this build expects for
+// schema has been applied to db, since the database is otherwise missing
+// tables or columns the code uses. If newer migrations have been applied
+// too, it returns a NewerSchemaError, which callers should report but may
+// run with (see SchemaVersions).
+func CheckVersion(db *sql.DB, schema string) error {
+	want, ok := SchemaVersions[schema]
+	if !ok {
+		return fmt.Errorf("Unknown schema %q", schema)
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return fmt.Errorf("Couldn't read the %s schema version: %s", schema, err)
+	}
+	have := newest(applied)
+	if have < want {
+		return fmt.Errorf("The %s schema is out of date: it's at version %d, but version %d is needed. Run boulder-migrate up", schema, have, want)
+	}
+	if _, ok := applied[want]; !ok {
+		return fmt.Errorf("The %s schema is at version %d, but migration %d, which this build needs, was never applied", schema, have, want)
+	}
+	if have > want {
+		return NewerSchemaError{Schema: schema, Version: have, Want: want}
+	}
+	return nil
+}
+
+// The goose_db_version table as goose creates it for each database.
+const (
+	mysqlVersionTable = `CREATE TABLE goose_db_version (
+		id serial NOT NULL,
+		version_id bigint NOT NULL,
+		is_applied boolean NOT NULL,
+		tstamp timestamp NULL default now(),
+		PRIMARY KEY(id)
+	)`
+	sqliteVersionTable = `CREATE TABLE goose_db_version (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	)`
+)
+
+// isSQLite returns true if db is an embedded SQLite database rather than
+// MySQL. The SQLite driver needs cgo and is only linked into some builds, so
+// its type can't be named here.
+func isSQLite(db *sql.DB) bool {
+	return fmt.Sprintf("%T", db.Driver()) == "*sqlite3.SQLiteDriver"
+}
+
+// ensureVersionTable creates the goose_db_version table if it doesn't
+// exist yet.
+func ensureVersionTable(db *sql.DB) error {
+	query, create := "SHOW TABLES LIKE 'goose_db_version'", mysqlVersionTable
+	if isSQLite(db) {
+		query = "SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'goose_db_version'"
+		create = sqliteVersionTable
+	}
+	var name string
+	err := db.QueryRow(query).Scan(&name)
+	if err == nil {
+		return nil
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = db.Exec(create)
+	if err != nil {
+		return err
+	}
+	// goose records version 0 as applied when it creates the table
+	_, err = db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", 0, true)
+	return err
+}
+
+// run executes statements and records migration's new state in a
+// transaction. MySQL commits schema changes as they are made, so a
+// migration that fails part way may need to be cleaned up by hand.
+func run(db *sql.DB, migration Migration, statements []string, applied bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err = tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Migration %s failed: %s", migration.Name, err)
+		}
+	}
+	_, err = tx.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", migration.Version, applied)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies the migrations newer than the current version of db, in order,
+// and returns the ones it applied. It refuses to run if the current version
+// isn't one of migrations, or if an older migration was never applied, since
+// it would otherwise never be.
+func Up(db *sql.DB, migrations []Migration) ([]Migration, error) {
+	statuses, err := Status(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if current != 0 && !hasVersion(migrations, current) {
+		return nil, fmt.Errorf("The database is at version %d, which none of the migrations have", current)
+	}
+	for _, status := range statuses {
+		if status.OutOfOrder {
+			return nil, fmt.Errorf("Migration %s is older than the current version %d but was never applied. Roll back to before it, or apply it by hand", status.Name, current)
+		}
+	}
+
+	var applied []Migration
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if err = run(db, migration, migration.Up, true); err != nil {
+			return applied, err
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// Down rolls back the newest migration applied to db, and returns it.
+func Down(db *sql.DB, migrations []Migration) (Migration, error) {
+	if err := ensureVersionTable(db); err != nil {
+		return Migration{}, err
+	}
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return Migration{}, err
+	}
+	if current == 0 {
+		return Migration{}, fmt.Errorf("No migrations have been applied")
+	}
+
+	for _, migration := range migrations {
+		if migration.Version == current {
+			return migration, run(db, migration, migration.Down, false)
+		}
+	}
+	return Migration{}, fmt.Errorf("The current version %d has no migration file", current)
+}
+
+// Status reports which of migrations have been applied to db.
+func Status(db *sql.DB, migrations []Migration) ([]MigrationStatus, error) {
+	if err := ensureVersionTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	current := newest(applied)
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i].Migration = migration
+		statuses[i].AppliedAt, statuses[i].Applied = applied[migration.Version]
+		statuses[i].OutOfOrder = !statuses[i].Applied && migration.Version < current
+	}
+	return statuses, nil
+}
+
+func hasVersion(migrations []Migration, version int64) bool {
+	for _, migration := range migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
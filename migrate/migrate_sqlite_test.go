@@ -0,0 +1,82 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build sqlite
+// +build sqlite
+
+package migrate
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/mattn/go-sqlite3"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func testMigration(version int64, table string) Migration {
+	return Migration{
+		Version: version,
+		Name:    table,
+		Up:      []string{"CREATE TABLE " + table + " (id INTEGER);"},
+		Down:    []string{"DROP TABLE " + table + ";"},
+	}
+}
+
+// A migration merged after a newer one has been applied is reported and
+// blocks Up, rather than being skipped for good.
+func TestOutOfOrderMigrations(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	test.AssertNotError(t, err, "Couldn't open database")
+	defer db.Close()
+	// Each connection to :memory: gets a database of its own
+	db.SetMaxOpenConns(1)
+
+	first, second, third := testMigration(1, "a"), testMigration(2, "b"), testMigration(3, "c")
+	applied, err := Up(db, []Migration{first, third})
+	test.AssertNotError(t, err, "Couldn't apply migrations")
+	test.AssertEquals(t, len(applied), 2)
+
+	all := []Migration{first, second, third}
+	statuses, err := Status(db, all)
+	test.AssertNotError(t, err, "Couldn't read status")
+	test.Assert(t, statuses[0].Applied && !statuses[0].OutOfOrder, "First migration should be applied")
+	test.Assert(t, !statuses[1].Applied && statuses[1].OutOfOrder, "Second migration should be out of order")
+	test.Assert(t, statuses[2].Applied && !statuses[2].OutOfOrder, "Third migration should be applied")
+
+	applied, err = Up(db, all)
+	test.AssertError(t, err, "Up skipped an out of order migration")
+	test.AssertEquals(t, len(applied), 0)
+
+	_, err = Up(db, []Migration{first})
+	test.AssertError(t, err, "Up ran against a version none of the migrations have")
+}
+
+func TestCheckVersion(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	test.AssertNotError(t, err, "Couldn't open database")
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = Up(db, []Migration{testMigration(1, "a"), testMigration(3, "c")})
+	test.AssertNotError(t, err, "Couldn't apply migrations")
+
+	defer delete(SchemaVersions, "test")
+	SchemaVersions["test"] = 3
+	test.AssertNotError(t, CheckVersion(db, "test"), "Current version refused")
+
+	SchemaVersions["test"] = 4
+	test.AssertError(t, CheckVersion(db, "test"), "Older version accepted")
+
+	SchemaVersions["test"] = 2
+	err = CheckVersion(db, "test")
+	_, newer := err.(NewerSchemaError)
+	test.Assert(t, err != nil && !newer, "Version with a needed migration missing accepted")
+
+	SchemaVersions["test"] = 1
+	err = CheckVersion(db, "test")
+	_, newer = err.(NewerSchemaError)
+	test.Assert(t, newer, "Newer version not reported")
+}
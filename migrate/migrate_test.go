@@ -0,0 +1,94 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestParse(t *testing.T) {
+	up, down, err := parse(strings.NewReader(`-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE a (
+  id int NOT NULL
+);
+ALTER TABLE b ADD COLUMN c int; ALTER TABLE b ADD COLUMN d int;
+
+-- +goose StatementBegin
+CREATE PROCEDURE p()
+BEGIN
+  SELECT 1;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE a;
+DROP TABLE z
+`))
+	test.AssertNotError(t, err, "Couldn't parse migration")
+	test.AssertDeepEquals(t, up, []string{
+		"CREATE TABLE a (\n  id int NOT NULL\n);",
+		"ALTER TABLE b ADD COLUMN c int; ALTER TABLE b ADD COLUMN d int;",
+		"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\nEND;",
+	})
+	// The last statement in a section doesn't need a semicolon
+	test.AssertDeepEquals(t, down, []string{"DROP TABLE a;", "DROP TABLE z"})
+
+	_, _, err = parse(strings.NewReader("-- +goose Up\n-- +goose StatementBegin\nCREATE TABLE a (id int);\n"))
+	test.AssertError(t, err, "Parsed an unterminated statement block")
+	_, _, err = parse(strings.NewReader("CREATE TABLE a (id int);\n"))
+	test.AssertError(t, err, "Parsed a statement outside a section")
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrations")
+	test.AssertNotError(t, err, "Couldn't create migration directory")
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		test.AssertNotError(t, err, "Couldn't write migration")
+	}
+	write("20150902000000_Second.sql", "-- +goose Up\nSELECT 2;\n")
+	write("20150901000000_First.sql", "-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 0;\n")
+	write("dbconf.yml", "test:\n")
+
+	migrations, err := Load(dir)
+	test.AssertNotError(t, err, "Couldn't load migrations")
+	test.AssertEquals(t, len(migrations), 2)
+	test.AssertEquals(t, migrations[0].Version, int64(20150901000000))
+	test.AssertEquals(t, migrations[0].Name, "20150901000000_First.sql")
+	test.AssertDeepEquals(t, migrations[0].Down, []string{"SELECT 0;"})
+	test.AssertEquals(t, migrations[1].Version, int64(20150902000000))
+
+	write("20150902000000_Duplicate.sql", "-- +goose Up\nSELECT 3;\n")
+	_, err = Load(dir)
+	test.AssertError(t, err, "Loaded migrations with the same version")
+}
+
+// The expected versions have to be bumped whenever a migration is added,
+// every migration Boulder ships has to parse, and SQLite databases have to
+// end up at the same version as MySQL ones.
+func TestSchemaVersions(t *testing.T) {
+	for schema, version := range SchemaVersions {
+		for _, sqlite := range []bool{false, true} {
+			dir := Dir(schema, sqlite)
+			migrations, err := Load(filepath.Join("..", dir))
+			test.AssertNotError(t, err, "Couldn't load migrations in "+dir)
+			newest := migrations[len(migrations)-1]
+			if newest.Version != version {
+				t.Errorf("SchemaVersions[%q] is %d, but the newest migration in %s is %s", schema, version, dir, newest.Name)
+			}
+		}
+	}
+}
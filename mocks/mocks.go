@@ -33,8 +33,13 @@ func (mock *MockDNS) LookupTXT(hostname string) ([]string, time.Duration, error)
 
 // LookupHost is a mock
 func (mock *MockDNS) LookupHost(hostname string) ([]net.IP, time.Duration, error) {
-	if hostname == "always.invalid" || hostname == "invalid.invalid" {
+	switch hostname {
+	case "always.invalid", "invalid.invalid":
 		return []net.IP{}, 0, nil
+	case "ipv6.localhost":
+		return []net.IP{net.ParseIP("::1")}, 0, nil
+	case "dualstack.localhost":
+		return []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}, 0, nil
 	}
 	ip := net.ParseIP("127.0.0.1")
 	return []net.IP{ip}, 0, nil
@@ -64,6 +69,9 @@ func (mock *MockDNS) LookupCNAME(domain string) (string, time.Duration, error) {
 		return "", 0, fmt.Errorf("SERVFAIL")
 	case "cname2dname.com":
 		return "dname2cname.com.", 30, nil
+	case "cname-nx.reserved.com":
+		// alias target has no relevant CAA records, so the parent applies
+		return "nx.absent.com.", 30, nil
 	default:
 		return "", 0, nil
 	}
@@ -105,6 +113,32 @@ func (mock *MockDNS) LookupCAA(domain string) ([]*dns.CAA, time.Duration, error)
 		record.Tag = "issue"
 		record.Value = "letsencrypt.org"
 		results = append(results, &record)
+	case "accounturi.com":
+		record.Tag = "issue"
+		record.Value = "letsencrypt.org; accounturi=https://letsencrypt.org/acme/reg/1"
+		results = append(results, &record)
+	case "methods.com":
+		record.Tag = "issue"
+		record.Value = "letsencrypt.org; validationmethods=dns-01,tls-sni-01"
+		results = append(results, &record)
+	case "malformed-parameter.com":
+		record.Tag = "issue"
+		record.Value = "letsencrypt.org; =dns-01"
+		results = append(results, &record)
+	case "wild.com":
+		record.Tag = "issue"
+		record.Value = "symantec.com"
+		results = append(results, &record, &dns.CAA{Tag: "issuewild", Value: "letsencrypt.org"})
+	case "iodef.com":
+		record.Tag = "issue"
+		record.Value = "symantec.com"
+		results = append(results, &record,
+			&dns.CAA{Tag: "iodef", Value: "mailto:security@iodef.com"},
+			&dns.CAA{Tag: "iodef", Value: "https://iodef.com/report"})
+	case "iodef-only.com":
+		record.Tag = "iodef"
+		record.Value = "mailto:security@iodef-only.com"
+		results = append(results, &record)
 	case "servfail.com":
 		return results, 0, fmt.Errorf("SERVFAIL")
 	}
@@ -0,0 +1,23 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE `blacklist` ADD COLUMN (
+  `addedBy` varchar(255) NOT NULL DEFAULT '',
+  `added` DATETIME NULL,
+  `reason` varchar(1024) NOT NULL DEFAULT '',
+  `expires` DATETIME NULL
+);
+
+ALTER TABLE `whitelist` ADD COLUMN (
+  `addedBy` varchar(255) NOT NULL DEFAULT '',
+  `added` DATETIME NULL,
+  `reason` varchar(1024) NOT NULL DEFAULT '',
+  `expires` DATETIME NULL
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE `blacklist` DROP COLUMN `addedBy`, DROP COLUMN `added`, DROP COLUMN `reason`, DROP COLUMN `expires`;
+ALTER TABLE `whitelist` DROP COLUMN `addedBy`, DROP COLUMN `added`, DROP COLUMN `reason`, DROP COLUMN `expires`;
@@ -0,0 +1,17 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `reviewRules` (
+  `pattern` varchar(255) NOT NULL,
+  `addedBy` varchar(255) NOT NULL DEFAULT '',
+  `added` DATETIME NULL,
+  `reason` varchar(1024) NOT NULL DEFAULT '',
+  `expires` DATETIME NULL,
+  PRIMARY KEY (`pattern`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `reviewRules`;
@@ -0,0 +1,28 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE `whitelist` ADD COLUMN (
+  `registrationID` bigint(20) NOT NULL DEFAULT 0,
+  `regGroup` varchar(255) NOT NULL DEFAULT ''
+);
+
+-- A host may have a rule for each registration or group it's limited to
+ALTER TABLE `whitelist` DROP PRIMARY KEY, ADD PRIMARY KEY (`host`, `registrationID`, `regGroup`);
+
+CREATE TABLE `registrationGroups` (
+  `groupName` varchar(255) NOT NULL,
+  `registrationID` bigint(20) NOT NULL,
+  `addedBy` varchar(255) NOT NULL DEFAULT '',
+  `added` DATETIME NULL,
+  PRIMARY KEY (`groupName`, `registrationID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+-- Without their scope, limited rules would whitelist the host for everyone
+DELETE FROM `whitelist` WHERE `registrationID` != 0 OR `regGroup` != '';
+ALTER TABLE `whitelist` DROP PRIMARY KEY, ADD PRIMARY KEY (`host`);
+ALTER TABLE `whitelist` DROP COLUMN `registrationID`, DROP COLUMN `regGroup`;
+DROP TABLE `registrationGroups`;
@@ -0,0 +1,50 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- SQLite databases start from the schema the MySQL migrations up to this
+-- version build, so that both have the version in migrate.SchemaVersions.
+
+CREATE TABLE `blacklist` (
+  `host` varchar(255) NOT NULL PRIMARY KEY,
+  `addedBy` varchar(255) NOT NULL DEFAULT '',
+  `added` DATETIME NULL,
+  `reason` varchar(1024) NOT NULL DEFAULT '',
+  `expires` DATETIME NULL
+);
+
+-- A host may have a rule for each registration or group it's limited to
+CREATE TABLE `whitelist` (
+  `host` varchar(255) NOT NULL,
+  `addedBy` varchar(255) NOT NULL DEFAULT '',
+  `added` DATETIME NULL,
+  `reason` varchar(1024) NOT NULL DEFAULT '',
+  `expires` DATETIME NULL,
+  `registrationID` bigint NOT NULL DEFAULT 0,
+  `regGroup` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`host`, `registrationID`, `regGroup`)
+);
+
+CREATE TABLE `reviewRules` (
+  `pattern` varchar(255) NOT NULL PRIMARY KEY,
+  `addedBy` varchar(255) NOT NULL DEFAULT '',
+  `added` DATETIME NULL,
+  `reason` varchar(1024) NOT NULL DEFAULT '',
+  `expires` DATETIME NULL
+);
+
+CREATE TABLE `registrationGroups` (
+  `groupName` varchar(255) NOT NULL,
+  `registrationID` bigint NOT NULL,
+  `addedBy` varchar(255) NOT NULL DEFAULT '',
+  `added` DATETIME NULL,
+  PRIMARY KEY (`groupName`, `registrationID`)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `registrationGroups`;
+DROP TABLE `reviewRules`;
+DROP TABLE `whitelist`;
+DROP TABLE `blacklist`;
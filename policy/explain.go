@@ -0,0 +1,107 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"strings"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// Explanation lays out how the policy applies to an identifier: whether
+// WillingToIssue accepts it, the rules it matches and the challenges it
+// would be offered. It's meant for operators working out why a name was
+// or wasn't issued for.
+type Explanation struct {
+	Identifier     core.AcmeIdentifier
+	RegistrationID int64
+
+	// Err is what WillingToIssue returns for the identifier, nil if the CA
+	// is willing to issue for it.
+	Err error
+
+	// PublicSuffix is the public suffix a DNS name ends in, "" if it
+	// doesn't end in one.
+	PublicSuffix string
+
+	// BlacklistRule is the blacklist rule the name matches, if any, in
+	// either its ASCII or Unicode form.
+	BlacklistRule *BlacklistRule
+
+	// WhitelistRule is the whitelist rule for the name that applies to
+	// RegistrationID, or if none does the first of the name's rules, and
+	// WhitelistApplies reports which. The whitelist is only required when
+	// WhitelistEnforced is set.
+	WhitelistRule     *WhitelistRule
+	WhitelistApplies  bool
+	WhitelistEnforced bool
+
+	// ReviewRule is the pattern of the review rule that holds the name for
+	// manual review, "" if there isn't one.
+	ReviewRule string
+
+	Challenges   []string
+	Combinations [][]int
+}
+
+// Explain works out how the policy applies to id when requested by the
+// registration regID. The error is only non-nil if the policy rules
+// couldn't be looked up; a name the CA won't issue for is reported in
+// Explanation.Err.
+func (pa PolicyAuthorityImpl) Explain(id core.AcmeIdentifier, regID int64) (Explanation, error) {
+	e := Explanation{
+		Identifier:        id,
+		RegistrationID:    regID,
+		Err:               pa.WillingToIssue(id, regID),
+		WhitelistEnforced: pa.EnforceWhitelist,
+	}
+	if id.Type != core.IdentifierDNS && id.Type != core.IdentifierIP {
+		return e, nil
+	}
+
+	name, _ := core.WildcardBase(strings.ToLower(id.Value))
+	if id.Type == core.IdentifierDNS {
+		if pa.Suffixes != nil {
+			e.PublicSuffix, _ = pa.Suffixes.Rules().PublicSuffix(name)
+		}
+		forms := []string{name}
+		if uname, ok := unicodeName(name); ok {
+			forms = append(forms, uname)
+		}
+		for _, form := range forms {
+			rule, found, err := pa.DB.blacklistRuleFor(reverseName(form))
+			if err != nil {
+				return e, err
+			}
+			if found {
+				e.BlacklistRule = &rule
+				break
+			}
+		}
+		review, err := pa.ReviewRuleFor(core.AcmeIdentifier{Type: id.Type, Value: name})
+		if err != nil {
+			return e, err
+		}
+		e.ReviewRule = review
+	}
+
+	rules, err := pa.DB.whitelistRulesFor(name)
+	if err != nil {
+		return e, err
+	}
+	if rule, ok := pa.DB.applicableWhitelistRule(rules, regID); ok {
+		e.WhitelistRule, e.WhitelistApplies = &rule, true
+	} else if len(rules) > 0 {
+		e.WhitelistRule = &rules[0]
+	}
+
+	challenges, combinations := pa.ChallengesFor(id)
+	for _, challenge := range challenges {
+		e.Challenges = append(e.Challenges, challenge.Type)
+	}
+	e.Combinations = combinations
+	return e, nil
+}
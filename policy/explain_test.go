@@ -0,0 +1,70 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestExplain(t *testing.T) {
+	pa := PolicyAuthorityImpl{
+		DB: &PolicyAuthorityDatabaseImpl{
+			clk: clock.NewFake(),
+			cache: &ruleCache{
+				blacklist: map[string]domainRule{
+					"com.bad": domainRule{Host: "com.bad", AddedBy: "alice", Reason: "phishing"},
+				},
+				whitelist: map[string][]WhitelistRule{
+					"www.bad.com":   {{Host: "www.bad.com"}},
+					"team-a.com":    {{Host: "team-a.com", Group: "team-a"}},
+					"good-bank.com": {{Host: "good-bank.com"}},
+				},
+				review: []compiledReviewRule{
+					{ReviewRule{Pattern: "bank"}, regexp.MustCompile("bank")},
+				},
+				groups: map[string]map[int64]bool{"team-a": {1: true}},
+			},
+		},
+		EnforceWhitelist: true,
+		Suffixes:         NewSuffixList(EmbeddedSuffixRules()),
+	}
+	dns := func(name string) core.AcmeIdentifier {
+		return core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
+	}
+
+	// The blacklist wins over the whitelist
+	e, err := pa.Explain(dns("www.bad.com"), 1)
+	test.AssertNotError(t, err, "Couldn't explain name")
+	test.AssertEquals(t, e.Err, error(BlacklistedError{Detail: "matches the blacklist rule for bad.com"}))
+	test.AssertEquals(t, e.PublicSuffix, "com")
+	test.Assert(t, e.BlacklistRule != nil, "Didn't report the blacklist rule")
+	test.AssertEquals(t, e.BlacklistRule.Host, "bad.com")
+	test.AssertEquals(t, e.BlacklistRule.Reason, "phishing")
+	test.Assert(t, e.WhitelistRule != nil && e.WhitelistApplies, "Didn't report the whitelist rule")
+	test.AssertEquals(t, len(e.Challenges), len(e.Combinations))
+
+	e, err = pa.Explain(dns("team-a.com"), 2)
+	test.AssertNotError(t, err, "Couldn't explain name")
+	_, ok := e.Err.(NotWhitelistedError)
+	test.Assert(t, ok, "Issued for a registration outside the rule's group")
+	test.Assert(t, e.WhitelistRule != nil && !e.WhitelistApplies, "Whitelist rule applied to another registration")
+
+	e, err = pa.Explain(dns("good-bank.com"), 2)
+	test.AssertNotError(t, err, "Couldn't explain name")
+	test.AssertNotError(t, e.Err, "Refused a whitelisted name")
+	test.AssertEquals(t, e.ReviewRule, "bank")
+
+	e, err = pa.Explain(dns("example.notatld"), 0)
+	test.AssertNotError(t, err, "Couldn't explain name")
+	test.AssertEquals(t, e.PublicSuffix, "")
+	_, ok = e.Err.(NonPublicError)
+	test.Assert(t, ok, "Issued for a name without a public suffix")
+}
@@ -0,0 +1,222 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/net/idna"
+)
+
+// IDNRules decides which internationalized domain names we issue for, on top
+// of the IDNA2008 and UTS #46 validity checks every A-label must pass.
+type IDNRules struct {
+	// Scripts, if not empty, holds the names of the only Unicode scripts
+	// (e.g. "Latin", "Cyrillic", "Han") that labels may be written in.
+	Scripts map[string]bool
+	// AllowMixedScripts allows labels to combine scripts other than in the
+	// ways Chinese, Japanese and Korean names usually do.
+	AllowMixedScripts bool
+	// AllowConfusables allows labels whose every character looks like an
+	// ASCII letter or digit, such as Cyrillic "аррӏе".
+	AllowConfusables bool
+}
+
+// ParseIDNScripts checks Unicode script names for IDNRules.Scripts.
+func ParseIDNScripts(names []string) (map[string]bool, error) {
+	scripts := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := unicode.Scripts[name]; !ok {
+			return nil, fmt.Errorf("Unknown Unicode script %q", name)
+		}
+		scripts[name] = true
+	}
+	return scripts, nil
+}
+
+// ScriptError indicates that a name uses scripts we won't issue for.
+type ScriptError struct{ Detail string }
+
+// ConfusableError indicates that a name can be mistaken for another name.
+type ConfusableError struct{ Detail string }
+
+func (e ScriptError) Error() string { return withDetail("Name uses scripts that are not allowed", e.Detail) }
+func (e ConfusableError) Error() string {
+	return withDetail("Name is confusable with an ASCII name", e.Detail)
+}
+
+// idnaProfile is the strict form of the UTS #46 lookup profile: STD3 ASCII
+// rules, the hyphen, joiner and Bidi rules, and nontransitional mapping.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.VerifyDNSLength(true),
+)
+
+// checkALabel decodes a lower case A-label and returns its U-label if it's
+// one we are willing to issue for. The U-label:
+//
+//  * MUST pass the checks of idnaProfile
+//  * MUST encode back to exactly the same A-label, so that UTS #46 mapping
+//    leaves it unchanged
+//  * MUST contain at least one non-ASCII character
+//  * MUST only contain letters, combining marks, decimal digits and hyphens,
+//    which excludes the symbols UTS #46 allows but IDNA2008 does not
+//  * MUST satisfy the script and confusable rules
+func (rules IDNRules) checkALabel(label string) (string, error) {
+	ulabel, err := idnaProfile.ToUnicode(label)
+	if err != nil {
+		return "", SyntaxError{Detail: fmt.Sprintf("label %q isn't a valid A-label: %s", label, err)}
+	}
+	if alabel, err := idnaProfile.ToASCII(ulabel); err != nil || alabel != label {
+		return "", SyntaxError{Detail: fmt.Sprintf("label %q (%s) isn't in its canonical form", label, ulabel)}
+	}
+	if isASCII(ulabel) {
+		return "", SyntaxError{Detail: fmt.Sprintf("label %q has no non-ASCII characters", label)}
+	}
+
+	scripts := map[string]bool{}
+	for _, r := range ulabel {
+		disallowed := SyntaxError{Detail: fmt.Sprintf("label %q (%s) contains the disallowed character %U", label, ulabel, r)}
+		switch {
+		case unicode.IsLetter(r):
+			script := scriptOf(r)
+			if script == "" {
+				return "", disallowed
+			}
+			scripts[script] = true
+		case unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd), r == '-':
+		default:
+			return "", disallowed
+		}
+	}
+
+	if err = rules.checkScripts(scripts); err != nil {
+		return "", ScriptError{Detail: fmt.Sprintf("label %q (%s) uses %s", label, ulabel, scriptList(scripts))}
+	}
+	if !rules.AllowConfusables && isASCII(skeleton(ulabel)) {
+		return "", ConfusableError{Detail: fmt.Sprintf("label %q (%s) looks like %q", label, ulabel, skeleton(ulabel))}
+	}
+	return ulabel, nil
+}
+
+// mixedScriptSets are the combinations of scripts UTS #39 treats as a single
+// script at its "highly restrictive" level.
+var mixedScriptSets = []map[string]bool{
+	{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true},
+	{"Latin": true, "Han": true, "Bopomofo": true},
+	{"Latin": true, "Han": true, "Hangul": true},
+}
+
+func (rules IDNRules) checkScripts(scripts map[string]bool) error {
+	if len(rules.Scripts) > 0 {
+		for script := range scripts {
+			if !rules.Scripts[script] {
+				return ScriptError{}
+			}
+		}
+	}
+	if len(scripts) <= 1 || rules.AllowMixedScripts {
+		return nil
+	}
+	for _, set := range mixedScriptSets {
+		if isSubset(scripts, set) {
+			return nil
+		}
+	}
+	return ScriptError{}
+}
+
+// unicodeName decodes the A-labels in domain, and reports whether there
+// were any. Labels that aren't valid punycode are left as they are.
+func unicodeName(domain string) (string, bool) {
+	labels := strings.Split(domain, ".")
+	decoded := false
+	for i, label := range labels {
+		if !punycodeRegexp.MatchString(label) {
+			continue
+		}
+		ulabel, err := idna.Punycode.ToUnicode(label)
+		if err != nil || ulabel == label {
+			continue
+		}
+		// The decoder accepts some malformed labels, which don't survive
+		// encoding again
+		if alabel, err := idna.Punycode.ToASCII(ulabel); err == nil && alabel == label {
+			labels[i] = ulabel
+			decoded = true
+		}
+	}
+	return strings.Join(labels, "."), decoded
+}
+
+// scriptList names the scripts in a sorted, comma separated list.
+func scriptList(scripts map[string]bool) string {
+	var names []string
+	for name := range scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func isSubset(a, b map[string]bool) bool {
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptOf returns the name of the script r belongs to, or "" for characters
+// that aren't specific to a script.
+func scriptOf(r rune) string {
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// confusables maps characters of other scripts to the ASCII characters they
+// are easily mistaken for. It is a subset of the UTS #39 confusables data,
+// covering the scripts most often used to imitate ASCII names.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j',
+	'ӏ': 'l', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'у': 'y', 'ү': 'y',
+	'ԝ': 'w', 'х': 'x',
+	// Greek
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u',
+	'χ': 'x',
+	// Armenian
+	'հ': 'h', 'ո': 'n', 'օ': 'o', 'զ': 'q', 'ս': 'u',
+}
+
+// skeleton replaces each character of s that has an ASCII lookalike with it.
+func skeleton(s string) string {
+	return strings.Map(func(r rune) rune {
+		if ascii, ok := confusables[r]; ok {
+			return ascii
+		}
+		return r
+	}, s)
+}
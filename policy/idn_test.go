@@ -0,0 +1,113 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestUnicodeName(t *testing.T) {
+	testCases := []struct {
+		decoded string
+		encoded string
+	}{
+		{"bücher", "bcher-kva"},
+		{"münchen", "mnchen-3ya"},
+		{"пример", "e1afmkfd"},
+		{"испытание", "80akhbyknj4f"},
+		{"中国", "fiqs8s"},
+		{"한국", "3e0b707e"},
+		{"ドメイン名例", "eckwd4c7cu47r2wf"},
+		{"ελληνικά", "hxargifdar"},
+	}
+	for _, tc := range testCases {
+		name, ok := unicodeName("www.xn--" + tc.encoded + ".example")
+		test.Assert(t, ok, "Didn't decode xn--"+tc.encoded)
+		test.AssertEquals(t, name, "www."+tc.decoded+".example")
+	}
+
+	for _, bad := range []string{"xn--bcher-kv!", "xn--99999999999", "xn--ü-kva", "www.example"} {
+		name, ok := unicodeName(bad)
+		test.Assert(t, !ok, "Decoded "+bad)
+		test.AssertEquals(t, name, bad)
+	}
+}
+
+func TestCheckALabel(t *testing.T) {
+	testCases := []struct {
+		label string
+		err   error
+	}{
+		{"xn--bcher-kva", nil},
+		{"xn--e1afmkfd", nil},
+		{"xn--fiqs8s", nil},
+		{"xn--3e0b707e", nil},
+		{"xn--eckwd4c7cu47r2wf", nil},
+		{"xn--hxargifdar", nil},
+		{"xn--", SyntaxError{}},
+		{"xn--abc-", SyntaxError{}},           // Only ASCII
+		{"xn--bcher-kva9", SyntaxError{}},     // Truncated
+		{"xn--bcher-2pa", SyntaxError{}},      // Upper case Ü
+		{"xn--wgv71a119e7w1h", SyntaxError{}}, // Halfwidth katakana
+		{"xn--abc-jdc", SyntaxError{}},        // Starts with a combining mark
+		{"xn--ls8h", SyntaxError{}},           // Emoji
+		{"xn--paypl-7ve", ScriptError{}},      // Latin with a Cyrillic а
+		{"xn--80ak6aa92e", ConfusableError{}}, // Cyrillic аррӏе
+		{"xn--uxacnc", ConfusableError{}},     // Greek οικο
+	}
+	rules := IDNRules{}
+	for _, tc := range testCases {
+		_, err := rules.checkALabel(tc.label)
+		if reflect.TypeOf(err) != reflect.TypeOf(tc.err) {
+			t.Errorf("checkALabel(%q) = %v, expected %v", tc.label, err, tc.err)
+		}
+	}
+
+	ulabel, err := rules.checkALabel("xn--bcher-kva")
+	test.AssertNotError(t, err, "Rejected a valid A-label")
+	test.AssertEquals(t, ulabel, "bücher")
+
+	// Japanese names mix Han, Hiragana and Katakana
+	_, err = rules.checkALabel("xn--r8jz45g")
+	test.AssertNotError(t, err, "Rejected Han with Hiragana")
+
+	rules.AllowMixedScripts = true
+	_, err = rules.checkALabel("xn--bcher-kva858cxa8bt7a")
+	test.AssertNotError(t, err, "Rejected mixed scripts when they are allowed")
+	_, err = rules.checkALabel("xn--paypl-7ve")
+	test.AssertEquals(t, err, error(ConfusableError{Detail: `label "xn--paypl-7ve" (paypаl) looks like "paypal"`}))
+	_, err = rules.checkALabel("xn--80ak6aa92e")
+	_, ok := err.(ConfusableError)
+	test.Assert(t, ok, "Accepted a confusable")
+
+	rules.AllowConfusables = true
+	_, err = rules.checkALabel("xn--80ak6aa92e")
+	test.AssertNotError(t, err, "Rejected a confusable when they are allowed")
+
+	rules.Scripts, err = ParseIDNScripts([]string{"Latin"})
+	test.AssertNotError(t, err, "Couldn't parse scripts")
+	_, err = rules.checkALabel("xn--bcher-kva")
+	test.AssertNotError(t, err, "Rejected an allowed script")
+	_, err = rules.checkALabel("xn--e1afmkfd")
+	_, ok = err.(ScriptError)
+	test.Assert(t, ok, "Accepted a disallowed script")
+
+	_, err = ParseIDNScripts([]string{"Klingon"})
+	test.AssertError(t, err, "Parsed an unknown script")
+}
+
+func TestWillingToIssueIDN(t *testing.T) {
+	// Syntax errors are found before the blacklist is consulted
+	pa := PolicyAuthorityImpl{Suffixes: NewSuffixList(EmbeddedSuffixRules())}
+	for _, domain := range []string{"xn--bcher-2pa.com", "www.xn--.com", "xn--80ak6aa92e.com"} {
+		err := pa.WillingToIssue(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}, 0)
+		test.AssertError(t, err, domain)
+	}
+}
@@ -6,9 +6,14 @@
 package policy
 
 import (
-	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	blog "github.com/letsencrypt/boulder/log"
 
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
@@ -19,18 +24,161 @@ const blacklisted = "blacklist"
 
 type domainRule struct {
 	Host string `db:"host"`
+	// Who added the rule, when and why, so it can be explained later
+	AddedBy string     `db:"addedBy" json:",omitempty"`
+	Added   *time.Time `db:"added" json:",omitempty"`
+	Reason  string     `db:"reason" json:",omitempty"`
+	// Expires, if set, is when the rule stops applying
+	Expires *time.Time `db:"expires" json:",omitempty"`
+}
+
+func (r domainRule) expired(now time.Time) bool {
+	return expiredAt(r.Expires, now)
+}
+
+func expiredAt(expires *time.Time, now time.Time) bool {
+	return expires != nil && !now.Before(*expires)
+}
+
+func (r domainRule) String() string {
+	s := fmt.Sprintf("%s [added by %q", r.Host, r.AddedBy)
+	if r.Added != nil {
+		s += fmt.Sprintf(" at %s", r.Added.Format(time.RFC3339))
+	}
+	s += fmt.Sprintf(", reason %q", r.Reason)
+	if r.Expires != nil {
+		s += fmt.Sprintf(", expires %s", r.Expires.Format(time.RFC3339))
+	}
+	return s + "]"
 }
 
 // BlacklistRule is used to hold rules blacklisting a DNS name
 type BlacklistRule domainRule
 
-// WhitelistRule is used to hold rules whitelisting a DNS name
-type WhitelistRule domainRule
+func (r BlacklistRule) String() string { return domainRule(r).String() }
+
+// WhitelistRule is used to hold rules whitelisting a DNS name. A rule with a
+// RegistrationID or Group only whitelists the name for that registration, or
+// for the registrations in that group.
+type WhitelistRule struct {
+	Host string `db:"host"`
+	// Who added the rule, when and why, so it can be explained later
+	AddedBy string     `db:"addedBy" json:",omitempty"`
+	Added   *time.Time `db:"added" json:",omitempty"`
+	Reason  string     `db:"reason" json:",omitempty"`
+	// Expires, if set, is when the rule stops applying
+	Expires *time.Time `db:"expires" json:",omitempty"`
+
+	RegistrationID int64  `db:"registrationID" json:",omitempty"`
+	Group          string `db:"regGroup" json:",omitempty"`
+}
+
+func (r WhitelistRule) rule() domainRule {
+	return domainRule{
+		Host:    r.Host,
+		AddedBy: r.AddedBy,
+		Added:   r.Added,
+		Reason:  r.Reason,
+		Expires: r.Expires,
+	}
+}
+
+func (r WhitelistRule) String() string {
+	return r.rule().String() + r.scope()
+}
+
+// scope describes the registrations the rule is limited to, if any.
+func (r WhitelistRule) scope() string {
+	s := ""
+	if r.RegistrationID != 0 {
+		s += fmt.Sprintf(" for registration ID %d", r.RegistrationID)
+	}
+	if r.Group != "" {
+		s += fmt.Sprintf(" for group %q", r.Group)
+	}
+	return s
+}
+
+// key identifies the rule among the rules for its host, as the whitelist's
+// primary key does.
+func (r WhitelistRule) key() string {
+	return fmt.Sprintf("%s %d %q", r.Host, r.RegistrationID, r.Group)
+}
+
+// scopeAllows reports whether the rule applies to regID.
+func (r WhitelistRule) scopeAllows(regID int64, inGroup func(string, int64) bool) bool {
+	if r.RegistrationID != 0 && r.RegistrationID != regID {
+		return false
+	}
+	return r.Group == "" || inGroup(r.Group, regID)
+}
+
+// RawRule is a rule as written in a rule file. Rule files written before
+// rules had provenance list just the host, which is still accepted.
+type RawRule WhitelistRule
+
+// BlacklistRule converts a rule from a rule file into a blacklist rule,
+// which can't be limited to some registrations.
+func (r RawRule) BlacklistRule() (BlacklistRule, error) {
+	if r.RegistrationID != 0 || r.Group != "" {
+		return BlacklistRule{}, fmt.Errorf("Blacklist rule for %s can't be limited to a registration or group", r.Host)
+	}
+	return BlacklistRule(WhitelistRule(r).rule()), nil
+}
+
+// groupMember records that a registration belongs to a group, for whitelist
+// rules limited to the group.
+type groupMember struct {
+	Group          string     `db:"groupName"`
+	RegistrationID int64      `db:"registrationID"`
+	AddedBy        string     `db:"addedBy"`
+	Added          *time.Time `db:"added"`
+}
+
+// UnmarshalJSON reads a rule that's either an object or a bare host name.
+func (r *RawRule) UnmarshalJSON(data []byte) error {
+	var host string
+	if err := json.Unmarshal(data, &host); err == nil {
+		*r = RawRule{Host: host}
+		return nil
+	}
+	type rawRule RawRule
+	return json.Unmarshal(data, (*rawRule)(r))
+}
+
+// ReviewRule holds a regular expression for high-risk names, such as ones
+// containing brand names, that must be reviewed by hand before we issue for
+// them. The pattern isn't anchored, so it matches anywhere in a name.
+type ReviewRule struct {
+	Pattern string `db:"pattern"`
+	// Who added the rule, when and why, so it can be explained later
+	AddedBy string     `db:"addedBy" json:",omitempty"`
+	Added   *time.Time `db:"added" json:",omitempty"`
+	Reason  string     `db:"reason" json:",omitempty"`
+	// Expires, if set, is when the rule stops applying
+	Expires *time.Time `db:"expires" json:",omitempty"`
+}
+
+func (r ReviewRule) String() string {
+	return domainRule{
+		Host:    r.Pattern,
+		AddedBy: r.AddedBy,
+		Added:   r.Added,
+		Reason:  r.Reason,
+		Expires: r.Expires,
+	}.String()
+}
+
+// compiledReviewRule is a ReviewRule with its pattern compiled
+type compiledReviewRule struct {
+	ReviewRule
+	re *regexp.Regexp
+}
 
 // RawRuleSet describes the rule set file format
 type RawRuleSet struct {
-	Blacklist []string
-	Whitelist []string
+	Blacklist []RawRule
+	Whitelist []RawRule
 }
 
 // RuleSet describes the rules to load into the policy database
@@ -52,6 +200,23 @@ func reverseName(domain string) string {
 type PolicyAuthorityDatabaseImpl struct {
 	log   *blog.AuditLogger
 	dbMap *gorp.DbMap
+	clk   clock.Clock
+
+	// cache, once CacheRules has been called, holds every rule so that
+	// CheckHostLists doesn't have to query the database
+	cacheMu sync.RWMutex
+	cache   *ruleCache
+}
+
+// ruleCache holds the blacklist, keyed by reversed host as in the database,
+// the whitelist rules for each host, the review rules and the registration
+// groups.
+type ruleCache struct {
+	blacklist map[string]domainRule
+	whitelist map[string][]WhitelistRule
+	review    []compiledReviewRule
+	// groups holds the registrations in each group
+	groups map[string]map[int64]bool
 }
 
 // NewPolicyAuthorityDatabaseImpl constructs a Policy Authority Database (and
@@ -60,44 +225,170 @@ func NewPolicyAuthorityDatabaseImpl(dbMap *gorp.DbMap) (padb *PolicyAuthorityDat
 	logger := blog.GetAuditLogger()
 
 	dbMap.AddTableWithName(BlacklistRule{}, "blacklist").SetKeys(false, "Host")
-	dbMap.AddTableWithName(WhitelistRule{}, "whitelist").SetKeys(false, "Host")
+	dbMap.AddTableWithName(WhitelistRule{}, "whitelist").SetKeys(false, "Host", "RegistrationID", "Group")
+	dbMap.AddTableWithName(ReviewRule{}, "reviewRules").SetKeys(false, "Pattern")
+	dbMap.AddTableWithName(groupMember{}, "registrationGroups").SetKeys(false, "Group", "RegistrationID")
 
 	padb = &PolicyAuthorityDatabaseImpl{
 		dbMap: dbMap,
 		log:   logger,
+		clk:   clock.Default(),
 	}
 
 	return padb, nil
 }
 
 // LoadRules loads the whitelist and blacklist into the database in a transaction
-// deleting any previous content
+// deleting any previous content. Rules without an Added time are stamped with
+// the current time.
 func (padb *PolicyAuthorityDatabaseImpl) LoadRules(rs RuleSet) error {
-	tx, err := padb.dbMap.Begin()
+	old, err := padb.DumpRules()
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	_, err = tx.Exec("DELETE FROM blacklist")
+	now := padb.clk.Now()
+
+	tx, err := padb.dbMap.Begin()
 	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM blacklist"); err != nil {
 		tx.Rollback()
 		return err
 	}
+	blacklist, oldBlacklist := map[string]string{}, map[string]string{}
 	for _, r := range rs.Blacklist {
+		if r.Added == nil {
+			r.Added = &now
+		}
+		blacklist[r.Host] = domainRule(r).String()
 		r.Host = reverseName(r.Host)
-		tx.Insert(&r)
+		if err = tx.Insert(&r); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
-	_, err = tx.Exec("DELETE FROM whitelist")
-	if err != nil {
+	if _, err = tx.Exec("DELETE FROM whitelist"); err != nil {
 		tx.Rollback()
 		return err
 	}
+	whitelist, oldWhitelist := map[string]string{}, map[string]string{}
 	for _, r := range rs.Whitelist {
-		tx.Insert(&r)
+		if r.Added == nil {
+			r.Added = &now
+		}
+		whitelist[r.key()] = r.String()
+		if err = tx.Insert(&r); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, r := range old.Blacklist {
+		oldBlacklist[r.Host] = domainRule(r).String()
+	}
+	for _, r := range old.Whitelist {
+		oldWhitelist[r.key()] = r.String()
 	}
+	padb.auditReplacedRules(blacklisted, oldBlacklist, blacklist)
+	padb.auditReplacedRules(whitelisted, oldWhitelist, whitelist)
+	return nil
+}
 
-	err = tx.Commit()
-	return err
+// auditReplacedRules logs each rule of a list replaced by LoadRules that was
+// removed, or added or changed. Rules are given as descriptions keyed by
+// what identifies them in the list.
+func (padb *PolicyAuthorityDatabaseImpl) auditReplacedRules(list string, oldRules, newRules map[string]string) {
+	for key, r := range oldRules {
+		if _, kept := newRules[key]; !kept {
+			// AUDIT[ Policy Changes ]
+			padb.log.Audit(fmt.Sprintf("Removed %s rule %s while loading rules", list, r))
+		}
+	}
+	for key, r := range newRules {
+		if oldRules[key] != r {
+			// AUDIT[ Policy Changes ]
+			padb.log.Audit(fmt.Sprintf("Added %s rule %s while loading rules", list, r))
+		}
+	}
+}
+
+// AddBlacklistRule adds a rule to the blacklist, replacing any rule for the
+// same host.
+func (padb *PolicyAuthorityDatabaseImpl) AddBlacklistRule(rule BlacklistRule) error {
+	if rule.Added == nil {
+		now := padb.clk.Now()
+		rule.Added = &now
+	}
+	description := domainRule(rule).String()
+	rule.Host = reverseName(rule.Host)
+	return padb.addRule(blacklisted, &rule, description)
+}
+
+// AddWhitelistRule adds a rule to the whitelist, replacing any rule for the
+// same host, registration and group. Rules for the host limited to other
+// registrations or groups are kept.
+func (padb *PolicyAuthorityDatabaseImpl) AddWhitelistRule(rule WhitelistRule) error {
+	if rule.Added == nil {
+		now := padb.clk.Now()
+		rule.Added = &now
+	}
+	return padb.addRule(whitelisted, &rule, rule.String())
+}
+
+// addRule stores row in list in place of any rule with the same primary key,
+// and logs the rule's description.
+func (padb *PolicyAuthorityDatabaseImpl) addRule(list string, row interface{}, description string) error {
+	tx, err := padb.dbMap.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Delete(row); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Insert(row); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	// AUDIT[ Policy Changes ]
+	padb.log.Audit(fmt.Sprintf("Added %s rule %s", list, description))
+	return nil
+}
+
+// RemoveBlacklistRule removes the blacklist rule for host, recording who
+// removed it in the audit log.
+func (padb *PolicyAuthorityDatabaseImpl) RemoveBlacklistRule(host, removedBy string) error {
+	return padb.removeRule(blacklisted, &BlacklistRule{Host: reverseName(host)}, host, removedBy)
+}
+
+// RemoveWhitelistRule removes the whitelist rule for host limited to regID
+// and group, which are zero for a rule that applies to everyone, recording
+// who removed it in the audit log.
+func (padb *PolicyAuthorityDatabaseImpl) RemoveWhitelistRule(host string, regID int64, group, removedBy string) error {
+	rule := WhitelistRule{Host: host, RegistrationID: regID, Group: group}
+	return padb.removeRule(whitelisted, &rule, host+rule.scope(), removedBy)
+}
+
+// removeRule deletes the rule in list with row's primary key. The rule is
+// named by description in errors and the audit log.
+func (padb *PolicyAuthorityDatabaseImpl) removeRule(list string, row interface{}, description, removedBy string) error {
+	n, err := padb.dbMap.Delete(row)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("No %s rule for %s", list, description)
+	}
+	// AUDIT[ Policy Changes ]
+	padb.log.Audit(fmt.Sprintf("Removed %s rule for %s, removed by %q", list, description, removedBy))
+	return nil
 }
 
 // DumpRules retrieves all domainRules in the database so they can be written to
@@ -108,8 +399,8 @@ func (padb *PolicyAuthorityDatabaseImpl) DumpRules() (rs RuleSet, err error) {
 	if err != nil {
 		return
 	}
-	for _, r := range bList {
-		r.Host = reverseName(r.Host)
+	for i := range bList {
+		bList[i].Host = reverseName(bList[i].Host)
 	}
 	rs.Blacklist = bList
 	var wList []WhitelistRule
@@ -121,56 +412,338 @@ func (padb *PolicyAuthorityDatabaseImpl) DumpRules() (rs RuleSet, err error) {
 	return rs, err
 }
 
-func (padb *PolicyAuthorityDatabaseImpl) allowedByBlacklist(host string) bool {
-	var rule BlacklistRule
-	// Use lexical ordering to quickly find blacklisted root domains
-	err := padb.dbMap.SelectOne(
-		&rule,
-		`SELECT * FROM blacklist WHERE :host >= host ORDER BY host DESC LIMIT 1`,
-		map[string]interface{}{"host": host},
-	)
+// CacheRules loads every rule into memory for CheckHostLists to use instead
+// of querying the database, and loads them again every interval to pick up
+// changes. A failed refresh is logged and keeps the rules already cached.
+func (padb *PolicyAuthorityDatabaseImpl) CacheRules(interval time.Duration) error {
+	if err := padb.refreshCache(); err != nil {
+		return err
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if err := padb.refreshCache(); err != nil {
+				padb.log.Err(fmt.Sprintf("Couldn't refresh policy rules, keeping the cached rules: %s", err))
+			}
+		}
+	}()
+	return nil
+}
+
+func (padb *PolicyAuthorityDatabaseImpl) refreshCache() error {
+	var bList []BlacklistRule
+	if _, err := padb.dbMap.Select(&bList, "SELECT * FROM blacklist"); err != nil {
+		return err
+	}
+	var wList []WhitelistRule
+	if _, err := padb.dbMap.Select(&wList, "SELECT * FROM whitelist"); err != nil {
+		return err
+	}
+	review, err := padb.compiledReviewRules()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return true
+		return err
+	}
+	var members []groupMember
+	if _, err = padb.dbMap.Select(&members, "SELECT * FROM registrationGroups"); err != nil {
+		return err
+	}
+	cache := &ruleCache{
+		review:    review,
+		blacklist: make(map[string]domainRule, len(bList)),
+		whitelist: make(map[string][]WhitelistRule, len(wList)),
+		groups:    map[string]map[int64]bool{},
+	}
+	for _, r := range bList {
+		cache.blacklist[r.Host] = domainRule(r)
+	}
+	for _, r := range wList {
+		cache.whitelist[r.Host] = append(cache.whitelist[r.Host], r)
+	}
+	for _, m := range members {
+		if cache.groups[m.Group] == nil {
+			cache.groups[m.Group] = map[int64]bool{}
 		}
-		return false
+		cache.groups[m.Group][m.RegistrationID] = true
 	}
-	if host == rule.Host || strings.HasPrefix(host, rule.Host+".") {
-		return false
+
+	padb.cacheMu.Lock()
+	defer padb.cacheMu.Unlock()
+	padb.cache = cache
+	return nil
+}
+
+func (padb *PolicyAuthorityDatabaseImpl) cachedRules() *ruleCache {
+	padb.cacheMu.RLock()
+	defer padb.cacheMu.RUnlock()
+	return padb.cache
+}
+
+// blacklistCandidates lists the reversed names a blacklist rule would need
+// to match reversed host: host itself and each of its parent domains.
+func blacklistCandidates(host string) []string {
+	labels := strings.Split(host, ".")
+	candidates := make([]string, len(labels))
+	for i := range labels {
+		candidates[i] = strings.Join(labels[:i+1], ".")
+	}
+	return candidates
+}
+
+// blacklistRuleFor finds an unexpired blacklist rule for reversed host or one
+// of its parent domains. The rule is returned with its host in the usual
+// order.
+func (padb *PolicyAuthorityDatabaseImpl) blacklistRuleFor(host string) (rule BlacklistRule, found bool, err error) {
+	now := padb.clk.Now()
+	candidates := blacklistCandidates(host)
+	if cache := padb.cachedRules(); cache != nil {
+		for _, candidate := range candidates {
+			if cached, ok := cache.blacklist[candidate]; ok && !cached.expired(now) {
+				rule = BlacklistRule(cached)
+				rule.Host = reverseName(rule.Host)
+				return rule, true, nil
+			}
+		}
+		return rule, false, nil
 	}
-	return true
+
+	var rules []BlacklistRule
+	placeholders := make([]string, len(candidates))
+	args := []interface{}{now}
+	for i, candidate := range candidates {
+		placeholders[i] = "?"
+		args = append(args, candidate)
+	}
+	_, err = padb.dbMap.Select(
+		&rules,
+		`SELECT * FROM blacklist WHERE (expires IS NULL OR expires > ?) AND host IN (`+strings.Join(placeholders, ",")+`)`,
+		args...,
+	)
+	if err != nil || len(rules) == 0 {
+		return rule, false, err
+	}
+	rule = rules[0]
+	rule.Host = reverseName(rule.Host)
+	return rule, true, nil
 }
 
-func (padb *PolicyAuthorityDatabaseImpl) allowedByWhitelist(host string) bool {
-	var rule WhitelistRule
-	err := padb.dbMap.SelectOne(
-		&rule,
-		`SELECT * FROM whitelist WHERE :host = host LIMIT 1`,
-		map[string]interface{}{"host": host},
+// whitelistRulesFor finds the unexpired whitelist rules for host, whichever
+// registrations they apply to.
+func (padb *PolicyAuthorityDatabaseImpl) whitelistRulesFor(host string) (rules []WhitelistRule, err error) {
+	now := padb.clk.Now()
+	if cache := padb.cachedRules(); cache != nil {
+		for _, r := range cache.whitelist[host] {
+			if !r.rule().expired(now) {
+				rules = append(rules, r)
+			}
+		}
+		return rules, nil
+	}
+
+	_, err = padb.dbMap.Select(
+		&rules,
+		`SELECT * FROM whitelist WHERE :host = host AND (expires IS NULL OR expires > :now)`,
+		map[string]interface{}{"host": host, "now": now},
 	)
+	return rules, err
+}
+
+// applicableWhitelistRule picks the first of rules that applies to regID.
+func (padb *PolicyAuthorityDatabaseImpl) applicableWhitelistRule(rules []WhitelistRule, regID int64) (WhitelistRule, bool) {
+	for _, r := range rules {
+		if r.scopeAllows(regID, padb.inGroup) {
+			return r, true
+		}
+	}
+	return WhitelistRule{}, false
+}
+
+// checkWhitelist returns a NotWhitelistedError unless one of the whitelist
+// rules for host applies to regID.
+func (padb *PolicyAuthorityDatabaseImpl) checkWhitelist(host string, regID int64) error {
+	rules, err := padb.whitelistRulesFor(host)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return false
+		return NotWhitelistedError{Detail: "the whitelist couldn't be checked"}
+	}
+	if len(rules) == 0 {
+		return NotWhitelistedError{}
+	}
+	if _, ok := padb.applicableWhitelistRule(rules, regID); !ok {
+		return NotWhitelistedError{Detail: fmt.Sprintf("the whitelist rules for %s are limited to other registrations", host)}
+	}
+	return nil
+}
+
+func (padb *PolicyAuthorityDatabaseImpl) inGroup(group string, regID int64) bool {
+	if cache := padb.cachedRules(); cache != nil {
+		return cache.groups[group][regID]
+	}
+	count, err := padb.dbMap.SelectInt(
+		`SELECT COUNT(*) FROM registrationGroups WHERE groupName = :group AND registrationID = :regID`,
+		map[string]interface{}{"group": group, "regID": regID},
+	)
+	return err == nil && count > 0
+}
+
+// AddGroupMember adds a registration to a group, so that whitelist rules for
+// the group apply to it.
+func (padb *PolicyAuthorityDatabaseImpl) AddGroupMember(group string, regID int64, addedBy string) error {
+	now := padb.clk.Now()
+	member := groupMember{
+		Group:          group,
+		RegistrationID: regID,
+		AddedBy:        addedBy,
+		Added:          &now,
+	}
+	if err := padb.dbMap.Insert(&member); err != nil {
+		return err
+	}
+	// AUDIT[ Policy Changes ]
+	padb.log.Audit(fmt.Sprintf("Added registration ID %d to group %q, added by %q", regID, group, addedBy))
+	return nil
+}
+
+// RemoveGroupMember removes a registration from a group.
+func (padb *PolicyAuthorityDatabaseImpl) RemoveGroupMember(group string, regID int64, removedBy string) error {
+	result, err := padb.dbMap.Exec("DELETE FROM registrationGroups WHERE groupName = ? AND registrationID = ?", group, regID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("Registration ID %d isn't in group %q", regID, group)
+	}
+	// AUDIT[ Policy Changes ]
+	padb.log.Audit(fmt.Sprintf("Removed registration ID %d from group %q, removed by %q", regID, group, removedBy))
+	return nil
+}
+
+// GroupMembers retrieves the registration IDs in every group.
+func (padb *PolicyAuthorityDatabaseImpl) GroupMembers() (map[string][]int64, error) {
+	var members []groupMember
+	if _, err := padb.dbMap.Select(&members, "SELECT * FROM registrationGroups ORDER BY groupName, registrationID"); err != nil {
+		return nil, err
+	}
+	groups := map[string][]int64{}
+	for _, m := range members {
+		groups[m.Group] = append(groups[m.Group], m.RegistrationID)
+	}
+	return groups, nil
+}
+
+// AddReviewRule adds a rule holding names that match its pattern for review,
+// replacing any rule with the same pattern.
+func (padb *PolicyAuthorityDatabaseImpl) AddReviewRule(rule ReviewRule) error {
+	if _, err := regexp.Compile(rule.Pattern); err != nil {
+		return fmt.Errorf("Invalid review rule pattern %q: %s", rule.Pattern, err)
+	}
+	if rule.Added == nil {
+		now := padb.clk.Now()
+		rule.Added = &now
+	}
+
+	tx, err := padb.dbMap.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM reviewRules WHERE pattern = ?", rule.Pattern); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Insert(&rule); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	// AUDIT[ Policy Changes ]
+	padb.log.Audit(fmt.Sprintf("Added review rule %s", rule))
+	return nil
+}
+
+// RemoveReviewRule removes the review rule with pattern, recording who
+// removed it in the audit log.
+func (padb *PolicyAuthorityDatabaseImpl) RemoveReviewRule(pattern, removedBy string) error {
+	result, err := padb.dbMap.Exec("DELETE FROM reviewRules WHERE pattern = ?", pattern)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("No review rule for %q", pattern)
+	}
+	// AUDIT[ Policy Changes ]
+	padb.log.Audit(fmt.Sprintf("Removed review rule for %q, removed by %q", pattern, removedBy))
+	return nil
+}
+
+// ReviewRules retrieves every review rule in the database.
+func (padb *PolicyAuthorityDatabaseImpl) ReviewRules() (rules []ReviewRule, err error) {
+	_, err = padb.dbMap.Select(&rules, "SELECT * FROM reviewRules")
+	return
+}
+
+// compiledReviewRules retrieves and compiles every review rule. Patterns
+// are checked when they're added, so one that doesn't compile is logged
+// and skipped.
+func (padb *PolicyAuthorityDatabaseImpl) compiledReviewRules() ([]compiledReviewRule, error) {
+	rules, err := padb.ReviewRules()
+	if err != nil {
+		return nil, err
+	}
+	var compiled []compiledReviewRule
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			padb.log.Err(fmt.Sprintf("Skipping invalid review rule pattern %q: %s", rule.Pattern, err))
+			continue
 		}
-		return false
+		compiled = append(compiled, compiledReviewRule{rule, re})
 	}
-	return true
+	return compiled, nil
+}
+
+// ReviewRuleFor returns the pattern of the first unexpired review rule that
+// matches any of names, or "" if none do.
+func (padb *PolicyAuthorityDatabaseImpl) ReviewRuleFor(names []string) (string, error) {
+	var rules []compiledReviewRule
+	if cache := padb.cachedRules(); cache != nil {
+		rules = cache.review
+	} else {
+		var err error
+		if rules, err = padb.compiledReviewRules(); err != nil {
+			return "", err
+		}
+	}
+
+	now := padb.clk.Now()
+	for _, rule := range rules {
+		if expiredAt(rule.Expires, now) {
+			continue
+		}
+		for _, name := range names {
+			if rule.re.MatchString(name) {
+				return rule.Pattern, nil
+			}
+		}
+	}
+	return "", nil
 }
 
 // CheckHostLists will query the database for white/blacklist rules that match host,
-// if both whitelist and blacklist rules are found the blacklist will always win
-func (padb *PolicyAuthorityDatabaseImpl) CheckHostLists(host string, requireWhitelisted bool) error {
+// if both whitelist and blacklist rules are found the blacklist will always win.
+// Expired rules are ignored, as are whitelist rules limited to registrations
+// other than regID. If the rules can't be checked, host isn't allowed.
+func (padb *PolicyAuthorityDatabaseImpl) CheckHostLists(host string, requireWhitelisted bool, regID int64) error {
 	if requireWhitelisted {
-		if !padb.allowedByWhitelist(host) {
-			// return fmt.Errorf("Domain is not whitelisted for issuance")
-			return NotWhitelistedError{}
+		if err := padb.checkWhitelist(host, regID); err != nil {
+			return err
 		}
 	}
 	// Overrides the whitelist if a blacklist rule is found
-	host = reverseName(host)
-	if !padb.allowedByBlacklist(host) {
-		// return fmt.Errorf("Domain is blacklisted for issuance")
-		return BlacklistedError{}
+	rule, found, err := padb.blacklistRuleFor(reverseName(host))
+	if err != nil {
+		return BlacklistedError{Detail: "the blacklist couldn't be checked"}
+	}
+	if found {
+		return BlacklistedError{Detail: fmt.Sprintf("matches the blacklist rule for %s", rule.Host)}
 	}
 	return nil
 }
@@ -6,15 +6,22 @@
 package policy
 
 import (
+	"encoding/json"
+	"regexp"
 	"testing"
+	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/sa/satest"
 	"github.com/letsencrypt/boulder/test"
 )
 
 func padbImpl(t *testing.T) (*PolicyAuthorityDatabaseImpl, func()) {
 	dbMap, err := sa.NewDbMap(dbConnStr)
 	test.AssertNotError(t, err, "Could not construct dbMap")
+	satest.MigrateSQLite(t, dbMap, "policy")
 
 	padb, err := NewPolicyAuthorityDatabaseImpl(dbMap)
 	test.AssertNotError(t, err, "Couldn't create PADB")
@@ -42,17 +49,17 @@ func TestBlacklist(t *testing.T) {
 	})
 	test.AssertNotError(t, err, "Couldn't load rules")
 
-	err = p.CheckHostLists("bad.com", false)
+	err = p.CheckHostLists("bad.com", false, 0)
 	test.AssertError(t, err, "Hostname should be blacklisted")
-	err = p.CheckHostLists("still.bad.com", false)
+	err = p.CheckHostLists("still.bad.com", false, 0)
 	test.AssertError(t, err, "Hostname should be blacklisted")
-	err = p.CheckHostLists("badminton.com", false)
+	err = p.CheckHostLists("badminton.com", false, 0)
 	test.AssertNotError(t, err, "Hostname shouldn't be blacklisted")
 	// Whitelisted subdomain of blacklisted root should still be blacklsited
-	err = p.CheckHostLists("good.bad.com", true)
+	err = p.CheckHostLists("good.bad.com", true, 0)
 	test.AssertError(t, err, "Blacklist should beat whitelist")
 	// Not blacklisted
-	err = p.CheckHostLists("good.com", false)
+	err = p.CheckHostLists("good.com", false, 0)
 	test.AssertNotError(t, err, "Hostname shouldn't be blacklisted")
 }
 
@@ -77,15 +84,229 @@ func TestWhitelist(t *testing.T) {
 	})
 	test.AssertNotError(t, err, "Couldn't load rules")
 
-	err = p.CheckHostLists("bad.com", true)
+	err = p.CheckHostLists("bad.com", true, 0)
 	test.AssertError(t, err, "Hostname should be blacklisted")
 	// Whitelisted subdomain of blacklisted root should still be blacklsited
-	err = p.CheckHostLists("good.bad.com", true)
+	err = p.CheckHostLists("good.bad.com", true, 0)
 	test.AssertError(t, err, "Blacklist should beat whitelist")
 	// Non-existent domain should fail
-	err = p.CheckHostLists("not-good.com", true)
+	err = p.CheckHostLists("not-good.com", true, 0)
 	test.AssertError(t, err, "Hostname isn't on whitelist")
 	// Whitelisted
-	err = p.CheckHostLists("good.com", true)
+	err = p.CheckHostLists("good.com", true, 0)
 	test.AssertNotError(t, err, "Hostname is on whitelist")
 }
+
+func TestAddRemoveRules(t *testing.T) {
+	p, cleanup := padbImpl(t)
+	defer cleanup()
+
+	err := p.AddBlacklistRule(BlacklistRule{Host: "bad.com", AddedBy: "tester", Reason: "Testing"})
+	test.AssertNotError(t, err, "Couldn't add blacklist rule")
+	err = p.AddWhitelistRule(WhitelistRule{Host: "good.com"})
+	test.AssertNotError(t, err, "Couldn't add whitelist rule")
+
+	rs, err := p.DumpRules()
+	test.AssertNotError(t, err, "Couldn't dump rules")
+	test.AssertEquals(t, len(rs.Blacklist), 1)
+	test.AssertEquals(t, rs.Blacklist[0].Host, "bad.com")
+	test.AssertEquals(t, rs.Blacklist[0].Reason, "Testing")
+	test.Assert(t, rs.Blacklist[0].Added != nil, "Rule wasn't given an added time")
+
+	test.AssertError(t, p.CheckHostLists("www.bad.com", false, 0), "Hostname should be blacklisted")
+	test.AssertNotError(t, p.CheckHostLists("good.com", true, 0), "Hostname is on whitelist")
+
+	err = p.RemoveBlacklistRule("bad.com", "tester")
+	test.AssertNotError(t, err, "Couldn't remove blacklist rule")
+	test.AssertNotError(t, p.CheckHostLists("www.bad.com", false, 0), "Hostname shouldn't be blacklisted")
+	err = p.RemoveBlacklistRule("bad.com", "tester")
+	test.AssertError(t, err, "Removed a rule that doesn't exist")
+}
+
+func TestRawRuleUnmarshal(t *testing.T) {
+	var rules RawRuleSet
+	err := json.Unmarshal([]byte(`{
+		"Blacklist": ["bad.com", {"Host": "worse.com", "AddedBy": "tester", "Reason": "Testing", "Expires": "2015-10-02T00:00:00Z"}],
+		"Whitelist": ["good.com"]
+	}`), &rules)
+	test.AssertNotError(t, err, "Couldn't unmarshal rules")
+	test.AssertEquals(t, len(rules.Blacklist), 2)
+	test.AssertEquals(t, rules.Blacklist[0].Host, "bad.com")
+	test.Assert(t, rules.Blacklist[0].Expires == nil, "Bare host rule shouldn't expire")
+	test.AssertEquals(t, rules.Blacklist[1].Host, "worse.com")
+	test.AssertEquals(t, rules.Blacklist[1].AddedBy, "tester")
+	test.AssertEquals(t, rules.Blacklist[1].Reason, "Testing")
+	test.Assert(t, rules.Blacklist[1].Expires != nil, "Rule expiry wasn't unmarshaled")
+	test.AssertEquals(t, rules.Whitelist[0].Host, "good.com")
+
+	err = json.Unmarshal([]byte(`{"Blacklist": [7]}`), &rules)
+	test.AssertError(t, err, "Unmarshaled an invalid rule")
+
+	err = json.Unmarshal([]byte(`{"Blacklist": [{"Host": "bad.com", "Group": "team-a"}], "Whitelist": [{"Host": "team-a.com", "Group": "team-a"}]}`), &rules)
+	test.AssertNotError(t, err, "Couldn't unmarshal rules")
+	test.AssertEquals(t, WhitelistRule(rules.Whitelist[0]).Group, "team-a")
+	_, err = rules.Blacklist[0].BlacklistRule()
+	test.AssertError(t, err, "Blacklist rules can't be scoped")
+}
+
+func TestCachedRules(t *testing.T) {
+	fc := clock.NewFake()
+	expires := fc.Now().Add(time.Hour)
+	p := &PolicyAuthorityDatabaseImpl{
+		clk: fc,
+		cache: &ruleCache{
+			blacklist: map[string]domainRule{
+				"com.bad":       domainRule{Host: "com.bad"},
+				"com.temporary": domainRule{Host: "com.temporary", Expires: &expires},
+			},
+			whitelist: map[string][]WhitelistRule{
+				"good.com":      {{Host: "good.com"}},
+				"temporary.net": {{Host: "temporary.net", Expires: &expires}},
+			},
+		},
+	}
+
+	test.AssertError(t, p.CheckHostLists("bad.com", false, 0), "Hostname should be blacklisted")
+	test.AssertError(t, p.CheckHostLists("still.bad.com", false, 0), "Hostname should be blacklisted")
+	test.AssertNotError(t, p.CheckHostLists("com.bad-site.com", false, 0), "Hostname shouldn't be blacklisted")
+	test.AssertNotError(t, p.CheckHostLists("badminton.com", false, 0), "Hostname shouldn't be blacklisted")
+	test.AssertError(t, p.CheckHostLists("www.temporary.com", false, 0), "Hostname should be blacklisted")
+	test.AssertNotError(t, p.CheckHostLists("good.com", true, 0), "Hostname is on whitelist")
+	test.AssertNotError(t, p.CheckHostLists("temporary.net", true, 0), "Hostname is on whitelist")
+	test.AssertError(t, p.CheckHostLists("not-good.com", true, 0), "Hostname isn't on whitelist")
+
+	fc.Add(time.Hour)
+	test.AssertNotError(t, p.CheckHostLists("www.temporary.com", false, 0), "Expired rule shouldn't blacklist")
+	test.AssertError(t, p.CheckHostLists("temporary.net", true, 0), "Expired rule shouldn't whitelist")
+}
+
+func TestScopedWhitelist(t *testing.T) {
+	p := &PolicyAuthorityDatabaseImpl{
+		clk: clock.NewFake(),
+		cache: &ruleCache{
+			whitelist: map[string][]WhitelistRule{
+				"everyone.com": {{Host: "everyone.com"}},
+				"team-a.com":   {{Host: "team-a.com", Group: "team-a"}},
+				"one.com":      {{Host: "one.com", RegistrationID: 3}},
+				"shared.com": {
+					{Host: "shared.com", RegistrationID: 3},
+					{Host: "shared.com", Group: "team-a"},
+				},
+			},
+			groups: map[string]map[int64]bool{
+				"team-a": {1: true, 2: true},
+			},
+		},
+	}
+
+	testCases := []struct {
+		host  string
+		regID int64
+		ok    bool
+	}{
+		{"everyone.com", 1, true},
+		{"everyone.com", 3, true},
+		{"team-a.com", 1, true},
+		{"team-a.com", 2, true},
+		{"team-a.com", 3, false},
+		{"one.com", 3, true},
+		{"one.com", 1, false},
+		{"shared.com", 1, true},
+		{"shared.com", 3, true},
+		{"shared.com", 4, false},
+	}
+	for _, tc := range testCases {
+		err := p.CheckHostLists(tc.host, true, tc.regID)
+		if (err == nil) != tc.ok {
+			t.Errorf("CheckHostLists(%q, true, %d) = %v, expected allowed %t", tc.host, tc.regID, err, tc.ok)
+		}
+	}
+	// Scoped rules don't matter when the whitelist isn't enforced
+	test.AssertNotError(t, p.CheckHostLists("one.com", false, 1), "Hostname isn't blacklisted")
+}
+
+func TestScopedWhitelistDB(t *testing.T) {
+	p, cleanup := padbImpl(t)
+	defer cleanup()
+
+	err := p.AddWhitelistRule(WhitelistRule{Host: "team-a.com", Group: "team-a"})
+	test.AssertNotError(t, err, "Couldn't add whitelist rule")
+	err = p.AddWhitelistRule(WhitelistRule{Host: "one.com", RegistrationID: 3})
+	test.AssertNotError(t, err, "Couldn't add whitelist rule")
+	err = p.AddGroupMember("team-a", 1, "tester")
+	test.AssertNotError(t, err, "Couldn't add group member")
+
+	test.AssertNotError(t, p.CheckHostLists("team-a.com", true, 1), "Group member should be whitelisted")
+	test.AssertError(t, p.CheckHostLists("team-a.com", true, 3), "Non-member shouldn't be whitelisted")
+	test.AssertNotError(t, p.CheckHostLists("one.com", true, 3), "Registration should be whitelisted")
+	test.AssertError(t, p.CheckHostLists("one.com", true, 1), "Other registration shouldn't be whitelisted")
+
+	// Rules for the same host with different scopes are kept side by side
+	err = p.AddWhitelistRule(WhitelistRule{Host: "one.com", Group: "team-a"})
+	test.AssertNotError(t, err, "Couldn't add a second whitelist rule for the host")
+	test.AssertNotError(t, p.CheckHostLists("one.com", true, 3), "Adding a rule replaced another scope's rule")
+	test.AssertNotError(t, p.CheckHostLists("one.com", true, 1), "Group member should be whitelisted")
+	err = p.RemoveWhitelistRule("one.com", 0, "team-a", "tester")
+	test.AssertNotError(t, err, "Couldn't remove whitelist rule")
+	test.AssertError(t, p.CheckHostLists("one.com", true, 1), "Removed rule still applies")
+	test.AssertNotError(t, p.CheckHostLists("one.com", true, 3), "Removing a rule removed another scope's rule")
+	err = p.RemoveWhitelistRule("one.com", 0, "team-a", "tester")
+	test.AssertError(t, err, "Removed a rule that doesn't exist")
+
+	groups, err := p.GroupMembers()
+	test.AssertNotError(t, err, "Couldn't list groups")
+	test.AssertEquals(t, len(groups["team-a"]), 1)
+
+	err = p.RemoveGroupMember("team-a", 1, "tester")
+	test.AssertNotError(t, err, "Couldn't remove group member")
+	test.AssertError(t, p.CheckHostLists("team-a.com", true, 1), "Removed member shouldn't be whitelisted")
+	err = p.RemoveGroupMember("team-a", 1, "tester")
+	test.AssertError(t, err, "Removed a registration that isn't in the group")
+}
+
+func TestReviewRuleFor(t *testing.T) {
+	fc := clock.NewFake()
+	expires := fc.Now().Add(time.Hour)
+	p := &PolicyAuthorityDatabaseImpl{
+		clk: fc,
+		cache: &ruleCache{
+			review: []compiledReviewRule{
+				{ReviewRule{Pattern: "payp[a4]l"}, regexp.MustCompile("payp[a4]l")},
+				{ReviewRule{Pattern: "^bank\\.", Expires: &expires}, regexp.MustCompile("^bank\\.")},
+			},
+		},
+	}
+	pa := PolicyAuthorityImpl{DB: p}
+
+	testCases := []struct {
+		domain string
+		rule   string
+	}{
+		{"paypal.com", "payp[a4]l"},
+		{"secure-payp4l-login.net", "payp[a4]l"},
+		{"xn--pypal-4ve.com", "payp[a4]l"}, // Cyrillic а
+		{"bank.com", "^bank\\."},
+		{"mybank.com", ""},
+		{"example.com", ""},
+	}
+	for _, tc := range testCases {
+		rule, err := pa.ReviewRuleFor(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: tc.domain})
+		test.AssertNotError(t, err, tc.domain)
+		if rule != tc.rule {
+			t.Errorf("ReviewRuleFor(%q) = %q, expected %q", tc.domain, rule, tc.rule)
+		}
+	}
+
+	fc.Add(time.Hour)
+	rule, err := pa.ReviewRuleFor(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "bank.com"})
+	test.AssertNotError(t, err, "bank.com")
+	test.AssertEquals(t, rule, "")
+}
+
+func TestDomainRuleString(t *testing.T) {
+	added := time.Date(2015, 10, 2, 0, 0, 0, 0, time.UTC)
+	r := domainRule{Host: "bad.com", AddedBy: "tester", Added: &added, Reason: "Testing"}
+	test.AssertEquals(t, r.String(), `bad.com [added by "tester" at 2015-10-02T00:00:00Z, reason "Testing"]`)
+	r.Expires = &added
+	test.AssertEquals(t, r.String(), `bad.com [added by "tester" at 2015-10-02T00:00:00Z, reason "Testing", expires 2015-10-02T00:00:00Z]`)
+}
@@ -6,6 +6,7 @@
 package policy
 
 import (
+	"fmt"
 	"net"
 	"regexp"
 	"strings"
@@ -22,7 +23,13 @@ type PolicyAuthorityImpl struct {
 	DB  *PolicyAuthorityDatabaseImpl
 
 	EnforceWhitelist bool
-	PublicSuffixList map[string]bool // A copy of the DNS root zone
+	// Suffixes is the Public Suffix List names must end in.
+	Suffixes *SuffixList
+	// IPBlocklist lists ranges of IP addresses we won't issue for, on top
+	// of the reserved ranges that are never allowed.
+	IPBlocklist []net.IPNet
+	// IDN holds the rules for internationalized names.
+	IDN IDNRules
 }
 
 // NewPolicyAuthorityImpl constructs a Policy Authority.
@@ -39,14 +46,83 @@ func NewPolicyAuthorityImpl(dbMap *gorp.DbMap, enforceWhitelist bool) (*PolicyAu
 		log:              logger,
 		DB:               padb,
 		EnforceWhitelist: enforceWhitelist,
-		PublicSuffixList: PublicSuffixList,
+		Suffixes:         NewSuffixList(EmbeddedSuffixRules()),
 	}
 
 	return &pa, nil
 }
 
+// ParseIPBlocklist parses CIDR ranges for PolicyAuthorityImpl.IPBlocklist.
+func ParseIPBlocklist(cidrs []string) ([]net.IPNet, error) {
+	blocklist := make([]net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		blocklist[i] = *ipNet
+	}
+	return blocklist, nil
+}
+
 const maxLabels = 10
 
+// reservedIPNets are the IANA special-purpose address ranges (RFC 6890 and
+// its updates), none of which are reachable on the public Internet.
+// IPv4-mapped IPv6 addresses aren't listed: net.IPNet treats ::ffff:0:0/96
+// as covering all of IPv4, and they fail the canonical form check anyway.
+var reservedIPNets = mustParseCIDRs(
+	"0.0.0.0/8",       // "This network"
+	"10.0.0.0/8",      // Private use
+	"100.64.0.0/10",   // Shared address space
+	"127.0.0.0/8",     // Loopback
+	"169.254.0.0/16",  // Link local
+	"172.16.0.0/12",   // Private use
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // Documentation (TEST-NET-1)
+	"192.88.99.0/24",  // 6to4 relay anycast
+	"192.168.0.0/16",  // Private use
+	"198.18.0.0/15",   // Benchmarking
+	"198.51.100.0/24", // Documentation (TEST-NET-2)
+	"203.0.113.0/24",  // Documentation (TEST-NET-3)
+	"224.0.0.0/4",     // Multicast
+	"240.0.0.0/4",     // Reserved, and limited broadcast
+	"::/128",          // Unspecified
+	"::1/128",         // Loopback
+	"64:ff9b::/96",    // IPv4-IPv6 translation
+	"100::/64",        // Discard-only
+	"2001::/23",       // IETF protocol assignments
+	"2001:db8::/32",   // Documentation
+	"2002::/16",       // 6to4
+	"fc00::/7",        // Unique local
+	"fe80::/10",       // Link local
+	"ff00::/8",        // Multicast
+)
+
+func mustParseCIDRs(cidrs ...string) []net.IPNet {
+	ipNets, err := ParseIPBlocklist(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return ipNets
+}
+
+// ReservedIPNet returns the reserved range that ip is in, or nil if it is
+// in none of them.
+func ReservedIPNet(ip net.IP) *net.IPNet {
+	return netContaining(ip, reservedIPNets)
+}
+
+// netContaining returns the first of ipNets that contains ip, or nil.
+func netContaining(ip net.IP, ipNets []net.IPNet) *net.IPNet {
+	for i := range ipNets {
+		if ipNets[i].Contains(ip) {
+			return &ipNets[i]
+		}
+	}
+	return nil
+}
+
 var dnsLabelRegexp = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9-]{0,62}$")
 var punycodeRegexp = regexp.MustCompile("^xn--")
 
@@ -57,133 +133,212 @@ func isDNSCharacter(ch byte) bool {
 		ch == '.' || ch == '-'
 }
 
-// Test whether the domain name indicated by the label set is a label-wise
-// suffix match for the provided suffix set.  If the `properSuffix` flag is
-// set, then the name is required to not be in the suffix set (i.e., it must
-// have at least one label beyond any suffix in the set).
-func suffixMatch(labels []string, suffixSet map[string]bool, properSuffix bool) bool {
-	for i := range labels {
-		if domain := strings.Join(labels[i:], "."); suffixSet[domain] {
-			// If we match on the whole domain, gate on properSuffix
-			return !properSuffix || (i > 0)
-		}
-	}
-	return false
-}
+// Each of the errors below may carry a Detail saying which check failed, such
+// as the offending label or the blacklist rule that matched, which is added
+// to its message.
 
 // InvalidIdentifierError indicates that we didn't understand the IdentifierType
 // provided.
-type InvalidIdentifierError struct{}
+type InvalidIdentifierError struct{ Detail string }
 
 // SyntaxError indicates that the user input was not well formatted.
-type SyntaxError struct{}
+type SyntaxError struct{ Detail string }
 
 // NonPublicError indicates that one or more identifiers were not on the public
 // Internet.
-type NonPublicError struct{}
+type NonPublicError struct{ Detail string }
 
 // BlacklistedError indicates we have blacklisted one or more of these identifiers.
-type BlacklistedError struct{}
+type BlacklistedError struct{ Detail string }
 
 // NotWhitelistedError indicates we have not whitelisted one or more of these identifiers.
-type NotWhitelistedError struct{}
+type NotWhitelistedError struct{ Detail string }
+
+func (e InvalidIdentifierError) Error() string { return withDetail("Invalid identifier type", e.Detail) }
+func (e SyntaxError) Error() string            { return withDetail("Syntax error", e.Detail) }
+func (e NonPublicError) Error() string         { return withDetail("Name does not end in a public suffix", e.Detail) }
+func (e BlacklistedError) Error() string       { return withDetail("Name is blacklisted", e.Detail) }
+func (e NotWhitelistedError) Error() string    { return withDetail("Name is not whitelisted", e.Detail) }
 
-func (e InvalidIdentifierError) Error() string { return "Invalid identifier type" }
-func (e SyntaxError) Error() string            { return "Syntax error" }
-func (e NonPublicError) Error() string         { return "Name does not end in a public suffix" }
-func (e BlacklistedError) Error() string       { return "Name is blacklisted" }
-func (e NotWhitelistedError) Error() string    { return "Name is not whitelisted" }
+func withDetail(message, detail string) string {
+	if detail == "" {
+		return message
+	}
+	return message + ": " + detail
+}
 
 // WillingToIssue determines whether the CA is willing to issue for the provided
-// identifier.
+// identifier to the registration regID.
 //
 // We place several criteria on identifiers we are willing to issue for:
 //
 //  * MUST self-identify as DNS identifiers
+//  * MAY start with a "*." wildcard label, in which case the rest of the
+//    name is held to the criteria below
 //  * MUST contain only bytes in the DNS hostname character set
 //  * MUST NOT have more than maxLabels labels
 //  * MUST follow the DNS hostname syntax rules in RFC 1035 and RFC 2181
 //    In particular:
 //    * MUST NOT contain underscores
-//  * MUST NOT contain IDN labels (xn--)
+//  * MAY contain IDN labels (xn--), each of which MUST decode to a U-label
+//    that passes checkALabel
 //  * MUST NOT match the syntax of an IP address
 //  * MUST end in a public suffix
 //  * MUST have at least one label in addition to the public suffix
 //  * MUST NOT be a label-wise suffix match for a name on the black list,
-//    where comparison is case-independent (normalized to lower case)
+//    where comparison is case-independent (normalized to lower case), in
+//    either its ASCII form or, for IDNs, its Unicode form
+//  * MUST match a whitelist rule that applies to regID, if
+//    pa.EnforceWhitelist is true
 //
 // XXX: Is there any need for this method to be constant-time?  We're
 //      going to refuse to issue anyway, but timing could leak whether
 //      names are on the blacklist.
 //
 // XXX: We should probably fold everything to lower-case somehow.
-func (pa PolicyAuthorityImpl) WillingToIssue(id core.AcmeIdentifier) error {
+func (pa PolicyAuthorityImpl) WillingToIssue(id core.AcmeIdentifier, regID int64) error {
+	if id.Type == core.IdentifierIP {
+		return pa.willingToIssueIP(id.Value, regID)
+	}
 	if id.Type != core.IdentifierDNS {
-		return InvalidIdentifierError{}
+		return InvalidIdentifierError{Detail: fmt.Sprintf("type %q isn't supported", id.Type)}
 	}
-	domain := id.Value
+	// A wildcard is held to the rules for the name it stands in for
+	domain, _ := core.WildcardBase(id.Value)
 
 	for _, ch := range []byte(domain) {
 		if !isDNSCharacter(ch) {
-			return SyntaxError{}
+			return SyntaxError{Detail: fmt.Sprintf("%q isn't allowed in DNS names", ch)}
 		}
 	}
 
 	domain = strings.ToLower(domain)
 	if len(domain) > 255 {
-		return SyntaxError{}
+		return SyntaxError{Detail: "name is longer than 255 characters"}
 	}
 
 	if ip := net.ParseIP(domain); ip != nil {
-		return SyntaxError{}
+		return SyntaxError{Detail: "IP addresses must use the IP identifier type"}
 	}
 
 	labels := strings.Split(domain, ".")
-	if len(labels) > maxLabels || len(labels) < 2 {
-		return SyntaxError{}
+	if len(labels) > maxLabels {
+		return SyntaxError{Detail: fmt.Sprintf("name has more than %d labels", maxLabels)}
 	}
-	for _, label := range labels {
+	if len(labels) < 2 {
+		return SyntaxError{Detail: "name has fewer than 2 labels"}
+	}
+	ulabels := make([]string, len(labels))
+	for i, label := range labels {
 		// DNS defines max label length as 63 characters. Some implementations allow
 		// more, but we will be conservative.
 		if len(label) < 1 || len(label) > 63 {
-			return SyntaxError{}
+			return SyntaxError{Detail: fmt.Sprintf("label %q isn't between 1 and 63 characters long", label)}
 		}
 
 		if !dnsLabelRegexp.MatchString(label) {
-			return SyntaxError{}
+			return SyntaxError{Detail: fmt.Sprintf("label %q doesn't start with a letter or digit", label)}
 		}
 
+		ulabels[i] = label
 		if punycodeRegexp.MatchString(label) {
-			return SyntaxError{}
+			ulabel, err := pa.IDN.checkALabel(label)
+			if err != nil {
+				return err
+			}
+			ulabels[i] = ulabel
 		}
 	}
 
 	// Require match to PSL, plus at least one label
-	if !suffixMatch(labels, pa.PublicSuffixList, true) {
+	if n, ok := pa.Suffixes.Rules().suffixLabels(labels); !ok {
 		return NonPublicError{}
+	} else if n >= len(labels) {
+		return NonPublicError{Detail: fmt.Sprintf("%s is itself a public suffix", domain)}
 	}
 
 	// Require no match against blacklist (and if pa.EnforceWhitelist is true
 	// require domain to match a whitelist rule)
-	if err := pa.DB.CheckHostLists(domain, pa.EnforceWhitelist); err != nil {
+	if err := pa.DB.CheckHostLists(domain, pa.EnforceWhitelist, regID); err != nil {
 		return err
 	}
+	// Blacklist rules may be written with either form of an IDN
+	if udomain := strings.Join(ulabels, "."); udomain != domain {
+		if err := pa.DB.CheckHostLists(udomain, false, regID); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// ReviewRuleFor returns the pattern of a review rule that id matches, or ""
+// if it can be issued for without manual review. Internationalized names are
+// also matched in Unicode form and with lookalike characters replaced by the
+// ASCII characters they imitate, so that a rule for "paypal" catches
+// "pаypal" written with a Cyrillic "а".
+func (pa PolicyAuthorityImpl) ReviewRuleFor(id core.AcmeIdentifier) (string, error) {
+	if id.Type != core.IdentifierDNS {
+		return "", nil
+	}
+	domain := strings.ToLower(id.Value)
+	names := []string{domain}
+	if udomain, ok := unicodeName(domain); ok {
+		names = append(names, udomain, skeleton(udomain))
+	}
+
+	return pa.DB.ReviewRuleFor(names)
+}
+
+// willingToIssueIP determines whether the CA is willing to issue for an IP
+// address identifier. The address:
+//
+//  * MUST be written the way net.IP.String() writes it, so that each address
+//    has exactly one identifier
+//  * MUST NOT be in a reserved range
+//  * MUST NOT be in a range on the IP blocklist
+//  * MUST match a whitelist rule that applies to regID, if
+//    pa.EnforceWhitelist is true
+func (pa PolicyAuthorityImpl) willingToIssueIP(value string, regID int64) error {
+	ip := net.ParseIP(value)
+	if ip == nil || ip.String() != value {
+		return SyntaxError{Detail: "value isn't an IP address in canonical form"}
+	}
+	if ipNet := netContaining(ip, reservedIPNets); ipNet != nil {
+		return NonPublicError{Detail: fmt.Sprintf("address is in the reserved range %s", ipNet)}
+	}
+	if ipNet := netContaining(ip, pa.IPBlocklist); ipNet != nil {
+		return BlacklistedError{Detail: fmt.Sprintf("address is in the blocked range %s", ipNet)}
+	}
+	if pa.EnforceWhitelist {
+		return pa.DB.checkWhitelist(value, regID)
+	}
+	return nil
+}
+
 // ChallengesFor makes a decision of what challenges, and combinations, are
 // acceptable for the given identifier.
 //
 // Note: Current implementation is static, but future versions may not be.
+// The HTTP and TLS based challenges work for IP address identifiers as well
+// as DNS names. DNS names are also offered the DNS challenge, which is the
+// only one that can authorize wildcard certificates.
 func (pa PolicyAuthorityImpl) ChallengesFor(identifier core.AcmeIdentifier) (challenges []core.Challenge, combinations [][]int) {
 	challenges = []core.Challenge{
 		core.SimpleHTTPChallenge(),
 		core.DvsniChallenge(),
+		core.HTTPChallenge01(),
+		core.TLSSNIChallenge01(),
 	}
 	combinations = [][]int{
 		[]int{0},
 		[]int{1},
+		[]int{2},
+		[]int{3},
+	}
+	if identifier.Type == core.IdentifierDNS {
+		challenges = append(challenges, core.DNSChallenge())
+		combinations = append(combinations, []int{4})
 	}
 	return
 }
@@ -6,20 +6,23 @@
 package policy
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/sa/satest"
 	"github.com/letsencrypt/boulder/test"
 )
 
 var log = mocks.UseMockLog()
-var dbConnStr = "mysql+tcp://boulder@localhost:3306/boulder_policy_test"
+var dbConnStr = test.DBConnect("mysql+tcp://boulder@localhost:3306/boulder_policy_test")
 
 func paImpl(t *testing.T) (*PolicyAuthorityImpl, func()) {
 	dbMap, err := sa.NewDbMap(dbConnStr)
 	test.AssertNotError(t, err, "Could not construct dbMap")
+	satest.MigrateSQLite(t, dbMap, "policy")
 
 	pa, err := NewPolicyAuthorityImpl(dbMap, false)
 	test.AssertNotError(t, err, "Couldn't create PADB")
@@ -47,9 +50,9 @@ func TestWillingToIssue(t *testing.T) {
 
 		`www.abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz.com`, // Label too long (>63 characters)
 
-		`www.-ombo.com`,   // Label starts with '-'
-		`www.xn--hmr.net`, // Punycode (disallowed for now)
-		`xn--.net`,        // No punycode for now.
+		`www.-ombo.com`,    // Label starts with '-'
+		`xn--.net`,         // Empty U-label
+		`www.xn--abc-.net`, // ASCII-only U-label
 		`0`,
 		`1`,
 		`*`,
@@ -57,7 +60,9 @@ func TestWillingToIssue(t *testing.T) {
 		`*.*`,
 		`zombo*com`,
 		`*.com`,
-		`*.zombo.com`,
+		`*.*.zombo.com`,
+		`www.*.zombo.com`,
+		`*zombo.com`,
 		`.`,
 		`..`,
 		`a..`,
@@ -81,6 +86,7 @@ func TestWillingToIssue(t *testing.T) {
 
 	shouldBeNonPublic := []string{
 		`co.uk`,
+		`*.co.uk`,
 		`example.acting`,
 		`example.internal`,
 		// All-numeric final label not okay.
@@ -93,6 +99,16 @@ func TestWillingToIssue(t *testing.T) {
 		`www.google.com`,
 		`lots.of.labels.pornhub.com`,
 	}
+	shouldBeBlacklistedWildcard := []string{
+		`*.ebay.co.uk`,
+		`*.www.google.com`,
+		`*.xn--bcher-kva.com`,
+	}
+	// Blacklisted in their Unicode form
+	shouldBeBlacklistedIDN := map[string]string{
+		`xn--bcher-kva.com`:    `bücher.com`,
+		`www.xn--e1afmkfd.com`: `пример.com`,
+	}
 
 	shouldBeAccepted := []string{
 		"www.zombo.com",
@@ -103,6 +119,10 @@ func TestWillingToIssue(t *testing.T) {
 		"zombo-.com",
 		"www.zom-bo.com",
 		"www.zombo-.com",
+		"*.zombo.com",
+		"*.www.zombo.com",
+		"www.xn--hmr.net",
+		"xn--bcher-kva.de",
 	}
 
 	pa, cleanup := paImpl(t)
@@ -112,12 +132,15 @@ func TestWillingToIssue(t *testing.T) {
 	for _, b := range shouldBeBlacklisted {
 		rules.Blacklist = append(rules.Blacklist, BlacklistRule{Host: b})
 	}
+	for _, b := range shouldBeBlacklistedIDN {
+		rules.Blacklist = append(rules.Blacklist, BlacklistRule{Host: b})
+	}
 	err := pa.DB.LoadRules(rules)
 	test.AssertNotError(t, err, "Couldn't load rules")
 
 	// Test for invalid identifier type
-	identifier := core.AcmeIdentifier{Type: "ip", Value: "example.com"}
-	err = pa.WillingToIssue(identifier)
+	identifier := core.AcmeIdentifier{Type: "email", Value: "example.com"}
+	err = pa.WillingToIssue(identifier, 0)
 	_, ok := err.(InvalidIdentifierError)
 	if !ok {
 		t.Error("Identifier was not correctly forbidden: ", identifier)
@@ -126,7 +149,7 @@ func TestWillingToIssue(t *testing.T) {
 	// Test syntax errors
 	for _, domain := range shouldBeSyntaxError {
 		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
-		err := pa.WillingToIssue(identifier)
+		err := pa.WillingToIssue(identifier, 0)
 		_, ok := err.(SyntaxError)
 		if !ok {
 			t.Error("Identifier was not correctly forbidden: ", identifier, err)
@@ -136,7 +159,7 @@ func TestWillingToIssue(t *testing.T) {
 	// Test public suffix matching
 	for _, domain := range shouldBeNonPublic {
 		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
-		err := pa.WillingToIssue(identifier)
+		err := pa.WillingToIssue(identifier, 0)
 		_, ok := err.(NonPublicError)
 		if !ok {
 			t.Error("Identifier was not correctly forbidden: ", identifier, err)
@@ -144,9 +167,18 @@ func TestWillingToIssue(t *testing.T) {
 	}
 
 	// Test blacklisting
-	for _, domain := range shouldBeBlacklisted {
+	for _, domain := range append(shouldBeBlacklisted, shouldBeBlacklistedWildcard...) {
+		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
+		err := pa.WillingToIssue(identifier, 0)
+		_, ok := err.(BlacklistedError)
+		if !ok {
+			t.Error("Identifier was not correctly forbidden: ", identifier, err)
+		}
+	}
+
+	for domain := range shouldBeBlacklistedIDN {
 		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
-		err := pa.WillingToIssue(identifier)
+		err := pa.WillingToIssue(identifier, 0)
 		_, ok := err.(BlacklistedError)
 		if !ok {
 			t.Error("Identifier was not correctly forbidden: ", identifier, err)
@@ -156,23 +188,78 @@ func TestWillingToIssue(t *testing.T) {
 	// Test acceptance of good names
 	for _, domain := range shouldBeAccepted {
 		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
-		if err := pa.WillingToIssue(identifier); err != nil {
+		if err := pa.WillingToIssue(identifier, 0); err != nil {
 			t.Error("Identifier was incorrectly forbidden: ", identifier, err)
 		}
 	}
 }
 
+func TestWillingToIssueIP(t *testing.T) {
+	blocklist, err := ParseIPBlocklist([]string{"8.8.8.0/24", "2620:0:ccc::/48"})
+	test.AssertNotError(t, err, "Couldn't parse blocklist")
+	_, err = ParseIPBlocklist([]string{"8.8.8.8"})
+	test.AssertError(t, err, "Parsed an address without a prefix length")
+
+	// IP identifiers don't touch the database unless the whitelist is enforced
+	pa := PolicyAuthorityImpl{IPBlocklist: blocklist}
+
+	testCases := []struct {
+		ip  string
+		err error
+	}{
+		{"1.2.3.4", nil},
+		{"2606:4700::6810:85e5", nil},
+		{"example.com", SyntaxError{}},
+		{"01.2.3.4", SyntaxError{}},
+		{"1.2.3.4/32", SyntaxError{}},
+		{"[2606:4700::6810:85e5]", SyntaxError{}},
+		{"2606:4700:0:0::6810:85e5", SyntaxError{}}, // Not in canonical form
+		{"::ffff:1.2.3.4", SyntaxError{}},
+		{"2606:4700::6810:85E5", SyntaxError{}},
+		{"10.1.2.3", NonPublicError{}},
+		{"127.0.0.1", NonPublicError{}},
+		{"169.254.169.254", NonPublicError{}},
+		{"100.64.0.1", NonPublicError{}},
+		{"192.0.2.1", NonPublicError{}},
+		{"224.0.0.1", NonPublicError{}},
+		{"255.255.255.255", NonPublicError{}},
+		{"0.0.0.0", NonPublicError{}},
+		{"::1", NonPublicError{}},
+		{"::", NonPublicError{}},
+		{"fe80::1", NonPublicError{}},
+		{"fd00::1", NonPublicError{}},
+		{"2001:db8::1", NonPublicError{}},
+		{"ff02::1", NonPublicError{}},
+		{"8.8.8.8", BlacklistedError{}},
+		{"2620:0:ccc::2", BlacklistedError{}},
+	}
+	for _, tc := range testCases {
+		err := pa.WillingToIssue(core.AcmeIdentifier{Type: core.IdentifierIP, Value: tc.ip}, 0)
+		if reflect.TypeOf(err) != reflect.TypeOf(tc.err) {
+			t.Errorf("WillingToIssue(%q) = %v, expected %v", tc.ip, err, tc.err)
+		}
+	}
+}
+
 func TestChallengesFor(t *testing.T) {
 	pa, cleanup := paImpl(t)
 	defer cleanup()
 
-	challenges, combinations := pa.ChallengesFor(core.AcmeIdentifier{})
+	challenges, combinations := pa.ChallengesFor(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"})
 
-	if len(challenges) != 2 || challenges[0].Type != core.ChallengeTypeSimpleHTTP ||
-		challenges[1].Type != core.ChallengeTypeDVSNI {
+	if len(challenges) != 5 || challenges[0].Type != core.ChallengeTypeSimpleHTTP ||
+		challenges[1].Type != core.ChallengeTypeDVSNI || challenges[2].Type != core.ChallengeTypeHTTP01 ||
+		challenges[3].Type != core.ChallengeTypeTLSSNI01 || challenges[4].Type != core.ChallengeTypeDNS {
 		t.Error("Incorrect challenges returned")
 	}
-	if len(combinations) != 2 || combinations[0][0] != 0 || combinations[1][0] != 1 {
+	if len(combinations) != 5 || combinations[0][0] != 0 || combinations[1][0] != 1 ||
+		combinations[2][0] != 2 || combinations[3][0] != 3 || combinations[4][0] != 4 {
 		t.Error("Incorrect combinations returned")
 	}
+
+	// IP addresses have no DNS zone to put a record in
+	challenges, combinations = pa.ChallengesFor(core.AcmeIdentifier{Type: core.IdentifierIP, Value: "1.2.3.4"})
+	if len(challenges) != 4 || len(combinations) != 4 {
+		t.Error("Incorrect challenges returned for an IP address")
+	}
 }
@@ -0,0 +1,277 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/net/idna"
+
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// SuffixRules is a parsed Public Suffix List. Rule names are stored in ASCII
+// (A-label) form, since that is how WillingToIssue sees domains.
+type SuffixRules struct {
+	// Each map holds rule names without their "*." or "!" prefix
+	plain      map[string]bool
+	wildcards  map[string]bool
+	exceptions map[string]bool
+	// private holds the rules from the private domains section, written
+	// the way Rules() writes them
+	private map[string]bool
+}
+
+func newSuffixRules() *SuffixRules {
+	return &SuffixRules{
+		plain:      map[string]bool{},
+		wildcards:  map[string]bool{},
+		exceptions: map[string]bool{},
+		private:    map[string]bool{},
+	}
+}
+
+// EmbeddedSuffixRules returns the Public Suffix List compiled into Boulder,
+// for use when no list file is configured or it can't be loaded. It was
+// generated without wildcard and exception rules, treating each "*.name"
+// rule as "name".
+func EmbeddedSuffixRules() *SuffixRules {
+	rules := newSuffixRules()
+	for name := range PublicSuffixList {
+		rules.plain[name] = true
+	}
+	return rules
+}
+
+const (
+	beginPrivateSection = "===BEGIN PRIVATE DOMAINS==="
+	endPrivateSection   = "===END PRIVATE DOMAINS==="
+)
+
+// ParseSuffixList reads rules in the public_suffix_list.dat format published
+// at https://publicsuffix.org/list/. Rules in the private domains section,
+// which are suffixes run by companies such as hosting providers rather than
+// registries, are only kept if includePrivate is true.
+func ParseSuffixList(r io.Reader, includePrivate bool) (*SuffixRules, error) {
+	rules := newSuffixRules()
+	private := false
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.Contains(line, beginPrivateSection):
+			private = true
+			continue
+		case strings.Contains(line, endPrivateSection):
+			private = false
+			continue
+		case line == "" || strings.HasPrefix(line, "//"):
+			continue
+		case private && !includePrivate:
+			continue
+		}
+		// Each rule is the first word of its line
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			line = line[:i]
+		}
+		if err := rules.add(line, private); err != nil {
+			return nil, fmt.Errorf("Line %d: %s", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(rules.plain) == 0 {
+		return nil, errors.New("Public suffix list has no rules")
+	}
+	return rules, nil
+}
+
+func (rules *SuffixRules) add(rule string, private bool) error {
+	prefix, set := "", rules.plain
+	switch {
+	case strings.HasPrefix(rule, "!"):
+		prefix, set = "!", rules.exceptions
+		if !strings.Contains(rule, ".") {
+			return fmt.Errorf("Exception rule %q must have at least two labels", rule)
+		}
+	case strings.HasPrefix(rule, "*."):
+		prefix, set = "*.", rules.wildcards
+	}
+	name := rule[len(prefix):]
+
+	labels := strings.Split(strings.ToLower(name), ".")
+	for i, label := range labels {
+		if label == "" || strings.ContainsAny(label, "*!") {
+			return fmt.Errorf("Invalid rule %q", rule)
+		}
+		if !isASCII(label) {
+			alabel, err := idna.Punycode.ToASCII(label)
+			if err != nil {
+				return fmt.Errorf("Invalid rule %q", rule)
+			}
+			labels[i] = alabel
+		}
+		for j := 0; j < len(labels[i]); j++ {
+			if !isDNSCharacter(labels[i][j]) || labels[i][j] == '.' {
+				return fmt.Errorf("Invalid rule %q", rule)
+			}
+		}
+	}
+	name = strings.Join(labels, ".")
+	set[name] = true
+	if private {
+		rules.private[prefix+name] = true
+	}
+	return nil
+}
+
+// suffixLabels returns the number of labels at the end of a domain that
+// make up its public suffix, following the algorithm at
+// https://publicsuffix.org/list/, and whether any rule matched. Unlike that
+// algorithm there is no implicit "*" rule, so names under TLDs missing from
+// the list don't match.
+func (rules *SuffixRules) suffixLabels(labels []string) (int, bool) {
+	for i := range labels {
+		if rules.exceptions[strings.Join(labels[i:], ".")] {
+			return len(labels) - i - 1, true
+		}
+	}
+	longest := 0
+	for i := range labels {
+		name := strings.Join(labels[i:], ".")
+		n := len(labels) - i
+		if rules.plain[name] && n > longest {
+			longest = n
+		}
+		if i > 0 && rules.wildcards[name] && n+1 > longest {
+			longest = n + 1
+		}
+	}
+	return longest, longest > 0
+}
+
+// PublicSuffix returns the public suffix domain ends in, and whether it
+// ends in one at all.
+func (rules *SuffixRules) PublicSuffix(domain string) (string, bool) {
+	labels := strings.Split(strings.ToLower(domain), ".")
+	n, ok := rules.suffixLabels(labels)
+	if !ok {
+		return "", false
+	}
+	if n > len(labels) {
+		n = len(labels)
+	}
+	return strings.Join(labels[len(labels)-n:], "."), true
+}
+
+// Rules returns every rule in the list, sorted and written the way the
+// public_suffix_list.dat format writes them, except that names are in ASCII
+// form.
+func (rules *SuffixRules) Rules() []string {
+	var list []string
+	for name := range rules.plain {
+		list = append(list, name)
+	}
+	for name := range rules.wildcards {
+		list = append(list, "*."+name)
+	}
+	for name := range rules.exceptions {
+		list = append(list, "!"+name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// IsPrivate reports whether rule, written the way Rules() writes it, came
+// from the private domains section.
+func (rules *SuffixRules) IsPrivate(rule string) bool {
+	return rules.private[rule]
+}
+
+// DiffSuffixRules lists the rules that are only in newRules, and only in
+// oldRules.
+func DiffSuffixRules(oldRules, newRules *SuffixRules) (added, removed []string) {
+	oldList, newList := oldRules.Rules(), newRules.Rules()
+	for len(oldList) > 0 || len(newList) > 0 {
+		switch {
+		case len(oldList) == 0 || (len(newList) > 0 && newList[0] < oldList[0]):
+			added = append(added, newList[0])
+			newList = newList[1:]
+		case len(newList) == 0 || oldList[0] < newList[0]:
+			removed = append(removed, oldList[0])
+			oldList = oldList[1:]
+		default:
+			oldList, newList = oldList[1:], newList[1:]
+		}
+	}
+	return
+}
+
+// SuffixList holds the Public Suffix List used by the PA and lets it be
+// replaced while it is in use.
+type SuffixList struct {
+	mu    sync.RWMutex
+	rules *SuffixRules
+}
+
+// NewSuffixList makes a SuffixList starting out with rules.
+func NewSuffixList(rules *SuffixRules) *SuffixList {
+	return &SuffixList{rules: rules}
+}
+
+// Rules returns the rules currently in use.
+func (l *SuffixList) Rules() *SuffixRules {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.rules
+}
+
+// Replace starts using rules in place of the current ones.
+func (l *SuffixList) Replace(rules *SuffixRules) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = rules
+}
+
+// LoadSuffixListFile parses a public_suffix_list.dat file.
+func LoadSuffixListFile(path string, includePrivate bool) (*SuffixRules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseSuffixList(file, includePrivate)
+}
+
+// ReloadOnSignal starts loading the list from path again each time the
+// process receives sig. A file that can't be loaded is logged and leaves the
+// current rules in place.
+func (l *SuffixList) ReloadOnSignal(sig os.Signal, path string, includePrivate bool) {
+	logger := blog.GetAuditLogger()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, sig)
+	go func() {
+		for range sigChan {
+			rules, err := LoadSuffixListFile(path, includePrivate)
+			if err != nil {
+				logger.Err(fmt.Sprintf("Couldn't reload public suffix list from %s, keeping the current one: %s", path, err))
+				continue
+			}
+			added, removed := DiffSuffixRules(l.Rules(), rules)
+			l.Replace(rules)
+			logger.Audit(fmt.Sprintf("Reloaded public suffix list from %s: %d rules added, %d removed", path, len(added), len(removed)))
+		}
+	}()
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+const testSuffixList = `// This Source Code Form is subject to the terms of the Mozilla Public
+// ===BEGIN ICANN DOMAINS===
+
+com
+uk
+co.uk
+
+// ck : https://en.wikipedia.org/wiki/.ck
+*.ck
+!www.ck
+
+// cn : https://en.wikipedia.org/wiki/.cn
+cn
+公司.cn
+
+// ===END ICANN DOMAINS===
+// ===BEGIN PRIVATE DOMAINS===
+
+// GitHub, Inc.
+github.io  Anything after the first space is ignored
+
+// ===END PRIVATE DOMAINS===
+`
+
+func TestParseSuffixList(t *testing.T) {
+	rules, err := ParseSuffixList(strings.NewReader(testSuffixList), true)
+	test.AssertNotError(t, err, "Couldn't parse suffix list")
+	test.AssertEquals(t, strings.Join(rules.Rules(), " "), "!www.ck *.ck cn co.uk com github.io uk xn--55qx5d.cn")
+	test.Assert(t, rules.IsPrivate("github.io"), "github.io should be private")
+	test.Assert(t, !rules.IsPrivate("com"), "com shouldn't be private")
+
+	rules, err = ParseSuffixList(strings.NewReader(testSuffixList), false)
+	test.AssertNotError(t, err, "Couldn't parse suffix list")
+	test.AssertEquals(t, strings.Join(rules.Rules(), " "), "!www.ck *.ck cn co.uk com uk xn--55qx5d.cn")
+
+	for _, bad := range []string{"", "// Only a comment", "com\n*.*.com", "com\n!com", "com\nexample..com", "com\nex_ample.com"} {
+		_, err = ParseSuffixList(strings.NewReader(bad), true)
+		test.AssertError(t, err, bad)
+	}
+}
+
+func TestSuffixLabels(t *testing.T) {
+	rules, err := ParseSuffixList(strings.NewReader(testSuffixList), true)
+	test.AssertNotError(t, err, "Couldn't parse suffix list")
+
+	testCases := []struct {
+		domain string
+		labels int
+		match  bool
+	}{
+		{"example.com", 1, true},
+		{"www.example.co.uk", 2, true},
+		{"co.uk", 2, true},
+		{"example.ck", 2, true},
+		{"www.example.ck", 2, true},
+		{"www.ck", 1, true},
+		{"example.xn--55qx5d.cn", 2, true},
+		{"example.github.io", 2, true},
+		{"example.test", 0, false},
+	}
+	for _, tc := range testCases {
+		labels, match := rules.suffixLabels(strings.Split(tc.domain, "."))
+		if labels != tc.labels || match != tc.match {
+			t.Errorf("suffixLabels(%q) = %d, %t, expected %d, %t", tc.domain, labels, match, tc.labels, tc.match)
+		}
+	}
+}
+
+func TestDiffSuffixRules(t *testing.T) {
+	oldRules, err := ParseSuffixList(strings.NewReader("com\nnet\norg\n"), true)
+	test.AssertNotError(t, err, "Couldn't parse suffix list")
+	newRules, err := ParseSuffixList(strings.NewReader("app\ncom\nzone\nnet\n"), true)
+	test.AssertNotError(t, err, "Couldn't parse suffix list")
+
+	added, removed := DiffSuffixRules(oldRules, newRules)
+	test.AssertEquals(t, strings.Join(added, " "), "app zone")
+	test.AssertEquals(t, strings.Join(removed, " "), "org")
+}
+
+func TestSuffixListReload(t *testing.T) {
+	file, err := ioutil.TempFile("", "public_suffix_list.dat")
+	test.AssertNotError(t, err, "Couldn't create suffix list file")
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("com\n")
+	test.AssertNotError(t, err, "Couldn't write suffix list file")
+	file.Close()
+
+	rules, err := LoadSuffixListFile(file.Name(), true)
+	test.AssertNotError(t, err, "Couldn't load suffix list file")
+	pa := PolicyAuthorityImpl{Suffixes: NewSuffixList(rules)}
+	id := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.dev"}
+	_, ok := pa.WillingToIssue(id, 0).(NonPublicError)
+	test.Assert(t, ok, "Issued for a suffix that isn't in the list")
+
+	pa.Suffixes.ReloadOnSignal(syscall.SIGUSR1, file.Name(), true)
+	err = ioutil.WriteFile(file.Name(), []byte("com\ndev\n"), 0644)
+	test.AssertNotError(t, err, "Couldn't update suffix list file")
+	test.AssertNotError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1), "Couldn't send signal")
+
+	for i := 0; i < 100 && len(pa.Suffixes.Rules().Rules()) != 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.AssertEquals(t, strings.Join(pa.Suffixes.Rules().Rules(), " "), "com dev")
+}
@@ -9,7 +9,9 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
 	"net/mail"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -32,8 +34,29 @@ type RegistrationAuthorityImpl struct {
 	clk         clock.Clock
 	log         *blog.AuditLogger
 
-	AuthzBase  string
-	MaxKeySize int
+	AuthzBase    string
+	RegBase      string
+	MaxKeySize   int
+	KeyBlocklist *core.KeyBlocklist
+	// Profiles controls which registrations may request each certificate
+	// profile, keyed by profile name.
+	Profiles map[string]ProfileAccess
+	// CAARecheckWindow is how long after validation an authorization can be
+	// used without checking CAA again. Zero disables the re-check.
+	CAARecheckWindow time.Duration
+}
+
+// ProfileAccess controls which registrations may request a certificate
+// profile.
+type ProfileAccess struct {
+	// AllowAll makes the profile available to every registration.
+	AllowAll bool
+	// Registrations lists the IDs of the registrations that may request the
+	// profile when AllowAll is false.
+	Registrations []int64
+	// DefaultFor lists the IDs of registrations that are issued certificates
+	// under this profile when a request doesn't name one.
+	DefaultFor []int64
 }
 
 // NewRegistrationAuthorityImpl constructs a new RA object.
@@ -87,6 +110,8 @@ type certificateRequestEvent struct {
 	VerifiedFields      []string  `json:",omitempty"`
 	CommonName          string    `json:",omitempty"`
 	Names               []string  `json:",omitempty"`
+	IPAddresses         []net.IP  `json:",omitempty"`
+	Profile             string    `json:",omitempty"`
 	NotBefore           time.Time `json:",omitempty"`
 	NotAfter            time.Time `json:",omitempty"`
 	RequestTime         time.Time `json:",omitempty"`
@@ -94,11 +119,55 @@ type certificateRequestEvent struct {
 	Error               string    `json:",omitempty"`
 }
 
+// certificateProfile determines the certificate profile to request from the
+// CA. A profile named in the request must be one the registration is allowed
+// to use. Otherwise, the registration's default profile is used if it has
+// one, and the CA's default profile if not, which is indicated by returning
+// the empty string.
+func (ra *RegistrationAuthorityImpl) certificateProfile(requested string, regID int64) (string, error) {
+	if requested == "" {
+		// Iterate in a fixed order so the choice is stable if a registration
+		// is mistakenly listed as the default for more than one profile.
+		names := make([]string, 0, len(ra.Profiles))
+		for name := range ra.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if containsRegID(ra.Profiles[name].DefaultFor, regID) {
+				return name, nil
+			}
+		}
+		return "", nil
+	}
+
+	access, ok := ra.Profiles[requested]
+	if !ok {
+		return "", core.MalformedRequestError(fmt.Sprintf("Unknown certificate profile %s", requested))
+	}
+	if !access.AllowAll && !containsRegID(access.Registrations, regID) && !containsRegID(access.DefaultFor, regID) {
+		return "", core.UnauthorizedError(fmt.Sprintf("Registration is not allowed to use certificate profile %s", requested))
+	}
+	return requested, nil
+}
+
+func containsRegID(ids []int64, regID int64) bool {
+	for _, id := range ids {
+		if id == regID {
+			return true
+		}
+	}
+	return false
+}
+
 // NewRegistration constructs a new Registration from a request.
 func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (reg core.Registration, err error) {
 	if err = core.GoodKey(init.Key.Key, ra.MaxKeySize); err != nil {
 		return core.Registration{}, core.MalformedRequestError(fmt.Sprintf("Invalid public key: %s", err.Error()))
 	}
+	if err = core.CheckKeyBlocked(init.Key.Key, ra.KeyBlocklist, ra.SA); err != nil {
+		return core.Registration{}, err
+	}
 	reg = core.Registration{
 		Key: init.Key,
 	}
@@ -122,7 +191,8 @@ func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (re
 
 // NewAuthorization constuct a new Authz from a request.
 func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization, regID int64) (authz core.Authorization, err error) {
-	reg, err := ra.SA.GetRegistration(regID)
+	// Clients ask for authorizations right after registering
+	reg, err := core.ReadYourWrites(ra.SA).GetRegistration(regID)
 	if err != nil {
 		err = core.MalformedRequestError(fmt.Sprintf("Invalid registration ID: %d", regID))
 		return authz, err
@@ -131,13 +201,21 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 	identifier := request.Identifier
 
 	// Check that the identifier is present and appropriate
-	if err = ra.PA.WillingToIssue(identifier); err != nil {
+	if err = ra.PA.WillingToIssue(identifier, regID); err != nil {
 		err = core.UnauthorizedError(err.Error())
 		return authz, err
 	}
 
+	// Wildcard names are covered by an authorization for the base domain
+	if base, wildcard := core.WildcardBase(identifier.Value); wildcard {
+		err = core.MalformedRequestError(fmt.Sprintf("Authorize %s with the %s challenge to issue for %s", base, core.ChallengeTypeDNS, identifier.Value))
+		return authz, err
+	}
+
 	// Check CAA records for the requested identifier
-	present, valid, err := ra.VA.CheckCAARecords(identifier)
+	// The validation method isn't known yet, so method restrictions are
+	// checked once a challenge has been validated
+	present, valid, err := ra.VA.CheckCAARecords(identifier, ra.accountURI(regID), "")
 	if err != nil {
 		return authz, err
 	}
@@ -148,6 +226,17 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 		return authz, err
 	}
 
+	// High-risk names are held until an administrator reviews them
+	status := core.StatusPending
+	reviewRule, err := ra.PA.ReviewRuleFor(identifier)
+	if err != nil {
+		err = core.InternalServerError(fmt.Sprintf("Couldn't check review rules: %s", err))
+		return authz, err
+	}
+	if reviewRule != "" {
+		status = core.StatusNeedsReview
+	}
+
 	// Create validations, but we have to update them with URIs later
 	challenges, combinations := ra.PA.ChallengesFor(identifier)
 
@@ -155,7 +244,7 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 	authz = core.Authorization{
 		Identifier:     identifier,
 		RegistrationID: regID,
-		Status:         core.StatusPending,
+		Status:         status,
 		Combinations:   combinations,
 		Challenges:     challenges,
 	}
@@ -192,6 +281,11 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 		// InternalServerError because we created the authorization just above,
 		// and adding Sane challenges should not break it.
 		err = core.InternalServerError(err.Error())
+		return authz, err
+	}
+	if reviewRule != "" {
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ra.log.Audit(fmt.Sprintf("Holding authorization %s for %s, registration ID %d, for review [Matched rule: %q]", authz.ID, identifier.Value, regID, reviewRule))
 	}
 	return authz, err
 }
@@ -239,20 +333,23 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 
 	logEvent.CommonName = csr.Subject.CommonName
 	logEvent.Names = csr.DNSNames
+	logEvent.IPAddresses = csr.IPAddresses
 
-	// Validate that authorization key is authorized for all domains
-	names := make([]string, len(csr.DNSNames))
-	copy(names, csr.DNSNames)
-	if len(csr.Subject.CommonName) > 0 {
-		names = append(names, csr.Subject.CommonName)
-	}
+	// Validate that authorization key is authorized for all domains and IP
+	// addresses
+	hostNames, ipAddresses := core.SubjectNames(csr.Subject.CommonName, csr.DNSNames, csr.IPAddresses)
+	identifiers := core.NameIdentifiers(hostNames, ipAddresses)
 
-	if len(names) == 0 {
+	if len(identifiers) == 0 {
 		err = core.UnauthorizedError("CSR has no names in it")
 		logEvent.Error = err.Error()
 		return emptyCert, err
 	}
 
+	names := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		names[i] = identifier.Value
+	}
 	csrPreviousDenied, err := ra.SA.AlreadyDeniedCSR(names)
 	if err != nil {
 		logEvent.Error = err.Error()
@@ -270,13 +367,22 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	}
 
 	// Check that each requested name has a valid authorization
+	// Clients request certificates as soon as their authorizations become
+	// valid, so they're looked up on the primary
+	sa := core.ReadYourWrites(ra.SA)
 	now := ra.clk.Now()
 	earliestExpiry := time.Date(2100, 01, 01, 0, 0, 0, 0, time.UTC)
-	for _, name := range names {
-		authz, err := ra.SA.GetLatestValidAuthorization(registration.ID, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name})
+	for _, identifier := range identifiers {
+		// A wildcard name is authorized by the domain it is a wildcard for
+		authzIdentifier := identifier
+		var wildcard bool
+		if identifier.Type == core.IdentifierDNS {
+			authzIdentifier.Value, wildcard = core.WildcardBase(identifier.Value)
+		}
+		authz, err := sa.GetLatestValidAuthorization(registration.ID, authzIdentifier)
 		if err != nil || authz.Expires.Before(now) {
 			// unable to find a valid authorization or authz is expired
-			err = core.UnauthorizedError(fmt.Sprintf("Key not authorized for name %s", name))
+			err = core.UnauthorizedError(fmt.Sprintf("Key not authorized for name %s", identifier.Value))
 			logEvent.Error = err.Error()
 			return emptyCert, err
 		}
@@ -284,13 +390,37 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 		if authz.Expires.Before(earliestExpiry) {
 			earliestExpiry = *authz.Expires
 		}
+
+		if wildcard {
+			if err = ra.checkWildcard(identifier, authz); err != nil {
+				logEvent.Error = err.Error()
+				return emptyCert, err
+			}
+		}
+
+		if err = ra.recheckCAA(authz, now); err != nil {
+			logEvent.Error = err.Error()
+			return emptyCert, err
+		}
+
+		if err = ra.checkReviewed(identifier, authz); err != nil {
+			logEvent.Error = err.Error()
+			return emptyCert, err
+		}
 	}
 
 	// Mark that we verified the CN and SANs
 	logEvent.VerifiedFields = []string{"subject.commonName", "subjectAltName"}
 
+	profile, err := ra.certificateProfile(req.Profile, regID)
+	if err != nil {
+		logEvent.Error = err.Error()
+		return emptyCert, err
+	}
+	logEvent.Profile = profile
+
 	// Create the certificate and log the result
-	if cert, err = ra.CA.IssueCertificate(*csr, regID, earliestExpiry); err != nil {
+	if cert, err = ra.CA.IssueCertificate(*csr, regID, earliestExpiry, profile); err != nil {
 		// While this could be InternalServerError for certain conditions, most
 		// of the failure reasons (such as GoodKey failing) are caused by malformed
 		// requests.
@@ -324,6 +454,111 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	return cert, nil
 }
 
+// accountURI returns the ACME URI of a registration, as matched against the
+// "accounturi" CAA parameter.
+func (ra *RegistrationAuthorityImpl) accountURI(regID int64) string {
+	return fmt.Sprintf("%s%d", ra.RegBase, regID)
+}
+
+// checkReviewed refuses to issue for a name that matches a review rule unless
+// authz was approved by an administrator. Authorizations that were valid
+// before the rule was added, or never held, would otherwise let the name be
+// issued for without review.
+func (ra *RegistrationAuthorityImpl) checkReviewed(name core.AcmeIdentifier, authz core.Authorization) error {
+	reviewRule, err := ra.PA.ReviewRuleFor(name)
+	if err != nil {
+		return core.InternalServerError(fmt.Sprintf("Couldn't check review rules: %s", err))
+	}
+	if reviewRule == "" || authz.ReviewedBy != "" {
+		return nil
+	}
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	ra.log.Audit(fmt.Sprintf("Refusing to issue for %s, registration ID %d, with unreviewed authorization %s [Matched rule: %q]", name.Value, authz.RegistrationID, authz.ID, reviewRule))
+	return core.UnauthorizedError(fmt.Sprintf("Issuance for %s needs manual review; request a new authorization, which will be held until an administrator approves it", name.Value))
+}
+
+// checkWildcard checks that authz, for the base domain of the wildcard name,
+// was validated with the DNS challenge, and that CAA allows us to issue for
+// the wildcard. Proving control of a single host over HTTP or TLS doesn't show
+// control of every name in the zone, and issuewild records are only consulted
+// for wildcard names, so neither is covered by the authorization itself.
+func (ra *RegistrationAuthorityImpl) checkWildcard(name core.AcmeIdentifier, authz core.Authorization) error {
+	validatedByDNS := false
+	for _, chall := range authz.Challenges {
+		if chall.Status == core.StatusValid && chall.Type == core.ChallengeTypeDNS {
+			validatedByDNS = true
+			break
+		}
+	}
+	if !validatedByDNS {
+		return core.UnauthorizedError(fmt.Sprintf("Wildcard name %s requires an authorization for %s completed with the %s challenge", name.Value, authz.Identifier.Value, core.ChallengeTypeDNS))
+	}
+
+	present, valid, err := ra.VA.CheckCAARecords(name, ra.accountURI(authz.RegistrationID), core.ChallengeTypeDNS)
+	if err != nil {
+		return err
+	}
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	ra.log.Audit(fmt.Sprintf("Checked CAA records for %s, registration ID %d [Present: %t, Valid for issuance: %t]", name.Value, authz.RegistrationID, present, valid))
+	if !valid {
+		return core.UnauthorizedError(fmt.Sprintf("CAA records for %s forbid issuance", name.Value))
+	}
+	return nil
+}
+
+// recheckCAA checks CAA again for a valid authorization that was validated
+// longer than CAARecheckWindow ago, or at an unknown time, this time with the
+// validation method that was used.
+func (ra *RegistrationAuthorityImpl) recheckCAA(authz core.Authorization, now time.Time) error {
+	if ra.CAARecheckWindow == 0 {
+		return nil
+	}
+	var validated *time.Time
+	method := ""
+	for _, chall := range authz.Challenges {
+		if chall.Status == core.StatusValid {
+			validated = chall.Validated
+			method = chall.Type
+			break
+		}
+	}
+	if validated != nil && now.Sub(*validated) <= ra.CAARecheckWindow {
+		return nil
+	}
+
+	present, valid, err := ra.VA.CheckCAARecords(authz.Identifier, ra.accountURI(authz.RegistrationID), method)
+	if err != nil {
+		return err
+	}
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	ra.log.Audit(fmt.Sprintf("Rechecked CAA records for %s, registration ID %d [Present: %t, Valid for issuance: %t]", authz.Identifier.Value, authz.RegistrationID, present, valid))
+	if !valid {
+		return core.UnauthorizedError(fmt.Sprintf("CAA records for %s forbid issuance", authz.Identifier.Value))
+	}
+	return nil
+}
+
+// checkValidationMethodCAA checks that CAA allows issuance for authz's
+// identifier when it is validated with the given method.
+func (ra *RegistrationAuthorityImpl) checkValidationMethodCAA(authz core.Authorization, method string) *core.ProblemDetails {
+	present, valid, err := ra.VA.CheckCAARecords(authz.Identifier, ra.accountURI(authz.RegistrationID), method)
+	if err != nil {
+		return &core.ProblemDetails{
+			Type:   core.ServerInternalProblem,
+			Detail: fmt.Sprintf("Couldn't check CAA records for %s: %s", authz.Identifier.Value, err),
+		}
+	}
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	ra.log.Audit(fmt.Sprintf("Checked CAA records for %s with method %s, registration ID %d [Present: %t, Valid for issuance: %t]", authz.Identifier.Value, method, authz.RegistrationID, present, valid))
+	if !valid {
+		return &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: fmt.Sprintf("CAA records for %s forbid issuance with the %s challenge", authz.Identifier.Value, method),
+		}
+	}
+	return nil
+}
+
 // UpdateRegistration updates an existing Registration with new values.
 func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration, update core.Registration) (reg core.Registration, err error) {
 	base.MergeUpdate(update)
@@ -345,6 +580,12 @@ func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration,
 
 // UpdateAuthorization updates an authorization with new values.
 func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization, challengeIndex int, response core.Challenge) (authz core.Authorization, err error) {
+	// Held authorizations can't be validated until they're approved
+	if base.Status == core.StatusNeedsReview {
+		err = core.UnauthorizedError("Authorization is awaiting manual review")
+		return
+	}
+
 	// Copy information over that the client is allowed to supply
 	authz = base
 	if challengeIndex >= len(authz.Challenges) {
@@ -376,7 +617,7 @@ func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization
 	}
 
 	// Dispatch to the VA for service
-	ra.VA.UpdateValidations(authz, challengeIndex)
+	err = ra.VA.UpdateValidations(authz, challengeIndex)
 
 	return
 }
@@ -456,6 +697,39 @@ func (ra *RegistrationAuthorityImpl) AdministrativelyRevokeCertificate(cert x509
 	return nil
 }
 
+// ReviewAuthorization approves or denies an authorization held for review.
+// Once approved the client can complete its challenges as usual, and once
+// denied the authorization is invalid. It is only called from the
+// authz-reviewer tool, and user is the name of the person who ran it.
+func (ra *RegistrationAuthorityImpl) ReviewAuthorization(authzID string, approve bool, user string) error {
+	// The authorization is written back, so it has to be up to date
+	authz, err := core.ReadYourWrites(ra.SA).GetAuthorization(authzID)
+	if err != nil {
+		return core.NotFoundError(fmt.Sprintf("Unable to find authorization %s: %s", authzID, err))
+	}
+	if authz.Status != core.StatusNeedsReview {
+		return core.MalformedRequestError(fmt.Sprintf("Authorization %s is %s, not awaiting review", authzID, authz.Status))
+	}
+
+	decision := "Denied"
+	if approve {
+		decision = "Approved"
+		authz.Status = core.StatusPending
+		authz.ReviewedBy = user
+		err = ra.SA.UpdatePendingAuthorization(authz)
+	} else {
+		authz.Status = core.StatusInvalid
+		err = ra.SA.FinalizeAuthorization(authz)
+	}
+	if err != nil {
+		return core.InternalServerError(err.Error())
+	}
+
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	ra.log.Audit(fmt.Sprintf("%s held authorization %s for %s, registration ID %d, authz-reviewer user: %s", decision, authzID, authz.Identifier.Value, authz.RegistrationID, user))
+	return nil
+}
+
 // OnValidationUpdate is called when a given Authorization is updated by the VA.
 func (ra *RegistrationAuthorityImpl) OnValidationUpdate(authz core.Authorization) error {
 	// Consider validation successful if any of the combinations
@@ -479,6 +753,28 @@ func (ra *RegistrationAuthorityImpl) OnValidationUpdate(authz core.Authorization
 		}
 	}
 
+	// CAA validationmethods restrictions can only be checked now that we
+	// know which method was used
+	if authz.Status == core.StatusValid {
+		for i := range authz.Challenges {
+			if authz.Challenges[i].Status != core.StatusValid {
+				continue
+			}
+			if prob := ra.checkValidationMethodCAA(authz, authz.Challenges[i].Type); prob != nil {
+				authz.Challenges[i].Status = core.StatusInvalid
+				authz.Challenges[i].Error = prob
+				authz.Status = core.StatusInvalid
+			}
+		}
+	}
+
+	now := ra.clk.Now()
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Status == core.StatusValid {
+			authz.Challenges[i].Validated = &now
+		}
+	}
+
 	// If no validation succeeded, then the authorization is invalid
 	// NOTE: This only works because we only ever do one validation
 	if authz.Status != core.StatusValid {
@@ -222,6 +222,10 @@ func wrapError(err error) (rpcError RPCError) {
 			rpcError.Type = "SignatureValidationError"
 		case core.CertificateIssuanceError:
 			rpcError.Type = "CertificateIssuanceError"
+		case core.BlockedKeyError:
+			rpcError.Type = "BlockedKeyError"
+		case core.DNSSECError:
+			rpcError.Type = "DNSSECError"
 		}
 	}
 	return
@@ -247,6 +251,10 @@ func unwrapError(rpcError RPCError) (err error) {
 			err = core.SignatureValidationError(rpcError.Value)
 		case "CertificateIssuanceError":
 			err = core.CertificateIssuanceError(rpcError.Value)
+		case "BlockedKeyError":
+			err = core.BlockedKeyError(rpcError.Value)
+		case "DNSSECError":
+			err = core.DNSSECError(rpcError.Value)
 		default:
 			err = errors.New(rpcError.Value)
 		}
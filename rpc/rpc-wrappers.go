@@ -42,9 +42,12 @@ const (
 	MethodRevokeCertificate                 = "RevokeCertificate"                 // CA
 	MethodRevokeCertificateWithReg          = "RevokeCertificateWithReg"          // RA
 	MethodAdministrativelyRevokeCertificate = "AdministrativelyRevokeCertificate" // RA
+	MethodReviewAuthorization               = "ReviewAuthorization"               // RA
 	MethodOnValidationUpdate                = "OnValidationUpdate"                // RA
 	MethodUpdateValidations                 = "UpdateValidations"                 // VA
 	MethodCheckCAARecords                   = "CheckCAARecords"                   // VA
+	MethodPerformValidation                 = "PerformValidation"                 // VA
+	MethodPerformCAACheck                   = "PerformCAACheck"                   // VA
 	MethodIssueCertificate                  = "IssueCertificate"                  // CA
 	MethodGenerateOCSP                      = "GenerateOCSP"                      // CA
 	MethodGetRegistration                   = "GetRegistration"                   // SA
@@ -61,8 +64,14 @@ const (
 	MethodFinalizeAuthorization             = "FinalizeAuthorization"             // SA
 	MethodAddCertificate                    = "AddCertificate"                    // SA
 	MethodAlreadyDeniedCSR                  = "AlreadyDeniedCSR"                  // SA
+	MethodKeyBlocked                        = "KeyBlocked"                        // SA
 )
 
+// primaryMethodSuffix is appended to the names of the SA's getter methods to
+// read from the primary database, rather than a replica that may lag behind
+// it.
+const primaryMethodSuffix = "FromPrimary"
+
 // Request structs
 type registrationRequest struct {
 	Reg core.Registration
@@ -101,6 +110,7 @@ type issueCertificateRequest struct {
 	Bytes          []byte
 	RegID          int64
 	EarliestExpiry time.Time
+	Profile        string
 }
 
 type addCertificateRequest struct {
@@ -120,7 +130,9 @@ type markCertificateRevokedRequest struct {
 }
 
 type caaRequest struct {
-	Ident core.AcmeIdentifier
+	Ident      core.AcmeIdentifier
+	AccountURI string
+	Method     string
 }
 
 type validationRequest struct {
@@ -128,6 +140,11 @@ type validationRequest struct {
 	Index int
 }
 
+type performValidationRequest struct {
+	Ident     core.AcmeIdentifier
+	Challenge core.Challenge
+}
+
 type alreadyDeniedCSRReq struct {
 	Names []string
 }
@@ -314,6 +331,22 @@ func NewRegistrationAuthorityServer(rpc RPCServer, impl core.RegistrationAuthori
 		return
 	})
 
+	rpc.Handle(MethodReviewAuthorization, func(req []byte) (response []byte, err error) {
+		var reviewReq struct {
+			ID      string
+			Approve bool
+			User    string
+		}
+		if err = json.Unmarshal(req, &reviewReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodReviewAuthorization, err, req)
+			return
+		}
+
+		err = impl.ReviewAuthorization(reviewReq.ID, reviewReq.Approve, reviewReq.User)
+		return
+	})
+
 	rpc.Handle(MethodOnValidationUpdate, func(req []byte) (response []byte, err error) {
 		var authz core.Authorization
 		if err = json.Unmarshal(req, &authz); err != nil {
@@ -467,6 +500,25 @@ func (rac RegistrationAuthorityClient) AdministrativelyRevokeCertificate(cert x5
 	return
 }
 
+// ReviewAuthorization sends an approval or denial of a held authorization
+// from the authz-reviewer
+func (rac RegistrationAuthorityClient) ReviewAuthorization(authzID string, approve bool, user string) (err error) {
+	var reviewReq struct {
+		ID      string
+		Approve bool
+		User    string
+	}
+	reviewReq.ID = authzID
+	reviewReq.Approve = approve
+	reviewReq.User = user
+	data, err := json.Marshal(reviewReq)
+	if err != nil {
+		return
+	}
+	_, err = rac.rpc.DispatchSync(MethodReviewAuthorization, data)
+	return
+}
+
 // OnValidationUpdate senda a notice that a validation has updated
 func (rac RegistrationAuthorityClient) OnValidationUpdate(authz core.Authorization) (err error) {
 	data, err := json.Marshal(authz)
@@ -482,6 +534,9 @@ func (rac RegistrationAuthorityClient) OnValidationUpdate(authz core.Authorizati
 //
 // ValidationAuthorityClient / Server
 //  -> UpdateValidations
+//  -> CheckCAARecords
+//  -> PerformValidation
+//  -> PerformCAACheck
 func NewValidationAuthorityServer(rpc RPCServer, impl core.ValidationAuthority) (err error) {
 	rpc.Handle(MethodUpdateValidations, func(req []byte) (response []byte, err error) {
 		var vaReq validationRequest
@@ -503,7 +558,7 @@ func NewValidationAuthorityServer(rpc RPCServer, impl core.ValidationAuthority)
 			return
 		}
 
-		present, valid, err := impl.CheckCAARecords(caaReq.Ident)
+		present, valid, err := impl.CheckCAARecords(caaReq.Ident, caaReq.AccountURI, caaReq.Method)
 		if err != nil {
 			return
 		}
@@ -521,6 +576,48 @@ func NewValidationAuthorityServer(rpc RPCServer, impl core.ValidationAuthority)
 		return
 	})
 
+	rpc.Handle(MethodPerformValidation, func(req []byte) (response []byte, err error) {
+		var pvReq performValidationRequest
+		if err = json.Unmarshal(req, &pvReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodPerformValidation, err, req)
+			return
+		}
+
+		// A failed validation is reported through the challenge's status and
+		// error, so the returned error is not sent back separately
+		challenge, _ := impl.PerformValidation(pvReq.Ident, pvReq.Challenge)
+		response, err = json.Marshal(challenge)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodPerformValidation, err, pvReq)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodPerformCAACheck, func(req []byte) (response []byte, err error) {
+		var caaReq caaRequest
+		if err = json.Unmarshal(req, &caaReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodPerformCAACheck, err, req)
+			return
+		}
+
+		present, valid, err := impl.PerformCAACheck(caaReq.Ident, caaReq.AccountURI, caaReq.Method)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(caaResponse{Present: present, Valid: valid})
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodPerformCAACheck, err, caaReq)
+			return
+		}
+		return
+	})
+
 	return nil
 }
 
@@ -547,13 +644,15 @@ func (vac ValidationAuthorityClient) UpdateValidations(authz core.Authorization,
 	}
 
 	_, err = vac.rpc.DispatchSync(MethodUpdateValidations, data)
-	return nil
+	return err
 }
 
 // CheckCAARecords sends a request to check CAA records
-func (vac ValidationAuthorityClient) CheckCAARecords(ident core.AcmeIdentifier) (present bool, valid bool, err error) {
+func (vac ValidationAuthorityClient) CheckCAARecords(ident core.AcmeIdentifier, accountURI, method string) (present bool, valid bool, err error) {
 	var caaReq caaRequest
 	caaReq.Ident = ident
+	caaReq.AccountURI = accountURI
+	caaReq.Method = method
 	data, err := json.Marshal(caaReq)
 	if err != nil {
 		return
@@ -575,6 +674,59 @@ func (vac ValidationAuthorityClient) CheckCAARecords(ident core.AcmeIdentifier)
 	return
 }
 
+// PerformValidation sends a request to validate a single challenge from the
+// remote VA's vantage point
+func (vac ValidationAuthorityClient) PerformValidation(ident core.AcmeIdentifier, challenge core.Challenge) (result core.Challenge, err error) {
+	data, err := json.Marshal(performValidationRequest{
+		Ident:     ident,
+		Challenge: challenge,
+	})
+	if err != nil {
+		return
+	}
+
+	jsonResp, err := vac.rpc.DispatchSync(MethodPerformValidation, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonResp, &result)
+	if err != nil {
+		return
+	}
+	if result.Status != core.StatusValid && result.Error != nil {
+		err = result.Error
+	}
+	return
+}
+
+// PerformCAACheck sends a request to check CAA records from the remote VA's
+// vantage point
+func (vac ValidationAuthorityClient) PerformCAACheck(ident core.AcmeIdentifier, accountURI, method string) (present bool, valid bool, err error) {
+	data, err := json.Marshal(caaRequest{
+		Ident:      ident,
+		AccountURI: accountURI,
+		Method:     method,
+	})
+	if err != nil {
+		return
+	}
+
+	jsonResp, err := vac.rpc.DispatchSync(MethodPerformCAACheck, data)
+	if err != nil {
+		return
+	}
+
+	var caaResp caaResponse
+	err = json.Unmarshal(jsonResp, &caaResp)
+	if err != nil {
+		return
+	}
+	present = caaResp.Present
+	valid = caaResp.Valid
+	return
+}
+
 // NewCertificateAuthorityServer constructs an RPC server
 //
 // CertificateAuthorityClient / Server
@@ -596,7 +748,7 @@ func NewCertificateAuthorityServer(rpc RPCServer, impl core.CertificateAuthority
 			return
 		}
 
-		cert, err := impl.IssueCertificate(*csr, icReq.RegID, icReq.EarliestExpiry)
+		cert, err := impl.IssueCertificate(*csr, icReq.RegID, icReq.EarliestExpiry, icReq.Profile)
 		if err != nil {
 			return
 		}
@@ -656,10 +808,11 @@ func NewCertificateAuthorityClient(client RPCClient) (cac CertificateAuthorityCl
 }
 
 // IssueCertificate sends a request to issue a certificate
-func (cac CertificateAuthorityClient) IssueCertificate(csr x509.CertificateRequest, regID int64, earliestExpiry time.Time) (cert core.Certificate, err error) {
+func (cac CertificateAuthorityClient) IssueCertificate(csr x509.CertificateRequest, regID int64, earliestExpiry time.Time, profile string) (cert core.Certificate, err error) {
 	var icReq issueCertificateRequest
 	icReq.Bytes = csr.Raw
 	icReq.RegID = regID
+	icReq.Profile = profile
 	data, err := json.Marshal(icReq)
 	if err != nil {
 		return
@@ -713,6 +866,12 @@ func (cac CertificateAuthorityClient) GenerateOCSP(signRequest core.OCSPSigningR
 
 // NewStorageAuthorityServer constructs an RPC server
 func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error {
+	// The getters are served twice: reading from wherever impl reads, which
+	// may be a replica, and under names ending in primaryMethodSuffix reading
+	// from the primary.
+	handleStorageGetter(rpc, impl, "")
+	handleStorageGetter(rpc, core.ReadYourWrites(impl), primaryMethodSuffix)
+
 	rpc.Handle(MethodUpdateRegistration, func(req []byte) (response []byte, err error) {
 		var reg core.Registration
 		if err = json.Unmarshal(req, &reg); err != nil {
@@ -725,175 +884,207 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		return
 	})
 
-	rpc.Handle(MethodGetRegistration, func(req []byte) (response []byte, err error) {
-		var grReq getRegistrationRequest
-		err = json.Unmarshal(req, &grReq)
+	rpc.Handle(MethodAddCertificate, func(req []byte) (response []byte, err error) {
+		var acReq addCertificateRequest
+		err = json.Unmarshal(req, &acReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodGetRegistration, err, req)
-			return
-		}
-
-		reg, err := impl.GetRegistration(grReq.ID)
-		if err != nil {
+			improperMessage(MethodAddCertificate, err, req)
 			return
 		}
 
-		response, err = json.Marshal(reg)
+		id, err := impl.AddCertificate(acReq.Bytes, acReq.RegID)
 		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetRegistration, err, req)
 			return
 		}
+		response = []byte(id)
 		return
 	})
 
-	rpc.Handle(MethodGetRegistrationByKey, func(req []byte) (response []byte, err error) {
-		var jwk jose.JsonWebKey
-		if err = json.Unmarshal(req, &jwk); err != nil {
+	rpc.Handle(MethodNewRegistration, func(req []byte) (response []byte, err error) {
+		var registration core.Registration
+		err = json.Unmarshal(req, &registration)
+		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodGetRegistrationByKey, err, req)
+			improperMessage(MethodNewRegistration, err, req)
 			return
 		}
 
-		reg, err := impl.GetRegistrationByKey(jwk)
+		output, err := impl.NewRegistration(registration)
 		if err != nil {
 			return
 		}
 
-		response, err = json.Marshal(reg)
+		response, err = json.Marshal(output)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetRegistrationByKey, err, req)
+			errorCondition(MethodNewRegistration, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodGetAuthorization, func(req []byte) (response []byte, err error) {
-		authz, err := impl.GetAuthorization(string(req))
+	rpc.Handle(MethodNewPendingAuthorization, func(req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err = json.Unmarshal(req, &authz); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodNewPendingAuthorization, err, req)
+			return
+		}
+
+		output, err := impl.NewPendingAuthorization(authz)
 		if err != nil {
 			return
 		}
 
-		response, err = json.Marshal(authz)
+		response, err = json.Marshal(output)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetAuthorization, err, req)
+			errorCondition(MethodNewPendingAuthorization, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodGetLatestValidAuthorization, func(req []byte) (response []byte, err error) {
-		var lvar latestValidAuthorizationRequest
-		if err = json.Unmarshal(req, &lvar); err != nil {
+	rpc.Handle(MethodUpdatePendingAuthorization, func(req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err = json.Unmarshal(req, &authz); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewAuthorization, err, req)
+			improperMessage(MethodUpdatePendingAuthorization, err, req)
 			return
 		}
 
-		authz, err := impl.GetLatestValidAuthorization(lvar.RegID, lvar.Identifier)
-		if err != nil {
-			return
-		}
+		err = impl.UpdatePendingAuthorization(authz)
+		return
+	})
 
-		response, err = json.Marshal(authz)
-		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetLatestValidAuthorization, err, req)
+	rpc.Handle(MethodFinalizeAuthorization, func(req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err = json.Unmarshal(req, &authz); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodFinalizeAuthorization, err, req)
 			return
 		}
+
+		err = impl.FinalizeAuthorization(authz)
 		return
 	})
 
-	rpc.Handle(MethodAddCertificate, func(req []byte) (response []byte, err error) {
-		var acReq addCertificateRequest
-		err = json.Unmarshal(req, &acReq)
-		if err != nil {
+	rpc.Handle(MethodMarkCertificateRevoked, func(req []byte) (response []byte, err error) {
+		var mcrReq markCertificateRevokedRequest
+
+		if err = json.Unmarshal(req, &mcrReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodAddCertificate, err, req)
+			improperMessage(MethodMarkCertificateRevoked, err, req)
 			return
 		}
 
-		id, err := impl.AddCertificate(acReq.Bytes, acReq.RegID)
-		if err != nil {
+		err = impl.MarkCertificateRevoked(mcrReq.Serial, mcrReq.OCSPResponse, mcrReq.ReasonCode)
+		return
+	})
+
+	rpc.Handle(MethodUpdateOCSP, func(req []byte) (response []byte, err error) {
+		var updateOCSPReq updateOCSPRequest
+
+		if err = json.Unmarshal(req, &updateOCSPReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdateOCSP, err, req)
 			return
 		}
-		response = []byte(id)
+
+		err = impl.UpdateOCSP(updateOCSPReq.Serial, updateOCSPReq.OCSPResponse)
 		return
 	})
 
-	rpc.Handle(MethodNewRegistration, func(req []byte) (response []byte, err error) {
-		var registration core.Registration
-		err = json.Unmarshal(req, &registration)
+	return nil
+}
+
+// handleStorageGetter registers handlers for impl's methods under their
+// method names plus suffix.
+func handleStorageGetter(rpc RPCServer, impl core.StorageGetter, suffix string) {
+	rpc.Handle(MethodGetRegistration+suffix, func(req []byte) (response []byte, err error) {
+		var grReq getRegistrationRequest
+		err = json.Unmarshal(req, &grReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewRegistration, err, req)
+			improperMessage(MethodGetRegistration, err, req)
 			return
 		}
 
-		output, err := impl.NewRegistration(registration)
+		reg, err := impl.GetRegistration(grReq.ID)
 		if err != nil {
 			return
 		}
 
-		response, err = json.Marshal(output)
+		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewRegistration, err, req)
+			errorCondition(MethodGetRegistration, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodNewPendingAuthorization, func(req []byte) (response []byte, err error) {
-		var authz core.Authorization
-		if err = json.Unmarshal(req, &authz); err != nil {
+	rpc.Handle(MethodGetRegistrationByKey+suffix, func(req []byte) (response []byte, err error) {
+		var jwk jose.JsonWebKey
+		if err = json.Unmarshal(req, &jwk); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewPendingAuthorization, err, req)
+			improperMessage(MethodGetRegistrationByKey, err, req)
 			return
 		}
 
-		output, err := impl.NewPendingAuthorization(authz)
+		reg, err := impl.GetRegistrationByKey(jwk)
 		if err != nil {
 			return
 		}
 
-		response, err = json.Marshal(output)
+		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewPendingAuthorization, err, req)
+			errorCondition(MethodGetRegistrationByKey, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodUpdatePendingAuthorization, func(req []byte) (response []byte, err error) {
-		var authz core.Authorization
-		if err = json.Unmarshal(req, &authz); err != nil {
-			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodUpdatePendingAuthorization, err, req)
+	rpc.Handle(MethodGetAuthorization+suffix, func(req []byte) (response []byte, err error) {
+		authz, err := impl.GetAuthorization(string(req))
+		if err != nil {
 			return
 		}
 
-		err = impl.UpdatePendingAuthorization(authz)
+		response, err = json.Marshal(authz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetAuthorization, err, req)
+			return
+		}
 		return
 	})
 
-	rpc.Handle(MethodFinalizeAuthorization, func(req []byte) (response []byte, err error) {
-		var authz core.Authorization
-		if err = json.Unmarshal(req, &authz); err != nil {
+	rpc.Handle(MethodGetLatestValidAuthorization+suffix, func(req []byte) (response []byte, err error) {
+		var lvar latestValidAuthorizationRequest
+		if err = json.Unmarshal(req, &lvar); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodFinalizeAuthorization, err, req)
+			improperMessage(MethodNewAuthorization, err, req)
 			return
 		}
 
-		err = impl.FinalizeAuthorization(authz)
+		authz, err := impl.GetLatestValidAuthorization(lvar.RegID, lvar.Identifier)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(authz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetLatestValidAuthorization, err, req)
+			return
+		}
 		return
 	})
 
-	rpc.Handle(MethodGetCertificate, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodGetCertificate+suffix, func(req []byte) (response []byte, err error) {
 		cert, err := impl.GetCertificate(string(req))
 		if err != nil {
 			return
@@ -909,7 +1100,7 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		return jsonResponse, nil
 	})
 
-	rpc.Handle(MethodGetCertificateByShortSerial, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodGetCertificateByShortSerial+suffix, func(req []byte) (response []byte, err error) {
 		cert, err := impl.GetCertificateByShortSerial(string(req))
 		if err != nil {
 			return
@@ -925,7 +1116,7 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		return jsonResponse, nil
 	})
 
-	rpc.Handle(MethodGetCertificateStatus, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodGetCertificateStatus+suffix, func(req []byte) (response []byte, err error) {
 		status, err := impl.GetCertificateStatus(string(req))
 		if err != nil {
 			return
@@ -940,33 +1131,7 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		return
 	})
 
-	rpc.Handle(MethodMarkCertificateRevoked, func(req []byte) (response []byte, err error) {
-		var mcrReq markCertificateRevokedRequest
-
-		if err = json.Unmarshal(req, &mcrReq); err != nil {
-			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodMarkCertificateRevoked, err, req)
-			return
-		}
-
-		err = impl.MarkCertificateRevoked(mcrReq.Serial, mcrReq.OCSPResponse, mcrReq.ReasonCode)
-		return
-	})
-
-	rpc.Handle(MethodUpdateOCSP, func(req []byte) (response []byte, err error) {
-		var updateOCSPReq updateOCSPRequest
-
-		if err = json.Unmarshal(req, &updateOCSPReq); err != nil {
-			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodUpdateOCSP, err, req)
-			return
-		}
-
-		err = impl.UpdateOCSP(updateOCSPReq.Serial, updateOCSPReq.OCSPResponse)
-		return
-	})
-
-	rpc.Handle(MethodAlreadyDeniedCSR, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodAlreadyDeniedCSR+suffix, func(req []byte) (response []byte, err error) {
 		var adcReq alreadyDeniedCSRReq
 
 		err = json.Unmarshal(req, &adcReq)
@@ -989,12 +1154,28 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		return
 	})
 
-	return nil
+	rpc.Handle(MethodKeyBlocked+suffix, func(req []byte) (response []byte, err error) {
+		blocked, err := impl.KeyBlocked(string(req))
+		if err != nil {
+			return
+		}
+
+		if blocked {
+			response = []byte{1}
+		} else {
+			response = []byte{0}
+		}
+		return
+	})
 }
 
 // StorageAuthorityClient is a client to communicate with the Storage Authority
 type StorageAuthorityClient struct {
 	rpc RPCClient
+	// methodSuffix is appended to the names of the getter methods it calls:
+	// primaryMethodSuffix to read from the primary, or "" to read from
+	// wherever the SA reads.
+	methodSuffix string
 }
 
 // NewStorageAuthorityClient constructs an RPC client
@@ -1003,6 +1184,13 @@ func NewStorageAuthorityClient(client RPCClient) (sac StorageAuthorityClient, er
 	return
 }
 
+// Primary returns a client whose getters read from the SA's primary
+// database, for flows that need to see writes they have just made.
+func (cac StorageAuthorityClient) Primary() core.StorageGetter {
+	cac.methodSuffix = primaryMethodSuffix
+	return cac
+}
+
 // GetRegistration sends a request to get a registration by ID
 func (cac StorageAuthorityClient) GetRegistration(id int64) (reg core.Registration, err error) {
 	var grReq getRegistrationRequest
@@ -1013,7 +1201,7 @@ func (cac StorageAuthorityClient) GetRegistration(id int64) (reg core.Registrati
 		return
 	}
 
-	jsonReg, err := cac.rpc.DispatchSync(MethodGetRegistration, data)
+	jsonReg, err := cac.rpc.DispatchSync(MethodGetRegistration+cac.methodSuffix, data)
 	if err != nil {
 		return
 	}
@@ -1029,7 +1217,7 @@ func (cac StorageAuthorityClient) GetRegistrationByKey(key jose.JsonWebKey) (reg
 		return
 	}
 
-	jsonReg, err := cac.rpc.DispatchSync(MethodGetRegistrationByKey, jsonKey)
+	jsonReg, err := cac.rpc.DispatchSync(MethodGetRegistrationByKey+cac.methodSuffix, jsonKey)
 	if err != nil {
 		return
 	}
@@ -1040,7 +1228,7 @@ func (cac StorageAuthorityClient) GetRegistrationByKey(key jose.JsonWebKey) (reg
 
 // GetAuthorization sends a request to get an Authorization by ID
 func (cac StorageAuthorityClient) GetAuthorization(id string) (authz core.Authorization, err error) {
-	jsonAuthz, err := cac.rpc.DispatchSync(MethodGetAuthorization, []byte(id))
+	jsonAuthz, err := cac.rpc.DispatchSync(MethodGetAuthorization+cac.methodSuffix, []byte(id))
 	if err != nil {
 		return
 	}
@@ -1061,7 +1249,7 @@ func (cac StorageAuthorityClient) GetLatestValidAuthorization(registrationId int
 		return
 	}
 
-	jsonAuthz, err := cac.rpc.DispatchSync(MethodGetLatestValidAuthorization, data)
+	jsonAuthz, err := cac.rpc.DispatchSync(MethodGetLatestValidAuthorization+cac.methodSuffix, data)
 	if err != nil {
 		return
 	}
@@ -1072,7 +1260,7 @@ func (cac StorageAuthorityClient) GetLatestValidAuthorization(registrationId int
 
 // GetCertificate sends a request to get a Certificate by ID
 func (cac StorageAuthorityClient) GetCertificate(id string) (cert core.Certificate, err error) {
-	jsonCert, err := cac.rpc.DispatchSync(MethodGetCertificate, []byte(id))
+	jsonCert, err := cac.rpc.DispatchSync(MethodGetCertificate+cac.methodSuffix, []byte(id))
 	if err != nil {
 		return
 	}
@@ -1084,7 +1272,7 @@ func (cac StorageAuthorityClient) GetCertificate(id string) (cert core.Certifica
 // GetCertificateByShortSerial sends a request to search for a certificate by
 // the predictable portion of its serial number.
 func (cac StorageAuthorityClient) GetCertificateByShortSerial(id string) (cert core.Certificate, err error) {
-	jsonCert, err := cac.rpc.DispatchSync(MethodGetCertificateByShortSerial, []byte(id))
+	jsonCert, err := cac.rpc.DispatchSync(MethodGetCertificateByShortSerial+cac.methodSuffix, []byte(id))
 	if err != nil {
 		return
 	}
@@ -1096,7 +1284,7 @@ func (cac StorageAuthorityClient) GetCertificateByShortSerial(id string) (cert c
 // GetCertificateStatus sends a request to obtain the current status of a
 // certificate by ID
 func (cac StorageAuthorityClient) GetCertificateStatus(id string) (status core.CertificateStatus, err error) {
-	jsonStatus, err := cac.rpc.DispatchSync(MethodGetCertificateStatus, []byte(id))
+	jsonStatus, err := cac.rpc.DispatchSync(MethodGetCertificateStatus+cac.methodSuffix, []byte(id))
 	if err != nil {
 		return
 	}
@@ -1238,7 +1426,7 @@ func (cac StorageAuthorityClient) AlreadyDeniedCSR(names []string) (exists bool,
 		return
 	}
 
-	response, err := cac.rpc.DispatchSync(MethodAlreadyDeniedCSR, data)
+	response, err := cac.rpc.DispatchSync(MethodAlreadyDeniedCSR+cac.methodSuffix, data)
 	if err != nil {
 		return
 	}
@@ -1251,3 +1439,19 @@ func (cac StorageAuthorityClient) AlreadyDeniedCSR(names []string) (exists bool,
 	}
 	return
 }
+
+// KeyBlocked sends a request to check whether a key digest has been blocked
+func (cac StorageAuthorityClient) KeyBlocked(keyDigest string) (blocked bool, err error) {
+	response, err := cac.rpc.DispatchSync(MethodKeyBlocked+cac.methodSuffix, []byte(keyDigest))
+	if err != nil {
+		return
+	}
+
+	switch response[0] {
+	case 0:
+		blocked = false
+	case 1:
+		blocked = true
+	}
+	return
+}
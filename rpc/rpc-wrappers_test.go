@@ -99,3 +99,59 @@ func TestGenerateOCSP(t *testing.T) {
 	_, err = client.GenerateOCSP(req)
 	test.AssertError(t, err, "Should have failed at signer")
 }
+
+func TestPerformValidation(t *testing.T) {
+	mock := &MockRPCClient{}
+
+	client, err := NewValidationAuthorityClient(mock)
+	test.AssertNotError(t, err, "Client construction")
+
+	challenge := core.Challenge{Type: core.ChallengeTypeTLSSNI01, Token: "token"}
+	ident := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"}
+
+	challenge.Status = core.StatusValid
+	mock.NextResp, _ = json.Marshal(challenge)
+	result, err := client.PerformValidation(ident, challenge)
+	test.AssertNotError(t, err, "Valid challenge returned an error")
+	test.AssertEquals(t, result.Status, core.StatusValid)
+	test.AssertEquals(t, mock.LastMethod, MethodPerformValidation)
+
+	challenge.Status = core.StatusInvalid
+	challenge.Error = &core.ProblemDetails{Type: core.UnauthorizedProblem, Detail: "nope"}
+	mock.NextResp, _ = json.Marshal(challenge)
+	result, err = client.PerformValidation(ident, challenge)
+	test.AssertError(t, err, "Invalid challenge didn't return an error")
+	test.AssertEquals(t, result.Status, core.StatusInvalid)
+	test.AssertEquals(t, result.Error.Type, core.UnauthorizedProblem)
+}
+
+func TestPerformCAACheck(t *testing.T) {
+	mock := &MockRPCClient{}
+
+	client, err := NewValidationAuthorityClient(mock)
+	test.AssertNotError(t, err, "Client construction")
+
+	ident := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"}
+	mock.NextResp, _ = json.Marshal(caaResponse{Present: true, Valid: false})
+	present, valid, err := client.PerformCAACheck(ident, "", "")
+	test.AssertNotError(t, err, "PerformCAACheck failed")
+	test.Assert(t, present, "Present should be true")
+	test.Assert(t, !valid, "Valid should be false")
+	test.AssertEquals(t, mock.LastMethod, MethodPerformCAACheck)
+}
+
+func TestSAReadYourWrites(t *testing.T) {
+	mock := &MockRPCClient{}
+	client, err := NewStorageAuthorityClient(mock)
+	test.AssertNotError(t, err, "Client construction")
+
+	mock.NextResp = []byte{1}
+	_, err = client.KeyBlocked("digest")
+	test.AssertNotError(t, err, "KeyBlocked failed")
+	test.AssertEquals(t, mock.LastMethod, MethodKeyBlocked)
+
+	mock.NextResp = []byte{1}
+	_, err = core.ReadYourWrites(client).KeyBlocked("digest")
+	test.AssertNotError(t, err, "KeyBlocked failed")
+	test.AssertEquals(t, mock.LastMethod, MethodKeyBlocked+primaryMethodSuffix)
+}
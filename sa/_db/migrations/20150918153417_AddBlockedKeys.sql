@@ -0,0 +1,15 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `blockedKeys` (
+  `keyDigest` varchar(255) NOT NULL,
+  `certSerial` varchar(255) NOT NULL,
+  `added` datetime NOT NULL,
+  PRIMARY KEY (`keyDigest`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `blockedKeys`;
@@ -0,0 +1,18 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE `pendingAuthorizations` ADD COLUMN (
+  `reviewedBy` varchar(255) NOT NULL DEFAULT ''
+);
+
+ALTER TABLE `authz` ADD COLUMN (
+  `reviewedBy` varchar(255) NOT NULL DEFAULT ''
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE `pendingAuthorizations` DROP COLUMN `reviewedBy`;
+
+ALTER TABLE `authz` DROP COLUMN `reviewedBy`;
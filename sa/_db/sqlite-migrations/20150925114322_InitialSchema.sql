@@ -0,0 +1,135 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- SQLite databases start from the schema the MySQL migrations up to this
+-- version build, so that both have the version in migrate.SchemaVersions.
+-- SQLite index names are per database rather than per table.
+
+CREATE TABLE `registrations` (
+  `id` integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  `jwk` blob NOT NULL,
+  `jwk_sha256` varchar(255) NOT NULL,
+  `contact` varchar(255) NOT NULL,
+  `agreement` varchar(255) NOT NULL,
+  `LockCol` bigint NOT NULL
+);
+CREATE UNIQUE INDEX `jwk_sha256` ON `registrations` (`jwk_sha256`);
+
+CREATE TABLE `authz` (
+  `id` varchar(255) NOT NULL PRIMARY KEY,
+  `identifier` varchar(255) NOT NULL,
+  `registrationID` bigint NOT NULL REFERENCES `registrations` (`id`),
+  `status` varchar(255) NOT NULL,
+  `expires` datetime DEFAULT NULL,
+  `combinations` varchar(255) NOT NULL
+);
+CREATE INDEX `regId_authz_idx` ON `authz` (`registrationID`);
+
+CREATE TABLE `pendingAuthorizations` (
+  `id` varchar(255) NOT NULL PRIMARY KEY,
+  `identifier` varchar(255) NOT NULL,
+  `registrationID` bigint NOT NULL REFERENCES `registrations` (`id`),
+  `status` varchar(255) NOT NULL,
+  `expires` datetime DEFAULT NULL,
+  `combinations` varchar(255) NOT NULL,
+  `LockCol` bigint NOT NULL
+);
+CREATE INDEX `regId_pendingAuthorizations_idx` ON `pendingAuthorizations` (`registrationID`);
+
+CREATE TABLE `challenges` (
+  `id` integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  `authorizationID` varchar(255) NOT NULL,
+  `LockCol` bigint DEFAULT NULL,
+  `type` varchar(255) NOT NULL,
+  `status` varchar(255) NOT NULL,
+  `error` blob DEFAULT NULL,
+  `validated` datetime DEFAULT NULL,
+  `uri` varchar(255) DEFAULT NULL,
+  `token` varchar(255) NOT NULL,
+  `tls` tinyint(1) DEFAULT NULL,
+  `validation` blob,
+  `validationRecord` blob,
+  `accountKey` blob,
+  `keyAuthorization` varchar(255) NOT NULL DEFAULT ''
+);
+CREATE INDEX `authorizationID_challenges_idx` ON `challenges` (`authorizationID`);
+
+CREATE TABLE `certificates` (
+  `registrationID` bigint NOT NULL REFERENCES `registrations` (`id`),
+  `serial` varchar(255) NOT NULL PRIMARY KEY,
+  `digest` varchar(255) NOT NULL,
+  `der` blob NOT NULL,
+  `issued` datetime NOT NULL,
+  `expires` datetime NOT NULL
+);
+CREATE INDEX `regId_certificates_idx` ON `certificates` (`registrationID`);
+
+CREATE TABLE `certificateStatus` (
+  `serial` varchar(255) NOT NULL PRIMARY KEY,
+  `subscriberApproved` tinyint(1) NOT NULL,
+  `status` varchar(255) NOT NULL,
+  `ocspLastUpdated` datetime NOT NULL,
+  `revokedDate` datetime NOT NULL,
+  `revokedReason` int NOT NULL,
+  `lastExpirationNagSent` datetime NOT NULL,
+  `LockCol` bigint NOT NULL
+);
+
+CREATE TABLE `crls` (
+  `serial` varchar(255) NOT NULL PRIMARY KEY,
+  `createdAt` datetime NOT NULL,
+  `crl` varchar(255) NOT NULL
+);
+
+CREATE TABLE `deniedCSRs` (
+  `id` integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  `names` varchar(255) NOT NULL
+);
+
+CREATE TABLE `ocspResponses` (
+  `id` integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  `serial` varchar(255) NOT NULL,
+  `createdAt` datetime NOT NULL,
+  `response` blob NOT NULL
+);
+CREATE INDEX `serial_ocspResponses_idx` ON `ocspResponses` (`serial`);
+
+CREATE TABLE `identifierData` (
+  `reversedName` varchar(255) NOT NULL,
+  `certSHA1` varchar(40) NOT NULL
+);
+CREATE UNIQUE INDEX `certSHA1_reversedName` ON `identifierData` (`certSHA1`, `reversedName`);
+
+CREATE TABLE `externalCerts` (
+  `sha1` varchar(40) NOT NULL,
+  `issuer` text DEFAULT NULL,
+  `subject` text DEFAULT NULL,
+  `notAfter` datetime DEFAULT NULL,
+  `spki` blob DEFAULT NULL,
+  `valid` tinyint(1) DEFAULT NULL,
+  `ev` tinyint(1) DEFAULT NULL,
+  `rawDERCert` blob DEFAULT NULL
+);
+CREATE UNIQUE INDEX `sha1` ON `externalCerts` (`sha1`);
+
+CREATE TABLE `blockedKeys` (
+  `keyDigest` varchar(255) NOT NULL PRIMARY KEY,
+  `certSerial` varchar(255) NOT NULL,
+  `added` datetime NOT NULL
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `blockedKeys`;
+DROP TABLE `externalCerts`;
+DROP TABLE `identifierData`;
+DROP TABLE `ocspResponses`;
+DROP TABLE `deniedCSRs`;
+DROP TABLE `crls`;
+DROP TABLE `certificateStatus`;
+DROP TABLE `certificates`;
+DROP TABLE `challenges`;
+DROP TABLE `pendingAuthorizations`;
+DROP TABLE `authz`;
+DROP TABLE `registrations`;
@@ -0,0 +1,42 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE `pendingAuthorizations` ADD COLUMN `reviewedBy` varchar(255) NOT NULL DEFAULT '';
+
+ALTER TABLE `authz` ADD COLUMN `reviewedBy` varchar(255) NOT NULL DEFAULT '';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+-- SQLite can't drop columns, so the tables are rebuilt without it.
+
+CREATE TABLE `pendingAuthorizations_old` (
+  `id` varchar(255) NOT NULL PRIMARY KEY,
+  `identifier` varchar(255) NOT NULL,
+  `registrationID` bigint NOT NULL REFERENCES `registrations` (`id`),
+  `status` varchar(255) NOT NULL,
+  `expires` datetime DEFAULT NULL,
+  `combinations` varchar(255) NOT NULL,
+  `LockCol` bigint NOT NULL
+);
+INSERT INTO `pendingAuthorizations_old`
+  SELECT `id`, `identifier`, `registrationID`, `status`, `expires`, `combinations`, `LockCol`
+  FROM `pendingAuthorizations`;
+DROP TABLE `pendingAuthorizations`;
+ALTER TABLE `pendingAuthorizations_old` RENAME TO `pendingAuthorizations`;
+CREATE INDEX `regId_pendingAuthorizations_idx` ON `pendingAuthorizations` (`registrationID`);
+
+CREATE TABLE `authz_old` (
+  `id` varchar(255) NOT NULL PRIMARY KEY,
+  `identifier` varchar(255) NOT NULL,
+  `registrationID` bigint NOT NULL REFERENCES `registrations` (`id`),
+  `status` varchar(255) NOT NULL,
+  `expires` datetime DEFAULT NULL,
+  `combinations` varchar(255) NOT NULL
+);
+INSERT INTO `authz_old`
+  SELECT `id`, `identifier`, `registrationID`, `status`, `expires`, `combinations`
+  FROM `authz`;
+DROP TABLE `authz`;
+ALTER TABLE `authz_old` RENAME TO `authz`;
+CREATE INDEX `regId_authz_idx` ON `authz` (`registrationID`);
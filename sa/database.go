@@ -17,23 +17,42 @@ import (
 	blog "github.com/letsencrypt/boulder/log"
 )
 
+// sqlitePrefix starts DBConnect strings naming an embedded SQLite database,
+// e.g. "sqlite3:///var/lib/boulder/sa.db", or "sqlite3://:memory:" for one
+// that lives only as long as the process.
+const sqlitePrefix = "sqlite3://"
+
+// sqliteDriver names the database/sql driver sqlite.go registers for SQLite
+// databases.
+const sqliteDriver = "boulder-sqlite3"
+
 // NewDbMap creates the root gorp mapping object. Create one of these for each
 // database schema you wish to map. Each DbMap contains a list of mapped tables.
 // It automatically maps the tables for the primary parts of Boulder around the
 // Storage Authority. This may require some further work when we use a disjoint
 // schema, like that for `certificate-authority-data.go`.
+//
+// dbConnect is either a mysql+tcp:// URL or a sqlite3:// one. Either way,
+// the database's tables come from the schema's migrations.
 func NewDbMap(dbConnect string) (*gorp.DbMap, error) {
 	logger := blog.GetAuditLogger()
 
+	driver, dialect := "mysql", gorp.Dialect(gorp.MySQLDialect{Engine: "InnoDB", Encoding: "UTF8"})
 	var err error
-	dbConnect, err = recombineURLForDB(dbConnect)
-	if err != nil {
-		return nil, err
+	dbConnect = strings.TrimSpace(dbConnect)
+	if strings.HasPrefix(dbConnect, sqlitePrefix) {
+		driver, dialect = sqliteDriver, gorp.SqliteDialect{}
+		dbConnect = sqliteDSN(dbConnect)
+	} else {
+		dbConnect, err = recombineURLForDB(dbConnect)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	logger.Debug("Connecting to database")
 
-	db, err := sql.Open("mysql", dbConnect)
+	db, err := sql.Open(driver, dbConnect)
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +60,6 @@ func NewDbMap(dbConnect string) (*gorp.DbMap, error) {
 		return nil, err
 	}
 
-	dialect := gorp.MySQLDialect{Engine: "InnoDB", Encoding: "UTF8"}
 	dbmap := &gorp.DbMap{Db: db, Dialect: dialect, TypeConverter: BoulderTypeConverter{}}
 
 	initTables(dbmap)
@@ -51,6 +69,27 @@ func NewDbMap(dbConnect string) (*gorp.DbMap, error) {
 	return dbmap, err
 }
 
+// IsSQLite returns true if dbMap is backed by an embedded SQLite database
+// rather than MySQL.
+func IsSQLite(dbMap *gorp.DbMap) bool {
+	_, ok := dbMap.Dialect.(gorp.SqliteDialect)
+	return ok
+}
+
+// sqliteDSN transforms a sqlite3:// DBConnect string into the file name the
+// sqlite3 driver opens. In-memory databases use a shared cache so that every
+// connection in the pool sees the same database, instead of each getting an
+// empty one of its own.
+func sqliteDSN(dbConnect string) string {
+	path := strings.TrimPrefix(dbConnect, sqlitePrefix)
+	if path == ":memory:" {
+		return "file::memory:?cache=shared"
+	}
+	// Wait for other connections' writes instead of failing with
+	// "database is locked"
+	return path + "?_busy_timeout=5000"
+}
+
 // recombineURLForDB transforms a database URL to a URL-like string
 // that the mysql driver can use. The mysql driver needs the Host data
 // to be wrapped in "tcp()" but url.Parse will escape the parentheses
@@ -142,4 +181,5 @@ func initTables(dbMap *gorp.DbMap) {
 	dbMap.AddTableWithName(core.OCSPResponse{}, "ocspResponses").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.CRL{}, "crls").SetKeys(false, "Serial")
 	dbMap.AddTableWithName(core.DeniedCSR{}, "deniedCSRs").SetKeys(true, "ID")
+	dbMap.AddTableWithName(core.BlockedKey{}, "blockedKeys").SetKeys(false, "KeyDigest")
 }
@@ -15,3 +15,8 @@ func TestInvalidDSN(t *testing.T) {
 	_, err := NewDbMap("invalid")
 	test.AssertError(t, err, "DB connect string missing the slash separating the database name")
 }
+
+func TestSQLiteDSN(t *testing.T) {
+	test.AssertEquals(t, sqliteDSN("sqlite3://:memory:"), "file::memory:?cache=shared")
+	test.AssertEquals(t, sqliteDSN("sqlite3:///var/lib/boulder/sa.db"), "/var/lib/boulder/sa.db?_busy_timeout=5000")
+}
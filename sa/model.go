@@ -42,6 +42,7 @@ type challModel struct {
 	Validation       []byte          `db:"validation"`
 	ValidationRecord []byte          `db:"validationRecord"`
 	AccountKey       []byte          `db:"accountKey"`
+	KeyAuthorization string          `db:"keyAuthorization"`
 
 	LockCol int64
 }
@@ -124,6 +125,13 @@ func challengeToModel(c *core.Challenge, authID string) (*challModel, error) {
 		}
 		cm.ValidationRecord = vrJSON
 	}
+	if c.KeyAuthorization != nil {
+		kaString := c.KeyAuthorization.String()
+		if len(kaString) > 255 {
+			return nil, fmt.Errorf("Key authorization is too long to store in the database")
+		}
+		cm.KeyAuthorization = kaString
+	}
 	if c.AccountKey != nil {
 		akJSON, err := json.Marshal(c.AccountKey)
 		if err != nil {
@@ -175,6 +183,13 @@ func modelToChallenge(cm *challModel) (core.Challenge, error) {
 		}
 		c.ValidationRecord = vr
 	}
+	if len(cm.KeyAuthorization) > 0 {
+		ka, err := core.NewKeyAuthorizationFromString(cm.KeyAuthorization)
+		if err != nil {
+			return core.Challenge{}, err
+		}
+		c.KeyAuthorization = &ka
+	}
 	if len(cm.AccountKey) > 0 {
 		var ak jose.JsonWebKey
 		err := json.Unmarshal(cm.AccountKey, &ak)
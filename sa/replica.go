@@ -0,0 +1,83 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// ReplicaLag returns how far the replica db is behind its primary, as
+// reported by SHOW SLAVE STATUS, which needs the REPLICATION CLIENT
+// privilege.
+func ReplicaLag(db *sql.DB) (time.Duration, error) {
+	rows, err := db.Query("SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("Database isn't a replica")
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	return secondsBehindMaster(columns, values)
+}
+
+// secondsBehindMaster reads the Seconds_Behind_Master column of a SHOW SLAVE
+// STATUS row. It's NULL while replication isn't running.
+func secondsBehindMaster(columns []string, values []sql.RawBytes) (time.Duration, error) {
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" {
+			continue
+		}
+		if values[i] == nil {
+			return 0, fmt.Errorf("Replication isn't running")
+		}
+		seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, fmt.Errorf("SHOW SLAVE STATUS has no Seconds_Behind_Master column")
+}
+
+// MonitorReplicaLag reports the lag of the replica db every interval, in
+// milliseconds as the SA.Replica.Lag gauge, and counts the times it couldn't
+// be read as SA.Replica.LagErrors. It never returns.
+func MonitorReplicaLag(db *sql.DB, stats statsd.Statter, interval time.Duration) {
+	log := blog.GetAuditLogger()
+	for {
+		lag, err := ReplicaLag(db)
+		if err != nil {
+			log.Warning(fmt.Sprintf("Couldn't read replica lag: %s", err))
+			stats.Inc("SA.Replica.LagErrors", 1, 1.0)
+		} else {
+			stats.Gauge("SA.Replica.Lag", int64(lag/time.Millisecond), 1.0)
+		}
+		time.Sleep(interval)
+	}
+}
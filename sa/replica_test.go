@@ -0,0 +1,59 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	primary, replica := &gorp.DbMap{}, &gorp.DbMap{}
+	ssa, err := NewSQLStorageAuthority(primary, clock.NewFake())
+	test.AssertNotError(t, err, "Couldn't create SA")
+	test.Assert(t, ssa.readMap == primary, "SA without a replica doesn't read from the primary")
+
+	ssa.SetReplica(replica)
+	test.Assert(t, ssa.readMap == replica, "SA doesn't read from its replica")
+	p := ssa.Primary().(*SQLStorageAuthority)
+	test.Assert(t, p.readMap == primary, "Primary doesn't read from the primary")
+	test.Assert(t, ssa.readMap == replica, "Primary changed the SA it came from")
+}
+
+func TestSecondsBehindMaster(t *testing.T) {
+	columns := []string{"Slave_IO_State", "Seconds_Behind_Master", "Last_Error"}
+	lag, err := secondsBehindMaster(columns, []sql.RawBytes{sql.RawBytes("Waiting"), sql.RawBytes("42"), nil})
+	test.AssertNotError(t, err, "Couldn't read lag")
+	test.AssertEquals(t, lag, 42*time.Second)
+
+	_, err = secondsBehindMaster(columns, []sql.RawBytes{nil, nil, nil})
+	test.AssertError(t, err, "Read lag while replication is stopped")
+
+	_, err = secondsBehindMaster([]string{"Last_Error"}, []sql.RawBytes{nil})
+	test.AssertError(t, err, "Read lag without a Seconds_Behind_Master column")
+}
+
+// Blocked keys and denied CSRs have to be checked on the primary, so they
+// mustn't touch the replica at all.
+func TestBlockChecksReadPrimary(t *testing.T) {
+	ssa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	replica, err := NewDbMap(dbConnStr)
+	test.AssertNotError(t, err, "Couldn't create replica dbMap")
+	replica.Db.Close()
+	ssa.SetReplica(replica)
+
+	_, err = ssa.KeyBlocked("digest")
+	test.AssertNotError(t, err, "KeyBlocked read from the replica")
+	_, err = ssa.AlreadyDeniedCSR([]string{"example.com"})
+	test.AssertNotError(t, err, "AlreadyDeniedCSR read from the replica")
+}
@@ -2,10 +2,14 @@ package satest
 
 import (
 	"encoding/json"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/migrate"
 )
 
 var theKey = `{
@@ -50,3 +54,24 @@ func CreateWorkingRegistration(t *testing.T, sa core.StorageAuthority) core.Regi
 	}
 	return reg
 }
+
+// MigrateSQLite applies schema's ("sa" or "policy") SQLite migrations to
+// dbMap if it's a SQLite database. The in-memory databases the tests use
+// with BOULDER_TEST_DB=sqlite are empty whenever they're opened, whereas
+// the MySQL test databases are migrated ahead of time.
+func MigrateSQLite(t *testing.T, dbMap *gorp.DbMap, schema string) {
+	if _, ok := dbMap.Dialect.(gorp.SqliteDialect); !ok {
+		return
+	}
+	// Tests run in their package's directory, so find the migrations
+	// relative to this file instead
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(file), "..", "..", migrate.Dir(schema, true))
+	migrations, err := migrate.Load(dir)
+	if err != nil {
+		t.Fatalf("Couldn't load %s migrations: %s", schema, err)
+	}
+	if _, err = migrate.Up(dbMap.Db, migrations); err != nil {
+		t.Fatalf("Couldn't migrate %s database: %s", schema, err)
+	}
+}
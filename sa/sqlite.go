@@ -0,0 +1,28 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build sqlite
+// +build sqlite
+
+package sa
+
+import (
+	"database/sql"
+
+	sqlite3 "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/mattn/go-sqlite3"
+)
+
+// The SQLite driver uses cgo, so it's only registered in builds made with
+// "-tags sqlite". Without it, sqlite3:// DBConnect strings fail with
+// `sql: unknown driver "boulder-sqlite3"`.
+func init() {
+	// SQLite only enforces foreign keys on connections that turn them on
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			_, err := conn.Exec("PRAGMA foreign_keys = ON", nil)
+			return err
+		},
+	})
+}
@@ -28,8 +28,11 @@ const getChallengesQuery = "SELECT * FROM challenges WHERE authorizationID = :au
 // SQLStorageAuthority defines a Storage Authority
 type SQLStorageAuthority struct {
 	dbMap *gorp.DbMap
-	clk   clock.Clock
-	log   *blog.AuditLogger
+	// readMap serves the StorageGetter methods. It's a read replica if one
+	// has been set, and dbMap otherwise.
+	readMap *gorp.DbMap
+	clk     clock.Clock
+	log     *blog.AuditLogger
 }
 
 func digest256(data []byte) []byte {
@@ -57,21 +60,42 @@ func NewSQLStorageAuthority(dbMap *gorp.DbMap, clk clock.Clock) (*SQLStorageAuth
 	logger.Notice("Storage Authority Starting")
 
 	ssa := &SQLStorageAuthority{
-		dbMap: dbMap,
-		clk:   clk,
-		log:   logger,
+		dbMap:   dbMap,
+		readMap: dbMap,
+		clk:     clk,
+		log:     logger,
 	}
 
 	return ssa, nil
 }
 
+// SetReplica makes the StorageGetter methods read from replica, a read
+// replica of the SA database, instead of the primary. Replicas lag behind the
+// primary, so flows that read back something they just wrote should read
+// through Primary.
+func (ssa *SQLStorageAuthority) SetReplica(replica *gorp.DbMap) {
+	ssa.readMap = replica
+}
+
+// Primary returns a StorageGetter that reads from the primary database, and
+// so sees every write that has been made through the SA.
+func (ssa *SQLStorageAuthority) Primary() core.StorageGetter {
+	primary := *ssa
+	primary.readMap = ssa.dbMap
+	return &primary
+}
+
 // SetSQLDebug enables/disables GORP SQL-level Debugging
 func (ssa *SQLStorageAuthority) SetSQLDebug(state bool) {
 	SetSQLDebug(ssa.dbMap, state)
+	if ssa.readMap != ssa.dbMap {
+		SetSQLDebug(ssa.readMap, state)
+	}
 }
 
 func statusIsPending(status core.AcmeStatus) bool {
-	return status == core.StatusPending || status == core.StatusProcessing || status == core.StatusUnknown
+	return status == core.StatusPending || status == core.StatusProcessing || status == core.StatusUnknown ||
+		status == core.StatusNeedsReview
 }
 
 func existingPending(tx *gorp.Transaction, id string) bool {
@@ -129,7 +153,7 @@ func (e NoSuchRegistrationError) Error() string {
 
 // GetRegistration obtains a Registration by ID
 func (ssa *SQLStorageAuthority) GetRegistration(id int64) (core.Registration, error) {
-	regObj, err := ssa.dbMap.Get(regModel{}, id)
+	regObj, err := ssa.readMap.Get(regModel{}, id)
 	if err != nil {
 		return core.Registration{}, err
 	}
@@ -151,7 +175,7 @@ func (ssa *SQLStorageAuthority) GetRegistrationByKey(key jose.JsonWebKey) (core.
 	if err != nil {
 		return core.Registration{}, err
 	}
-	err = ssa.dbMap.SelectOne(reg, "SELECT * FROM registrations WHERE jwk_sha256 = :key", map[string]interface{}{"key": sha})
+	err = ssa.readMap.SelectOne(reg, "SELECT * FROM registrations WHERE jwk_sha256 = :key", map[string]interface{}{"key": sha})
 
 	if err == sql.ErrNoRows {
 		msg := fmt.Sprintf("No registrations with public key sha256 %s", sha)
@@ -166,7 +190,7 @@ func (ssa *SQLStorageAuthority) GetRegistrationByKey(key jose.JsonWebKey) (core.
 
 // GetAuthorization obtains an Authorization by ID
 func (ssa *SQLStorageAuthority) GetAuthorization(id string) (authz core.Authorization, err error) {
-	tx, err := ssa.dbMap.Begin()
+	tx, err := ssa.readMap.Begin()
 	if err != nil {
 		return
 	}
@@ -226,7 +250,7 @@ func (ssa *SQLStorageAuthority) GetLatestValidAuthorization(registrationId int64
 		return
 	}
 	var auth core.Authorization
-	err = ssa.dbMap.SelectOne(&auth, "SELECT id FROM authz "+
+	err = ssa.readMap.SelectOne(&auth, "SELECT id FROM authz "+
 		"WHERE identifier = :identifier AND registrationID = :registrationId AND status = 'valid' "+
 		"ORDER BY expires DESC LIMIT 1",
 		map[string]interface{}{"identifier": string(ident), "registrationId": registrationId})
@@ -237,17 +261,18 @@ func (ssa *SQLStorageAuthority) GetLatestValidAuthorization(registrationId int64
 	return ssa.GetAuthorization(auth.ID)
 }
 
-// GetCertificateByShortSerial takes an id consisting of the first, sequential half of a
-// serial number and returns the first certificate whose full serial number is
-// lexically greater than that id. This allows clients to query on the known
-// sequential half of our serial numbers to enumerate all certificates.
+// GetCertificateByShortSerial takes an id consisting of the first half of a
+// serial number (the CA's prefix byte and the first seven random bytes) and
+// returns the certificate whose full serial number starts with that id. Since
+// serials are random, short serials are not guaranteed unique; if more than
+// one certificate matches, an error is returned.
 func (ssa *SQLStorageAuthority) GetCertificateByShortSerial(shortSerial string) (cert core.Certificate, err error) {
 	if len(shortSerial) != 16 {
 		err = errors.New("Invalid certificate short serial " + shortSerial)
 		return
 	}
 
-	err = ssa.dbMap.SelectOne(&cert, "SELECT * FROM certificates WHERE serial LIKE :shortSerial",
+	err = ssa.readMap.SelectOne(&cert, "SELECT * FROM certificates WHERE serial LIKE :shortSerial",
 		map[string]interface{}{"shortSerial": shortSerial + "%"})
 	return
 }
@@ -260,7 +285,7 @@ func (ssa *SQLStorageAuthority) GetCertificate(serial string) (core.Certificate,
 		return core.Certificate{}, err
 	}
 
-	certObj, err := ssa.dbMap.Get(core.Certificate{}, serial)
+	certObj, err := ssa.readMap.Get(core.Certificate{}, serial)
 	if err != nil {
 		return core.Certificate{}, err
 	}
@@ -286,7 +311,7 @@ func (ssa *SQLStorageAuthority) GetCertificateStatus(serial string) (status core
 		return
 	}
 
-	certificateStats, err := ssa.dbMap.Get(core.CertificateStatus{}, serial)
+	certificateStats, err := ssa.readMap.Get(core.CertificateStatus{}, serial)
 	if err != nil {
 		return
 	}
@@ -309,7 +334,8 @@ func (ssa *SQLStorageAuthority) NewRegistration(reg core.Registration) (core.Reg
 
 // UpdateOCSP stores an updated OCSP response.
 func (ssa *SQLStorageAuthority) UpdateOCSP(serial string, ocspResponse []byte) (err error) {
-	status, err := ssa.GetCertificateStatus(serial)
+	// The status is written back below, so it has to be up to date
+	status, err := ssa.Primary().GetCertificateStatus(serial)
 	if err != nil {
 		return fmt.Errorf(
 			"Unable to update OCSP for certificate %s: cert status not found.", serial)
@@ -345,12 +371,15 @@ func (ssa *SQLStorageAuthority) UpdateOCSP(serial string, ocspResponse []byte) (
 // MarkCertificateRevoked stores the fact that a certificate is revoked, along
 // with a timestamp and a reason.
 func (ssa *SQLStorageAuthority) MarkCertificateRevoked(serial string, ocspResponse []byte, reasonCode core.RevocationCode) (err error) {
-	if _, err = ssa.GetCertificate(serial); err != nil {
+	// The certificate may have been issued moments ago, so it has to be
+	// looked up on the primary
+	primary := ssa.Primary()
+	if _, err = primary.GetCertificate(serial); err != nil {
 		return fmt.Errorf(
 			"Unable to mark certificate %s revoked: cert not found.", serial)
 	}
 
-	if _, err = ssa.GetCertificateStatus(serial); err != nil {
+	if _, err = primary.GetCertificateStatus(serial); err != nil {
 		return fmt.Errorf(
 			"Unable to mark certificate %s revoked: cert status not found.", serial)
 	}
@@ -395,11 +424,60 @@ func (ssa *SQLStorageAuthority) MarkCertificateRevoked(serial string, ocspRespon
 		err = errors.New("No certificate updated. Maybe the lock column was off?")
 		return
 	}
+
+	if reasonCode == core.RevocationCode(1) {
+		if err = ssa.blockCertificateKey(tx, serial); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
 	err = tx.Commit()
 
 	return
 }
 
+// blockCertificateKey adds the public key of the certificate with the given
+// serial to the blockedKeys table, so that it will be refused for any future
+// registration or certificate request. It is used when a certificate is
+// revoked for keyCompromise.
+func (ssa *SQLStorageAuthority) blockCertificateKey(tx *gorp.Transaction, serial string) error {
+	certObj, err := tx.Get(core.Certificate{}, serial)
+	if err != nil {
+		return err
+	}
+	if certObj == nil {
+		return fmt.Errorf("No certificate with serial %s", serial)
+	}
+	cert, err := x509.ParseCertificate(certObj.(*core.Certificate).DER)
+	if err != nil {
+		return err
+	}
+	digest, err := core.KeyDigest(cert.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	var existing int64
+	err = tx.SelectOne(
+		&existing,
+		"SELECT count(*) FROM blockedKeys WHERE keyDigest = :keyDigest",
+		map[string]interface{}{"keyDigest": digest},
+	)
+	if err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	ssa.log.Notice(fmt.Sprintf("Blocking key %s of certificate %s revoked for key compromise", digest, serial))
+	return tx.Insert(&core.BlockedKey{
+		KeyDigest:  digest,
+		CertSerial: serial,
+		Added:      ssa.clk.Now(),
+	})
+}
+
 // UpdateRegistration stores an updated Registration
 func (ssa *SQLStorageAuthority) UpdateRegistration(reg core.Registration) error {
 	rm, err := registrationToModel(&reg)
@@ -589,7 +667,22 @@ func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (dig
 		return
 	}
 
-	// TODO Verify that the serial number doesn't yet exist
+	// Serials are random, so the CA relies on us to refuse duplicates. The
+	// primary key on serial would also catch this, but checking first gives a
+	// clearer error.
+	var existing int64
+	err = tx.SelectOne(&existing, "SELECT count(*) FROM certificates WHERE serial = :serial",
+		map[string]interface{}{"serial": serial})
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if existing > 0 {
+		tx.Rollback()
+		err = fmt.Errorf("Certificate with serial %s already exists", serial)
+		return
+	}
+
 	err = tx.Insert(cert)
 	if err != nil {
 		tx.Rollback()
@@ -625,3 +718,21 @@ func (ssa *SQLStorageAuthority) AlreadyDeniedCSR(names []string) (already bool,
 
 	return
 }
+
+// KeyBlocked is used to determine if a public key, identified by the digest
+// computed by core.KeyDigest, has been blocked due to key compromise. Like
+// AlreadyDeniedCSR, it reads from the primary, so that a key blocked a
+// moment ago can't slip through a lagging replica.
+func (ssa *SQLStorageAuthority) KeyBlocked(keyDigest string) (blocked bool, err error) {
+	var count int64
+	err = ssa.dbMap.SelectOne(
+		&count,
+		"SELECT count(*) FROM blockedKeys WHERE keyDigest = :keyDigest",
+		map[string]interface{}{"keyDigest": keyDigest},
+	)
+	if err != nil {
+		return
+	}
+	blocked = count > 0
+	return
+}
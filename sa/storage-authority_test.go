@@ -24,7 +24,7 @@ import (
 	"github.com/letsencrypt/boulder/test"
 )
 
-const dbConnStr = "mysql+tcp://boulder@localhost:3306/boulder_sa_test"
+var dbConnStr = test.DBConnect("mysql+tcp://boulder@localhost:3306/boulder_sa_test")
 
 var log = mocks.UseMockLog()
 
@@ -35,6 +35,7 @@ func initSA(t *testing.T) (*SQLStorageAuthority, clock.FakeClock, func()) {
 	if err != nil {
 		t.Fatalf("Failed to create dbMap: %s", err)
 	}
+	satest.MigrateSQLite(t, dbMap, "sa")
 
 	fc := clock.NewFake()
 	fc.Add(1 * time.Hour)
@@ -300,6 +301,9 @@ func TestAddCertificate(t *testing.T) {
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 	test.AssertEquals(t, digest, "qWoItDZmR4P9eFbeYgXXP3SR4ApnkQj8x4LsB_ORKBo")
 
+	_, err = sa.AddCertificate(certDER, reg.ID)
+	test.AssertError(t, err, "Added a certificate with a duplicate serial")
+
 	// Example cert serial is 0x21bd4, so a prefix of all zeroes should fetch it.
 	retrievedCert, err := sa.GetCertificateByShortSerial("0000000000000000")
 	test.AssertNotError(t, err, "Couldn't get www.eff.org.der by short serial")
@@ -456,4 +460,13 @@ func TestMarkCertificateRevoked(t *testing.T) {
 	if ocspResponse != string(fetched.Response) {
 		t.Errorf("OCSPResponse response, expected %#v, got %#v", ocspResponse, string(fetched.Response))
 	}
+
+	// Revoking for keyCompromise blocks the certificate's key
+	cert, err := x509.ParseCertificate(certDER)
+	test.AssertNotError(t, err, "Couldn't parse www.eff.org.der")
+	digest, err := core.KeyDigest(cert.PublicKey)
+	test.AssertNotError(t, err, "Couldn't compute key digest")
+	blocked, err := sa.KeyBlocked(digest)
+	test.AssertNotError(t, err, "KeyBlocked failed")
+	test.Assert(t, blocked, "Key of certificate revoked for key compromise was not blocked")
 }
@@ -193,6 +193,14 @@ else
   run_unit_tests
 fi
 
+#
+# The SA and PA tests again, against in-memory SQLite databases
+#
+
+if [ "${RUN_SQLITE_TESTS}" == "1" ]; then
+  BOULDER_TEST_DB=sqlite run go test -tags sqlite ./sa/... ./policy/... ./migrate/...
+fi
+
 # If the unittests failed, exit before trying to run the integration test.
 if [ ${FAILURE} != 0 ]; then
   echo "--------------------------------------------------"
@@ -7,8 +7,7 @@ function die() {
   exit 1
 }
 
-SERVICES="ca
-sa
+SERVICES="sa
 policy"
 DBENVS="development
 test
@@ -21,7 +20,7 @@ for svc in $SERVICES; do
     mysql -u root -e "drop database if exists \`${db}\`; create database if not exists \`${db}\`; grant all privileges on ${db}.* to 'boulder'@'localhost'" || die "unable to create ${db}"
     echo "created empty ${db} database"
 
-    goose -path=./$svc/_db/ -env=$dbenv up || die "unable to migrate ${db}"
+    go run ./cmd/boulder-migrate/main.go --schema $svc --db-connect "mysql+tcp://boulder@localhost:3306/${db}" up || die "unable to migrate ${db}"
     echo "migrated ${db} database"
   done
 done
@@ -3,9 +3,25 @@ package test
 import (
 	"database/sql"
 	"io"
+	"os"
 	"testing"
 )
 
+// DBConnect returns the DBConnect string tests should use for the MySQL
+// database mysqlConnect, or for an in-memory SQLite database if the
+// BOULDER_TEST_DB environment variable is "sqlite". SQLite needs the tests
+// to be built with "-tags sqlite".
+func DBConnect(mysqlConnect string) string {
+	if usingSQLite() {
+		return "sqlite3://:memory:"
+	}
+	return mysqlConnect
+}
+
+func usingSQLite() bool {
+	return os.Getenv("BOULDER_TEST_DB") == "sqlite"
+}
+
 var (
 	_ CleanUpDB = &sql.DB{}
 )
@@ -67,7 +83,11 @@ func deleteEverythingInAllTables(db CleanUpDB) error {
 // migrations) or the ones describing the internal configuration of
 // the server. To be used only in test code.
 func allTableNamesInDB(db CleanUpDB) ([]string, error) {
-	r, err := db.Query("select table_name from information_schema.tables t where t.table_schema = DATABASE() and t.table_name != 'goose_db_version';")
+	query := "select table_name from information_schema.tables t where t.table_schema = DATABASE() and t.table_name != 'goose_db_version';"
+	if usingSQLite() {
+		query = "select name from sqlite_master where type = 'table' and name not like 'sqlite_%' and name != 'goose_db_version' order by name;"
+	}
+	r, err := db.Query(query)
 	if err != nil {
 		return nil, err
 	}
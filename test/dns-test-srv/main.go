@@ -6,13 +6,107 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net"
+	"os"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
 )
 
+var (
+	rootKeyFile     = flag.String("root-key", "test/dnssec/root.key", "DNSKEY record for the root zone, used as the VA's trust anchor")
+	rootPrivateFile = flag.String("root-private", "test/dnssec/root.private", "Private key for the root zone DNSKEY")
+)
+
+// rootKey and rootPrivate sign every answer to queries with the DNSSEC OK bit
+// set, as if all names lived directly in a signed root zone. Queries for
+// types without an answer get an NSEC record, also signed, proving that the
+// name has no records of that type.
+var (
+	rootKey     *dns.DNSKEY
+	rootPrivate dns.PrivateKey
+)
+
+func loadRootKey() error {
+	keyFile, err := os.Open(*rootKeyFile)
+	if err != nil {
+		return err
+	}
+	defer keyFile.Close()
+	for token := range dns.ParseZone(keyFile, ".", *rootKeyFile) {
+		if token.Error != nil {
+			return token.Error
+		}
+		if key, ok := token.RR.(*dns.DNSKEY); ok {
+			rootKey = key
+		}
+	}
+	if rootKey == nil {
+		return fmt.Errorf("no DNSKEY in %s", *rootKeyFile)
+	}
+
+	privateFile, err := os.Open(*rootPrivateFile)
+	if err != nil {
+		return err
+	}
+	defer privateFile.Close()
+	rootPrivate, err = rootKey.ReadPrivateKey(privateFile, *rootPrivateFile)
+	return err
+}
+
+// sign returns section with an RRSIG by the root key appended for each RRset.
+func sign(section []dns.RR) []dns.RR {
+	rrsets := make(map[uint16][]dns.RR)
+	var order []uint16
+	for _, rr := range section {
+		rtype := rr.Header().Rrtype
+		if _, ok := rrsets[rtype]; !ok {
+			order = append(order, rtype)
+		}
+		rrsets[rtype] = append(rrsets[rtype], rr)
+	}
+	now := time.Now()
+	for _, rtype := range order {
+		sig := &dns.RRSIG{
+			Hdr:        dns.RR_Header{Ttl: 0},
+			Algorithm:  rootKey.Algorithm,
+			KeyTag:     rootKey.KeyTag(),
+			SignerName: rootKey.Hdr.Name,
+			Inception:  uint32(now.Add(-time.Hour).Unix()),
+			Expiration: uint32(now.Add(time.Hour).Unix()),
+		}
+		if err := sig.Sign(rootPrivate, rrsets[rtype]); err != nil {
+			fmt.Printf("dns-srv: Failed to sign %s answer: %s\n", dns.TypeToString[rtype], err)
+			continue
+		}
+		section = append(section, sig)
+	}
+	return section
+}
+
+// denyType returns an NSEC record for name listing only the types the server
+// answers for, which proves that it has no records of any other type.
+func denyType(name string) *dns.NSEC {
+	types := []uint16{dns.TypeA, dns.TypeMX, dns.TypeRRSIG, dns.TypeNSEC}
+	next := "\\000." + name
+	if name == "." {
+		types = append(types, dns.TypeDNSKEY)
+		next = "\\000."
+	}
+	return &dns.NSEC{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeNSEC,
+			Class:  dns.ClassINET,
+			Ttl:    0,
+		},
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+}
+
 func dnsHandler(w dns.ResponseWriter, r *dns.Msg) {
 	defer w.Close()
 	m := new(dns.Msg)
@@ -45,9 +139,24 @@ func dnsHandler(w dns.ResponseWriter, r *dns.Msg) {
 			record.Preference = 10
 
 			m.Answer = append(m.Answer, record)
+		case dns.TypeDNSKEY:
+			if q.Name == "." {
+				m.Answer = append(m.Answer, rootKey)
+			}
 		}
 	}
 
+	if opt := r.IsEdns0(); opt != nil && opt.Do() {
+		m.SetEdns0(4096, true)
+		if len(m.Answer) == 0 {
+			for _, q := range r.Question {
+				m.Ns = append(m.Ns, denyType(q.Name))
+			}
+		}
+		m.Answer = sign(m.Answer)
+		m.Ns = sign(m.Ns)
+	}
+
 	w.WriteMsg(m)
 	return
 }
@@ -70,6 +179,11 @@ func serveTestResolver() {
 }
 
 func main() {
+	flag.Parse()
+	if err := loadRootKey(); err != nil {
+		fmt.Printf("dns-srv: Failed to load root key: %s\n", err)
+		os.Exit(1)
+	}
 	fmt.Println("dns-srv: Starting test DNS server")
 	serveTestResolver()
 	forever := make(chan bool, 1)
@@ -17,15 +17,20 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
 
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mail"
 	"github.com/letsencrypt/boulder/policy"
 )
 
@@ -34,12 +39,25 @@ const maxRedirect = 10
 
 var validationTimeout = time.Second * 5
 
+// attemptDeadline returns when a network operation started now must give up:
+// after validationTimeout, or at deadline if that comes first. A zero
+// deadline sets no limit of its own.
+func attemptDeadline(deadline time.Time) time.Time {
+	end := time.Now().Add(validationTimeout)
+	if !deadline.IsZero() && deadline.Before(end) {
+		return deadline
+	}
+	return end
+}
+
 // Returned by CheckCAARecords if it has to follow too many
 // consecutive CNAME lookups.
 var ErrTooManyCNAME = errors.New("too many CNAME/DNAME lookups")
 
 // ValidationAuthorityImpl represents a VA
 type ValidationAuthorityImpl struct {
+	// RA is told the outcome of each validation. Once workers are running,
+	// it and RemoteVAs must only be replaced through SetClients.
 	RA              core.RegistrationAuthority
 	log             *blog.AuditLogger
 	DNSResolver     core.DNSResolver
@@ -47,7 +65,65 @@ type ValidationAuthorityImpl struct {
 	simpleHTTPPort  int
 	simpleHTTPSPort int
 	dvsniPort       int
+	tlsSNIPort      int
 	UserAgent       string
+	// AllowLoopbackAddresses lets IP addresses be dialed on the loopback
+	// interface, for testing.
+	AllowLoopbackAddresses bool
+	// Mailer, if set, sends CAA iodef incident reports
+	Mailer mail.Mailer
+
+	// iodefSent records when a report was last sent for each hostname, so
+	// that repeated checks of a refused name don't each send one.
+	iodefSent map[string]time.Time
+	iodefMu   sync.Mutex
+	clk       clock.Clock
+
+	// RemoteVAs repeat each validation and CAA check from other network
+	// locations, so that an attacker near this VA cannot fool it alone.
+	RemoteVAs []RemoteVA
+	// Quorum is the number of perspectives, counting this VA, that must
+	// agree. Zero means a majority of all perspectives.
+	Quorum int
+
+	// clientsMu guards RA and RemoteVAs, which are replaced whenever the
+	// AMQP connection they use is re-established.
+	clientsMu sync.RWMutex
+
+	queue QueueConfig
+	jobs  chan validationJob
+	stats statsd.Statter
+}
+
+// PrimaryPerspective names this VA's own vantage point in validation records.
+const PrimaryPerspective = "primary"
+
+// RemoteVA is a ValidationAuthority at another network location, with the
+// name it is recorded under.
+type RemoteVA struct {
+	core.ValidationAuthority
+	Name string
+}
+
+// SetClients replaces RA and RemoteVAs. It may be called while validations
+// are running.
+func (va *ValidationAuthorityImpl) SetClients(ra core.RegistrationAuthority, remotes []RemoteVA) {
+	va.clientsMu.Lock()
+	defer va.clientsMu.Unlock()
+	va.RA = ra
+	va.RemoteVAs = remotes
+}
+
+func (va *ValidationAuthorityImpl) registrationAuthority() core.RegistrationAuthority {
+	va.clientsMu.RLock()
+	defer va.clientsMu.RUnlock()
+	return va.RA
+}
+
+func (va *ValidationAuthorityImpl) remoteVAs() []RemoteVA {
+	va.clientsMu.RLock()
+	defer va.clientsMu.RUnlock()
+	return va.RemoteVAs
 }
 
 // PortConfig specifies what ports the VA should call to on the remote
@@ -56,6 +132,7 @@ type PortConfig struct {
 	SimpleHTTPPort  int
 	SimpleHTTPSPort int
 	DVSNIPort       int
+	TLSSNIPort      int
 }
 
 // NewValidationAuthorityImpl constructs a new VA
@@ -67,6 +144,9 @@ func NewValidationAuthorityImpl(pc *PortConfig) *ValidationAuthorityImpl {
 		simpleHTTPPort:  pc.SimpleHTTPPort,
 		simpleHTTPSPort: pc.SimpleHTTPSPort,
 		dvsniPort:       pc.DVSNIPort,
+		tlsSNIPort:      pc.TLSSNIPort,
+		iodefSent:       make(map[string]time.Time),
+		clk:             clock.Default(),
 	}
 }
 
@@ -118,8 +198,12 @@ func verifyValidationJWS(validation *jose.JsonWebSignature, accountKey *jose.Jso
 // problemDetailsFromDNSError checks the error returned from Lookup...
 // methods and tests if the error was an underlying net.OpError or an error
 // caused by resolver returning SERVFAIL or other invalid Rcodes and returns
-// the relevant core.ProblemDetails.
+// the relevant core.ProblemDetails. DNSSEC validation failures get their own
+// problem type.
 func problemDetailsFromDNSError(err error) *core.ProblemDetails {
+	if dnssecErr, ok := err.(core.DNSSECError); ok {
+		return &core.ProblemDetails{Type: core.DNSSECProblem, Detail: dnssecErr.Error()}
+	}
 	problem := &core.ProblemDetails{Type: core.ConnectionProblem}
 	if netErr, ok := err.(*net.OpError); ok {
 		if netErr.Timeout() {
@@ -133,82 +217,189 @@ func problemDetailsFromDNSError(err error) *core.ProblemDetails {
 	return problem
 }
 
-// getAddr will query for all A records associated with hostname and return the
-// prefered address, the first net.IP in the addrs slice, and all addresses resolved.
-// This is the same choice made by the Go internal resolution library used by
-// net/http, except we only send A queries and accept IPv4 addresses.
-// TODO(#593): Add IPv6 support
-func (va *ValidationAuthorityImpl) getAddr(hostname string) (addr net.IP, addrs []net.IP, problem *core.ProblemDetails) {
+// getAddrs will query for all A and AAAA records associated with hostname and
+// return the addresses to try in order of preference, and all addresses
+// resolved. The first IPv6 address is preferred, with the first IPv4 address
+// as a fallback if connecting to it fails.
+func (va *ValidationAuthorityImpl) getAddrs(hostname string) (preferred []net.IP, addrs []net.IP, problem *core.ProblemDetails) {
 	addrs, _, err := va.DNSResolver.LookupHost(hostname)
 	if err != nil {
 		problem = problemDetailsFromDNSError(err)
 		va.log.Debug(fmt.Sprintf("%s DNS failure: %s", hostname, err))
 		return
 	}
+	var usable []net.IP
+	for _, addr := range addrs {
+		if ipNet := va.reservedIPNet(addr); ipNet != nil {
+			va.log.Debug(fmt.Sprintf("%s resolved to %s in the reserved range %s, skipping it", hostname, addr, ipNet))
+			continue
+		}
+		usable = append(usable, addr)
+	}
+	addrs = usable
 	if len(addrs) == 0 {
 		problem = &core.ProblemDetails{
 			Type:   core.UnknownHostProblem,
-			Detail: fmt.Sprintf("No IPv4 addresses found for %s", hostname),
+			Detail: fmt.Sprintf("No valid IP addresses found for %s", hostname),
 		}
 		return
 	}
-	addr = addrs[0]
-	va.log.Info(fmt.Sprintf("Resolved addresses for %s [using %s]: %s", hostname, addr, addrs))
+	preferred = preferredAddrs(addrs)
+	va.log.Info(fmt.Sprintf("Resolved addresses for %s [using %s]: %s", hostname, preferred, addrs))
 	return
 }
 
+// reservedIPNet returns the reserved range that ip is in, which the VA won't
+// connect to, or nil if it may. Loopback addresses are allowed when
+// AllowLoopbackAddresses is set.
+func (va *ValidationAuthorityImpl) reservedIPNet(ip net.IP) *net.IPNet {
+	if va.AllowLoopbackAddresses && ip.IsLoopback() {
+		return nil
+	}
+	return policy.ReservedIPNet(ip)
+}
+
+// preferredAddrs picks the first IPv6 address followed by the first IPv4
+// address from addrs.
+func preferredAddrs(addrs []net.IP) []net.IP {
+	var v4, v6 net.IP
+	for _, addr := range addrs {
+		if addr.To4() != nil {
+			if v4 == nil {
+				v4 = addr
+			}
+		} else if v6 == nil {
+			v6 = addr
+		}
+	}
+	var preferred []net.IP
+	if v6 != nil {
+		preferred = append(preferred, v6)
+	}
+	if v4 != nil {
+		preferred = append(preferred, v4)
+	}
+	return preferred
+}
+
+// dialer connects to the preferred addresses of a host in turn, recording
+// each attempt and the address finally used. Connections are not made, and
+// stop reading and writing, past deadline.
 type dialer struct {
-	record core.ValidationRecord
+	record    core.ValidationRecord
+	preferred []net.IP
+	deadline  time.Time
 }
 
 func (d *dialer) Dial(_, _ string) (net.Conn, error) {
-	realDialer := net.Dialer{Timeout: validationTimeout}
-	return realDialer.Dial("tcp", net.JoinHostPort(d.record.AddressUsed.String(), d.record.Port))
+	// Each address gets an equal share of the timeout, so falling back
+	// doesn't outlast the validation
+	end := attemptDeadline(d.deadline)
+	realDialer := net.Dialer{
+		Timeout:  end.Sub(time.Now()) / time.Duration(len(d.preferred)),
+		Deadline: end,
+	}
+	var err error
+	for _, addr := range d.preferred {
+		d.record.AddressesTried = append(d.record.AddressesTried, addr)
+		var conn net.Conn
+		conn, err = realDialer.Dial("tcp", net.JoinHostPort(addr.String(), d.record.Port))
+		if err == nil {
+			d.record.AddressUsed = addr
+			conn.SetDeadline(end)
+			return conn, nil
+		}
+	}
+	return nil, err
 }
 
-// resolveAndConstructDialer gets the prefered address using va.getAddr and returns
-// the chosen address and dialer for that address and correct port.
-func (va *ValidationAuthorityImpl) resolveAndConstructDialer(name, defaultPort string) (dialer, *core.ProblemDetails) {
+// DialTLS connects like Dial and completes a TLS handshake using config.
+func (d *dialer) DialTLS(config *tls.Config) (*tls.Conn, error) {
+	conn, err := d.Dial("tcp", "")
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err = tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// resolveAndConstructDialer gets the prefered addresses using va.getAddrs and
+// returns a dialer for those addresses and correct port.
+func (va *ValidationAuthorityImpl) resolveAndConstructDialer(name, defaultPort string) (*dialer, *core.ProblemDetails) {
 	port := fmt.Sprintf("%d", va.simpleHTTPPort)
 	if defaultPort != "" {
 		port = defaultPort
 	}
-	d := dialer{
+	d := &dialer{
 		record: core.ValidationRecord{
 			Hostname: name,
 			Port:     port,
 		},
 	}
 
-	addr, allAddrs, err := va.getAddr(name)
+	preferred, allAddrs, err := va.getAddrs(name)
 	if err != nil {
 		return d, err
 	}
 	d.record.AddressesResolved = allAddrs
-	d.record.AddressUsed = addr
+	d.preferred = preferred
 	return d, nil
 }
 
-// Validation methods
-
-func (va *ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge, error) {
-	challenge := input
-
-	if identifier.Type != core.IdentifierDNS {
-		challenge.Status = core.StatusInvalid
-		challenge.Error = &core.ProblemDetails{
+// constructDialer returns a dialer for the identifier being validated, or
+// for a host it redirected to. IP addresses are dialed directly rather than
+// looked up in DNS, and refused if they are in a reserved range, as the PA
+// does for IP address identifiers.
+func (va *ValidationAuthorityImpl) constructDialer(identifier core.AcmeIdentifier, port string) (*dialer, *core.ProblemDetails) {
+	if identifier.Type != core.IdentifierIP {
+		return va.resolveAndConstructDialer(identifier.Value, port)
+	}
+	if port == "" {
+		port = fmt.Sprintf("%d", va.simpleHTTPPort)
+	}
+	d := &dialer{
+		record: core.ValidationRecord{
+			Hostname: identifier.Value,
+			Port:     port,
+		},
+	}
+	ip := net.ParseIP(identifier.Value)
+	if ip == nil {
+		return d, &core.ProblemDetails{
 			Type:   core.MalformedProblem,
-			Detail: "Identifier type for SimpleHTTP was not DNS",
+			Detail: fmt.Sprintf("Invalid IP address identifier %q", identifier.Value),
 		}
-
-		va.log.Debug(fmt.Sprintf("SimpleHTTP [%s] Identifier failure", identifier))
-		return challenge, challenge.Error
 	}
+	if ipNet := va.reservedIPNet(ip); ipNet != nil {
+		return d, &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: fmt.Sprintf("%s is in the reserved range %s", ip, ipNet),
+		}
+	}
+	d.record.AddressesResolved = []net.IP{ip}
+	d.preferred = []net.IP{ip}
+	return d, nil
+}
+
+// Validation methods
+
+// fetchHTTP fetches the challenge response for the challenge token from the
+// identifier, following redirects, and returns the response body. Every
+// request, including redirects, is recorded in the challenge's
+// ValidationRecord. If strictRedirects is set, redirects are only followed to
+// http and https URLs on the configured validation ports. On failure the
+// returned challenge is marked invalid. No connection outlives deadline.
+func (va *ValidationAuthorityImpl) fetchHTTP(identifier core.AcmeIdentifier, useTLS, strictRedirects bool, input core.Challenge, deadline time.Time) ([]byte, core.Challenge, error) {
+	challenge := input
 
 	host := identifier.Value
 	var scheme string
 	var port int
-	if input.TLS == nil || (input.TLS != nil && *input.TLS) {
+	if useTLS {
 		scheme = "https"
 		port = va.simpleHTTPSPort
 	} else {
@@ -221,20 +412,24 @@ func (va *ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdenti
 	url := &url.URL{
 		Scheme: scheme,
 		Host:   hostPort,
-		Path:   fmt.Sprintf(".well-known/acme-challenge/%s", challenge.Token),
+		Path:   fmt.Sprintf("%s/%s", core.HTTPChallengePath, challenge.Token),
 	}
 
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-	va.log.Audit(fmt.Sprintf("Attempting to validate Simple%s for %s", strings.ToUpper(scheme), url))
+	if challenge.Type == core.ChallengeTypeSimpleHTTP {
+		va.log.Audit(fmt.Sprintf("Attempting to validate Simple%s for %s", strings.ToUpper(scheme), url))
+	} else {
+		va.log.Audit(fmt.Sprintf("Attempting to validate %s for %s", challenge.Type, url))
+	}
 	httpRequest, err := http.NewRequest("GET", url.String(), nil)
 	if err != nil {
 		challenge.Error = &core.ProblemDetails{
 			Type:   core.MalformedProblem,
-			Detail: "URL provided for SimpleHTTP was invalid",
+			Detail: fmt.Sprintf("URL provided for %s was invalid", challenge.Type),
 		}
-		va.log.Debug(fmt.Sprintf("SimpleHTTP [%s] HTTP failure: %s", identifier, err))
+		va.log.Debug(fmt.Sprintf("%s [%s] HTTP failure: %s", challenge.Type, identifier, err))
 		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return nil, challenge, err
 	}
 
 	if va.UserAgent != "" {
@@ -242,13 +437,19 @@ func (va *ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdenti
 	}
 
 	httpRequest.Host = hostPort
-	dialer, prob := va.resolveAndConstructDialer(host, portString)
+	// Dialers fill in the addresses they tried once the request is made, so
+	// their records are copied back into the challenge afterwards
+	firstRecord := len(challenge.ValidationRecord)
+	var dialers []*dialer
+	dialer, prob := va.constructDialer(identifier, portString)
+	dialer.deadline = deadline
 	dialer.record.URL = url.String()
+	dialers = append(dialers, dialer)
 	challenge.ValidationRecord = append(challenge.ValidationRecord, dialer.record)
 	if prob != nil {
 		challenge.Status = core.StatusInvalid
 		challenge.Error = prob
-		return challenge, prob
+		return nil, challenge, prob
 	}
 
 	tr := &http.Transport{
@@ -268,14 +469,20 @@ func (va *ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdenti
 			return fmt.Errorf("Too many redirects")
 		}
 
+		reqScheme := strings.ToLower(req.URL.Scheme)
+		if strictRedirects && reqScheme != "http" && reqScheme != "https" {
+			return fmt.Errorf("Invalid scheme in redirect: %q", req.URL.Scheme)
+		}
+
 		reqHost := req.URL.Host
 		reqPort := ""
-		if strings.Contains(reqHost, ":") {
-			splitHost := strings.SplitN(reqHost, ":", 2)
-			if len(splitHost) <= 1 {
+		// A colon after any IPv6 literal's closing bracket starts the port
+		if strings.LastIndex(reqHost, ":") > strings.LastIndex(reqHost, "]") {
+			var err error
+			reqHost, reqPort, err = net.SplitHostPort(reqHost)
+			if err != nil {
 				return fmt.Errorf("Malformed host")
 			}
-			reqHost, reqPort = splitHost[0], splitHost[1]
 			portNum, err := strconv.Atoi(reqPort)
 			if err != nil {
 				return err
@@ -283,26 +490,43 @@ func (va *ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdenti
 			if portNum < 0 || portNum > 65535 {
 				return fmt.Errorf("Invalid port number in redirect")
 			}
-		} else if strings.ToLower(req.URL.Scheme) == "https" {
-			reqPort = "443"
+			if strictRedirects && portNum != va.simpleHTTPPort && portNum != va.simpleHTTPSPort {
+				return fmt.Errorf("Redirect to port %d is not allowed", portNum)
+			}
+		} else {
+			reqHost = strings.TrimSuffix(strings.TrimPrefix(reqHost, "["), "]")
+			if reqScheme == "https" {
+				reqPort = "443"
+			}
 		}
 
-		dialer, err := va.resolveAndConstructDialer(reqHost, reqPort)
+		// Redirects to IP literals are dialed directly, after the same
+		// checks as IP address identifiers
+		reqIdentifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: reqHost}
+		if net.ParseIP(reqHost) != nil {
+			reqIdentifier.Type = core.IdentifierIP
+		}
+		dialer, err := va.constructDialer(reqIdentifier, reqPort)
+		dialer.deadline = deadline
 		dialer.record.URL = req.URL.String()
+		dialers = append(dialers, dialer)
 		challenge.ValidationRecord = append(challenge.ValidationRecord, dialer.record)
 		if err != nil {
 			return err
 		}
 		tr.Dial = dialer.Dial
-		va.log.Info(fmt.Sprintf("validateSimpleHTTP [%s] redirect from %q to %q [%s]", identifier, via[len(via)-1].URL.String(), req.URL.String(), dialer.record.AddressUsed))
+		va.log.Info(fmt.Sprintf("%s [%s] redirect from %q to %q %s", challenge.Type, identifier, via[len(via)-1].URL.String(), req.URL.String(), dialer.preferred))
 		return nil
 	}
 	client := http.Client{
 		Transport:     tr,
 		CheckRedirect: logRedirect,
-		Timeout:       validationTimeout,
+		Timeout:       attemptDeadline(deadline).Sub(time.Now()),
 	}
 	httpResponse, err := client.Do(httpRequest)
+	for i, d := range dialers {
+		challenge.ValidationRecord[firstRecord+i] = d.record
+	}
 	if err != nil {
 		challenge.Status = core.StatusInvalid
 		challenge.Error = &core.ProblemDetails{
@@ -310,29 +534,50 @@ func (va *ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdenti
 			Detail: fmt.Sprintf("Could not connect to %s", url),
 		}
 		va.log.Debug(strings.Join([]string{challenge.Error.Error(), err.Error()}, ": "))
-		return challenge, err
+		return nil, challenge, err
 	}
+	defer httpResponse.Body.Close()
 
 	if httpResponse.StatusCode != 200 {
 		challenge.Status = core.StatusInvalid
 		challenge.Error = &core.ProblemDetails{
 			Type: core.UnauthorizedProblem,
 			Detail: fmt.Sprintf("Invalid response from %s [%s]: %d",
-				url.String(), dialer.record.AddressUsed, httpResponse.StatusCode),
+				url.String(), dialers[len(dialers)-1].record.AddressUsed, httpResponse.StatusCode),
 		}
-		err = challenge.Error
-		return challenge, err
+		return nil, challenge, challenge.Error
 	}
 
-	// Read body & test
-	body, readErr := ioutil.ReadAll(httpResponse.Body)
-	if readErr != nil {
+	body, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
 		challenge.Status = core.StatusInvalid
 		challenge.Error = &core.ProblemDetails{
 			Type:   core.UnauthorizedProblem,
 			Detail: fmt.Sprintf("Error reading HTTP response body"),
 		}
-		return challenge, readErr
+		return nil, challenge, err
+	}
+	return body, challenge, nil
+}
+
+func (va *ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentifier, input core.Challenge, deadline time.Time) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS && identifier.Type != core.IdentifierIP {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: "Identifier type for SimpleHTTP was not DNS or IP",
+		}
+
+		va.log.Debug(fmt.Sprintf("SimpleHTTP [%s] Identifier failure", identifier))
+		return challenge, challenge.Error
+	}
+
+	useTLS := input.TLS == nil || *input.TLS
+	body, challenge, err := va.fetchHTTP(identifier, useTLS, false, challenge, deadline)
+	if err != nil {
+		return challenge, err
 	}
 
 	// Parse and verify JWS
@@ -372,13 +617,63 @@ func (va *ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdenti
 	return challenge, nil
 }
 
-func (va *ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge, error) {
+func (va *ValidationAuthorityImpl) validateHTTP01(identifier core.AcmeIdentifier, input core.Challenge, deadline time.Time) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS && identifier.Type != core.IdentifierIP {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: "Identifier type for http-01 was not DNS or IP",
+		}
+
+		va.log.Debug(fmt.Sprintf("http-01 [%s] Identifier failure", identifier))
+		return challenge, challenge.Error
+	}
+
+	// Compute the key authorization we expect from the account key, rather
+	// than trusting the one the client provided
+	expected, err := core.NewKeyAuthorization(challenge.Token, challenge.AccountKey)
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: "Could not compute key authorization",
+		}
+		va.log.Debug(fmt.Sprintf("http-01 [%s] Key authorization failure: %s", identifier, err))
+		return challenge, err
+	}
+
+	body, challenge, err := va.fetchHTTP(identifier, false, true, challenge, deadline)
+	if err != nil {
+		return challenge, err
+	}
+
+	// Servers commonly append a newline, so surrounding whitespace is ignored
+	payload := strings.TrimSpace(string(body))
+	if subtle.ConstantTimeCompare([]byte(payload), []byte(expected.String())) != 1 {
+		err = fmt.Errorf("The key authorization file from the server did not match this challenge [%v] != [%v]",
+			expected.String(), payload)
+		va.log.Debug(err.Error())
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: err.Error(),
+		}
+		return challenge, err
+	}
+
+	challenge.Status = core.StatusValid
+	return challenge, nil
+}
+
+func (va *ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier, input core.Challenge, deadline time.Time) (core.Challenge, error) {
 	challenge := input
 
-	if identifier.Type != "dns" {
+	if identifier.Type != core.IdentifierDNS && identifier.Type != core.IdentifierIP {
 		challenge.Error = &core.ProblemDetails{
 			Type:   core.MalformedProblem,
-			Detail: "Identifier type for DVSNI was not DNS",
+			Detail: "Identifier type for DVSNI was not DNS or IP",
 		}
 		challenge.Status = core.StatusInvalid
 		va.log.Debug(fmt.Sprintf("DVSNI [%s] Identifier failure", identifier))
@@ -410,54 +705,57 @@ func (va *ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 	Z := hex.EncodeToString(h.Sum(nil))
 	ZName := fmt.Sprintf("%s.%s.%s", Z[:32], Z[32:], core.DVSNISuffix)
 
-	addr, allAddrs, problem := va.getAddr(identifier.Value)
-	challenge.ValidationRecord = []core.ValidationRecord{
-		core.ValidationRecord{
-			Hostname:          identifier.Value,
-			AddressesResolved: allAddrs,
-			AddressUsed:       addr,
-		},
-	}
+	return va.validateSNI(identifier, challenge, ZName, va.dvsniPort, "DVSNI", deadline)
+}
+
+// validateSNI connects to the identifier on the given port with SNI set to
+// zName and checks that zName is a dNSName SAN in the certificate presented.
+// challengeName is used in log lines and problem details.
+func (va *ValidationAuthorityImpl) validateSNI(identifier core.AcmeIdentifier, input core.Challenge, zName string, port int, challengeName string, deadline time.Time) (core.Challenge, error) {
+	challenge := input
+
+	portString := fmt.Sprintf("%d", port)
+	dialer, problem := va.constructDialer(identifier, portString)
+	dialer.deadline = deadline
 	if problem != nil {
+		challenge.ValidationRecord = []core.ValidationRecord{dialer.record}
 		challenge.Status = core.StatusInvalid
 		challenge.Error = problem
 		return challenge, challenge.Error
 	}
 
-	// Make a connection with SNI = nonceName
-	portString := fmt.Sprintf("%d", va.dvsniPort)
-	hostPort := net.JoinHostPort(addr.String(), portString)
-	challenge.ValidationRecord[0].Port = portString
-	va.log.Notice(fmt.Sprintf("DVSNI [%s] Attempting to validate DVSNI for %s %s",
-		identifier, hostPort, ZName))
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: validationTimeout}, "tcp", hostPort, &tls.Config{
-		ServerName:         ZName,
+	// Make a connection with SNI = zName
+	va.log.Notice(fmt.Sprintf("%s [%s] Attempting to validate %s for %s %s",
+		challengeName, identifier, challengeName, net.JoinHostPort(identifier.Value, portString), zName))
+	conn, err := dialer.DialTLS(&tls.Config{
+		ServerName:         zName,
 		InsecureSkipVerify: true,
 	})
+	challenge.ValidationRecord = []core.ValidationRecord{dialer.record}
 
 	if err != nil {
 		challenge.Status = core.StatusInvalid
 		challenge.Error = &core.ProblemDetails{
 			Type:   parseHTTPConnError(err),
-			Detail: "Failed to connect to host for DVSNI challenge",
+			Detail: "Failed to connect to host for " + challengeName + " challenge",
 		}
-		va.log.Debug(fmt.Sprintf("DVSNI [%s] TLS Connection failure: %s", identifier, err))
+		va.log.Debug(fmt.Sprintf("%s [%s] TLS Connection failure: %s", challengeName, identifier, err))
 		return challenge, err
 	}
 	defer conn.Close()
 
-	// Check that ZName is a dNSName SAN in the server's certificate
+	// Check that zName is a dNSName SAN in the server's certificate
 	certs := conn.ConnectionState().PeerCertificates
 	if len(certs) == 0 {
 		challenge.Error = &core.ProblemDetails{
 			Type:   core.UnauthorizedProblem,
-			Detail: "No certs presented for DVSNI challenge",
+			Detail: "No certs presented for " + challengeName + " challenge",
 		}
 		challenge.Status = core.StatusInvalid
 		return challenge, challenge.Error
 	}
 	for _, name := range certs[0].DNSNames {
-		if subtle.ConstantTimeCompare([]byte(name), []byte(ZName)) == 1 {
+		if subtle.ConstantTimeCompare([]byte(name), []byte(zName)) == 1 {
 			challenge.Status = core.StatusValid
 			return challenge, nil
 		}
@@ -465,12 +763,41 @@ func (va *ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 
 	challenge.Error = &core.ProblemDetails{
 		Type:   core.UnauthorizedProblem,
-		Detail: "Correct ZName not found for DVSNI challenge",
+		Detail: "Correct ZName not found for " + challengeName + " challenge",
 	}
 	challenge.Status = core.StatusInvalid
 	return challenge, challenge.Error
 }
 
+func (va *ValidationAuthorityImpl) validateTLSSNI01(identifier core.AcmeIdentifier, input core.Challenge, deadline time.Time) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS && identifier.Type != core.IdentifierIP {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: "Identifier type for tls-sni-01 was not DNS or IP",
+		}
+		va.log.Debug(fmt.Sprintf("tls-sni-01 [%s] Identifier failure", identifier))
+		return challenge, challenge.Error
+	}
+
+	// Compute the key authorization we expect from the account key, rather
+	// than trusting the one the client provided
+	expected, err := core.NewKeyAuthorization(challenge.Token, challenge.AccountKey)
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: "Could not compute key authorization",
+		}
+		va.log.Debug(fmt.Sprintf("tls-sni-01 [%s] Key authorization failure: %s", identifier, err))
+		return challenge, err
+	}
+
+	return va.validateSNI(identifier, challenge, expected.TLSSNIName(), va.tlsSNIPort, "tls-sni-01", deadline)
+}
+
 // parseHTTPConnError returns the ACME ProblemType corresponding to an error
 // that occurred during domain validation.
 func parseHTTPConnError(err error) core.ProblemType {
@@ -527,6 +854,9 @@ func (va *ValidationAuthorityImpl) validateDNS(identifier core.AcmeIdentifier, i
 
 	// Look for the required record in the DNS
 	challengeSubdomain := fmt.Sprintf("%s.%s", core.DNSPrefix, identifier.Value)
+	challenge.ValidationRecord = []core.ValidationRecord{
+		core.ValidationRecord{Hostname: challengeSubdomain},
+	}
 	txts, _, err := va.DNSResolver.LookupTXT(challengeSubdomain)
 
 	if err != nil {
@@ -553,55 +883,152 @@ func (va *ValidationAuthorityImpl) validateDNS(identifier core.AcmeIdentifier, i
 
 // Overall validation process
 
+// validateChallenge checks the sanity of a challenge and validates it from
+// this VA's vantage point only, without connecting past deadline.
+func (va *ValidationAuthorityImpl) validateChallenge(identifier core.AcmeIdentifier, input core.Challenge, deadline time.Time) (core.Challenge, error) {
+	challenge := input
+	if !challenge.IsSane(true) {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{Type: core.MalformedProblem,
+			Detail: fmt.Sprintf("Challenge failed sanity check.")}
+		return challenge, errors.New(challenge.Error.Detail)
+	}
+
+	var err error
+	switch challenge.Type {
+	case core.ChallengeTypeSimpleHTTP:
+		challenge, err = va.validateSimpleHTTP(identifier, challenge, deadline)
+	case core.ChallengeTypeHTTP01:
+		challenge, err = va.validateHTTP01(identifier, challenge, deadline)
+	case core.ChallengeTypeDVSNI:
+		challenge, err = va.validateDvsni(identifier, challenge, deadline)
+	case core.ChallengeTypeTLSSNI01:
+		challenge, err = va.validateTLSSNI01(identifier, challenge, deadline)
+	case core.ChallengeTypeDNS:
+		challenge, err = va.validateDNS(identifier, challenge)
+	}
+	if err != nil {
+		return challenge, err
+	}
+
+	if !challenge.RecordsSane() {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{Type: core.ServerInternalProblem,
+			Detail: "Records for validation failed sanity check"}
+		return challenge, errors.New(challenge.Error.Detail)
+	}
+	return challenge, nil
+}
+
+// quorum returns the number of perspectives, counting this VA, that must
+// agree before a validation or CAA check is accepted, given the number of
+// remote VAs.
+func (va *ValidationAuthorityImpl) quorum(remotes int) int {
+	if va.Quorum > 0 {
+		return va.Quorum
+	}
+	return (remotes+1)/2 + 1
+}
+
+// remoteValidations validates input from every remote VA concurrently and
+// returns the sorted names of those that succeeded.
+func (va *ValidationAuthorityImpl) remoteValidations(remotes []RemoteVA, identifier core.AcmeIdentifier, input core.Challenge) []string {
+	results := make(chan string, len(remotes))
+	for _, remote := range remotes {
+		go func(remote RemoteVA) {
+			challenge, err := remote.PerformValidation(identifier, input)
+			if err != nil || challenge.Status != core.StatusValid {
+				va.log.Info(fmt.Sprintf("Remote VA %s failed to validate %s: %v", remote.Name, identifier, err))
+				results <- ""
+				return
+			}
+			results <- remote.Name
+		}(remote)
+	}
+
+	var passed []string
+	for range remotes {
+		if name := <-results; name != "" {
+			passed = append(passed, name)
+		}
+	}
+	sort.Strings(passed)
+	return passed
+}
+
+// checkPerspectives repeats a successful local validation from the remote
+// VAs and fails it unless a quorum of perspectives agree. The perspectives
+// that passed are noted on the last validation record.
+func (va *ValidationAuthorityImpl) checkPerspectives(remotes []RemoteVA, identifier core.AcmeIdentifier, input, challenge core.Challenge) (core.Challenge, error) {
+	passed := append([]string{PrimaryPerspective}, va.remoteValidations(remotes, identifier, input)...)
+	if n := len(challenge.ValidationRecord); n > 0 {
+		challenge.ValidationRecord[n-1].Perspectives = passed
+	}
+
+	if len(passed) < va.quorum(len(remotes)) {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type: core.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Validation succeeded from %d of %d perspectives, %d required",
+				len(passed), len(remotes)+1, va.quorum(len(remotes))),
+		}
+		va.log.Debug(fmt.Sprintf("%s [%s] Quorum failure: %s", challenge.Type, identifier, passed))
+		return challenge, challenge.Error
+	}
+	return challenge, nil
+}
+
 func (va *ValidationAuthorityImpl) validate(authz core.Authorization, challengeIndex int) {
 	logEvent := verificationRequestEvent{
 		ID:          authz.ID,
 		Requester:   authz.RegistrationID,
 		RequestTime: time.Now(),
 	}
-	if !authz.Challenges[challengeIndex].IsSane(true) {
-		chall := &authz.Challenges[challengeIndex]
-		chall.Status = core.StatusInvalid
-		chall.Error = &core.ProblemDetails{Type: core.MalformedProblem,
-			Detail: fmt.Sprintf("Challenge failed sanity check.")}
-		logEvent.Challenge = *chall
-		logEvent.Error = chall.Error.Detail
-	} else {
-		var err error
 
-		switch authz.Challenges[challengeIndex].Type {
-		case core.ChallengeTypeSimpleHTTP:
-			authz.Challenges[challengeIndex], err = va.validateSimpleHTTP(authz.Identifier, authz.Challenges[challengeIndex])
-		case core.ChallengeTypeDVSNI:
-			authz.Challenges[challengeIndex], err = va.validateDvsni(authz.Identifier, authz.Challenges[challengeIndex])
-		case core.ChallengeTypeDNS:
-			authz.Challenges[challengeIndex], err = va.validateDNS(authz.Identifier, authz.Challenges[challengeIndex])
-		}
+	challenge, err := va.performValidation(authz.Identifier, authz.Challenges[challengeIndex], time.Time{})
+	va.reportValidation(authz, challengeIndex, challenge, err, logEvent)
+}
 
-		if err != nil {
-			logEvent.Error = err.Error()
-		} else if !authz.Challenges[challengeIndex].RecordsSane() {
-			chall := &authz.Challenges[challengeIndex]
-			chall.Status = core.StatusInvalid
-			chall.Error = &core.ProblemDetails{Type: core.ServerInternalProblem,
-				Detail: "Records for validation failed sanity check"}
-			logEvent.Error = chall.Error.Detail
-		}
-		logEvent.Challenge = authz.Challenges[challengeIndex]
+// performValidation makes a single attempt at validating input, from the
+// remote perspectives as well if there are any. Local connections are given
+// up at deadline, if it isn't zero.
+func (va *ValidationAuthorityImpl) performValidation(identifier core.AcmeIdentifier, input core.Challenge, deadline time.Time) (core.Challenge, error) {
+	challenge, err := va.validateChallenge(identifier, input, deadline)
+	if remotes := va.remoteVAs(); err == nil && len(remotes) > 0 {
+		challenge, err = va.checkPerspectives(remotes, identifier, input, challenge)
+	}
+	return challenge, err
+}
+
+// reportValidation audit logs the outcome of a validation and passes the
+// updated authorization to the RA.
+func (va *ValidationAuthorityImpl) reportValidation(authz core.Authorization, challengeIndex int, challenge core.Challenge, err error, logEvent verificationRequestEvent) {
+	if err != nil {
+		logEvent.Error = err.Error()
 	}
+	authz.Challenges[challengeIndex] = challenge
+	logEvent.Challenge = challenge
 
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 	va.log.AuditObject("Validation result", logEvent)
 
 	va.log.Notice(fmt.Sprintf("Validations: %+v", authz))
 
-	va.RA.OnValidationUpdate(authz)
+	va.registrationAuthority().OnValidationUpdate(authz)
 }
 
-// UpdateValidations runs the validate() method asynchronously using goroutines.
+// PerformValidation validates a challenge from this VA's vantage point only
+// and returns the result without notifying the RA. Primary VAs call it on
+// their remote VAs.
+func (va *ValidationAuthorityImpl) PerformValidation(identifier core.AcmeIdentifier, challenge core.Challenge) (core.Challenge, error) {
+	return va.validateChallenge(identifier, challenge, time.Time{})
+}
+
+// UpdateValidations queues a challenge for the validation workers started by
+// StartWorkers, which report the result to the RA. It fails if the queue is
+// full so that callers back off rather than pile up work.
 func (va *ValidationAuthorityImpl) UpdateValidations(authz core.Authorization, challengeIndex int) error {
-	go va.validate(authz, challengeIndex)
-	return nil
+	return va.enqueue(validationJob{Authz: authz, ChallengeIndex: challengeIndex})
 }
 
 // CAASet consists of filtered CAA records
@@ -647,17 +1074,22 @@ func newCAASet(CAAs []*dns.CAA) *CAASet {
 	return &filtered
 }
 
+// getCAASet returns the relevant CAA record set for hostname, using the
+// algorithm from RFC 6844 section 4: the records at the name itself, otherwise
+// those relevant to its CNAME or DNAME target, otherwise those relevant to its
+// parent. Top-level domains are not queried.
 func (va *ValidationAuthorityImpl) getCAASet(hostname string) (*CAASet, error) {
-	label := strings.TrimRight(hostname, ".")
-	cnames := 0
-	// See RFC 6844 "Certification Authority Processing" for pseudocode.
+	aliases := 0
+	return va.relevantCAASet(strings.TrimRight(hostname, "."), &aliases)
+}
+
+// relevantCAASet implements getCAASet, counting alias lookups across
+// recursive calls so that loops terminate.
+func (va *ValidationAuthorityImpl) relevantCAASet(label string, aliases *int) (*CAASet, error) {
 	for {
 		if strings.IndexRune(label, '.') == -1 {
 			// Reached TLD
-			break
-		}
-		if _, present := policy.PublicSuffixList[label]; present {
-			break
+			return nil, nil
 		}
 		CAAs, _, err := va.DNSResolver.LookupCAA(label)
 		if err != nil {
@@ -666,41 +1098,217 @@ func (va *ValidationAuthorityImpl) getCAASet(hostname string) (*CAASet, error) {
 		if len(CAAs) > 0 {
 			return newCAASet(CAAs), nil
 		}
-		cname, _, err := va.DNSResolver.LookupCNAME(label)
+		target, err := va.caaAlias(label)
 		if err != nil {
 			return nil, err
 		}
-		dname, _, err := va.DNSResolver.LookupDNAME(label)
-		if err != nil {
-			return nil, err
+		if target != "" {
+			if *aliases++; *aliases > maxCNAME {
+				return nil, ErrTooManyCNAME
+			}
+			caaSet, err := va.relevantCAASet(target, aliases)
+			if err != nil || caaSet != nil {
+				return caaSet, err
+			}
 		}
-		if cname == "" && dname == "" {
-			// Try parent domain (note we confirmed
-			// earlier that label contains '.')
-			label = label[strings.IndexRune(label, '.')+1:]
+		// Try parent domain (note we confirmed
+		// earlier that label contains '.')
+		label = label[strings.IndexRune(label, '.')+1:]
+	}
+}
+
+// caaAlias returns the CNAME or DNAME target of label, or "" if it has none.
+func (va *ValidationAuthorityImpl) caaAlias(label string) (string, error) {
+	cname, _, err := va.DNSResolver.LookupCNAME(label)
+	if err != nil {
+		return "", err
+	}
+	dname, _, err := va.DNSResolver.LookupDNAME(label)
+	if err != nil {
+		return "", err
+	}
+	if cname != "" && dname != "" && cname != dname {
+		return "", errors.New("both CNAME and DNAME exist for " + label)
+	}
+	if cname == "" {
+		cname = dname
+	}
+	return strings.TrimRight(cname, "."), nil
+}
+
+// caaIssuer is a parsed issue or issuewild property value: an issuer domain
+// name followed by optional "tag=value" parameters, separated by semicolons
+// (RFC 6844 section 5.2).
+type caaIssuer struct {
+	Domain     string
+	Parameters map[string]string
+}
+
+func parseCAAIssuer(value string) (caaIssuer, error) {
+	parts := strings.Split(value, ";")
+	issuer := caaIssuer{
+		Domain:     strings.ToLower(strings.TrimSpace(parts[0])),
+		Parameters: make(map[string]string),
+	}
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if part == "" {
 			continue
 		}
-		if cname != "" && dname != "" && cname != dname {
-			return nil, errors.New("both CNAME and DNAME exist for " + label)
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return caaIssuer{}, fmt.Errorf("Malformed CAA parameter %q", part)
 		}
-		if cname != "" {
-			label = cname
-		} else {
-			label = dname
+		issuer.Parameters[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return issuer, nil
+}
+
+// authorizes returns true if the record permits issuerDomain to issue for
+// the given account URI and validation method. The "accounturi" and
+// "validationmethods" parameters are only checked when accountURI and method
+// respectively are known.
+func (issuer caaIssuer) authorizes(issuerDomain, accountURI, method string) bool {
+	if issuer.Domain == "" || issuer.Domain != strings.ToLower(issuerDomain) {
+		return false
+	}
+	if uri, ok := issuer.Parameters["accounturi"]; ok && accountURI != "" && uri != accountURI {
+		return false
+	}
+	if methods, ok := issuer.Parameters["validationmethods"]; ok && method != "" {
+		for _, m := range strings.Split(methods, ",") {
+			if strings.TrimSpace(m) == method {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// iodefReportInterval is how long after reporting a refusal for a hostname
+// further refusals for it go unreported.
+const iodefReportInterval = 24 * time.Hour
+
+// reportCAARefusal sends an incident report for hostname to each mailto:
+// iodef URL in caaSet (RFC 6844 section 5.4), unless one was sent within
+// iodefReportInterval. Other iodef schemes are logged and skipped.
+func (va *ValidationAuthorityImpl) reportCAARefusal(hostname string, caaSet *CAASet) {
+	if va.Mailer == nil || caaSet == nil || len(caaSet.Iodef) == 0 {
+		return
+	}
+
+	now := va.clk.Now()
+	va.iodefMu.Lock()
+	for name, sent := range va.iodefSent {
+		if now.Sub(sent) >= iodefReportInterval {
+			delete(va.iodefSent, name)
+		}
+	}
+	_, recent := va.iodefSent[hostname]
+	if !recent {
+		va.iodefSent[hostname] = now
+	}
+	va.iodefMu.Unlock()
+	if recent {
+		va.log.Debug(fmt.Sprintf("CAA [%s] Refusal already reported", hostname))
+		return
+	}
+
+	for _, iodef := range caaSet.Iodef {
+		u, err := url.Parse(iodef.Value)
+		if err != nil || u.Scheme != "mailto" || u.Opaque == "" {
+			va.log.Info(fmt.Sprintf("CAA [%s] Unsupported iodef URL %q", hostname, iodef.Value))
+			continue
 		}
-		if cnames++; cnames > maxCNAME {
-			return nil, ErrTooManyCNAME
+		msg := fmt.Sprintf(caaReportMessage, va.IssuerDomain, hostname)
+		if err = va.Mailer.SendMail([]string{u.Opaque}, msg); err != nil {
+			va.log.Warning(fmt.Sprintf("CAA [%s] Failed to send iodef report to %s: %s", hostname, u.Opaque, err))
 		}
 	}
-	// no CAA records found
-	return nil, nil
 }
 
+const caaReportMessage = `Hello,
+
+A request to %s for a certificate for %s was refused because of
+the CAA records published for that name.
+
+No action is needed if the request was not expected.
+`
+
 // CheckCAARecords verifies that, if the indicated subscriber domain has any CAA
-// records, they authorize the configured CA domain to issue a certificate
-func (va *ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifier) (present, valid bool, err error) {
+// records, they authorize the configured CA domain to issue a certificate. With
+// remote VAs configured, a quorum of perspectives must also find issuance
+// authorized. Refusals are reported to the domain's iodef contacts.
+func (va *ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifier, accountURI, method string) (present, valid bool, err error) {
+	present, valid, caaSet, err := va.checkCAARecords(identifier, accountURI, method)
+	if err != nil {
+		return
+	}
+	if remotes := va.remoteVAs(); valid && len(remotes) > 0 {
+		var remotePresent bool
+		remotePresent, valid = va.checkCAAPerspectives(remotes, identifier, accountURI, method)
+		present = present || remotePresent
+	}
+	if !valid {
+		va.reportCAARefusal(strings.ToLower(identifier.Value), caaSet)
+	}
+	return
+}
+
+// PerformCAACheck checks CAA records from this VA's vantage point only and
+// reports nothing to the domain's iodef contacts, since this VA's result may
+// not be the final one. Primary VAs call it on their remote VAs.
+func (va *ValidationAuthorityImpl) PerformCAACheck(identifier core.AcmeIdentifier, accountURI, method string) (present, valid bool, err error) {
+	present, valid, _, err = va.checkCAARecords(identifier, accountURI, method)
+	return
+}
+
+// checkCAAPerspectives repeats a successful local CAA check from the remote
+// VAs and returns whether any found CAA records, and whether a quorum of
+// perspectives, counting this VA, found issuance authorized.
+func (va *ValidationAuthorityImpl) checkCAAPerspectives(remotes []RemoteVA, identifier core.AcmeIdentifier, accountURI, method string) (present, valid bool) {
+	type caaResult struct {
+		present, valid bool
+	}
+	results := make(chan caaResult, len(remotes))
+	for _, remote := range remotes {
+		go func(remote RemoteVA) {
+			remotePresent, remoteValid, err := remote.PerformCAACheck(identifier, accountURI, method)
+			if err != nil {
+				va.log.Info(fmt.Sprintf("Remote VA %s failed to check CAA for %s: %s", remote.Name, identifier, err))
+			}
+			results <- caaResult{remotePresent, remoteValid && err == nil}
+		}(remote)
+	}
+
+	agreed := 1
+	for range remotes {
+		result := <-results
+		present = present || result.present
+		if result.valid {
+			agreed++
+		}
+	}
+	if agreed < va.quorum(len(remotes)) {
+		va.log.Debug(fmt.Sprintf("CAA [%s] Quorum failure: %d of %d perspectives", identifier, agreed, len(remotes)+1))
+		return present, false
+	}
+	return present, true
+}
+
+// checkCAARecords performs the CAA check from this VA's vantage point only,
+// returning the records it found, if any, for reporting a refusal.
+// CAA records only exist for DNS names, so IP address identifiers always pass.
+func (va *ValidationAuthorityImpl) checkCAARecords(identifier core.AcmeIdentifier, accountURI, method string) (present, valid bool, caaSet *CAASet, err error) {
+	if identifier.Type == core.IdentifierIP {
+		return false, true, nil, nil
+	}
 	hostname := strings.ToLower(identifier.Value)
-	caaSet, err := va.getCAASet(hostname)
+	// A wildcard name's CAA records are those of the domain it is a wildcard
+	// for, rather than of a literal "*" label.
+	base, wildcard := core.WildcardBase(hostname)
+	caaSet, err = va.getCAASet(base)
 	if err != nil {
 		return
 	}
@@ -709,31 +1317,35 @@ func (va *ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifie
 		present = false
 		valid = true
 		return
-	} else if caaSet.criticalUnknown() {
-		present = true
+	}
+	present = true
+	if caaSet.criticalUnknown() {
 		valid = false
 		return
-	} else if len(caaSet.Issue) > 0 || len(caaSet.Issuewild) > 0 {
-		present = true
-		var checkSet []*dns.CAA
-		if strings.SplitN(hostname, ".", 2)[0] == "*" {
-			checkSet = caaSet.Issuewild
-		} else {
-			checkSet = caaSet.Issue
-		}
-		for _, caa := range checkSet {
-			if caa.Value == va.IssuerDomain {
-				valid = true
-				return
-			} else if caa.Flag > 0 {
-				valid = false
-				return
-			}
-		}
+	}
 
-		valid = false
+	// issuewild takes precedence over issue for wildcard names
+	checkSet := caaSet.Issue
+	if wildcard && len(caaSet.Issuewild) > 0 {
+		checkSet = caaSet.Issuewild
+	}
+	if len(checkSet) == 0 {
+		// No issuance restrictions, can issue
+		valid = true
 		return
 	}
+	for _, caa := range checkSet {
+		issuer, err := parseCAAIssuer(caa.Value)
+		if err != nil {
+			va.log.Info(fmt.Sprintf("CAA [%s] %s", hostname, err))
+			continue
+		}
+		if issuer.authorizes(va.IssuerDomain, accountURI, method) {
+			valid = true
+			return present, valid, caaSet, nil
+		}
+	}
 
+	valid = false
 	return
 }
@@ -15,6 +15,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/syslog"
 	"math/big"
@@ -22,12 +23,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
 
 	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/mocks"
@@ -71,6 +75,10 @@ const pathMoved = "301"
 const pathRedirectLookup = "re-lookup"
 const pathRedirectLookupInvalid = "re-lookup-invalid"
 const pathRedirectPort = "port-redirect"
+const pathRedirectScheme = "scheme-redirect"
+const pathRedirectReservedIP = "reserved-ip-redirect"
+const pathRedirectIPv6 = "ipv6-redirect"
+const pathWrongKeyAuthz = "wrong-key-authz"
 
 func createValidation(token string, enableTLS bool) string {
 	payload, _ := json.Marshal(map[string]interface{}{
@@ -172,6 +180,66 @@ func simpleSrv(t *testing.T, token string, enableTLS bool) *httptest.Server {
 	return server
 }
 
+// httpSrv serves http-01 key authorizations for accountKey. Requests that
+// aren't for one of the special paths are answered with the key authorization
+// for the token in the first request the server received, so that redirects
+// can be followed to any path. Use a new server for each challenge.
+func httpSrv(t *testing.T) *httptest.Server {
+	m := http.NewServeMux()
+
+	currentToken := ""
+
+	m.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Host, "localhost:") && r.Host != "other.valid" {
+			t.Errorf("Bad Host header: %s", r.Host)
+		}
+		token := path.Base(r.URL.Path)
+		if currentToken == "" {
+			currentToken = token
+		}
+		switch token {
+		case path404:
+			t.Logf("HTTPSRV: Got a 404 req\n")
+			http.NotFound(w, r)
+		case pathFound:
+			t.Logf("HTTPSRV: Got a 302 redirect req\n")
+			http.Redirect(w, r, pathMoved, 302)
+		case pathMoved:
+			t.Logf("HTTPSRV: Got a 301 redirect req\n")
+			http.Redirect(w, r, "valid", 301)
+		case pathRedirectLookup:
+			t.Logf("HTTPSRV: Got a redirect req to a valid hostname\n")
+			http.Redirect(w, r, "http://other.valid/path", 302)
+		case pathRedirectPort:
+			t.Logf("HTTPSRV: Got a port redirect req\n")
+			http.Redirect(w, r, "http://other.valid:8080/path", 302)
+		case pathRedirectScheme:
+			t.Logf("HTTPSRV: Got a scheme redirect req\n")
+			http.Redirect(w, r, "ftp://other.valid/path", 302)
+		case pathRedirectReservedIP:
+			t.Logf("HTTPSRV: Got a redirect req to a reserved IP address\n")
+			http.Redirect(w, r, "http://10.0.0.1/path", 302)
+		case pathRedirectIPv6:
+			t.Logf("HTTPSRV: Got a redirect req to an IPv6 address\n")
+			_, port, _ := net.SplitHostPort(r.Host)
+			http.Redirect(w, r, "http://"+net.JoinHostPort("2001:db8::1", port)+"/path", 302)
+		case "looper":
+			t.Logf("HTTPSRV: Got a loop req\n")
+			http.Redirect(w, r, r.URL.String(), 301)
+		case pathWrongKeyAuthz:
+			t.Logf("HTTPSRV: Got a wrong key authorization req\n")
+			ka, _ := core.NewKeyAuthorization("other", accountKey)
+			fmt.Fprint(w, ka.String())
+		default:
+			t.Logf("HTTPSRV: Got a valid req\n")
+			ka, _ := core.NewKeyAuthorization(currentToken, accountKey)
+			fmt.Fprintln(w, ka.String())
+		}
+	})
+
+	return httptest.NewServer(m)
+}
+
 func dvsniSrv(t *testing.T, chall core.Challenge) *httptest.Server {
 	encodedSig := core.B64enc(chall.Validation.Signatures[0].Signature)
 	h := sha256.New()
@@ -219,6 +287,44 @@ func dvsniSrv(t *testing.T, chall core.Challenge) *httptest.Server {
 	return hs
 }
 
+// tlssniSrv serves a self-signed certificate whose only dNSName SAN is the
+// tls-sni-01 name for chall, regardless of the SNI requested.
+func tlssniSrv(t *testing.T, chall core.Challenge) *httptest.Server {
+	keyAuthz, err := core.NewKeyAuthorization(chall.Token, accountKey)
+	test.AssertNotError(t, err, "Could not make key authorization")
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1337),
+		Subject: pkix.Name{
+			Organization: []string{"tests"},
+		},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().AddDate(0, 0, 1),
+
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+
+		DNSNames: []string{keyAuthz.TLSSNIName()},
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Could not generate server key")
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "Could not create server certificate")
+
+	hs := httptest.NewUnstartedServer(http.DefaultServeMux)
+	hs.TLS = &tls.Config{
+		Certificates: []tls.Certificate{tls.Certificate{
+			Certificate: [][]byte{certBytes},
+			PrivateKey:  key,
+		}},
+		ClientAuth: tls.NoClientCert,
+	}
+	hs.StartTLS()
+	return hs
+}
+
 func brokenTLSSrv() *httptest.Server {
 	server := httptest.NewUnstartedServer(http.DefaultServeMux)
 	server.TLS = &tls.Config{
@@ -244,10 +350,11 @@ func TestSimpleHttpTLS(t *testing.T) {
 	port, err := getPort(hs)
 	test.AssertNotError(t, err, "failed to get test server port")
 	va := NewValidationAuthorityImpl(&PortConfig{SimpleHTTPSPort: port})
+	va.AllowLoopbackAddresses = true
 	va.DNSResolver = &mocks.MockDNS{}
 
 	log.Clear()
-	finChall, err := va.validateSimpleHTTP(ident, chall)
+	finChall, err := va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusValid)
 	test.AssertNotError(t, err, "Error validating simpleHttp")
 	logs := log.GetAllMatching(`^\[AUDIT\] Attempting to validate SimpleHTTPS for `)
@@ -285,24 +392,26 @@ func TestSimpleHttp(t *testing.T) {
 		badPort = goodPort - 1
 	}
 	va := NewValidationAuthorityImpl(&PortConfig{SimpleHTTPPort: badPort})
+	va.AllowLoopbackAddresses = true
 	va.DNSResolver = &mocks.MockDNS{}
 
-	invalidChall, err := va.validateSimpleHTTP(ident, chall)
+	invalidChall, err := va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, "Server's down; expected refusal. Where did we connect?")
 	test.AssertEquals(t, invalidChall.Error.Type, core.ConnectionProblem)
 
 	va = NewValidationAuthorityImpl(&PortConfig{SimpleHTTPPort: goodPort})
+	va.AllowLoopbackAddresses = true
 	va.DNSResolver = &mocks.MockDNS{}
 	log.Clear()
-	finChall, err := va.validateSimpleHTTP(ident, chall)
+	finChall, err := va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusValid)
 	test.AssertNotError(t, err, "Error validating simpleHttp")
 	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] `)), 1)
 
 	log.Clear()
 	chall.Token = path404
-	invalidChall, err = va.validateSimpleHTTP(ident, chall)
+	invalidChall, err = va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, "Should have found a 404 for the challenge.")
 	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
@@ -312,7 +421,7 @@ func TestSimpleHttp(t *testing.T) {
 	chall.Token = pathWrongToken
 	// The "wrong token" will actually be the expectedToken.  It's wrong
 	// because it doesn't match pathWrongToken.
-	invalidChall, err = va.validateSimpleHTTP(ident, chall)
+	invalidChall, err = va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, "Should have found the wrong token value.")
 	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
@@ -320,33 +429,33 @@ func TestSimpleHttp(t *testing.T) {
 
 	log.Clear()
 	chall.Token = pathMoved
-	finChall, err = va.validateSimpleHTTP(ident, chall)
+	finChall, err = va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusValid)
 	test.AssertNotError(t, err, "Failed to follow 301 redirect")
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/301" to ".*/valid"`)), 1)
 
 	log.Clear()
 	chall.Token = pathFound
-	finChall, err = va.validateSimpleHTTP(ident, chall)
+	finChall, err = va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusValid)
 	test.AssertNotError(t, err, "Failed to follow 302 redirect")
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/302" to ".*/301"`)), 1)
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/301" to ".*/valid"`)), 1)
 
-	ipIdentifier := core.AcmeIdentifier{Type: core.IdentifierType("ip"), Value: "127.0.0.1"}
-	invalidChall, err = va.validateSimpleHTTP(ipIdentifier, chall)
+	emailIdentifier := core.AcmeIdentifier{Type: core.IdentifierType("email"), Value: "admin@letsencrypt.org"}
+	invalidChall, err = va.validateSimpleHTTP(emailIdentifier, chall, time.Time{})
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
-	test.AssertError(t, err, "IdentifierType IP shouldn't have worked.")
+	test.AssertError(t, err, "IdentifierType email shouldn't have worked.")
 	test.AssertEquals(t, invalidChall.Error.Type, core.MalformedProblem)
 
-	invalidChall, err = va.validateSimpleHTTP(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "always.invalid"}, chall)
+	invalidChall, err = va.validateSimpleHTTP(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "always.invalid"}, chall, time.Time{})
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, "Domain name is invalid.")
 	test.AssertEquals(t, invalidChall.Error.Type, core.UnknownHostProblem)
 
 	chall.Token = "wait-long"
 	started := time.Now()
-	invalidChall, err = va.validateSimpleHTTP(ident, chall)
+	invalidChall, err = va.validateSimpleHTTP(ident, chall, time.Time{})
 	took := time.Since(started)
 	// Check that the HTTP connection times out after 5 seconds and doesn't block for 10 seconds
 	test.Assert(t, (took > (time.Second * 5)), "HTTP timed out before 5 seconds")
@@ -370,11 +479,12 @@ func TestSimpleHttpRedirectLookup(t *testing.T) {
 	port, err := getPort(hs)
 	test.AssertNotError(t, err, "failed to get test server port")
 	va := NewValidationAuthorityImpl(&PortConfig{SimpleHTTPPort: port})
+	va.AllowLoopbackAddresses = true
 	va.DNSResolver = &mocks.MockDNS{}
 
 	log.Clear()
 	chall.Token = pathMoved
-	finChall, err := va.validateSimpleHTTP(ident, chall)
+	finChall, err := va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusValid)
 	test.AssertNotError(t, err, chall.Token)
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/301" to ".*/valid"`)), 1)
@@ -382,7 +492,7 @@ func TestSimpleHttpRedirectLookup(t *testing.T) {
 
 	log.Clear()
 	chall.Token = pathFound
-	finChall, err = va.validateSimpleHTTP(ident, chall)
+	finChall, err = va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusValid)
 	test.AssertNotError(t, err, chall.Token)
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/302" to ".*/301"`)), 1)
@@ -391,7 +501,7 @@ func TestSimpleHttpRedirectLookup(t *testing.T) {
 
 	log.Clear()
 	chall.Token = pathRedirectLookupInvalid
-	finChall, err = va.validateSimpleHTTP(ident, chall)
+	finChall, err = va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, chall.Token)
 	test.AssertEquals(t, len(log.GetAllMatching(`Resolved addresses for localhost \[using 127.0.0.1\]: \[127.0.0.1\]`)), 1)
@@ -399,7 +509,7 @@ func TestSimpleHttpRedirectLookup(t *testing.T) {
 
 	log.Clear()
 	chall.Token = pathRedirectLookup
-	finChall, err = va.validateSimpleHTTP(ident, chall)
+	finChall, err = va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusValid)
 	test.AssertNotError(t, err, chall.Token)
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/re-lookup" to ".*other.valid/path"`)), 1)
@@ -408,7 +518,7 @@ func TestSimpleHttpRedirectLookup(t *testing.T) {
 
 	log.Clear()
 	chall.Token = pathRedirectPort
-	finChall, err = va.validateSimpleHTTP(ident, chall)
+	finChall, err = va.validateSimpleHTTP(ident, chall, time.Time{})
 	fmt.Println(finChall.ValidationRecord)
 	test.AssertEquals(t, finChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, chall.Token)
@@ -430,15 +540,229 @@ func TestSimpleHttpRedirectLoop(t *testing.T) {
 	port, err := getPort(hs)
 	test.AssertNotError(t, err, "failed to get test server port")
 	va := NewValidationAuthorityImpl(&PortConfig{SimpleHTTPPort: port})
+	va.AllowLoopbackAddresses = true
 	va.DNSResolver = &mocks.MockDNS{}
 
 	log.Clear()
-	finChall, err := va.validateSimpleHTTP(ident, chall)
+	finChall, err := va.validateSimpleHTTP(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, chall.Token)
 	fmt.Println(finChall)
 }
 
+func TestHTTP01(t *testing.T) {
+	testCases := []struct {
+		token   string
+		valid   bool
+		records int
+	}{
+		{"THETOKEN", true, 1},
+		{pathFound, true, 3},
+		{pathRedirectLookup, true, 2},
+		{path404, false, 1},
+		{pathWrongKeyAuthz, false, 1},
+		{pathRedirectPort, false, 1},
+		{pathRedirectScheme, false, 1},
+		{pathRedirectReservedIP, false, 2},
+		{pathRedirectIPv6, false, 2},
+		{"looper", false, maxRedirect},
+	}
+
+	for _, tc := range testCases {
+		hs := httpSrv(t)
+		port, err := getPort(hs)
+		test.AssertNotError(t, err, "failed to get test server port")
+		va := NewValidationAuthorityImpl(&PortConfig{SimpleHTTPPort: port})
+		va.AllowLoopbackAddresses = true
+		va.DNSResolver = &mocks.MockDNS{}
+
+		chall := core.HTTPChallenge01()
+		chall.Token = tc.token
+		chall.AccountKey = accountKey
+		finChall, err := va.validateHTTP01(ident, chall, time.Time{})
+		hs.Close()
+
+		if tc.valid {
+			test.AssertNotError(t, err, tc.token)
+			test.AssertEquals(t, finChall.Status, core.StatusValid)
+			test.Assert(t, finChall.RecordsSane(), "Validation records should be sane for "+tc.token)
+		} else {
+			test.AssertError(t, err, tc.token)
+			test.AssertEquals(t, finChall.Status, core.StatusInvalid)
+		}
+		test.AssertEquals(t, len(finChall.ValidationRecord), tc.records)
+	}
+}
+
+func TestHTTP01AddressFamilies(t *testing.T) {
+	chall := core.HTTPChallenge01()
+	chall.Token = core.NewToken()
+	chall.AccountKey = accountKey
+	ka, err := core.NewKeyAuthorization(chall.Token, accountKey)
+	test.AssertNotError(t, err, "Couldn't make key authorization")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ka.String())
+	})
+
+	testCases := []struct {
+		hostname string
+		listen   string
+		tried    []string
+		used     string
+	}{
+		// IPv6 only
+		{"ipv6.localhost", "[::1]:0", []string{"::1"}, "::1"},
+		// IPv6 preferred, falling back to IPv4 when it can't connect
+		{"dualstack.localhost", "127.0.0.1:0", []string{"::1", "127.0.0.1"}, "127.0.0.1"},
+	}
+
+	for _, tc := range testCases {
+		ln, err := net.Listen("tcp", tc.listen)
+		test.AssertNotError(t, err, "Couldn't listen on "+tc.listen)
+		go http.Serve(ln, handler)
+		port := ln.Addr().(*net.TCPAddr).Port
+
+		va := NewValidationAuthorityImpl(&PortConfig{SimpleHTTPPort: port})
+		va.AllowLoopbackAddresses = true
+		va.DNSResolver = &mocks.MockDNS{}
+		finChall, err := va.validateHTTP01(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: tc.hostname}, chall, time.Time{})
+		ln.Close()
+
+		test.AssertNotError(t, err, tc.hostname)
+		test.AssertEquals(t, finChall.Status, core.StatusValid)
+		test.AssertEquals(t, len(finChall.ValidationRecord), 1)
+		record := finChall.ValidationRecord[0]
+		test.AssertEquals(t, record.AddressUsed.String(), tc.used)
+		test.AssertEquals(t, len(record.AddressesTried), len(tc.tried))
+		for i, addr := range tc.tried {
+			test.AssertEquals(t, record.AddressesTried[i].String(), addr)
+		}
+	}
+}
+
+func TestIPIdentifierValidation(t *testing.T) {
+	chall := core.HTTPChallenge01()
+	chall.Token = core.NewToken()
+	chall.AccountKey = accountKey
+	ka, err := core.NewKeyAuthorization(chall.Token, accountKey)
+	test.AssertNotError(t, err, "Couldn't make key authorization")
+
+	for _, ip := range []string{"127.0.0.1", "::1"} {
+		ln, err := net.Listen("tcp", net.JoinHostPort(ip, "0"))
+		test.AssertNotError(t, err, "Couldn't listen on "+ip)
+		port := ln.Addr().(*net.TCPAddr).Port
+		hostPort := net.JoinHostPort(ip, strconv.Itoa(port))
+		go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Host != hostPort {
+				t.Errorf("Bad Host header: %s", r.Host)
+			}
+			fmt.Fprint(w, ka.String())
+		}))
+
+		// MockDNS has no records for IP addresses, so these must not be looked up
+		va := NewValidationAuthorityImpl(&PortConfig{SimpleHTTPPort: port})
+		va.DNSResolver = &mocks.MockDNS{}
+		_, err = va.validateHTTP01(core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip}, chall, time.Time{})
+		test.AssertError(t, err, "Validated reserved address "+ip)
+
+		va.AllowLoopbackAddresses = true
+		finChall, err := va.validateHTTP01(core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip}, chall, time.Time{})
+		ln.Close()
+
+		test.AssertNotError(t, err, "http-01 validation of "+ip+" failed")
+		test.AssertEquals(t, finChall.Status, core.StatusValid)
+		test.AssertEquals(t, finChall.ValidationRecord[0].AddressUsed.String(), ip)
+	}
+
+	tlsChall := createChallenge(core.ChallengeTypeTLSSNI01)
+	hs := tlssniSrv(t, tlsChall)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	va := NewValidationAuthorityImpl(&PortConfig{TLSSNIPort: port})
+	va.DNSResolver = &mocks.MockDNS{}
+	va.AllowLoopbackAddresses = true
+	finChall, err := va.validateTLSSNI01(core.AcmeIdentifier{Type: core.IdentifierIP, Value: "127.0.0.1"}, tlsChall, time.Time{})
+	test.AssertNotError(t, err, "tls-sni-01 validation of 127.0.0.1 failed")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+
+	_, err = va.validateTLSSNI01(core.AcmeIdentifier{Type: core.IdentifierIP, Value: "not-an-ip"}, tlsChall, time.Time{})
+	test.AssertError(t, err, "Validated a malformed IP identifier")
+
+	// CAA doesn't apply to IP addresses
+	present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: core.IdentifierIP, Value: "1.2.3.4"}, "", "")
+	test.AssertNotError(t, err, "CAA check of an IP address failed")
+	test.Assert(t, !present && valid, "CAA check of an IP address didn't pass")
+}
+
+func TestPreferredAddrs(t *testing.T) {
+	addrs := []net.IP{
+		net.ParseIP("1.2.3.4"),
+		net.ParseIP("2602:80a:6000:abad:cafe::1"),
+		net.ParseIP("5.6.7.8"),
+		net.ParseIP("2602:80a:6000:abad:cafe::2"),
+	}
+	preferred := preferredAddrs(addrs)
+	test.AssertEquals(t, len(preferred), 2)
+	test.AssertEquals(t, preferred[0].String(), "2602:80a:6000:abad:cafe::1")
+	test.AssertEquals(t, preferred[1].String(), "1.2.3.4")
+
+	preferred = preferredAddrs(addrs[:1])
+	test.AssertEquals(t, len(preferred), 1)
+	test.AssertEquals(t, preferred[0].String(), "1.2.3.4")
+}
+
+// addrsDNS resolves every name to the addresses it holds.
+type addrsDNS struct {
+	mocks.MockDNS
+	addrs []net.IP
+}
+
+func (mock *addrsDNS) LookupHost(hostname string) ([]net.IP, time.Duration, error) {
+	return mock.addrs, 0, nil
+}
+
+func TestGetAddrsSkipsReserved(t *testing.T) {
+	resolver := &addrsDNS{}
+	for _, addr := range []string{
+		"64:ff9b::a00:1", // NAT64
+		"2002:a00:1::1",  // 6to4
+		"::1",
+		"127.0.0.1",
+		"2602:80a:6000:abad:cafe::1",
+		"1.2.3.4",
+	} {
+		resolver.addrs = append(resolver.addrs, net.ParseIP(addr))
+	}
+	va := NewValidationAuthorityImpl(&PortConfig{})
+	va.DNSResolver = resolver
+
+	_, addrs, problem := va.getAddrs("reserved.com")
+	test.Assert(t, problem == nil, "Lookup failed")
+	test.AssertEquals(t, len(addrs), 2)
+	test.AssertEquals(t, addrs[0].String(), "2602:80a:6000:abad:cafe::1")
+	test.AssertEquals(t, addrs[1].String(), "1.2.3.4")
+
+	va.AllowLoopbackAddresses = true
+	_, addrs, problem = va.getAddrs("reserved.com")
+	test.Assert(t, problem == nil, "Lookup failed")
+	test.AssertEquals(t, len(addrs), 4)
+
+	resolver.addrs = resolver.addrs[:2]
+	_, _, problem = va.getAddrs("reserved.com")
+	test.AssertEquals(t, problem.Type, core.UnknownHostProblem)
+}
+
+func TestHTTP01IdentifierType(t *testing.T) {
+	va := NewValidationAuthorityImpl(&PortConfig{})
+	chall := core.HTTPChallenge01()
+	chall.AccountKey = accountKey
+	finChall, err := va.validateHTTP01(core.AcmeIdentifier{Type: "email", Value: "admin@letsencrypt.org"}, chall, time.Time{})
+	test.AssertError(t, err, "Validated a non-DNS, non-IP identifier")
+	test.AssertEquals(t, finChall.Status, core.StatusInvalid)
+	test.AssertEquals(t, finChall.Error.Type, core.MalformedProblem)
+}
+
 func getPort(hs *httptest.Server) (int, error) {
 	url, err := url.Parse(hs.URL)
 	if err != nil {
@@ -463,26 +787,27 @@ func TestDvsni(t *testing.T) {
 	test.AssertNotError(t, err, "failed to get test server port")
 
 	va := NewValidationAuthorityImpl(&PortConfig{DVSNIPort: port})
+	va.AllowLoopbackAddresses = true
 
 	va.DNSResolver = &mocks.MockDNS{}
 
 	log.Clear()
-	finChall, err := va.validateDvsni(ident, chall)
+	finChall, err := va.validateDvsni(ident, chall, time.Time{})
 	test.AssertEquals(t, finChall.Status, core.StatusValid)
 	test.AssertNotError(t, err, "")
 	test.AssertEquals(t, len(log.GetAllMatching(`Resolved addresses for localhost \[using 127.0.0.1\]: \[127.0.0.1\]`)), 1)
 
 	log.Clear()
 	invalidChall, err := va.validateDvsni(core.AcmeIdentifier{
-		Type:  core.IdentifierType("ip"),
-		Value: net.JoinHostPort("127.0.0.1", fmt.Sprintf("%d", port)),
-	}, chall)
+		Type:  core.IdentifierType("email"),
+		Value: "admin@letsencrypt.org",
+	}, chall, time.Time{})
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
-	test.AssertError(t, err, "IdentifierType IP shouldn't have worked.")
+	test.AssertError(t, err, "IdentifierType email shouldn't have worked.")
 	test.AssertEquals(t, invalidChall.Error.Type, core.MalformedProblem)
 
 	log.Clear()
-	invalidChall, err = va.validateDvsni(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "always.invalid"}, chall)
+	invalidChall, err = va.validateDvsni(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "always.invalid"}, chall, time.Time{})
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, "Domain name was supposed to be invalid.")
 	test.AssertEquals(t, invalidChall.Error.Type, core.UnknownHostProblem)
@@ -498,7 +823,7 @@ func TestDvsni(t *testing.T) {
 
 	log.Clear()
 	started := time.Now()
-	invalidChall, err = va.validateDvsni(ident, chall)
+	invalidChall, err = va.validateDvsni(ident, chall, time.Time{})
 	took := time.Since(started)
 	// Check that the HTTP connection times out after 5 seconds and doesn't block for 10 seconds
 	test.Assert(t, (took > (time.Second * 5)), "HTTP timed out before 5 seconds")
@@ -510,12 +835,51 @@ func TestDvsni(t *testing.T) {
 
 	// Take down DVSNI validation server and check that validation fails.
 	hs.Close()
-	invalidChall, err = va.validateDvsni(ident, chall)
+	invalidChall, err = va.validateDvsni(ident, chall, time.Time{})
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, "Server's down; expected refusal. Where did we connect?")
 	test.AssertEquals(t, invalidChall.Error.Type, core.ConnectionProblem)
 }
 
+func TestTLSSNI01(t *testing.T) {
+	chall := core.TLSSNIChallenge01()
+	chall.AccountKey = accountKey
+
+	hs := tlssniSrv(t, chall)
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	va := NewValidationAuthorityImpl(&PortConfig{TLSSNIPort: port})
+	va.AllowLoopbackAddresses = true
+	va.DNSResolver = &mocks.MockDNS{}
+
+	finChall, err := va.validateTLSSNI01(ident, chall, time.Time{})
+	test.AssertNotError(t, err, "tls-sni-01 validation failed")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.Assert(t, finChall.RecordsSane(), "Validation records should be sane")
+	test.AssertEquals(t, finChall.ValidationRecord[0].Port, strconv.Itoa(port))
+
+	invalidChall, err := va.validateTLSSNI01(core.AcmeIdentifier{Type: "email", Value: "admin@letsencrypt.org"}, chall, time.Time{})
+	test.AssertError(t, err, "IdentifierType email shouldn't have worked.")
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertEquals(t, invalidChall.Error.Type, core.MalformedProblem)
+
+	// A different token gives a different name, which the server's
+	// certificate does not carry
+	wrongChall := chall
+	wrongChall.Token = core.NewToken()
+	invalidChall, err = va.validateTLSSNI01(ident, wrongChall, time.Time{})
+	test.AssertError(t, err, "Validated with the wrong key authorization")
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
+
+	hs.Close()
+	invalidChall, err = va.validateTLSSNI01(ident, chall, time.Time{})
+	test.AssertError(t, err, "Server's down; expected refusal. Where did we connect?")
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertEquals(t, invalidChall.Error.Type, core.ConnectionProblem)
+}
+
 func TestTLSError(t *testing.T) {
 	chall := createChallenge(core.ChallengeTypeDVSNI)
 	hs := brokenTLSSrv()
@@ -523,9 +887,10 @@ func TestTLSError(t *testing.T) {
 	port, err := getPort(hs)
 	test.AssertNotError(t, err, "failed to get test server port")
 	va := NewValidationAuthorityImpl(&PortConfig{DVSNIPort: port})
+	va.AllowLoopbackAddresses = true
 	va.DNSResolver = &mocks.MockDNS{}
 
-	invalidChall, err := va.validateDvsni(ident, chall)
+	invalidChall, err := va.validateDvsni(ident, chall, time.Time{})
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, "What cert was used?")
 	test.AssertEquals(t, invalidChall.Error.Type, core.TLSProblem)
@@ -542,6 +907,7 @@ func TestValidateHTTP(t *testing.T) {
 	port, err := getPort(hs)
 	test.AssertNotError(t, err, "failed to get test server port")
 	va := NewValidationAuthorityImpl(&PortConfig{SimpleHTTPPort: port})
+	va.AllowLoopbackAddresses = true
 	va.DNSResolver = &mocks.MockDNS{}
 	mockRA := &MockRegistrationAuthority{}
 	va.RA = mockRA
@@ -588,6 +954,7 @@ func TestValidateDvsni(t *testing.T) {
 	test.AssertNotError(t, err, "failed to get test server port")
 
 	va := NewValidationAuthorityImpl(&PortConfig{DVSNIPort: port})
+	va.AllowLoopbackAddresses = true
 	va.DNSResolver = &mocks.MockDNS{}
 	mockRA := &MockRegistrationAuthority{}
 	va.RA = mockRA
@@ -642,14 +1009,208 @@ func TestUpdateValidations(t *testing.T) {
 		Challenges:     []core.Challenge{challHTTP},
 	}
 
+	err := va.StartWorkers(QueueConfig{MaxAttempts: 1}, nil)
+	test.AssertNotError(t, err, "Couldn't start workers")
+
 	started := time.Now()
-	va.UpdateValidations(authz, 0)
+	err = va.UpdateValidations(authz, 0)
 	took := time.Since(started)
+	test.AssertNotError(t, err, "Couldn't queue validation")
 
 	// Check that the call to va.UpdateValidations didn't block for 3 seconds
 	test.Assert(t, (took < (time.Second * 3)), "UpdateValidations blocked")
 }
 
+func TestMultiPerspectiveValidation(t *testing.T) {
+	chall := core.TLSSNIChallenge01()
+	chall.AccountKey = accountKey
+	keyAuthz, err := core.NewKeyAuthorization(chall.Token, accountKey)
+	test.AssertNotError(t, err, "Could not make key authorization")
+	chall.KeyAuthorization = &keyAuthz
+
+	hs := tlssniSrv(t, chall)
+	defer hs.Close()
+	goodPort, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "failed to listen")
+	badPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	newVA := func(port int) *ValidationAuthorityImpl {
+		va := NewValidationAuthorityImpl(&PortConfig{TLSSNIPort: port})
+		va.AllowLoopbackAddresses = true
+		va.DNSResolver = &mocks.MockDNS{}
+		return va
+	}
+
+	testCases := []struct {
+		remotePorts  []int
+		quorum       int
+		valid        bool
+		perspectives []string
+	}{
+		{[]int{goodPort, goodPort, badPort}, 0, true, []string{PrimaryPerspective, "remote-0", "remote-1"}},
+		{[]int{goodPort, goodPort, badPort}, 4, false, []string{PrimaryPerspective, "remote-0", "remote-1"}},
+		{[]int{badPort, badPort, goodPort}, 0, false, []string{PrimaryPerspective, "remote-2"}},
+	}
+
+	for _, tc := range testCases {
+		va := newVA(goodPort)
+		va.Quorum = tc.quorum
+		for i, port := range tc.remotePorts {
+			va.RemoteVAs = append(va.RemoteVAs, RemoteVA{
+				ValidationAuthority: newVA(port),
+				Name:                fmt.Sprintf("remote-%d", i),
+			})
+		}
+		mockRA := &MockRegistrationAuthority{}
+		va.RA = mockRA
+
+		va.validate(core.Authorization{
+			ID:         core.NewToken(),
+			Identifier: ident,
+			Challenges: []core.Challenge{chall},
+		}, 0)
+
+		result := mockRA.lastAuthz.Challenges[0]
+		test.AssertEquals(t, len(result.ValidationRecord), 1)
+		test.AssertEquals(t, fmt.Sprintf("%s", result.ValidationRecord[0].Perspectives), fmt.Sprintf("%s", tc.perspectives))
+		if tc.valid {
+			test.AssertEquals(t, result.Status, core.StatusValid)
+		} else {
+			test.AssertEquals(t, result.Status, core.StatusInvalid)
+			test.AssertEquals(t, result.Error.Type, core.UnauthorizedProblem)
+		}
+	}
+}
+
+func TestCAAParameters(t *testing.T) {
+	va := NewValidationAuthorityImpl(&PortConfig{})
+	va.DNSResolver = &mocks.MockDNS{}
+	va.IssuerDomain = "letsencrypt.org"
+
+	testCases := []struct {
+		domain     string
+		accountURI string
+		method     string
+		valid      bool
+	}{
+		{"accounturi.com", "https://letsencrypt.org/acme/reg/1", "", true},
+		{"accounturi.com", "https://letsencrypt.org/acme/reg/2", "", false},
+		{"methods.com", "", core.ChallengeTypeTLSSNI01, true},
+		{"methods.com", "", core.ChallengeTypeHTTP01, false},
+		{"present.com", "https://letsencrypt.org/acme/reg/2", core.ChallengeTypeHTTP01, true},
+	}
+	for _, tc := range testCases {
+		present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: tc.domain}, tc.accountURI, tc.method)
+		test.AssertNotError(t, err, tc.domain)
+		test.Assert(t, present, "Present should be true for "+tc.domain)
+		test.AssertEquals(t, tc.valid, valid)
+	}
+}
+
+type mockMail struct {
+	To []string
+}
+
+func (m *mockMail) SendMail(to []string, msg string) error {
+	m.To = append(m.To, to...)
+	return nil
+}
+
+func TestCAAIodef(t *testing.T) {
+	va := NewValidationAuthorityImpl(&PortConfig{})
+	va.DNSResolver = &mocks.MockDNS{}
+	va.IssuerDomain = "letsencrypt.org"
+	mailer := &mockMail{}
+	va.Mailer = mailer
+
+	// Only mailto: URLs are reported to
+	_, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: "iodef.com"}, "", "")
+	test.AssertNotError(t, err, "iodef.com")
+	test.Assert(t, !valid, "Valid should be false")
+	test.AssertEquals(t, len(mailer.To), 1)
+	test.AssertEquals(t, mailer.To[0], "security@iodef.com")
+
+	// Nothing is reported when issuance is allowed
+	mailer.To = nil
+	_, valid, err = va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: "iodef-only.com"}, "", "")
+	test.AssertNotError(t, err, "iodef-only.com")
+	test.Assert(t, valid, "Valid should be true")
+	test.AssertEquals(t, len(mailer.To), 0)
+}
+
+// The RA checks CAA several times for each name, so a refused name is only
+// reported once a day, and only by the VA that makes the final decision.
+func TestCAAIodefOnce(t *testing.T) {
+	fc := clock.NewFake()
+	newVA := func() (*ValidationAuthorityImpl, *mockMail) {
+		va := NewValidationAuthorityImpl(&PortConfig{})
+		va.DNSResolver = &mocks.MockDNS{}
+		va.IssuerDomain = "letsencrypt.org"
+		va.clk = fc
+		mailer := &mockMail{}
+		va.Mailer = mailer
+		return va, mailer
+	}
+	va, mailer := newVA()
+	remote, remoteMailer := newVA()
+	va.RemoteVAs = []RemoteVA{RemoteVA{ValidationAuthority: remote, Name: "remote"}}
+
+	refused := core.AcmeIdentifier{Type: "dns", Value: "iodef.com"}
+	for i := 0; i < 3; i++ {
+		_, valid, err := va.CheckCAARecords(refused, "", "")
+		test.AssertNotError(t, err, "iodef.com")
+		test.Assert(t, !valid, "Valid should be false")
+	}
+	test.AssertEquals(t, len(mailer.To), 1)
+
+	_, valid, err := remote.PerformCAACheck(refused, "", "")
+	test.AssertNotError(t, err, "iodef.com")
+	test.Assert(t, !valid, "Valid should be false")
+	test.AssertEquals(t, len(remoteMailer.To), 0)
+
+	fc.Add(iodefReportInterval)
+	_, _, err = va.CheckCAARecords(refused, "", "")
+	test.AssertNotError(t, err, "iodef.com")
+	test.AssertEquals(t, len(mailer.To), 2)
+}
+
+func TestMultiPerspectiveCAA(t *testing.T) {
+	newVA := func(issuerDomain string) *ValidationAuthorityImpl {
+		va := NewValidationAuthorityImpl(&PortConfig{})
+		va.DNSResolver = &mocks.MockDNS{}
+		va.IssuerDomain = issuerDomain
+		return va
+	}
+
+	// The second remote VA is configured so that it disagrees whenever CAA
+	// records are present
+	va := newVA("letsencrypt.org")
+	va.RemoteVAs = []RemoteVA{
+		RemoteVA{ValidationAuthority: newVA("letsencrypt.org"), Name: "agrees"},
+		RemoteVA{ValidationAuthority: newVA("other.org"), Name: "disagrees"},
+	}
+
+	present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: "present.com"}, "", "")
+	test.AssertNotError(t, err, "present.com")
+	test.Assert(t, present, "Present should be true")
+	test.Assert(t, valid, "Valid should be true with a majority")
+
+	va.Quorum = 3
+	present, valid, err = va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: "present.com"}, "", "")
+	test.AssertNotError(t, err, "present.com")
+	test.Assert(t, present, "Present should be true")
+	test.Assert(t, !valid, "Valid should be false without every perspective")
+
+	present, valid, err = va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: "absent.com"}, "", "")
+	test.AssertNotError(t, err, "absent.com")
+	test.Assert(t, !present, "Present should be false")
+	test.Assert(t, valid, "Valid should be true when every perspective agrees")
+}
+
 func TestCAAChecking(t *testing.T) {
 	type CAATest struct {
 		Domain  string
@@ -677,6 +1238,18 @@ func TestCAAChecking(t *testing.T) {
 		CAATest{"nx.cname2-present.com", true, true},
 		CAATest{"dname-present.com", true, true},
 		CAATest{"dname2cname.com", true, true},
+		// Alias target without records falls back to the parent
+		CAATest{"cname-nx.reserved.com", true, false},
+		// issuewild
+		CAATest{"wild.com", true, false},
+		CAATest{"*.wild.com", true, true},
+		CAATest{"*.present.com", true, true},
+		// No issue or issuewild records
+		CAATest{"iodef-only.com", true, true},
+		// Parameters
+		CAATest{"malformed-parameter.com", true, false},
+		CAATest{"accounturi.com", true, true},
+		CAATest{"methods.com", true, true},
 		// CNAME to critical
 	}
 
@@ -684,14 +1257,14 @@ func TestCAAChecking(t *testing.T) {
 	va.DNSResolver = &mocks.MockDNS{}
 	va.IssuerDomain = "letsencrypt.org"
 	for _, caaTest := range tests {
-		present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: caaTest.Domain})
+		present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: caaTest.Domain}, "", "")
 		test.AssertNotError(t, err, caaTest.Domain)
 		fmt.Println(caaTest.Domain, caaTest.Present == present, caaTest.Valid == valid)
 		test.AssertEquals(t, caaTest.Present, present)
 		test.AssertEquals(t, caaTest.Valid, valid)
 	}
 
-	present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: "servfail.com"})
+	present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: "servfail.com"}, "", "")
 	test.AssertError(t, err, "servfail.com")
 	test.Assert(t, !present, "Present should be false")
 	test.Assert(t, !valid, "Valid should be false")
@@ -706,7 +1279,7 @@ func TestCAAChecking(t *testing.T) {
 		"cname-and-dname.com",
 		"servfail.com",
 	} {
-		_, _, err = va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: name})
+		_, _, err = va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: name}, "", "")
 		test.AssertError(t, err, name)
 	}
 }
@@ -733,6 +1306,61 @@ func TestDNSValidationFailure(t *testing.T) {
 	test.AssertEquals(t, authz.Challenges[0].Error.Type, core.UnauthorizedProblem)
 }
 
+// txtDNS answers every TXT query with the records it holds.
+type txtDNS struct {
+	mocks.MockDNS
+	txts []string
+}
+
+func (mock *txtDNS) LookupTXT(hostname string) ([]string, time.Duration, error) {
+	return mock.txts, 0, nil
+}
+
+func (mock *txtDNS) ExchangeOne(hostname string, qtype uint16) (*dns.Msg, time.Duration, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(hostname), qtype)
+	if qtype == dns.TypeTXT {
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: dns.Fqdn(hostname), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 3600},
+			Txt: mock.txts,
+		})
+	}
+	return m, 0, nil
+}
+
+func TestDNSValidationSuccess(t *testing.T) {
+	chalDNS := createChallenge(core.ChallengeTypeDNS)
+	test.Assert(t, chalDNS.Validation != nil, "Couldn't sign validation")
+	va := NewValidationAuthorityImpl(&PortConfig{})
+	va.DNSResolver = &txtDNS{txts: []string{"other", core.B64enc(chalDNS.Validation.Signatures[0].Signature)}}
+
+	finChall, err := va.validateDNS(ident, chalDNS)
+	test.AssertNotError(t, err, "DNS validation failed")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.Assert(t, finChall.RecordsSane(), "Validation records should be sane")
+	test.AssertEquals(t, finChall.ValidationRecord[0].Hostname, "_acme-challenge.localhost")
+}
+
+func TestDNSValidationSeesChangedRecord(t *testing.T) {
+	chalDNS := createChallenge(core.ChallengeTypeDNS)
+	resolver := &txtDNS{txts: []string{core.B64enc(chalDNS.Validation.Signatures[0].Signature)}}
+	cache := core.NewCachingDNSResolver(clock.NewFake(), resolver, time.Hour, nil)
+	cache.BypassValidation = true
+	va := NewValidationAuthorityImpl(&PortConfig{})
+	va.DNSResolver = cache
+
+	finChall, err := va.validateDNS(ident, chalDNS)
+	test.AssertNotError(t, err, "DNS validation failed")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+
+	// The record is removed, and the next validation must not be answered
+	// from what the first one saw
+	resolver.txts = []string{"other"}
+	finChall, err = va.validateDNS(ident, chalDNS)
+	test.AssertError(t, err, "DNS validation succeeded with a stale record")
+	test.AssertEquals(t, finChall.Status, core.StatusInvalid)
+}
+
 func TestDNSValidationInvalid(t *testing.T) {
 	var notDNS = core.AcmeIdentifier{
 		Type:  core.IdentifierType("iris"),
@@ -815,6 +1443,15 @@ func TestDNSValidationServFail(t *testing.T) {
 	test.AssertEquals(t, authz.Challenges[0].Error.Type, core.ConnectionProblem)
 }
 
+func TestProblemDetailsFromDNSError(t *testing.T) {
+	problem := problemDetailsFromDNSError(core.DNSSECError("DNSSEC validation failed for bogus.com."))
+	test.AssertEquals(t, problem.Type, core.DNSSECProblem)
+	test.AssertEquals(t, problem.Detail, "DNSSEC validation failed for bogus.com.")
+
+	problem = problemDetailsFromDNSError(errors.New("SERVFAIL"))
+	test.AssertEquals(t, problem.Type, core.ConnectionProblem)
+}
+
 func TestDNSValidationNoServer(t *testing.T) {
 	va := NewValidationAuthorityImpl(&PortConfig{})
 	va.DNSResolver = core.NewTestDNSResolverImpl(time.Second*5, []string{})
@@ -922,6 +1559,10 @@ func (ra *MockRegistrationAuthority) AdministrativelyRevokeCertificate(cert x509
 	return nil
 }
 
+func (ra *MockRegistrationAuthority) ReviewAuthorization(authzID string, approve bool, user string) error {
+	return nil
+}
+
 func (ra *MockRegistrationAuthority) OnValidationUpdate(authz core.Authorization) error {
 	ra.lastAuthz = &authz
 	return nil
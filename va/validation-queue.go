@@ -0,0 +1,230 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// QueueConfig sets up the pool of workers that UpdateValidations hands
+// validations to. Zero values are replaced with the defaults below.
+type QueueConfig struct {
+	// Workers is the number of validations run at once.
+	Workers int
+	// Size is the number of validations that may wait for a worker before
+	// UpdateValidations starts refusing them.
+	Size int
+	// MaxAttempts bounds how often a validation that fails with a connection
+	// problem is tried, waiting Backoff and then twice as long each time.
+	MaxAttempts int
+	Backoff     time.Duration
+	// JobTimeout is how long a validation, including retries, may take
+	// before its challenge is marked invalid.
+	JobTimeout time.Duration
+	// JournalDir, if set, keeps a file for each queued validation until it
+	// finishes, so validations interrupted by a restart are run again.
+	JournalDir string
+}
+
+const (
+	defaultWorkers     = 10
+	defaultQueueSize   = 1000
+	defaultMaxAttempts = 3
+	defaultBackoff     = time.Second
+	defaultJobTimeout  = 2 * time.Minute
+)
+
+type validationJob struct {
+	Authz          core.Authorization
+	ChallengeIndex int
+}
+
+func (job validationJob) journalName() string {
+	return fmt.Sprintf("%s.%d.json", job.Authz.ID, job.ChallengeIndex)
+}
+
+// StartWorkers starts the validation workers and queues any validations left
+// in the journal by a previous run. It must be called once, after RA is set.
+func (va *ValidationAuthorityImpl) StartWorkers(config QueueConfig, stats statsd.Statter) error {
+	if config.Workers <= 0 {
+		config.Workers = defaultWorkers
+	}
+	if config.Size <= 0 {
+		config.Size = defaultQueueSize
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultBackoff
+	}
+	if config.JobTimeout <= 0 {
+		config.JobTimeout = defaultJobTimeout
+	}
+
+	var pending []validationJob
+	if config.JournalDir != "" {
+		var err error
+		if pending, err = readJournal(config.JournalDir); err != nil {
+			return err
+		}
+	}
+	if len(pending) > config.Size {
+		config.Size = len(pending)
+	}
+
+	va.queue = config
+	va.stats = stats
+	jobs := make(chan validationJob, config.Size)
+	for _, job := range pending {
+		va.log.Info(fmt.Sprintf("Resuming validation of challenge %d of %s", job.ChallengeIndex, job.Authz.ID))
+		jobs <- job
+	}
+	va.jobs = jobs
+	for i := 0; i < config.Workers; i++ {
+		go va.worker()
+	}
+	return nil
+}
+
+func readJournal(dir string) ([]validationJob, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []validationJob
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var job validationJob
+		if err = json.Unmarshal(contents, &job); err != nil {
+			return nil, fmt.Errorf("Couldn't parse queued validation %s: %s", file.Name(), err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// enqueue journals job and hands it to the workers, refusing it if the
+// queue is full.
+func (va *ValidationAuthorityImpl) enqueue(job validationJob) error {
+	if va.jobs == nil {
+		return core.InternalServerError("Validation workers are not running")
+	}
+	if va.queue.JournalDir != "" {
+		contents, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(filepath.Join(va.queue.JournalDir, job.journalName()), contents, 0600); err != nil {
+			return err
+		}
+	}
+	select {
+	case va.jobs <- job:
+		va.gauge("VA.Queue.Depth", len(va.jobs))
+		return nil
+	default:
+		va.removeFromJournal(job)
+		va.inc("VA.Queue.Rejected")
+		return core.InternalServerError("Too many validations in progress, try again later")
+	}
+}
+
+func (va *ValidationAuthorityImpl) removeFromJournal(job validationJob) {
+	if va.queue.JournalDir == "" {
+		return
+	}
+	err := os.Remove(filepath.Join(va.queue.JournalDir, job.journalName()))
+	if err != nil && !os.IsNotExist(err) {
+		va.log.Warning(fmt.Sprintf("Couldn't remove finished validation from journal: %s", err))
+	}
+}
+
+func (va *ValidationAuthorityImpl) worker() {
+	for job := range va.jobs {
+		va.gauge("VA.Queue.Depth", len(va.jobs))
+		va.runJob(job)
+		va.removeFromJournal(job)
+	}
+}
+
+// runJob validates a queued challenge, retrying connection problems, and
+// reports the result to the RA. Jobs that fail once JobTimeout has passed
+// are reported as timed out.
+func (va *ValidationAuthorityImpl) runJob(job validationJob) {
+	logEvent := verificationRequestEvent{
+		ID:          job.Authz.ID,
+		Requester:   job.Authz.RegistrationID,
+		RequestTime: time.Now(),
+	}
+	input := job.Authz.Challenges[job.ChallengeIndex]
+
+	// The attempt runs in the worker itself and gives up its connections at
+	// the deadline, so the worker isn't freed while it is still running
+	deadline := time.Now().Add(va.queue.JobTimeout)
+	challenge, err := va.validateWithRetries(job.Authz.Identifier, input, deadline)
+	if challenge.Status != core.StatusValid && !time.Now().Before(deadline) {
+		va.inc("VA.Validations.TimedOut")
+		challenge = input
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.ConnectionProblem,
+			Detail: fmt.Sprintf("Validation did not complete within %s", va.queue.JobTimeout),
+		}
+		err = challenge.Error
+	}
+	va.reportValidation(job.Authz, job.ChallengeIndex, challenge, err, logEvent)
+}
+
+// validateWithRetries tries a validation up to MaxAttempts times while it
+// fails with a connection problem, backing off exponentially in between. No
+// attempt is started, or connection kept open, past deadline. Retries only
+// help if each attempt resolves the name afresh, so a caching resolver must
+// set BypassValidation.
+func (va *ValidationAuthorityImpl) validateWithRetries(identifier core.AcmeIdentifier, input core.Challenge, deadline time.Time) (core.Challenge, error) {
+	backoff := va.queue.Backoff
+	for attempt := 1; ; attempt++ {
+		challenge, err := va.performValidation(identifier, input, deadline)
+		if err == nil || challenge.Error == nil || challenge.Error.Type != core.ConnectionProblem || attempt >= va.queue.MaxAttempts {
+			return challenge, err
+		}
+		if !time.Now().Add(backoff).Before(deadline) {
+			return challenge, err
+		}
+		va.inc("VA.Validations.Retries")
+		va.log.Info(fmt.Sprintf("%s [%s] attempt %d failed, retrying in %s: %s", input.Type, identifier, attempt, backoff, err))
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (va *ValidationAuthorityImpl) gauge(stat string, value int) {
+	if va.stats != nil {
+		va.stats.Gauge(stat, int64(value), 1.0)
+	}
+}
+
+func (va *ValidationAuthorityImpl) inc(stat string) {
+	if va.stats != nil {
+		va.stats.Inc(stat, 1, 1.0)
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// notifyingRA passes on every validation update it receives.
+type notifyingRA struct {
+	MockRegistrationAuthority
+	updates chan core.Authorization
+}
+
+func (ra *notifyingRA) OnValidationUpdate(authz core.Authorization) error {
+	ra.updates <- authz
+	return nil
+}
+
+func (ra *notifyingRA) next(t *testing.T) core.Authorization {
+	select {
+	case authz := <-ra.updates:
+		return authz
+	case <-time.After(10 * time.Second):
+		t.Fatalf("No validation update received")
+	}
+	return core.Authorization{}
+}
+
+// stubListener accepts connections and either closes them straight away or,
+// if hold is set, leaves them open without responding until it is closed.
+type stubListener struct {
+	net.Listener
+	hold bool
+
+	mu       sync.Mutex
+	accepted int
+	conns    []net.Conn
+}
+
+func newStubListener(t *testing.T, hold bool) *stubListener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "failed to listen")
+	l := &stubListener{Listener: ln, hold: hold}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			l.mu.Lock()
+			l.accepted++
+			if l.hold {
+				l.conns = append(l.conns, conn)
+			} else {
+				conn.Close()
+			}
+			l.mu.Unlock()
+		}
+	}()
+	return l
+}
+
+func (l *stubListener) port() int {
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func (l *stubListener) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.accepted
+}
+
+func (l *stubListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	return l.Listener.Close()
+}
+
+func newQueueVA(port int) (*ValidationAuthorityImpl, *notifyingRA) {
+	va := NewValidationAuthorityImpl(&PortConfig{TLSSNIPort: port})
+	va.AllowLoopbackAddresses = true
+	va.DNSResolver = &mocks.MockDNS{}
+	ra := &notifyingRA{updates: make(chan core.Authorization, 10)}
+	va.RA = ra
+	return va, ra
+}
+
+func tlssniAuthz(t *testing.T) core.Authorization {
+	chall := core.TLSSNIChallenge01()
+	chall.AccountKey = accountKey
+	keyAuthz, err := core.NewKeyAuthorization(chall.Token, accountKey)
+	test.AssertNotError(t, err, "Could not make key authorization")
+	chall.KeyAuthorization = &keyAuthz
+	return core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     ident,
+		Challenges:     []core.Challenge{chall},
+	}
+}
+
+func TestValidationQueueRetries(t *testing.T) {
+	ln := newStubListener(t, false)
+	defer ln.Close()
+
+	va, ra := newQueueVA(ln.port())
+	err := va.StartWorkers(QueueConfig{MaxAttempts: 3, Backoff: time.Millisecond}, nil)
+	test.AssertNotError(t, err, "Couldn't start workers")
+
+	err = va.UpdateValidations(tlssniAuthz(t), 0)
+	test.AssertNotError(t, err, "Couldn't queue validation")
+
+	result := ra.next(t).Challenges[0]
+	test.AssertEquals(t, result.Status, core.StatusInvalid)
+	test.AssertEquals(t, result.Error.Type, core.ConnectionProblem)
+	test.AssertEquals(t, ln.count(), 3)
+}
+
+// servFailDNS answers the first A query for each name with SERVFAIL, and
+// 127.0.0.1 after that.
+type servFailDNS struct {
+	mocks.MockDNS
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+func (mock *servFailDNS) ExchangeOne(hostname string, qtype uint16) (*dns.Msg, time.Duration, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(hostname), qtype)
+	if qtype != dns.TypeA {
+		return m, 0, nil
+	}
+	mock.mu.Lock()
+	mock.queries[hostname]++
+	first := mock.queries[hostname] == 1
+	mock.mu.Unlock()
+	if first {
+		m.Rcode = dns.RcodeServerFailure
+		return m, 0, nil
+	}
+	m.Answer = append(m.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: dns.Fqdn(hostname), Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("127.0.0.1"),
+	})
+	return m, 0, nil
+}
+
+func (mock *servFailDNS) LookupHost(hostname string) ([]net.IP, time.Duration, error) {
+	r, rtt, _ := mock.ExchangeOne(hostname, dns.TypeA)
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, rtt, fmt.Errorf("DNS failure: %s", dns.RcodeToString[r.Rcode])
+	}
+	return []net.IP{r.Answer[0].(*dns.A).A}, rtt, nil
+}
+
+func TestValidationQueueRetryAfterServFail(t *testing.T) {
+	authz := tlssniAuthz(t)
+	hs := tlssniSrv(t, authz.Challenges[0])
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	// Cached as boulder-va caches, so the retry must not be answered with
+	// the SERVFAIL the first attempt got
+	resolver := &servFailDNS{queries: make(map[string]int)}
+	cache := core.NewCachingDNSResolver(clock.NewFake(), resolver, time.Hour, nil)
+	cache.BypassValidation = true
+
+	va, ra := newQueueVA(port)
+	va.DNSResolver = cache
+	err = va.StartWorkers(QueueConfig{MaxAttempts: 2, Backoff: time.Millisecond}, nil)
+	test.AssertNotError(t, err, "Couldn't start workers")
+
+	test.AssertNotError(t, va.UpdateValidations(authz, 0), "Couldn't queue validation")
+	test.AssertEquals(t, ra.next(t).Challenges[0].Status, core.StatusValid)
+	test.AssertEquals(t, resolver.queries[ident.Value], 2)
+}
+
+func TestValidationQueueNoRetryOnSuccess(t *testing.T) {
+	authz := tlssniAuthz(t)
+	hs := tlssniSrv(t, authz.Challenges[0])
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	va, ra := newQueueVA(port)
+	err = va.StartWorkers(QueueConfig{MaxAttempts: 3, Backoff: time.Millisecond}, nil)
+	test.AssertNotError(t, err, "Couldn't start workers")
+
+	test.AssertNotError(t, va.UpdateValidations(authz, 0), "Couldn't queue validation")
+	test.AssertEquals(t, ra.next(t).Challenges[0].Status, core.StatusValid)
+}
+
+func TestValidationQueueReconnect(t *testing.T) {
+	ln := newStubListener(t, false)
+	defer ln.Close()
+
+	va, ra := newQueueVA(ln.port())
+	err := va.StartWorkers(QueueConfig{Workers: 2, MaxAttempts: 1}, nil)
+	test.AssertNotError(t, err, "Couldn't start workers")
+
+	// The clients are replaced, as on an AMQP reconnect, while workers are
+	// reporting results. Run with -race to catch unguarded access.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			va.SetClients(ra, nil)
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		test.AssertNotError(t, va.UpdateValidations(tlssniAuthz(t), 0), "Couldn't queue validation")
+	}
+	for i := 0; i < 5; i++ {
+		test.AssertEquals(t, ra.next(t).Challenges[0].Status, core.StatusInvalid)
+	}
+	<-done
+}
+
+func TestValidationQueueTimeout(t *testing.T) {
+	ln := newStubListener(t, true)
+	defer ln.Close()
+
+	va, ra := newQueueVA(ln.port())
+	err := va.StartWorkers(QueueConfig{JobTimeout: 50 * time.Millisecond}, nil)
+	test.AssertNotError(t, err, "Couldn't start workers")
+
+	test.AssertNotError(t, va.UpdateValidations(tlssniAuthz(t), 0), "Couldn't queue validation")
+
+	result := ra.next(t).Challenges[0]
+	test.AssertEquals(t, result.Status, core.StatusInvalid)
+	test.AssertEquals(t, result.Error.Type, core.ConnectionProblem)
+	test.Assert(t, strings.Contains(result.Error.Detail, "did not complete"), "Wrong timeout detail: "+result.Error.Detail)
+}
+
+func TestValidationQueueFull(t *testing.T) {
+	va, _ := newQueueVA(0)
+	err := va.UpdateValidations(tlssniAuthz(t), 0)
+	_, ok := err.(core.InternalServerError)
+	test.Assert(t, ok, "Validation was queued without workers")
+
+	ln := newStubListener(t, true)
+	defer ln.Close()
+
+	va, _ = newQueueVA(ln.port())
+	err = va.StartWorkers(QueueConfig{Workers: 1, Size: 1}, nil)
+	test.AssertNotError(t, err, "Couldn't start workers")
+
+	// One validation hangs in the worker and one waits, so a third can't fit
+	for i := 0; i < 3 && err == nil; i++ {
+		err = va.UpdateValidations(tlssniAuthz(t), 0)
+	}
+	_, ok = err.(core.InternalServerError)
+	test.Assert(t, ok, "Queue accepted more validations than it holds")
+}
+
+func TestValidationQueueJournal(t *testing.T) {
+	authz := tlssniAuthz(t)
+	hs := tlssniSrv(t, authz.Challenges[0])
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	dir, err := ioutil.TempDir("", "validation-journal")
+	test.AssertNotError(t, err, "Couldn't create journal dir")
+	defer os.RemoveAll(dir)
+
+	// A validation left behind by a previous run
+	job := validationJob{Authz: authz, ChallengeIndex: 0}
+	contents, err := json.Marshal(job)
+	test.AssertNotError(t, err, "Couldn't marshal job")
+	journalFile := filepath.Join(dir, job.journalName())
+	test.AssertNotError(t, ioutil.WriteFile(journalFile, contents, 0600), "Couldn't write journal")
+
+	va, ra := newQueueVA(port)
+	err = va.StartWorkers(QueueConfig{JournalDir: dir}, nil)
+	test.AssertNotError(t, err, "Couldn't start workers")
+
+	resumed := ra.next(t)
+	test.AssertEquals(t, resumed.ID, authz.ID)
+	test.AssertEquals(t, resumed.Challenges[0].Status, core.StatusValid)
+
+	// The journal entry is removed once the RA has the result
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(journalFile); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Assert(t, os.IsNotExist(err), "Finished validation was left in the journal")
+
+	test.AssertError(t, va.StartWorkers(QueueConfig{JournalDir: filepath.Join(dir, "missing")}, nil),
+		"Started workers with a missing journal dir")
+}
@@ -91,6 +91,8 @@ func statusCodeFromError(err interface{}) int {
 		return http.StatusLengthRequired
 	case core.SignatureValidationError:
 		return http.StatusBadRequest
+	case core.BlockedKeyError:
+		return http.StatusBadRequest
 	case core.InternalServerError:
 		return http.StatusInternalServerError
 	default:
@@ -350,6 +352,11 @@ func (wfe *WebFrontEndImpl) verifyPOST(request *http.Request, regCheck bool, res
 	}
 
 	reg, err = wfe.SA.GetRegistrationByKey(*key)
+	if err != nil && regCheck {
+		// The registration may have been created too recently to have
+		// reached the replica the SA reads from
+		reg, err = core.ReadYourWrites(wfe.SA).GetRegistrationByKey(*key)
+	}
 	if err != nil {
 		// If we are requiring a valid registration, any failure to look up the
 		// registration is an overall failure to verify.
@@ -446,7 +453,7 @@ func (wfe *WebFrontEndImpl) NewRegistration(response http.ResponseWriter, reques
 		return
 	}
 
-	if existingReg, err := wfe.SA.GetRegistrationByKey(*key); err == nil {
+	if existingReg, err := core.ReadYourWrites(wfe.SA).GetRegistrationByKey(*key); err == nil {
 		logEvent.Error = "Registration key is already in use"
 		response.Header().Set("Location", fmt.Sprintf("%s%d", wfe.RegBase, existingReg.ID))
 		wfe.sendError(response, logEvent.Error, nil, http.StatusConflict)
@@ -547,10 +554,12 @@ func (wfe *WebFrontEndImpl) NewAuthorization(response http.ResponseWriter, reque
 	}
 	logEvent.Extra["AuthzID"] = authz.ID
 
-	// Make a URL for this authz, then blow away the ID and RegID before serializing
+	// Make a URL for this authz, then blow away the ID, RegID and reviewer
+	// before serializing
 	authzURL := wfe.AuthzBase + string(authz.ID)
 	authz.ID = ""
 	authz.RegistrationID = 0
+	authz.ReviewedBy = ""
 	responseBody, err := json.Marshal(authz)
 	if err != nil {
 		logEvent.Error = err.Error()
@@ -607,7 +616,10 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 
 	serial := core.SerialToString(providedCert.SerialNumber)
 	logEvent.Extra["ProvidedCertificateSerial"] = serial
-	cert, err := wfe.SA.GetCertificate(serial)
+	// Certificates can be revoked as soon as they're issued, so they're read
+	// from the primary
+	sa := core.ReadYourWrites(wfe.SA)
+	cert, err := sa.GetCertificate(serial)
 	if err != nil || !bytes.Equal(cert.DER, revokeRequest.CertificateDER) {
 		wfe.sendError(response, "No such certificate", err, http.StatusNotFound)
 		return
@@ -624,7 +636,7 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 	logEvent.Extra["RetrievedCertificateEmailAddresses"] = parsedCertificate.EmailAddresses
 	logEvent.Extra["RetrievedCertificateIPAddresses"] = parsedCertificate.IPAddresses
 
-	certStatus, err := wfe.SA.GetCertificateStatus(serial)
+	certStatus, err := sa.GetCertificateStatus(serial)
 	if err != nil {
 		logEvent.Error = err.Error()
 		wfe.sendError(response, "Certificate status not yet available", err, http.StatusNotFound)
@@ -864,6 +876,15 @@ func (wfe *WebFrontEndImpl) postChallenge(
 		return
 	}
 
+	// A key authorization must be for this challenge's token and the key that
+	// signed the request, otherwise validation could never succeed
+	if challengeUpdate.KeyAuthorization != nil &&
+		!challengeUpdate.KeyAuthorization.Match(authz.Challenges[challengeIndex].Token, &currReg.Key) {
+		logEvent.Error = "Key authorization doesn't match challenge token and account key"
+		wfe.sendError(response, logEvent.Error, nil, http.StatusBadRequest)
+		return
+	}
+
 	// Ask the RA to update this authorization
 	updatedAuthorization, err := wfe.RA.UpdateAuthorization(authz, challengeIndex, challengeUpdate)
 	if err != nil {
@@ -982,9 +1003,12 @@ func (wfe *WebFrontEndImpl) Authorization(response http.ResponseWriter, request
 	logEvent := wfe.populateRequestEvent(request)
 	defer wfe.logRequestDetails(&logEvent)
 
-	// Requests to this handler should have a path that leads to a known authz
+	// Requests to this handler should have a path that leads to a known authz.
+	// Clients fetch and update authorizations as soon as they're created, and
+	// a stale copy would be written back by challenge updates, so it's read
+	// from the primary.
 	id := parseIDFromPath(request.URL.Path)
-	authz, err := wfe.SA.GetAuthorization(id)
+	authz, err := core.ReadYourWrites(wfe.SA).GetAuthorization(id)
 	if err != nil {
 		wfe.sendError(response,
 			"Unable to find authorization", err,
@@ -1019,9 +1043,10 @@ func (wfe *WebFrontEndImpl) GetAuthorization(
 	request *http.Request,
 	authz core.Authorization,
 	logEvent *requestEvent) {
-	// Blank out ID and regID
+	// Blank out ID, regID and reviewer
 	authz.ID = ""
 	authz.RegistrationID = 0
+	authz.ReviewedBy = ""
 	jsonReply, err := json.Marshal(authz)
 	if err != nil {
 		logEvent.Error = err.Error()
@@ -1066,6 +1091,11 @@ func (wfe *WebFrontEndImpl) Certificate(response http.ResponseWriter, request *h
 	logEvent.Extra["RequestedSerial"] = serial
 
 	cert, err := wfe.SA.GetCertificateByShortSerial(serial)
+	if err != nil {
+		// The certificate may have been issued too recently to have reached
+		// the replica the SA reads from
+		cert, err = core.ReadYourWrites(wfe.SA).GetCertificateByShortSerial(serial)
+	}
 	if err != nil {
 		logEvent.Error = err.Error()
 		if strings.HasPrefix(err.Error(), "gorp: multiple rows returned") {
@@ -231,6 +231,10 @@ func (sa *MockSA) AlreadyDeniedCSR([]string) (bool, error) {
 	return false, nil
 }
 
+func (sa *MockSA) KeyBlocked(string) (bool, error) {
+	return false, nil
+}
+
 func (sa *MockSA) AddCertificate(certDER []byte, regID int64) (digest string, err error) {
 	return
 }
@@ -298,13 +302,17 @@ func (ra *MockRegistrationAuthority) AdministrativelyRevokeCertificate(cert x509
 	return nil
 }
 
+func (ra *MockRegistrationAuthority) ReviewAuthorization(authzID string, approve bool, user string) error {
+	return nil
+}
+
 func (ra *MockRegistrationAuthority) OnValidationUpdate(authz core.Authorization) error {
 	return nil
 }
 
 type MockCA struct{}
 
-func (ca *MockCA) IssueCertificate(csr x509.CertificateRequest, regID int64, earliestExpiry time.Time) (cert core.Certificate, err error) {
+func (ca *MockCA) IssueCertificate(csr x509.CertificateRequest, regID int64, earliestExpiry time.Time, profile string) (cert core.Certificate, err error) {
 	// Return a basic certificate so NewCertificate can continue
 	randomCertDer, _ := hex.DecodeString(GoodTestCert)
 	cert.DER = randomCertDer
@@ -325,10 +333,14 @@ func (pa *MockPA) ChallengesFor(identifier core.AcmeIdentifier) (challenges []co
 	return
 }
 
-func (pa *MockPA) WillingToIssue(id core.AcmeIdentifier) error {
+func (pa *MockPA) WillingToIssue(id core.AcmeIdentifier, regID int64) error {
 	return nil
 }
 
+func (pa *MockPA) ReviewRuleFor(id core.AcmeIdentifier) (string, error) {
+	return "", nil
+}
+
 func makeBody(s string) io.ReadCloser {
 	return ioutil.NopCloser(strings.NewReader(s))
 }
@@ -733,6 +745,56 @@ func TestChallenge(t *testing.T) {
 		`{"type":"dns","uri":"/acme/authz/asdf?challenge=foo"}`)
 }
 
+func TestChallengeKeyAuthorization(t *testing.T) {
+	wfe := setupWFE(t)
+
+	wfe.RA = &MockRegistrationAuthority{}
+	wfe.SA = &MockSA{}
+
+	// MockSA hands back test1KeyPublicJSON as the registration key
+	var accountKey jose.JsonWebKey
+	err := json.Unmarshal([]byte(test1KeyPublicJSON), &accountKey)
+	test.AssertNotError(t, err, "Could not unmarshal testing key")
+
+	challengeURL := "/acme/authz/asdf?challenge=foo"
+	authz := core.Authorization{
+		ID: "asdf",
+		Identifier: core.AcmeIdentifier{
+			Type:  "dns",
+			Value: "letsencrypt.org",
+		},
+		Challenges: []core.Challenge{
+			core.Challenge{
+				Type:  core.ChallengeTypeTLSSNI01,
+				URI:   (*core.AcmeURL)(mustParseURL(challengeURL)),
+				Token: "token",
+			},
+		},
+		RegistrationID: 1,
+	}
+
+	good, err := core.NewKeyAuthorization("token", &accountKey)
+	test.AssertNotError(t, err, "Could not make key authorization")
+	wrongToken, err := core.NewKeyAuthorization("other-token", &accountKey)
+	test.AssertNotError(t, err, "Could not make key authorization")
+
+	responseWriter := httptest.NewRecorder()
+	wfe.challenge(responseWriter,
+		makePostRequestWithPath(challengeURL,
+			signRequest(t, `{"resource":"challenge","keyAuthorization":"`+good.String()+`"}`, &wfe.nonceService)),
+		authz, &requestEvent{})
+	test.AssertEquals(t, responseWriter.Code, http.StatusAccepted)
+
+	responseWriter = httptest.NewRecorder()
+	wfe.challenge(responseWriter,
+		makePostRequestWithPath(challengeURL,
+			signRequest(t, `{"resource":"challenge","keyAuthorization":"`+wrongToken.String()+`"}`, &wfe.nonceService)),
+		authz, &requestEvent{})
+	test.AssertEquals(t, responseWriter.Code, http.StatusBadRequest)
+	test.AssertEquals(t, responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Key authorization doesn't match challenge token and account key"}`)
+}
+
 func TestNewRegistration(t *testing.T) {
 	wfe := setupWFE(t)
 	mux, err := wfe.Handler()